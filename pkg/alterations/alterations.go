@@ -0,0 +1,160 @@
+package alterations
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultWords are the words used to alter subdomains when none were given
+var DefaultWords = []string{
+	"admin", "api", "app", "backup", "beta", "cdn", "corp", "demo", "dev",
+	"develop", "development", "docs", "ext", "external", "gateway", "int",
+	"internal", "lab", "legacy", "mail", "mgmt", "new", "old", "portal",
+	"pre", "preprod", "prod", "production", "qa", "sandbox", "stage",
+	"staging", "stg", "test", "testing", "tmp", "uat", "v1", "v2", "vpn",
+	"www",
+}
+
+// maxIncrement is the max distance from the original number used
+// when incrementing or decrementing numbers found in labels.
+const maxIncrement = 3
+
+// Generator creates permutations of known subdomains
+type Generator struct {
+	words []string
+}
+
+// New creates a new alterations generator using the words provided
+func New(words []string) *Generator {
+	if len(words) == 0 {
+		words = DefaultWords
+	}
+	return &Generator{words: words}
+}
+
+// Generate calls the callback for every alteration of a hostname belonging
+// to domain. The same candidate may be generated more than once and
+// the original hostname may be among them, so callers should dedupe.
+func (g *Generator) Generate(hostname, domain string, callback func(candidate string)) {
+	subdomain := strings.TrimSuffix(hostname, "."+domain)
+	if subdomain == hostname || subdomain == "" {
+		return
+	}
+	labels := strings.Split(subdomain, ".")
+
+	emit := func(labels []string) {
+		callback(strings.Join(labels, ".") + "." + domain)
+	}
+
+	// Insert every word as a new label at every level
+	for i := 0; i <= len(labels); i++ {
+		for _, word := range g.words {
+			altered := make([]string, 0, len(labels)+1)
+			altered = append(altered, labels[:i]...)
+			altered = append(altered, word)
+			altered = append(altered, labels[i:]...)
+			emit(altered)
+		}
+	}
+
+	// Prefix and suffix every word to the first label
+	first := labels[0]
+	for _, word := range g.words {
+		for _, label := range []string{word + "-" + first, first + "-" + word, word + first, first + word} {
+			emit(replaceLabel(labels, 0, label))
+		}
+	}
+
+	for i, label := range labels {
+		// Increment and decrement the numbers found in the label
+		for _, altered := range incrementNumbers(label) {
+			emit(replaceLabel(labels, i, altered))
+		}
+
+		// Split dashed labels into multiple levels
+		if strings.Contains(label, "-") {
+			altered := make([]string, 0, len(labels)+1)
+			altered = append(altered, labels[:i]...)
+			altered = append(altered, strings.Split(label, "-")...)
+			altered = append(altered, labels[i+1:]...)
+			emit(altered)
+		}
+
+		// Join adjacent levels with a dash
+		if i+1 < len(labels) {
+			altered := make([]string, 0, len(labels)-1)
+			altered = append(altered, labels[:i]...)
+			altered = append(altered, label+"-"+labels[i+1])
+			altered = append(altered, labels[i+2:]...)
+			emit(altered)
+		}
+	}
+}
+
+// Affix calls the callback for every prefix prepended and every suffix
+// appended as given to the first label of a hostname belonging to domain,
+// eg. api-dev.example.com for api.example.com and the suffix -dev
+func Affix(hostname, domain string, prefixes, suffixes []string, callback func(candidate string)) {
+	subdomain := strings.TrimSuffix(hostname, "."+domain)
+	if subdomain == hostname || subdomain == "" {
+		return
+	}
+	first, rest, _ := strings.Cut(subdomain, ".")
+	if rest != "" {
+		rest = "." + rest
+	}
+
+	for _, prefix := range prefixes {
+		callback(prefix + first + rest + "." + domain)
+	}
+	for _, suffix := range suffixes {
+		callback(first + suffix + rest + "." + domain)
+	}
+}
+
+// replaceLabel returns a copy of labels with the label at index replaced
+func replaceLabel(labels []string, index int, label string) []string {
+	altered := make([]string, len(labels))
+	copy(altered, labels)
+	altered[index] = label
+	return altered
+}
+
+// incrementNumbers returns the variants of a label obtained by
+// incrementing and decrementing each number found in it, keeping
+// the original zero padding (eg. api01 => api00, api02, ...).
+func incrementNumbers(label string) []string {
+	var variants []string
+
+	for start := 0; start < len(label); {
+		if !isDigit(label[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(label) && isDigit(label[end]) {
+			end++
+		}
+
+		digits := label[start:end]
+		number, err := strconv.Atoi(digits)
+		if err == nil {
+			for delta := -maxIncrement; delta <= maxIncrement; delta++ {
+				if delta == 0 || number+delta < 0 {
+					continue
+				}
+				altered := strconv.Itoa(number + delta)
+				if len(altered) < len(digits) {
+					altered = strings.Repeat("0", len(digits)-len(altered)) + altered
+				}
+				variants = append(variants, label[:start]+altered+label[end:])
+			}
+		}
+		start = end
+	}
+	return variants
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,46 @@
+package alterations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	generator := New([]string{"dev"})
+
+	candidates := make(map[string]struct{})
+	generator.Generate("api01-eu.example.com", "example.com", func(candidate string) {
+		candidates[candidate] = struct{}{}
+	})
+
+	for _, expected := range []string{
+		"dev.api01-eu.example.com",
+		"api01-eu.dev.example.com",
+		"dev-api01-eu.example.com",
+		"api01-eu-dev.example.com",
+		"api02-eu.example.com",
+		"api00-eu.example.com",
+		"api01.eu.example.com",
+	} {
+		require.Contains(t, candidates, expected, "Could not get alteration")
+	}
+}
+
+func TestGenerateOutOfDomain(t *testing.T) {
+	generator := New(nil)
+
+	var candidates []string
+	generator.Generate("example.com", "example.com", func(candidate string) {
+		candidates = append(candidates, candidate)
+	})
+	require.Empty(t, candidates, "Got alterations for the domain itself")
+}
+
+func TestAffix(t *testing.T) {
+	var candidates []string
+	Affix("api.eu.example.com", "example.com", []string{"stg-"}, []string{"-dev", "01"}, func(candidate string) {
+		candidates = append(candidates, candidate)
+	})
+	require.Equal(t, []string{"stg-api.eu.example.com", "api-dev.eu.example.com", "api01.eu.example.com"}, candidates, "Got unexpected affixed candidates")
+}
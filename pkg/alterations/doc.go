@@ -0,0 +1,9 @@
+// Package alterations generates permutations of already discovered
+// subdomains, in the style of altdns and dnsgen.
+//
+// Words are inserted as new levels and prepended or appended to the
+// first label, numbers are incremented and decremented, and dashed
+// labels are split into levels or adjacent levels joined with dashes.
+// Affix is a lighter complement prepending and appending given words to
+// the first label only.
+package alterations
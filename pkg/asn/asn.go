@@ -0,0 +1,143 @@
+package asn
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ipRange is a range of ip addresses announced by an autonomous system
+type ipRange struct {
+	start netip.Addr
+	end   netip.Addr
+	asn   uint32
+	org   string
+}
+
+// Info describes the autonomous system announcing an ip
+type Info struct {
+	// Number is the autonomous system number
+	Number uint32 `json:"asn"`
+	// Org is the description of the autonomous system, usually its owner
+	Org string `json:"org,omitempty"`
+}
+
+// Database contains the ip ranges of the autonomous systems
+type Database struct {
+	ranges []ipRange
+}
+
+// Load reads a dataset from a file, gzipped if ending with .gz
+func Load(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	return Parse(reader)
+}
+
+// Parse reads a dataset from a reader
+func Parse(reader io.Reader) (*Database, error) {
+	db := &Database{}
+	// The ranges of an autonomous system share its description
+	orgs := make(map[string]string)
+
+	scanner := bufio.NewScanner(reader)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid asn dataset line %d", line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid asn dataset line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid asn dataset line %d: %w", line, err)
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asn dataset line %d: %w", line, err)
+		}
+		// 0 marks the ranges which are not routed
+		if asn == 0 {
+			continue
+		}
+		var org string
+		if len(fields) >= 5 {
+			if org = orgs[fields[4]]; org == "" {
+				org = strings.Clone(fields[4])
+				orgs[org] = org
+			}
+		}
+		db.ranges = append(db.ranges, ipRange{start: start.Unmap(), end: end.Unmap(), asn: uint32(asn), org: org})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+// Lookup returns the autonomous system number announcing the ip
+func (db *Database) Lookup(ip string) (uint32, bool) {
+	info, ok := db.LookupInfo(ip)
+	return info.Number, ok
+}
+
+// LookupInfo returns the number and the description of the autonomous
+// system announcing the ip
+func (db *Database) LookupInfo(ip string) (Info, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Info{}, false
+	}
+	addr = addr.Unmap()
+
+	// The range containing the ip is the last one starting before it
+	index := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if index < 0 || db.ranges[index].end.Less(addr) {
+		return Info{}, false
+	}
+	return Info{Number: db.ranges[index].asn, Org: db.ranges[index].org}, true
+}
+
+// ParseASN parses an autonomous system number with or without the AS prefix
+func ParseASN(value string) (uint32, error) {
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "AS")
+	asn, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid asn %s", value)
+	}
+	return uint32(asn), nil
+}
@@ -0,0 +1,44 @@
+package asn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseLookup(t *testing.T) {
+	dataset := "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"8.8.8.0\t8.8.8.255\t15169\tUS\tGOOGLE\n" +
+		"2606:4700::\t2606:4700:ffff:ffff:ffff:ffff:ffff:ffff\t13335\tUS\tCLOUDFLARENET\n"
+
+	db, err := Parse(strings.NewReader(dataset))
+	require.Nil(t, err, "Could not parse dataset")
+
+	asn, ok := db.Lookup("8.8.8.8")
+	require.True(t, ok, "Could not lookup ip")
+	require.Equal(t, uint32(15169), asn, "Got wrong asn")
+
+	asn, ok = db.Lookup("2606:4700::1111")
+	require.True(t, ok, "Could not lookup ipv6")
+	require.Equal(t, uint32(13335), asn, "Got wrong asn")
+
+	info, ok := db.LookupInfo("1.0.0.1")
+	require.True(t, ok, "Could not lookup ip info")
+	require.Equal(t, Info{Number: 13335, Org: "CLOUDFLARENET"}, info, "Got wrong asn info")
+
+	_, ok = db.Lookup("1.0.2.1")
+	require.False(t, ok, "Got asn for not routed ip")
+	_, ok = db.Lookup("9.9.9.9")
+	require.False(t, ok, "Got asn for unknown ip")
+}
+
+func TestParseASN(t *testing.T) {
+	asn, err := ParseASN("AS13335")
+	require.Nil(t, err, "Could not parse asn")
+	require.Equal(t, uint32(13335), asn, "Got wrong asn")
+
+	_, err = ParseASN("cloudflare")
+	require.NotNil(t, err, "Parsed invalid asn")
+}
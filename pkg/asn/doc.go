@@ -0,0 +1,5 @@
+// Package asn maps ip addresses to autonomous system numbers using an
+// offline dataset in the iptoasn.com tsv format, plain or gzipped:
+//
+//	range_start	range_end	AS_number	country_code	AS_description
+package asn
@@ -0,0 +1,105 @@
+package cdn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/projectdiscovery/cdncheck"
+)
+
+// Provider is the provider serving an ip
+type Provider struct {
+	// Name is the name of the provider (eg. cloudflare)
+	Name string `json:"name"`
+	// Type is the kind of provider, cdn, waf or cloud
+	Type string `json:"type"`
+}
+
+// providerRange is a range of ip addresses of a provider
+type providerRange struct {
+	network *net.IPNet
+	name    string
+}
+
+// Matcher maps ip addresses to their providers
+type Matcher struct {
+	client *cdncheck.Client
+	ranges []providerRange
+}
+
+// New creates a matcher with the bundled ranges
+func New() *Matcher {
+	return &Matcher{client: cdncheck.New()}
+}
+
+// Load reads the extra cdn ranges of a file
+func (m *Matcher) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return m.Parse(file)
+}
+
+// Parse reads extra cdn ranges from a reader
+func (m *Matcher) Parse(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid cdn ranges line %d", line)
+		}
+		_, network, err := net.ParseCIDR(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid cdn ranges line %d: %w", line, err)
+		}
+		m.ranges = append(m.ranges, providerRange{network: network, name: strings.ToLower(fields[0])})
+	}
+	return scanner.Err()
+}
+
+// Cloud returns the cloud provider hosting the ip
+func (m *Matcher) Cloud(ip string) (string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", false
+	}
+
+	matched, name, err := m.client.CheckCloud(parsed)
+	if err != nil || !matched {
+		return "", false
+	}
+	return name, true
+}
+
+// Lookup returns the provider serving the ip
+func (m *Matcher) Lookup(ip string) (Provider, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Provider{}, false
+	}
+
+	for _, providerRange := range m.ranges {
+		if providerRange.network.Contains(parsed) {
+			return Provider{Name: providerRange.name, Type: "cdn"}, true
+		}
+	}
+	matched, name, kind, err := m.client.Check(parsed)
+	if err != nil || !matched {
+		return Provider{}, false
+	}
+	return Provider{Name: name, Type: kind}, true
+}
@@ -0,0 +1,33 @@
+package cdn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcherLookup(t *testing.T) {
+	matcher := New()
+
+	provider, ok := matcher.Lookup("104.16.0.1")
+	require.True(t, ok, "Could not lookup bundled range")
+	require.Equal(t, "cloudflare", provider.Name, "Got wrong provider")
+
+	err := matcher.Parse(strings.NewReader("# extra ranges\nexamplecdn 192.0.2.0/24\n"))
+	require.Nil(t, err, "Could not parse ranges")
+	provider, ok = matcher.Lookup("192.0.2.10")
+	require.True(t, ok, "Could not lookup extra range")
+	require.Equal(t, "examplecdn", provider.Name, "Got wrong provider")
+
+	_, ok = matcher.Lookup("10.0.0.1")
+	require.False(t, ok, "Got provider for private ip")
+
+	cloud, ok := matcher.Cloud("13.32.0.1")
+	require.True(t, ok, "Could not lookup cloud range")
+	require.Equal(t, "aws", cloud, "Got wrong cloud provider")
+	_, ok = matcher.Cloud("10.0.0.1")
+	require.False(t, ok, "Got cloud provider for private ip")
+
+	require.NotNil(t, matcher.Parse(strings.NewReader("examplecdn 192.0.2.0\n")), "Parsed invalid range")
+}
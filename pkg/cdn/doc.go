@@ -0,0 +1,8 @@
+// Package cdn maps ip addresses to the cdn, waf and cloud providers
+// serving them, using the ranges bundled with cdncheck (aws, azure,
+// google, oracle... for the clouds). Extra ranges
+// taking precedence can be loaded from a file with a provider and a
+// cidr per line, so that the ranges can be updated without a release:
+//
+//	cloudflare 104.16.0.0/13
+package cdn
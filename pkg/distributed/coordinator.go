@@ -0,0 +1,308 @@
+package distributed
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/projectdiscovery/gologger"
+)
+
+// CoordinatorOptions configures a coordinator
+type CoordinatorOptions struct {
+	Workers       []string         // Workers are the addresses of the worker nodes (host:port or urls)
+	ResolversFile string           // ResolversFile are the resolvers split across the workers, their own being used if empty
+	Token         string           // Token is the secret sent to the workers
+	TempDir       string           // TempDir is the directory of the shares and outputs of the workers
+	Client        *http.Client     // Client sends the shares, http.DefaultClient being used if nil
+	Logger        *gologger.Logger // Logger logs the shares, gologger's default logger being used if nil
+}
+
+// Coordinator is a backend splitting the candidates and the resolvers
+// across worker nodes, each running massdns locally. The records of the
+// workers are returned to the run, which filters the wildcards and
+// deduplicates the hosts globally.
+type Coordinator struct {
+	options CoordinatorOptions
+	workers []string
+	client  *http.Client
+	logger  *gologger.Logger
+}
+
+// NewCoordinator creates a coordinator of the workers
+func NewCoordinator(options CoordinatorOptions) (*Coordinator, error) {
+	if len(options.Workers) == 0 {
+		return nil, errors.New("no workers specified")
+	}
+	workers := make([]string, 0, len(options.Workers))
+	for _, worker := range options.Workers {
+		worker = strings.TrimSuffix(strings.TrimSpace(worker), "/")
+		if worker == "" {
+			continue
+		}
+		if !strings.Contains(worker, "://") {
+			worker = "http://" + worker
+		}
+		workers = append(workers, worker)
+	}
+	if len(workers) == 0 {
+		return nil, errors.New("no workers specified")
+	}
+
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = gologger.DefaultLogger
+	}
+	return &Coordinator{options: options, workers: workers, client: client, logger: logger}, nil
+}
+
+// Name describes the backend
+func (c *Coordinator) Name() string {
+	return "distributed"
+}
+
+// Resolve splits the hostnames of the input file in one share per worker,
+// parsing the outputs of the workers. A share whose worker fails is sent
+// to the next worker.
+func (c *Coordinator) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	dir, err := os.MkdirTemp(c.options.TempDir, "shuffledns-shares-*")
+	if err != nil {
+		return fmt.Errorf("could not create shares directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	shares, err := c.split(inputFile, dir)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info().Msgf("Sending %d shares to %d workers\n", len(shares), len(c.workers))
+
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		errs   []error
+		parsed = make(chan struct{})
+	)
+	// The records are returned from a single goroutine as the outputs complete
+	outputs := make(chan workerOutput)
+	go func() {
+		defer close(parsed)
+		for output := range outputs {
+			if err := parseOutput(output, onRecord); err != nil {
+				mutex.Lock()
+				errs = append(errs, fmt.Errorf("%w: %s: %w", massdns.ErrParsePhase, output.worker, err))
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	for i, share := range shares {
+		wg.Add(1)
+		go func(i int, share string) {
+			defer wg.Done()
+
+			output, err := c.send(ctx, i, share, dir)
+			if err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+				return
+			}
+			outputs <- output
+		}(i, share)
+	}
+	wg.Wait()
+	close(outputs)
+	<-parsed
+
+	// Once interrupted, the outputs received so far are kept
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// workerOutput is the massdns output of a share
+type workerOutput struct {
+	worker string
+	file   string
+	format string
+}
+
+// send sends the share to the workers in turn, starting with the i-th,
+// until one of them resolves it
+func (c *Coordinator) send(ctx context.Context, i int, share, dir string) (workerOutput, error) {
+	var errs []error
+	for attempt := 0; attempt < len(c.workers); attempt++ {
+		worker := c.workers[(i+attempt)%len(c.workers)]
+		output, err := c.sendTo(ctx, worker, share, filepath.Join(dir, fmt.Sprintf("output-%d", i)))
+		if err == nil {
+			return output, nil
+		}
+		if ctx.Err() != nil {
+			return workerOutput{}, ctx.Err()
+		}
+		c.logger.Warning().Msgf("Worker %s could not resolve share %d: %s\n", worker, i, err)
+		errs = append(errs, fmt.Errorf("%s: %w", worker, err))
+	}
+	return workerOutput{}, fmt.Errorf("%w: share %d: %w", massdns.ErrMassdnsFailed, i, errors.Join(errs...))
+}
+
+// sendTo sends the share to the worker, downloading its output to the
+// file so that a failed worker leaves no partial records
+func (c *Coordinator) sendTo(ctx context.Context, worker, share, outputFile string) (workerOutput, error) {
+	body, err := os.Open(share)
+	if err != nil {
+		return workerOutput{}, err
+	}
+	defer body.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, worker+resolvePath, body)
+	if err != nil {
+		return workerOutput{}, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return workerOutput{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return workerOutput{}, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	format := resp.Header.Get(formatHeader)
+	if format == "" {
+		format = parser.FormatMassdns
+	}
+
+	output, err := os.Create(outputFile)
+	if err != nil {
+		return workerOutput{}, err
+	}
+	defer output.Close()
+	if _, err := io.Copy(output, resp.Body); err != nil {
+		return workerOutput{}, fmt.Errorf("could not download output: %w", err)
+	}
+	return workerOutput{worker: worker, file: outputFile, format: format}, nil
+}
+
+// parseOutput returns the records of the output of a worker to onRecord
+func parseOutput(output workerOutput, onRecord parser.OnRecordFN) error {
+	p, err := parser.Lookup(output.format)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(output.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return p.Parse(file, onRecord)
+}
+
+// split writes one share per worker, dealing the hostnames of the input
+// file and the resolvers in turn. Every worker is given all the resolvers
+// when there are fewer resolvers than workers.
+func (c *Coordinator) split(inputFile, dir string) ([]string, error) {
+	var resolvers []string
+	if c.options.ResolversFile != "" {
+		var err error
+		if resolvers, err = readLines(c.options.ResolversFile); err != nil {
+			return nil, fmt.Errorf("could not load resolvers: %w", err)
+		}
+	}
+
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open input: %w", err)
+	}
+	defer input.Close()
+
+	shares := make([]*shareWriter, len(c.workers))
+	defer func() {
+		for _, share := range shares {
+			if share != nil {
+				share.file.Close()
+			}
+		}
+	}()
+	for i := range shares {
+		shareResolvers := resolvers
+		if len(resolvers) >= len(c.workers) {
+			shareResolvers = nil
+			for j := i; j < len(resolvers); j += len(c.workers) {
+				shareResolvers = append(shareResolvers, resolvers[j])
+			}
+		}
+		if shares[i], err = newShareWriter(filepath.Join(dir, fmt.Sprintf("share-%d", i)), shareResolvers); err != nil {
+			return nil, fmt.Errorf("could not write share: %w", err)
+		}
+	}
+
+	var count int
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if hostname := strings.TrimSpace(scanner.Text()); hostname != "" {
+			if err := shares[count%len(shares)].add(hostname); err != nil {
+				return nil, fmt.Errorf("could not write share: %w", err)
+			}
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+	if count == 0 {
+		return nil, massdns.ErrEmptyInput
+	}
+
+	var paths []string
+	for _, share := range shares {
+		if share.hostnames == 0 {
+			continue
+		}
+		if err := share.writer.Flush(); err != nil {
+			return nil, fmt.Errorf("could not write share: %w", err)
+		}
+		paths = append(paths, share.file.Name())
+	}
+	return paths, nil
+}
+
+// readLines reads the lines of a file, skipping the blank ones and the comments
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,125 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMassdns answers every hostname of the input file with 10.0.0.1
+const fakeMassdns = `#!/bin/sh
+for input; do :; done
+while read -r name; do
+	printf ';; Server: 1.1.1.1:53\n;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1\n;; flags: qr rd ra ; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0\n\n;; QUESTION SECTION:\n%s. IN A\n\n;; ANSWER SECTION:\n%s. 300 IN A 10.0.0.1\n\n' "$name" "$name"
+done < "$input"
+`
+
+// newTestWorker serves a worker resolving with the fake massdns
+func newTestWorker(t *testing.T, token string) *httptest.Server {
+	dir := t.TempDir()
+	massdnsPath := filepath.Join(dir, "massdns")
+	require.Nil(t, os.WriteFile(massdnsPath, []byte(fakeMassdns), 0755), "Could not write massdns")
+
+	worker, err := NewWorker(WorkerOptions{MassdnsPath: massdnsPath, Threads: 10, TempDir: dir, Token: token})
+	require.Nil(t, err, "Could not create worker")
+	server := httptest.NewServer(worker)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCoordinatorResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake massdns is a shell script")
+	}
+
+	dir := t.TempDir()
+	var hostnames []string
+	for i := 0; i < 20; i++ {
+		hostnames = append(hostnames, fmt.Sprintf("host%d.example.com", i))
+	}
+	inputFile := filepath.Join(dir, "input.txt")
+	require.Nil(t, os.WriteFile(inputFile, []byte(strings.Join(hostnames, "\n")+"\n"), 0644), "Could not write input")
+	resolversFile := filepath.Join(dir, "resolvers.txt")
+	require.Nil(t, os.WriteFile(resolversFile, []byte("1.1.1.1\n8.8.8.8\n9.9.9.9\n"), 0644), "Could not write resolvers")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Error(rw, "out of order", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	first, second := newTestWorker(t, "secret"), newTestWorker(t, "secret")
+
+	// The share of the failing worker is resolved by the next one
+	coordinator, err := NewCoordinator(CoordinatorOptions{
+		Workers:       []string{first.URL, strings.TrimPrefix(failing.URL, "http://"), second.URL},
+		ResolversFile: resolversFile,
+		Token:         "secret",
+		TempDir:       dir,
+	})
+	require.Nil(t, err, "Could not create coordinator")
+
+	var resolved []string
+	err = coordinator.Resolve(context.Background(), inputFile, func(record *parser.Record) error {
+		require.Equal(t, []string{"10.0.0.1"}, record.IPs, "Got wrong ips")
+		resolved = append(resolved, record.Domain)
+		return nil
+	})
+	require.Nil(t, err, "Could not resolve")
+	require.ElementsMatch(t, hostnames, resolved, "Got wrong hostnames")
+
+	// The workers refuse the coordinators without the token
+	coordinator, err = NewCoordinator(CoordinatorOptions{Workers: []string{first.URL}, ResolversFile: resolversFile, TempDir: dir})
+	require.Nil(t, err, "Could not create coordinator")
+	err = coordinator.Resolve(context.Background(), inputFile, func(record *parser.Record) error { return nil })
+	require.ErrorIs(t, err, massdns.ErrMassdnsFailed, "Resolved without the token")
+}
+
+func TestWorkerRefusesShares(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake massdns is a shell script")
+	}
+
+	_, err := NewWorker(WorkerOptions{MassdnsPath: "massdns"})
+	require.NotNil(t, err, "Created a worker without token")
+
+	worker := newTestWorker(t, "secret")
+	send := func(token, share string) int {
+		req, err := http.NewRequest(http.MethodPost, worker.URL+resolvePath, strings.NewReader(share))
+		require.Nil(t, err, "Could not create request")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err, "Could not send share")
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, send("secret", "1.1.1.1\n[2606:4700::1111]:53\n\nhost.example.com\n"), "Refused a valid share")
+	require.Equal(t, http.StatusUnauthorized, send("", "1.1.1.1\n\nhost.example.com\n"), "Accepted a share without the token")
+	require.Equal(t, http.StatusUnauthorized, send("wrong", "1.1.1.1\n\nhost.example.com\n"), "Accepted a share with a wrong token")
+	for _, resolver := range []string{"resolver.example.com", "1.1.1.1:dns", "1.1.1.1:70000", "-o /tmp/x"} {
+		require.Equal(t, http.StatusBadRequest, send("secret", resolver+"\n\nhost.example.com\n"), "Accepted resolver %q", resolver)
+	}
+}
+
+func TestWorkerMaxShareSize(t *testing.T) {
+	dir := t.TempDir()
+	worker, err := NewWorker(WorkerOptions{MassdnsPath: "massdns", TempDir: dir, Token: "secret", MaxShareSize: 64})
+	require.Nil(t, err, "Could not create worker")
+
+	req := httptest.NewRequest(http.MethodPost, resolvePath, strings.NewReader("1.1.1.1\n\n"+strings.Repeat("host.example.com\n", 10)))
+	req.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	worker.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code, "Accepted a share over the size limit")
+}
@@ -0,0 +1,9 @@
+// Package distributed splits the resolution of the candidates across
+// worker nodes, each running massdns locally.
+//
+// A Worker serves the shares of the candidates over http, answering the
+// massdns output. The Coordinator is a massdns.Backend dealing the
+// candidates and the resolvers of a run across the workers, the records
+// they resolved going through the wildcard filtering and deduplication
+// of the run as the ones of a local massdns would.
+package distributed
@@ -0,0 +1,108 @@
+package distributed
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resolvePath is the endpoint of the workers resolving a share
+const resolvePath = "/resolve"
+
+// formatHeader is the header giving the parser format of the output of a worker
+const formatHeader = "X-Shuffledns-Format"
+
+// A share is the part of the candidates resolved by a worker, sent as
+// text: the resolvers the worker queries, one per line, then an empty
+// line and the hostnames to resolve, one per line. Workers fall back to
+// their own resolvers when the share has none.
+
+// shareWriter writes a share to a file
+type shareWriter struct {
+	file      *os.File
+	writer    *bufio.Writer
+	hostnames int
+}
+
+// newShareWriter creates the share file, writing the resolvers
+func newShareWriter(path string, resolvers []string) (*shareWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	for _, resolver := range resolvers {
+		writer.WriteString(resolver + "\n")
+	}
+	if _, err := writer.WriteString("\n"); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &shareWriter{file: file, writer: writer}, nil
+}
+
+// add adds a hostname to the share
+func (s *shareWriter) add(hostname string) error {
+	s.hostnames++
+	_, err := s.writer.WriteString(hostname + "\n")
+	return err
+}
+
+// readShare writes the resolvers and the hostnames of a share to the
+// files, the resolvers file being empty if the share has none. It returns
+// the number of hostnames.
+func readShare(reader io.Reader, resolversFile, hostnamesFile string) (int, error) {
+	resolvers, err := os.Create(resolversFile)
+	if err != nil {
+		return 0, err
+	}
+	defer resolvers.Close()
+	hostnames, err := os.Create(hostnamesFile)
+	if err != nil {
+		return 0, err
+	}
+	defer hostnames.Close()
+
+	var (
+		current = resolvers
+		count   int
+	)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			current = hostnames
+			continue
+		}
+		if current == hostnames {
+			count++
+		} else if !validResolver(line) {
+			return 0, fmt.Errorf("invalid resolver %q in share", line)
+		}
+		if _, err := current.WriteString(line + "\n"); err != nil {
+			return 0, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("could not read share: %w", err)
+	}
+	return count, nil
+}
+
+// validResolver tells if the resolver of a share is an ip with an
+// optional port, the only resolvers massdns is given
+func validResolver(resolver string) bool {
+	if net.ParseIP(resolver) != nil {
+		return true
+	}
+	host, port, err := net.SplitHostPort(resolver)
+	if err != nil || net.ParseIP(host) == nil {
+		return false
+	}
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number <= 65535
+}
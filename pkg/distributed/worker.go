@@ -0,0 +1,179 @@
+package distributed
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+	"github.com/projectdiscovery/gologger"
+)
+
+// WorkerOptions configures a worker node
+type WorkerOptions struct {
+	MassdnsPath   string             // MassdnsPath is the path to the massdns binary
+	Threads       int                // Threads is the number of concurrent massdns resolves
+	ResolversFile string             // ResolversFile is used for the shares sent without resolvers
+	MassDnsCmd    string             // MassDnsCmd are the extra massdns flags
+	NDJSON        bool               // NDJSON makes massdns output ndjson
+	TempDir       string             // TempDir is the directory of the shares being resolved
+	Token         string             // Token is the secret the coordinator must send, required
+	MaxShareSize  int64              // MaxShareSize is the size in bytes of the largest share accepted, DefaultMaxShareSize if 0
+	RateLimiter   *ratelimit.Limiter // RateLimiter paces the queries of the worker
+	Logger        *gologger.Logger   // Logger logs the shares, gologger's default logger being used if nil
+}
+
+// DefaultMaxShareSize is the size of the largest share a worker accepts by default
+const DefaultMaxShareSize = 256 << 20
+
+// Worker resolves the shares of the candidates sent by a coordinator with
+// the local massdns binary, answering its output. The wildcard filtering
+// and the deduplication are left to the coordinator.
+type Worker struct {
+	options WorkerOptions
+	logger  *gologger.Logger
+}
+
+// NewWorker creates a worker node
+func NewWorker(options WorkerOptions) (*Worker, error) {
+	if options.MassdnsPath == "" {
+		return nil, errors.New("no massdns binary specified")
+	}
+	if options.Token == "" {
+		return nil, errors.New("no worker token specified")
+	}
+	if options.MaxShareSize <= 0 {
+		options.MaxShareSize = DefaultMaxShareSize
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = gologger.DefaultLogger
+	}
+	return &Worker{options: options, logger: logger}, nil
+}
+
+// ListenAndServe serves the coordinators on the address until ctx is done
+func (w *Worker) ListenAndServe(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", address, err)
+	}
+	return w.Serve(ctx, listener)
+}
+
+// Serve serves the coordinators on the listener until ctx is done
+func (w *Worker) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           w,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	w.logger.Info().Msgf("Worker listening on %s\n", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP resolves the share of a request, answering the massdns output
+func (w *Worker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != resolvePath {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+w.options.Token)) != 1 {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	dir, err := os.MkdirTemp(w.options.TempDir, "shuffledns-share-*")
+	if err != nil {
+		w.fail(rw, http.StatusInternalServerError, fmt.Errorf("could not create share directory: %w", err))
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	resolversFile, hostnamesFile := filepath.Join(dir, "resolvers.txt"), filepath.Join(dir, "hostnames.txt")
+	count, err := readShare(http.MaxBytesReader(rw, req.Body, w.options.MaxShareSize), resolversFile, hostnamesFile)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		w.fail(rw, status, err)
+		return
+	}
+	if empty, err := massdns.IsEmptyFile(resolversFile); err != nil || empty {
+		resolversFile = w.options.ResolversFile
+	}
+	if resolversFile == "" {
+		w.fail(rw, http.StatusBadRequest, massdns.ErrEmptyResolvers)
+		return
+	}
+
+	instance, err := massdns.New(massdns.Options{
+		MassdnsPath:   w.options.MassdnsPath,
+		Threads:       w.options.Threads,
+		InputFile:     hostnamesFile,
+		ResolversFile: resolversFile,
+		MassDnsCmd:    w.options.MassDnsCmd,
+		NDJSON:        w.options.NDJSON,
+		TempDir:       dir,
+		RateLimiter:   w.options.RateLimiter,
+		Logger:        w.logger,
+	})
+	if err != nil {
+		w.fail(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.logger.Info().Msgf("Resolving a share of %d hostnames from %s\n", count, req.RemoteAddr)
+	stdout, _, took, err := instance.RunWithContext(req.Context())
+	if err != nil {
+		w.fail(rw, http.StatusInternalServerError, fmt.Errorf("%w: %s", massdns.ErrMassdnsFailed, err))
+		return
+	}
+	w.logger.Info().Msgf("Resolved a share of %d hostnames in %s\n", count, took)
+
+	output, err := os.Open(stdout)
+	if err != nil {
+		w.fail(rw, http.StatusInternalServerError, fmt.Errorf("could not read massdns output: %w", err))
+		return
+	}
+	defer output.Close()
+
+	format := parser.FormatMassdns
+	if w.options.NDJSON {
+		format = parser.FormatMassdnsNDJSON
+	}
+	rw.Header().Set(formatHeader, format)
+	rw.Header().Set("Content-Type", "text/plain")
+	if _, err := io.Copy(rw, output); err != nil {
+		w.logger.Error().Msgf("Could not send massdns output to %s: %s\n", req.RemoteAddr, err)
+	}
+}
+
+// fail answers the error of a share
+func (w *Worker) fail(rw http.ResponseWriter, status int, err error) {
+	w.logger.Error().Msgf("Could not resolve share: %s\n", err)
+	http.Error(rw, err.Error(), status)
+}
@@ -0,0 +1,320 @@
+package dnsclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/dnsx/libs/dnsx"
+	"github.com/projectdiscovery/retryabledns"
+	"golang.org/x/net/proxy"
+)
+
+// queryTimeout bounds a query, connection included, unless configured
+const queryTimeout = 5 * time.Second
+
+// client sends the queries itself instead of dnsx, either through a
+// proxy, to DoH resolvers, with a timeout, per resolver rate limit and
+// concurrency cap, or another rotation policy. Through a proxy the plain queries are
+// sent over tcp, since neither socks5 nor http proxies carry udp.
+// The certificates of the DoH and DoT resolvers are always verified.
+type client struct {
+	dialer        proxy.Dialer
+	proxied       bool
+	httpClient    *http.Client
+	rootCAs       *x509.CertPool
+	resolvers     []string
+	retries       int
+	timeout       time.Duration
+	limiters      map[string]*ratelimit.Limiter
+	inFlight      map[string]chan struct{}
+	questionTypes []uint16
+	rotation      string
+	stats         map[string]*resolverStats
+	index         atomic.Uint32
+}
+
+// newClient creates a client sending the queries through the proxy of the options, if any
+func newClient(options Options) (*client, error) {
+	if len(options.Resolvers) == 0 {
+		return nil, errors.New("no resolvers specified")
+	}
+
+	if options.Rotation != "" && !slices.Contains(Rotations, options.Rotation) {
+		return nil, fmt.Errorf("unsupported rotation %q", options.Rotation)
+	}
+
+	c := &client{
+		resolvers:     options.Resolvers,
+		retries:       options.Retries,
+		timeout:       options.Timeout,
+		questionTypes: options.QuestionTypes,
+		rotation:      options.Rotation,
+	}
+	if c.timeout <= 0 {
+		c.timeout = queryTimeout
+	}
+	c.dialer = &net.Dialer{Timeout: c.timeout}
+	if options.Proxy != "" {
+		dialer, err := ParseProxy(options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		c.dialer = dialer
+		c.proxied = true
+	}
+	c.httpClient = &http.Client{
+		Timeout: c.timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return c.dialer.Dial(network, address)
+			},
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: c.timeout,
+		},
+	}
+	if c.retries <= 0 {
+		c.retries = dnsx.DefaultOptions.MaxRetries
+	}
+	if len(c.questionTypes) == 0 {
+		c.questionTypes = []uint16{dns.TypeA}
+	}
+	if options.ResolverRateLimit > 0 {
+		c.limiters = make(map[string]*ratelimit.Limiter, len(c.resolvers))
+		for _, resolver := range c.resolvers {
+			c.limiters[resolver] = ratelimit.New(options.ResolverRateLimit)
+		}
+	}
+	if options.MaxInFlight > 0 {
+		c.inFlight = make(map[string]chan struct{}, len(c.resolvers))
+		for _, resolver := range c.resolvers {
+			c.inFlight[resolver] = make(chan struct{}, options.MaxInFlight)
+		}
+	}
+	if c.rotation == RotationWeighted {
+		c.stats = make(map[string]*resolverStats, len(c.resolvers))
+		for _, resolver := range c.resolvers {
+			c.stats[resolver] = &resolverStats{}
+		}
+	}
+	return c, nil
+}
+
+// ParseProxy returns a dialer for a socks5://, socks5h:// or http:// proxy url
+func ParseProxy(proxyURL string) (proxy.Dialer, error) {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse proxy: %w", err)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("no host in proxy %s", proxyURL)
+	}
+
+	forward := &net.Dialer{Timeout: queryTimeout}
+	switch parsed.Scheme {
+	case "socks5", "socks5h":
+		return proxy.FromURL(parsed, forward)
+	case "http":
+		return &connectDialer{proxyURL: parsed, forward: forward}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use socks5 or http", parsed.Scheme)
+	}
+}
+
+// QueryOne resolves the hostname with the first question type
+func (c *client) QueryOne(hostname string) (*retryabledns.DNSData, error) {
+	return c.query(hostname, c.questionTypes[:1])
+}
+
+// QueryMultiple resolves the hostname with every question type
+func (c *client) QueryMultiple(hostname string) (*retryabledns.DNSData, error) {
+	return c.query(hostname, c.questionTypes)
+}
+
+// query resolves the hostname with the question types, merging the answers
+func (c *client) query(hostname string, questionTypes []uint16) (*retryabledns.DNSData, error) {
+	data := &retryabledns.DNSData{Host: hostname}
+	for _, questionType := range questionTypes {
+		msg := &dns.Msg{}
+		msg.SetQuestion(dns.Fqdn(hostname), questionType)
+		msg.SetEdns0(4096, false)
+
+		resp, resolver, err := c.exchangeAny(msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := data.ParseFromMsg(resp); err != nil {
+			return nil, err
+		}
+		data.Resolver = append(data.Resolver, resolver)
+		data.StatusCode = dns.RcodeToString[resp.Rcode]
+		data.StatusCodeRaw = resp.Rcode
+		data.Raw += resp.String()
+		data.RawResp = resp
+	}
+	data.Timestamp = time.Now()
+	return data, nil
+}
+
+// exchangeAny sends the query to the resolvers chosen by the rotation until one answers
+func (c *client) exchangeAny(msg *dns.Msg) (*dns.Msg, string, error) {
+	var err error
+	for i := 0; i < c.retries; i++ {
+		resolver := c.nextResolver()
+
+		c.limiters[resolver].Take()
+		release := c.acquire(resolver)
+
+		var resp *dns.Msg
+		start := time.Now()
+		resp, err = c.exchange(msg, resolver)
+		release()
+		if c.stats != nil {
+			c.stats[resolver].record(time.Since(start), err)
+		}
+		if err == nil {
+			return resp, resolver, nil
+		}
+	}
+	return nil, "", err
+}
+
+// exchange sends the query to the resolver
+func (c *client) exchange(msg *dns.Msg, resolver string) (*dns.Msg, error) {
+	if url, ok := dohURL(resolver); ok {
+		return c.exchangeDoH(msg, url)
+	}
+	address, dot := dotAddress(resolver)
+	if !c.proxied && !dot {
+		dnsClient := &dns.Client{Timeout: c.timeout}
+		resp, _, err := dnsClient.Exchange(msg, resolver)
+		return resp, err
+	}
+
+	conn, err := c.dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(c.timeout))
+	if dot {
+		if conn, err = c.wrapTLS(conn, address); err != nil {
+			return nil, err
+		}
+	}
+	dnsConn := &dns.Conn{Conn: conn}
+	if err := dnsConn.WriteMsg(msg); err != nil {
+		return nil, err
+	}
+	return dnsConn.ReadMsg()
+}
+
+// wrapTLS performs the handshake with the DoT resolver at address,
+// verifying its certificate for the host of the address.
+func (c *client) wrapTLS(conn net.Conn, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, RootCAs: c.rootCAs, MinVersion: tls.VersionTLS12})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// exchangeDoH sends the query to the DoH resolver with a POST request
+func (c *client) exchangeDoH(msg *dns.Msg, url string) (*dns.Msg, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("Content-Type", "application/dns-message")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh resolver %s returned %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &dns.Msg{}
+	if err := answer.Unpack(body); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// connectDialer tunnels the connections through an http proxy with CONNECT
+type connectDialer struct {
+	proxyURL *url.URL
+	forward  *net.Dialer
+}
+
+// Dial connects to the address through the proxy
+func (d *connectDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.forward.Dial("tcp", d.proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := d.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(queryTimeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The resolver never speaks first, so nothing past the response is buffered
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused connection to %s: %s", address, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,128 @@
+package dnsclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyClientQueryOne(t *testing.T) {
+	// A tcp resolver answering every A query with the same address
+	resolverListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{Listener: resolverListener, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.1")
+		resp.Answer = append(resp.Answer, rr)
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	// An http proxy tunneling the CONNECT requests
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for proxy")
+	defer proxyListener.Close()
+	go func() {
+		for {
+			conn, err := proxyListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(target, conn) }()
+				_, _ = io.Copy(conn, target)
+			}(conn)
+		}
+	}()
+
+	client, err := New(Options{Resolvers: []string{resolverListener.Addr().String()}, Proxy: "http://" + proxyListener.Addr().String()})
+	require.Nil(t, err, "Could not create client")
+
+	resp, err := client.QueryOne("www.example.com")
+	require.Nil(t, err, "Could not query through proxy")
+	require.Equal(t, []string{"10.0.0.1"}, resp.A, "Got unexpected answer")
+
+	_, err = ParseProxy("ftp://127.0.0.1:21")
+	require.NotNil(t, err, "Got no error for unsupported proxy")
+}
+
+func TestDoHClientQueryOne(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &dns.Msg{}
+		if err := req.Unpack(body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.2")
+		resp.Answer = append(resp.Answer, rr)
+		packed, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer server.Close()
+
+	dnsClient, err := New(Options{Resolvers: []string{ParseResolver(server.URL + "/dns-query")}})
+	require.Nil(t, err, "Could not create client")
+
+	_, err = dnsClient.QueryOne("www.example.com")
+	require.NotNil(t, err, "Got answer from resolver with untrusted certificate")
+
+	dnsClient.(*client).httpClient = server.Client()
+	resp, err := dnsClient.QueryOne("www.example.com")
+	require.Nil(t, err, "Could not query over doh")
+	require.Equal(t, []string{"10.0.0.2"}, resp.A, "Got unexpected answer")
+}
+
+func TestDoTClientQueryOne(t *testing.T) {
+	// Reuse the certificate of a test server, valid for 127.0.0.1
+	certificates := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certificates.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certificates.TLS.Certificates})
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{Listener: listener, Net: "tcp-tls", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.3")
+		resp.Answer = append(resp.Answer, rr)
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	dnsClient, err := newClient(Options{Resolvers: []string{ParseResolver("tls://" + listener.Addr().String())}})
+	require.Nil(t, err, "Could not create client")
+
+	_, err = dnsClient.QueryOne("www.example.com")
+	require.NotNil(t, err, "Got answer from resolver with untrusted certificate")
+
+	dnsClient.rootCAs = certificates.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	resp, err := dnsClient.QueryOne("www.example.com")
+	require.Nil(t, err, "Could not query over dot")
+	require.Equal(t, []string{"10.0.0.3"}, resp.A, "Got unexpected answer")
+}
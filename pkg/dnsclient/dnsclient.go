@@ -0,0 +1,61 @@
+package dnsclient
+
+import (
+	"time"
+
+	"github.com/projectdiscovery/dnsx/libs/dnsx"
+	"github.com/projectdiscovery/retryabledns"
+)
+
+// Client resolves a hostname natively
+type Client interface {
+	// QueryOne resolves the hostname with the first question type
+	QueryOne(hostname string) (*retryabledns.DNSData, error)
+	// QueryMultiple resolves the hostname with every question type
+	QueryMultiple(hostname string) (*retryabledns.DNSData, error)
+}
+
+// Options contains the configuration of a client
+type Options struct {
+	// Resolvers are the resolvers queried, in the format returned by ParseResolver
+	Resolvers []string
+	// Retries is the number of retries, the dnsx default if not positive
+	Retries int
+	// Timeout bounds a query, 5 seconds if not set
+	Timeout time.Duration
+	// ResolverRateLimit is the max number of queries per second sent to each resolver
+	ResolverRateLimit int
+	// QuestionTypes are the types of the queries, A if not set
+	QuestionTypes []uint16
+	// Proxy is the socks5 or http proxy the queries are sent through
+	Proxy string
+	// Rotation is the policy choosing the resolver of each query, round-robin if not set
+	Rotation string
+	// MaxInFlight is the max number of concurrent queries sent to each resolver
+	MaxInFlight int
+}
+
+// New creates a client with the options
+func New(options Options) (Client, error) {
+	// dnsx neither supports proxies, verifies the DoH certificates,
+	// nor allows configuring the timeout, the rate, the concurrency
+	// and the rotation of the queries
+	if options.Proxy != "" || hasDoH(options.Resolvers) || options.Timeout > 0 || options.ResolverRateLimit > 0 ||
+		options.MaxInFlight > 0 || (options.Rotation != "" && options.Rotation != RotationRoundRobin) {
+		return newClient(options)
+	}
+
+	dnsxOptions := dnsx.DefaultOptions
+	dnsxOptions.BaseResolvers = options.Resolvers
+	if options.Retries > 0 {
+		dnsxOptions.MaxRetries = options.Retries
+	}
+	if len(options.QuestionTypes) > 0 {
+		dnsxOptions.QuestionTypes = options.QuestionTypes
+	}
+	client, err := dnsx.New(dnsxOptions)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
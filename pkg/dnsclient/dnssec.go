@@ -0,0 +1,69 @@
+package dnsclient
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSEC validation statuses of a hostname
+const (
+	// DNSSECSecure is the status of answers validated by the resolver
+	DNSSECSecure = "secure"
+	// DNSSECInsecure is the status of answers from unsigned zones
+	DNSSECInsecure = "insecure"
+	// DNSSECBogus is the status of answers failing the validation
+	DNSSECBogus = "bogus"
+)
+
+// Validator checks the DNSSEC validation of hostnames with validating resolvers
+type Validator struct {
+	client *client
+}
+
+// NewValidator creates a validator querying the resolvers of the options,
+// which are expected to validate DNSSEC themselves.
+func NewValidator(options Options) (*Validator, error) {
+	client, err := newClient(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{client: client}, nil
+}
+
+// Validate returns the DNSSEC validation status of the A answer of the
+// hostname. Validating resolvers fail the queries of bogus answers, which
+// are told apart from broken zones by retrying with checking disabled.
+func (v *Validator) Validate(hostname string) (string, error) {
+	resp, err := v.exchange(hostname, false)
+	if err != nil {
+		return "", err
+	}
+	if resp.Rcode != dns.RcodeServerFailure {
+		if resp.AuthenticatedData {
+			return DNSSECSecure, nil
+		}
+		return DNSSECInsecure, nil
+	}
+
+	resp, err = v.exchange(hostname, true)
+	if err != nil {
+		return "", err
+	}
+	if resp.Rcode == dns.RcodeServerFailure {
+		return "", fmt.Errorf("could not resolve %s", hostname)
+	}
+	return DNSSECBogus, nil
+}
+
+// exchange sends the A query of the hostname with the DO bit set
+func (v *Validator) exchange(hostname string, checkingDisabled bool) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
+	msg.SetEdns0(4096, true)
+	msg.AuthenticatedData = true
+	msg.CheckingDisabled = checkingDisabled
+
+	resp, _, err := v.client.exchangeAny(msg)
+	return resp, err
+}
@@ -0,0 +1,48 @@
+package dnsclient
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorValidate(t *testing.T) {
+	// A validating resolver: signed.example.com validates, bogus.example.com
+	// fails validation and every other name is unsigned
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		switch req.Question[0].Name {
+		case "signed.example.com.":
+			resp.AuthenticatedData = true
+		case "bogus.example.com.":
+			if !req.CheckingDisabled {
+				resp.Rcode = dns.RcodeServerFailure
+			}
+		}
+		if resp.Rcode == dns.RcodeSuccess {
+			rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.4")
+			resp.Answer = append(resp.Answer, rr)
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	validator, err := NewValidator(Options{Resolvers: []string{conn.LocalAddr().String()}})
+	require.Nil(t, err, "Could not create validator")
+
+	for hostname, expected := range map[string]string{
+		"signed.example.com":   DNSSECSecure,
+		"unsigned.example.com": DNSSECInsecure,
+		"bogus.example.com":    DNSSECBogus,
+	} {
+		status, err := validator.Validate(hostname)
+		require.Nil(t, err, "Could not validate %s", hostname)
+		require.Equal(t, expected, status, "Got unexpected status for %s", hostname)
+	}
+}
@@ -0,0 +1,10 @@
+// Package dnsclient creates the clients used for the native dns queries
+// made outside of massdns: wildcard detection, trusted verification and
+// the lookups of the extra record types.
+//
+// Queries are sent with dnsx, unless a socks5 or http proxy is configured,
+// for operators who must egress dns via a jump host, or DoH resolvers are
+// used. DoH resolvers are given as https:// urls and DoT ones as tls://
+// addresses, and their certificates are verified so that the answers
+// can't be tampered with on path.
+package dnsclient
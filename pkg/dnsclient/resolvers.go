@@ -0,0 +1,68 @@
+package dnsclient
+
+import (
+	"net"
+	"strings"
+)
+
+// dohPrefix and dohSuffix wrap the DoH urls and dotPrefix the DoT
+// addresses in the format used by dnsx
+const (
+	dohPrefix = "doh:"
+	dohSuffix = ":post"
+	dotPrefix = "dot:"
+)
+
+// ParseResolver returns a resolver line of a file in the format used by
+// the clients. Plain resolvers use port 53 unless one is given, https://
+// urls are queried over DoH and tls:// addresses over DoT, on port 853
+// unless one is given.
+func ParseResolver(resolver string) string {
+	switch {
+	case strings.HasPrefix(resolver, "https://"):
+		return dohPrefix + resolver + dohSuffix
+	case strings.HasPrefix(resolver, "tls://"):
+		return dotPrefix + withPort(strings.TrimPrefix(resolver, "tls://"), "853")
+	case strings.HasPrefix(resolver, dohPrefix), strings.HasPrefix(resolver, dotPrefix):
+		return resolver
+	}
+	return withPort(resolver, "53")
+}
+
+// withPort adds the default port to an address without one
+func withPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, port)
+}
+
+// dotAddress returns the address of a resolver, and whether it is a DoT one
+func dotAddress(resolver string) (string, bool) {
+	if !strings.HasPrefix(resolver, dotPrefix) {
+		return resolver, false
+	}
+	return strings.TrimPrefix(resolver, dotPrefix), true
+}
+
+// dohURL returns the url of a DoH resolver
+func dohURL(resolver string) (string, bool) {
+	if !strings.HasPrefix(resolver, dohPrefix) {
+		return "", false
+	}
+	resolver = strings.TrimPrefix(resolver, dohPrefix)
+	for _, suffix := range []string{":post", ":get", ":jsonapi"} {
+		resolver = strings.TrimSuffix(resolver, suffix)
+	}
+	return resolver, true
+}
+
+// hasDoH returns true if any of the resolvers is a DoH one
+func hasDoH(resolvers []string) bool {
+	for _, resolver := range resolvers {
+		if _, ok := dohURL(resolver); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package dnsclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResolver(t *testing.T) {
+	require.Equal(t, "1.1.1.1:53", ParseResolver("1.1.1.1"), "Could not add default port")
+	require.Equal(t, "1.1.1.1:5353", ParseResolver("1.1.1.1:5353"), "Could not keep port")
+	require.Equal(t, "[2606:4700:4700::1111]:53", ParseResolver("2606:4700:4700::1111"), "Could not add port to ipv6")
+	require.Equal(t, "doh:https://dns.google/dns-query:post", ParseResolver("https://dns.google/dns-query"), "Could not parse doh url")
+
+	require.Equal(t, "dot:1.1.1.1:853", ParseResolver("tls://1.1.1.1"), "Could not add default dot port")
+	require.Equal(t, "dot:1.1.1.1:8853", ParseResolver("tls://1.1.1.1:8853"), "Could not keep dot port")
+
+	url, ok := dohURL(ParseResolver("https://dns.google/dns-query"))
+	require.True(t, ok, "Could not get doh url")
+	require.Equal(t, "https://dns.google/dns-query", url, "Got unexpected doh url")
+}
@@ -0,0 +1,97 @@
+package dnsclient
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Rotation policies choosing the resolver of each query
+const (
+	// RotationRoundRobin queries the resolvers in turn
+	RotationRoundRobin = "round-robin"
+	// RotationRandom queries a resolver picked at random
+	RotationRandom = "random"
+	// RotationWeighted favors the resolvers answering the most and the fastest
+	RotationWeighted = "weighted"
+)
+
+// Rotations are the supported rotation policies
+var Rotations = []string{RotationRoundRobin, RotationRandom, RotationWeighted}
+
+// unknownLatency is the latency assumed for the resolvers which never answered
+const unknownLatency = 100 * time.Millisecond
+
+// resolverStats are the answers of a resolver scoring it for the weighted rotation
+type resolverStats struct {
+	mutex     sync.Mutex
+	successes int
+	failures  int
+	// latency is the moving average of the latency of the answers
+	latency time.Duration
+}
+
+// record accounts for a query sent to the resolver
+func (s *resolverStats) record(took time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.failures++
+		return
+	}
+	s.successes++
+	if s.latency == 0 {
+		s.latency = took
+	} else {
+		s.latency = (s.latency*7 + took) / 8
+	}
+}
+
+// score returns the weight of the resolver, its success rate over its
+// latency. The rate is smoothed so that new resolvers are given a chance.
+func (s *resolverStats) score() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rate := float64(s.successes+1) / float64(s.successes+s.failures+2)
+	latency := s.latency
+	if latency <= 0 {
+		latency = unknownLatency
+	}
+	return rate / latency.Seconds()
+}
+
+// nextResolver returns the resolver of the next query according to the rotation
+func (c *client) nextResolver() string {
+	switch c.rotation {
+	case RotationRandom:
+		return c.resolvers[rand.Intn(len(c.resolvers))]
+	case RotationWeighted:
+		scores := make([]float64, len(c.resolvers))
+		var total float64
+		for i, resolver := range c.resolvers {
+			scores[i] = c.stats[resolver].score()
+			total += scores[i]
+		}
+		pick := rand.Float64() * total
+		for i, score := range scores {
+			if pick -= score; pick < 0 {
+				return c.resolvers[i]
+			}
+		}
+		return c.resolvers[len(c.resolvers)-1]
+	default:
+		return c.resolvers[c.index.Add(1)%uint32(len(c.resolvers))]
+	}
+}
+
+// acquire waits for a query slot of the resolver, returning the function releasing it
+func (c *client) acquire(resolver string) func() {
+	slots, ok := c.inFlight[resolver]
+	if !ok {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
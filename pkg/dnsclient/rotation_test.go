@@ -0,0 +1,37 @@
+package dnsclient
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedRotation(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.4")
+		resp.Answer = append(resp.Answer, rr)
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	// The closed port refuses the queries, the resolver answering is favored
+	_, err = New(Options{Resolvers: []string{conn.LocalAddr().String()}, Rotation: "fastest"})
+	require.NotNil(t, err, "Created client with unknown rotation")
+	dnsClient, err := New(Options{Resolvers: []string{"127.0.0.1:1", conn.LocalAddr().String()}, Retries: 1, Rotation: RotationWeighted, MaxInFlight: 1})
+	require.Nil(t, err, "Could not create client")
+
+	var answered int
+	for i := 0; i < 50; i++ {
+		if _, err := dnsClient.QueryOne("www.example.com"); err == nil {
+			answered++
+		}
+	}
+	require.GreaterOrEqual(t, answered, 40, "Got too many queries sent to the dead resolver")
+}
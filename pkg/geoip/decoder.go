@@ -0,0 +1,176 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Data types of the MaxMind DB format
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds the nesting of the decoded values
+const maxDepth = 32
+
+var errTruncated = errors.New("truncated data")
+
+// decoder decodes the values of a section, pointers being offsets in it
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+// decode decodes the value at offset, returning the offset following it
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	control := d.buf[offset]
+	offset++
+
+	kind := uint(control >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(control & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		value := d.uint(offset, extra)
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + value
+		case 2:
+			size = 285 + value
+		default:
+			size = 65821 + value
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		fields := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("invalid map key")
+			}
+			if fields[name], offset, err = d.decode(next); err != nil {
+				return nil, 0, err
+			}
+		}
+		return fields, offset, nil
+	case typeArray:
+		values := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	payload := d.buf[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case typeString:
+		return string(payload), offset, nil
+	case typeBytes, typeUint128:
+		return payload, offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(uint64(d.uint(offset-size, size))), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(uint32(d.uint(offset-size, size)))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		return uint64(d.uint(offset-size, size)), offset, nil
+	case typeInt32:
+		return int64(int32(d.uint(offset-size, size))), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+// pointer decodes the pointer whose control byte was read
+func (d *decoder) pointer(control byte, offset uint) (uint, uint, error) {
+	size := uint(control>>3)&0x3 + 1
+	if offset+size > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	value := d.uint(offset, size)
+	switch size {
+	case 1:
+		value |= uint(control&0x7) << 8
+	case 2:
+		value = (value | uint(control&0x7)<<16) + 2048
+	case 3:
+		value = (value | uint(control&0x7)<<24) + 526336
+	}
+	return value, offset + size, nil
+}
+
+// uint decodes a big endian unsigned integer of size bytes
+func (d *decoder) uint(offset, size uint) uint {
+	var value uint
+	for _, b := range d.buf[offset : offset+size] {
+		value = value<<8 | uint(b)
+	}
+	return value
+}
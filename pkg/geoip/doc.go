@@ -0,0 +1,4 @@
+// Package geoip maps ip addresses to their country and city using a
+// local MaxMind database (GeoLite2-City, GeoIP2-City or GeoLite2-Country)
+// in the MaxMind DB format, which is decoded without external dependencies.
+package geoip
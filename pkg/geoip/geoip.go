@@ -0,0 +1,156 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata at the end of the database
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator is the size of the zeroed gap between the tree and the data
+const dataSeparator = 16
+
+// Location is the location of an ip
+type Location struct {
+	// Country is the ISO 3166 code of the country (eg. US)
+	Country string `json:"country,omitempty"`
+	// City is the english name of the city
+	City string `json:"city,omitempty"`
+}
+
+// Database is a MaxMind database loaded in memory
+type Database struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node of the ipv4 addresses in an ipv6 tree
+	ipv4Start uint
+}
+
+// Load reads a MaxMind database from a file
+func Load(path string) (*Database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(buf)
+}
+
+// Parse reads a MaxMind database from its content
+func Parse(buf []byte) (*Database, error) {
+	markerIndex := bytes.LastIndex(buf, metadataMarker)
+	if markerIndex == -1 {
+		return nil, errors.New("invalid maxmind database: metadata not found")
+	}
+	metadata, _, err := (&decoder{buf: buf[markerIndex+len(metadataMarker):]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxmind database metadata: %w", err)
+	}
+	fields, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid maxmind database metadata")
+	}
+
+	db := &Database{
+		nodeCount:  uint(toUint(fields["node_count"])),
+		recordSize: uint(toUint(fields["record_size"])),
+		ipVersion:  uint(toUint(fields["ip_version"])),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported maxmind database record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(markerIndex) {
+		return nil, errors.New("invalid maxmind database: truncated search tree")
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+dataSeparator : markerIndex]
+
+	// The ipv4 addresses are mapped to ::/96 in ipv6 trees
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.readNode(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// Lookup returns the location of the ip
+func (db *Database) Lookup(ip string) (Location, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Location{}, false
+	}
+
+	node, bits := uint(0), []byte(parsed.To16())
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		node, bits = db.ipv4Start, []byte(ipv4)
+	} else if db.ipVersion == 4 {
+		return Location{}, false
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.readNode(node, bit)
+	}
+	if node <= db.nodeCount {
+		return Location{}, false
+	}
+
+	offset := node - db.nodeCount - dataSeparator
+	record, _, err := (&decoder{buf: db.data}).decode(offset)
+	if err != nil {
+		return Location{}, false
+	}
+	var location Location
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := lookupPath(record, key, "iso_code").(string); ok {
+			location.Country = country
+			break
+		}
+	}
+	location.City, _ = lookupPath(record, "city", "names", "en").(string)
+	return location, location.Country != "" || location.City != ""
+}
+
+// readNode returns the left or right record of a node of the search tree
+func (db *Database) readNode(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := db.tree[node*8+bit*4:]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// lookupPath returns the value at the path of nested maps
+func lookupPath(value interface{}, path ...string) interface{} {
+	for _, key := range path {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = fields[key]
+	}
+	return value
+}
+
+// toUint converts a decoded unsigned integer
+func toUint(value interface{}) uint64 {
+	number, _ := value.(uint64)
+	return number
+}
@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeString encodes a short string
+func encodeString(value string) []byte {
+	return append([]byte{typeString<<5 | byte(len(value))}, value...)
+}
+
+// encodeMap encodes a map of the already encoded key and values pairs
+func encodeMap(pairs ...[]byte) []byte {
+	buf := []byte{typeMap<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		buf = append(buf, pair...)
+	}
+	return buf
+}
+
+// encodeUint32 encodes an unsigned integer on 4 bytes
+func encodeUint32(value uint32) []byte {
+	return []byte{typeUint32<<5 | 4, byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+}
+
+// buildDatabase builds an ipv4 database with 24 bit records mapping
+// 10.0.0.0/8 to a location
+func buildDatabase() []byte {
+	const nodeCount = 8
+	var tree []byte
+	for node := 0; node < nodeCount; node++ {
+		bit := (10 >> (7 - node)) & 1
+		next := uint32(node + 1)
+		if node == nodeCount-1 {
+			// The data is at the start of the data section
+			next = nodeCount + dataSeparator
+		}
+		records := [2]uint32{nodeCount, nodeCount}
+		records[bit] = next
+		for _, record := range records {
+			tree = append(tree, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+
+	data := encodeMap(
+		encodeString("city"), encodeMap(encodeString("names"), encodeMap(encodeString("en"), encodeString("Springfield"))),
+		encodeString("country"), encodeMap(encodeString("iso_code"), encodeString("US")),
+	)
+	metadata := encodeMap(
+		encodeString("node_count"), encodeUint32(nodeCount),
+		encodeString("record_size"), encodeUint32(24),
+		encodeString("ip_version"), encodeUint32(4),
+	)
+
+	buf := append(tree, make([]byte, dataSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, metadata...)
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	db, err := Parse(buildDatabase())
+	require.Nil(t, err, "Could not parse database")
+
+	location, ok := db.Lookup("10.1.2.3")
+	require.True(t, ok, "Could not lookup ip")
+	require.Equal(t, Location{Country: "US", City: "Springfield"}, location, "Got wrong location")
+
+	_, ok = db.Lookup("192.168.1.1")
+	require.False(t, ok, "Got location for unknown ip")
+	_, ok = db.Lookup("2001:db8::1")
+	require.False(t, ok, "Got location for ipv6 in ipv4 database")
+
+	_, err = Parse([]byte("not a database"))
+	require.NotNil(t, err, "Parsed invalid database")
+}
@@ -0,0 +1,9 @@
+// Package mailpolicy parses the SPF and DMARC policies published in the
+// TXT records of a domain and extracts the domains they reference.
+//
+// SPF records reference the mail senders of the domain through their
+// include, redirect, a, mx, ptr and exists mechanisms, and DMARC records
+// the receivers of the aggregate and forensic reports. The referenced
+// hostnames below the domain are enumeration candidates, and the others
+// reveal the third-party services the organization relies on.
+package mailpolicy
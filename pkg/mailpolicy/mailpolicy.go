@@ -0,0 +1,171 @@
+package mailpolicy
+
+import (
+	"strings"
+)
+
+// SPF is the sender policy published by a domain
+type SPF struct {
+	// Record is the raw TXT record
+	Record string `json:"record"`
+	// Includes are the domains whose policies are included or redirected to
+	Includes []string `json:"includes,omitempty"`
+	// Hosts are the domains of the a, mx, ptr and exists mechanisms
+	Hosts []string `json:"hosts,omitempty"`
+	// Networks are the ip4 and ip6 networks allowed to send
+	Networks []string `json:"networks,omitempty"`
+	// All is the all mechanism with its qualifier (eg. -all), if any
+	All string `json:"all,omitempty"`
+}
+
+// DMARC is the message authentication policy published by a domain
+type DMARC struct {
+	// Record is the raw TXT record
+	Record string `json:"record"`
+	// Policy is the policy of the domain (none, quarantine or reject)
+	Policy string `json:"policy,omitempty"`
+	// SubdomainPolicy is the policy of the subdomains, if different
+	SubdomainPolicy string `json:"subdomain_policy,omitempty"`
+	// Percent is the percentage of the messages the policy applies to, if set
+	Percent string `json:"percent,omitempty"`
+	// Reports are the domains receiving the aggregate and forensic reports
+	Reports []string `json:"reports,omitempty"`
+}
+
+// Policy is the summary of the mail policies of a domain
+type Policy struct {
+	// Domain is the domain the policies are published by
+	Domain string `json:"domain"`
+	SPF    *SPF   `json:"spf,omitempty"`
+	DMARC  *DMARC `json:"dmarc,omitempty"`
+	// Candidates are the referenced hostnames below the domain
+	Candidates []string `json:"candidates,omitempty"`
+	// ThirdParty are the referenced domains outside of the domain
+	ThirdParty []string `json:"third_party,omitempty"`
+}
+
+// Analyze summarizes the SPF policy found in the TXT records of the domain
+// and the DMARC policy found in the TXT records of its _dmarc name,
+// returning nil if the domain publishes neither.
+func Analyze(domain string, txt, dmarcTxt []string) *Policy {
+	policy := &Policy{Domain: domain}
+	for _, record := range txt {
+		if spf, ok := ParseSPF(record); ok {
+			policy.SPF = spf
+			break
+		}
+	}
+	for _, record := range dmarcTxt {
+		if dmarc, ok := ParseDMARC(record); ok {
+			policy.DMARC = dmarc
+			break
+		}
+	}
+	if policy.SPF == nil && policy.DMARC == nil {
+		return nil
+	}
+
+	var referenced []string
+	if policy.SPF != nil {
+		referenced = append(referenced, policy.SPF.Includes...)
+		referenced = append(referenced, policy.SPF.Hosts...)
+	}
+	if policy.DMARC != nil {
+		referenced = append(referenced, policy.DMARC.Reports...)
+	}
+	seen := make(map[string]struct{}, len(referenced))
+	for _, name := range referenced {
+		if _, ok := seen[name]; ok || name == domain {
+			continue
+		}
+		seen[name] = struct{}{}
+		if strings.HasSuffix(name, "."+domain) {
+			policy.Candidates = append(policy.Candidates, name)
+		} else {
+			policy.ThirdParty = append(policy.ThirdParty, name)
+		}
+	}
+	return policy
+}
+
+// ParseSPF parses the record if it is an SPF policy
+func ParseSPF(record string) (*SPF, bool) {
+	fields := strings.Fields(record)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return nil, false
+	}
+
+	spf := &SPF{Record: record}
+	for _, field := range fields[1:] {
+		term := strings.ToLower(field)
+		if strings.HasPrefix(term, "redirect=") {
+			spf.Includes = appendDomain(spf.Includes, strings.TrimPrefix(term, "redirect="))
+			continue
+		}
+		// The qualifier of the mechanism defaults to pass
+		mechanism := strings.TrimLeft(term, "+-~?")
+		name, value, _ := strings.Cut(mechanism, ":")
+		switch name {
+		case "include":
+			spf.Includes = appendDomain(spf.Includes, value)
+		case "a", "mx", "ptr", "exists":
+			// The a and mx domains may be followed by cidr lengths
+			value, _, _ = strings.Cut(value, "/")
+			spf.Hosts = appendDomain(spf.Hosts, value)
+		case "ip4", "ip6":
+			spf.Networks = append(spf.Networks, value)
+		case "all":
+			spf.All = term
+		}
+	}
+	return spf, true
+}
+
+// ParseDMARC parses the record if it is a DMARC policy
+func ParseDMARC(record string) (*DMARC, bool) {
+	tags := strings.Split(record, ";")
+	if !strings.EqualFold(strings.ReplaceAll(tags[0], " ", ""), "v=DMARC1") {
+		return nil, false
+	}
+
+	dmarc := &DMARC{Record: record}
+	for _, tag := range tags[1:] {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "p":
+			dmarc.Policy = strings.ToLower(value)
+		case "sp":
+			dmarc.SubdomainPolicy = strings.ToLower(value)
+		case "pct":
+			dmarc.Percent = value
+		case "rua", "ruf":
+			for _, uri := range strings.Split(value, ",") {
+				// The uris are mailto addresses optionally followed by a size limit
+				address, _, _ := strings.Cut(strings.TrimSpace(uri), "!")
+				if _, host, ok := strings.Cut(address, "@"); ok {
+					dmarc.Reports = appendDomain(dmarc.Reports, strings.ToLower(host))
+				}
+			}
+		}
+	}
+	return dmarc, true
+}
+
+// appendDomain appends the domain unless it is empty or made of macros,
+// which are expanded for every message and can't be resolved
+func appendDomain(domains []string, domain string) []string {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || strings.Contains(domain, "%") {
+		return domains
+	}
+	for _, existing := range domains {
+		if existing == domain {
+			return domains
+		}
+	}
+	return append(domains, domain)
+}
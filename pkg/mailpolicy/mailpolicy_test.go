@@ -0,0 +1,30 @@
+package mailpolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	txt := []string{
+		"google-site-verification=abc",
+		"v=spf1 ip4:192.0.2.0/24 include:_spf.google.com a:mail.example.com/28 mx exists:%{i}._spf.example.com ~all",
+	}
+	dmarcTxt := []string{"v=DMARC1; p=reject; sp=none; pct=50; rua=mailto:dmarc@example.com,mailto:reports@dmarc.agari.com!10m"}
+
+	policy := Analyze("example.com", txt, dmarcTxt)
+	require.NotNil(t, policy, "Could not get policy")
+	require.Equal(t, []string{"_spf.google.com"}, policy.SPF.Includes, "Could not get includes")
+	require.Equal(t, []string{"mail.example.com"}, policy.SPF.Hosts, "Could not get hosts")
+	require.Equal(t, []string{"192.0.2.0/24"}, policy.SPF.Networks, "Could not get networks")
+	require.Equal(t, "~all", policy.SPF.All, "Could not get all")
+	require.Equal(t, "reject", policy.DMARC.Policy, "Could not get policy")
+	require.Equal(t, "none", policy.DMARC.SubdomainPolicy, "Could not get subdomain policy")
+	require.Equal(t, "50", policy.DMARC.Percent, "Could not get percent")
+	require.Equal(t, []string{"example.com", "dmarc.agari.com"}, policy.DMARC.Reports, "Could not get report domains")
+	require.Equal(t, []string{"mail.example.com"}, policy.Candidates, "Could not get candidates")
+	require.Equal(t, []string{"_spf.google.com", "dmarc.agari.com"}, policy.ThirdParty, "Could not get third-party domains")
+
+	require.Nil(t, Analyze("example.com", []string{"v=spf2"}, nil), "Got policy without spf and dmarc")
+}
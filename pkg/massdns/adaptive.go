@@ -0,0 +1,79 @@
+package massdns
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+const (
+	// adaptiveBackoffRate is the failure rate of a run above which the
+	// massdns concurrency is halved
+	adaptiveBackoffRate = 0.10
+	// adaptiveRampRate is the failure rate of a run below which the
+	// massdns concurrency ramps back up towards the configured one
+	adaptiveRampRate = 0.02
+	// adaptiveMinThreads is the concurrency the backoff stops at
+	adaptiveMinThreads = 50
+)
+
+// massdnsThreads returns the concurrency of the next massdns run
+func (instance *Instance) massdnsThreads() int {
+	if threads := instance.threads.Load(); threads > 0 {
+		return int(threads)
+	}
+	return instance.options.Threads
+}
+
+// adaptThreads adjusts the concurrency of the next massdns runs to the
+// failure rate of the run on the input file: the queries answered with an
+// error such as SERVFAIL or REFUSED, and the ones which got no reply at all.
+// A spike halves the concurrency, a quiet run ramps it back up by half.
+func (instance *Instance) adaptThreads(inputFile string, replies ResolverReplies) {
+	names, err := countNames(inputFile)
+	if err != nil || names == 0 {
+		return
+	}
+	queries := names
+	if instance.options.DualStack {
+		queries *= 2
+	}
+	failures := replies.Errors + max(queries-replies.Answers-replies.Errors, 0)
+	rate := float64(failures) / float64(queries)
+
+	current := instance.massdnsThreads()
+	threads := current
+	switch {
+	case rate > adaptiveBackoffRate:
+		threads = max(current/2, min(adaptiveMinThreads, instance.options.Threads))
+	case rate < adaptiveRampRate:
+		threads = min(current+max(current/2, 1), instance.options.Threads)
+	}
+	if threads == current {
+		return
+	}
+	instance.threads.Store(int64(threads))
+	if threads < current {
+		instance.logger.Info().Msgf("%.1f%% of the queries failed or timed out, backing off to %d massdns threads\n", rate*100, threads)
+	} else {
+		instance.logger.Info().Msgf("%.1f%% of the queries failed or timed out, ramping up to %d massdns threads\n", rate*100, threads)
+	}
+}
+
+// countNames counts the names of an input file, one per line
+func countNames(inputFile string) (int64, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var names int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			names++
+		}
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,51 @@
+package massdns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountNames(t *testing.T) {
+	inputFile := filepath.Join(t.TempDir(), "input.txt")
+	require.Nil(t, os.WriteFile(inputFile, []byte("a.example.com\n\nb.example.com\n  \nc.example.com"), 0644), "Could not write input")
+
+	names, err := countNames(inputFile)
+	require.Nil(t, err, "Could not count names")
+	require.Equal(t, int64(3), names, "Got unexpected name count")
+}
+
+func TestAdaptThreads(t *testing.T) {
+	inputFile := filepath.Join(t.TempDir(), "input.txt")
+	require.Nil(t, os.WriteFile(inputFile, []byte(strings.Repeat("www.example.com\n", 100)), 0644), "Could not write input")
+
+	instance := &Instance{options: Options{Threads: 1000}, logger: gologger.DefaultLogger}
+	require.Equal(t, 1000, instance.massdnsThreads(), "Did not start with the configured threads")
+
+	// 30 errors and 20 names without reply
+	instance.adaptThreads(inputFile, ResolverReplies{Answers: 50, Errors: 30})
+	require.Equal(t, 500, instance.massdnsThreads(), "Did not back off on a spike")
+
+	// 5% failures is neither a spike nor quiet
+	instance.adaptThreads(inputFile, ResolverReplies{Answers: 95, Errors: 5})
+	require.Equal(t, 500, instance.massdnsThreads(), "Adapted threads on a moderate failure rate")
+
+	instance.adaptThreads(inputFile, ResolverReplies{Answers: 100})
+	require.Equal(t, 750, instance.massdnsThreads(), "Did not ramp up on a quiet run")
+	instance.adaptThreads(inputFile, ResolverReplies{Answers: 100})
+	require.Equal(t, 1000, instance.massdnsThreads(), "Ramped up over the configured threads")
+
+	for i := 0; i < 10; i++ {
+		instance.adaptThreads(inputFile, ResolverReplies{})
+	}
+	require.Equal(t, adaptiveMinThreads, instance.massdnsThreads(), "Backed off under the minimum threads")
+
+	// The AAAA queries are expected along with the A ones with dual stack
+	instance = &Instance{options: Options{Threads: 1000, DualStack: true}, logger: gologger.DefaultLogger}
+	instance.adaptThreads(inputFile, ResolverReplies{Answers: 100})
+	require.Equal(t, 500, instance.massdnsThreads(), "Did not count the AAAA queries without reply")
+}
@@ -0,0 +1,129 @@
+package massdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+)
+
+// SourceAXFR tags the hosts obtained from a zone transfer
+const SourceAXFR = "axfr"
+
+// axfrTimeout bounds the dial and every read of a zone transfer
+const axfrTimeout = 10 * time.Second
+
+// axfrPort is the port of the name servers the zones are transferred from
+var axfrPort = "53"
+
+// transferZones attempts zone transfers of the target domains against
+// their name servers and merges the records obtained into the store.
+// The transfers are only attempted by the first run of the instance.
+func (instance *Instance) transferZones(ctx context.Context, st store.Store) {
+	if instance.zonesTransferred {
+		return
+	}
+	instance.zonesTransferred = true
+
+	client, err := dnsclient.New(dnsclient.Options{Resolvers: instance.resolvers, QuestionTypes: []uint16{dns.TypeNS}, Proxy: instance.options.Proxy})
+	if err != nil {
+		instance.logger.Error().Msgf("Could not create dns resolver: %s\n", err)
+		return
+	}
+
+	for _, domain := range instance.options.Domains {
+		if ctx.Err() != nil {
+			return
+		}
+		instance.options.RateLimiter.Take()
+		resp, err := client.QueryOne(domain)
+		if err != nil || resp == nil || len(resp.NS) == 0 {
+			instance.logger.Debug().Msgf("No name servers found for %s\n", domain)
+			continue
+		}
+
+		for _, nameserver := range resp.NS {
+			records, err := instance.transferZone(domain, nameserver)
+			if err != nil {
+				instance.logger.Debug().Msgf("Zone transfer of %s refused by %s: %s\n", domain, nameserver, err)
+				continue
+			}
+			for _, record := range records {
+				if err := instance.storeRecord(st, record, SourceAXFR); err != nil {
+					instance.logger.Error().Msgf("Could not store zone transfer record: %s\n", err)
+				}
+			}
+			instance.logger.Info().Msgf("Zone transfer of %s allowed by %s, obtained %d hostnames\n", domain, nameserver, len(records))
+			// The other name servers serve the same zone
+			break
+		}
+	}
+}
+
+// transferZone transfers the zone of the domain from the name server and
+// returns the address and alias records of the hostnames below the domain
+func (instance *Instance) transferZone(domain, nameserver string) ([]*parser.Record, error) {
+	address := net.JoinHostPort(strings.TrimSuffix(nameserver, "."), axfrPort)
+
+	transfer := &dns.Transfer{DialTimeout: axfrTimeout, ReadTimeout: axfrTimeout}
+	if instance.options.Proxy != "" {
+		dialer, err := dnsclient.ParseProxy(instance.options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("could not dial through proxy: %w", err)
+		}
+		transfer.Conn = &dns.Conn{Conn: conn}
+	}
+
+	msg := &dns.Msg{}
+	msg.SetAxfr(dns.Fqdn(domain))
+	envelopes, err := transfer.In(msg, address)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*parser.Record)
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+		for _, rr := range envelope.RR {
+			hostname := strings.ToLower(strings.TrimSuffix(rr.Header().Name, "."))
+			// Wildcard records don't name actual hosts
+			if strings.HasPrefix(hostname, "*.") || (hostname != domain && !strings.HasSuffix(hostname, "."+domain)) {
+				continue
+			}
+
+			record, ok := records[hostname]
+			if !ok {
+				record = &parser.Record{Domain: hostname, Status: "NOERROR"}
+			}
+			switch rr := rr.(type) {
+			case *dns.A:
+				record.IPs = append(record.IPs, rr.A.String())
+			case *dns.AAAA:
+				record.IPs = append(record.IPs, rr.AAAA.String())
+			case *dns.CNAME:
+				record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(rr.Target, "."))
+			default:
+				continue
+			}
+			records[hostname] = record
+		}
+	}
+
+	result := make([]*parser.Record, 0, len(records))
+	for _, record := range records {
+		result = append(result, record)
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package massdns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startNameServer starts a name server delegated the zone and allowing its
+// transfer, on the same port over udp and tcp
+func startNameServer(t *testing.T, zone []string) string {
+	var records []dns.RR
+	for _, record := range zone {
+		rr, err := dns.NewRR(record)
+		require.Nil(t, err, "Could not parse zone record")
+		records = append(records, rr)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for name server")
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	require.Nil(t, err, "Could not listen for name server")
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		question := req.Question[0]
+		switch question.Qtype {
+		case dns.TypeNS:
+			rr, _ := dns.NewRR(question.Name + " 60 IN NS 127.0.0.1.")
+			resp.Answer = append(resp.Answer, rr)
+		case dns.TypeAXFR:
+			resp.Answer = records
+		default:
+			resp.Rcode = dns.RcodeRefused
+		}
+		_ = w.WriteMsg(resp)
+	})
+	for _, server := range []*dns.Server{{Listener: listener, Handler: handler}, {PacketConn: conn, Handler: handler}} {
+		server := server
+		go func() { _ = server.ActivateAndServe() }()
+		t.Cleanup(func() { _ = server.Shutdown() })
+	}
+	return listener.Addr().String()
+}
+
+func TestTransferZones(t *testing.T) {
+	// The hostnames of a zone allowing transfers are stored with their source
+	soa := "example.com. 60 IN SOA ns.example.com. admin.example.com. 1 60 60 60 60"
+	address := startNameServer(t, []string{
+		soa,
+		"www.example.com. 60 IN A 10.0.0.1",
+		"www.example.com. 60 IN AAAA 2001:db8::1",
+		"blog.example.com. 60 IN CNAME blogs.example.net.",
+		"*.wild.example.com. 60 IN A 10.0.0.2",
+		"mail.example.com. 60 IN MX 10 mx.example.net.",
+		soa,
+	})
+	_, port, err := net.SplitHostPort(address)
+	require.Nil(t, err, "Could not parse name server address")
+
+	builtin, builtinPort := trustedResolvers, axfrPort
+	trustedResolvers, axfrPort = []string{address}, port
+	t.Cleanup(func() { trustedResolvers, axfrPort = builtin, builtinPort })
+
+	instance, err := New(Options{
+		Domains:  []string{"example.com"},
+		TempDir:  t.TempDir(),
+		AXFR:     true,
+		NoStdout: true,
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+
+	st := store.NewMemory()
+	defer st.Close()
+	instance.transferZones(context.Background(), st)
+
+	www, err := st.GetHost("www.example.com")
+	require.Nil(t, err, "Could not get transferred host")
+	sort.Strings(www.IPs)
+	require.Equal(t, &store.Host{Status: "NOERROR", IPs: []string{"10.0.0.1", "2001:db8::1"}, Source: SourceAXFR}, www, "Got unexpected transferred host")
+	blog, err := st.GetHost("blog.example.com")
+	require.Nil(t, err, "Could not get transferred alias")
+	require.Equal(t, &store.Host{Status: "NOERROR", CNAMEs: []string{"blogs.example.net"}, Source: SourceAXFR}, blog, "Got unexpected transferred alias")
+	require.Equal(t, "www.example.com", st.GetHostnames("10.0.0.1"), "Transferred host was not indexed by ip")
+
+	for _, hostname := range []string{"*.wild.example.com", "mail.example.com"} {
+		_, err := st.GetHost(hostname)
+		require.NotNil(t, err, "Got unexpected transferred host %s", hostname)
+	}
+}
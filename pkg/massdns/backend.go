@@ -0,0 +1,409 @@
+package massdns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
+	"github.com/miekg/dns"
+	fileutil "github.com/projectdiscovery/utils/file"
+)
+
+// Backend resolves the hostnames of an input file, one per line
+type Backend interface {
+	// Name describes the backend in the logs and errors
+	Name() string
+	// Resolve resolves the hostnames of the input file, returning the
+	// records to onRecord from a single goroutine. Once ctx is done,
+	// the records resolved so far are returned without an error.
+	Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error
+}
+
+// Names of the built-in backends
+const (
+	// BackendMassdns resolves with the massdns binary
+	BackendMassdns = "massdns"
+	// BackendNative resolves with the built-in dns client
+	BackendNative = "native"
+	// BackendZDNS resolves with the zdns binary
+	BackendZDNS = "zdns"
+)
+
+// Backends are the built-in backends
+var Backends = []string{BackendMassdns, BackendNative, BackendZDNS}
+
+// backend returns the backend resolving the input of a run, hash being
+// the hash of the input when the run is resumable
+func (instance *Instance) backend(hash string) (Backend, error) {
+	switch {
+	case instance.options.CustomBackend != nil:
+		return instance.options.CustomBackend, nil
+	case instance.options.VerifyOnly:
+		client, err := instance.newVerifyClient()
+		if err != nil {
+			return nil, err
+		}
+		return &nativeBackend{instance: instance, client: client, verify: true}, nil
+	case instance.options.Backend == BackendNative:
+		return &nativeBackend{instance: instance}, nil
+	case instance.options.Backend == BackendZDNS:
+		return &zdnsBackend{instance: instance}, nil
+	default:
+		return &massdnsBackend{instance: instance, hash: hash}, nil
+	}
+}
+
+// massdnsResolvers returns the resolvers given to the resolution backends
+func (instance *Instance) massdnsResolvers() ([]string, error) {
+	resolversFile := instance.resolversFile
+	if resolversFile == "" {
+		resolversFile = instance.options.ResolversFile
+	}
+	resolvers, err := wildcards.LoadResolversFromFile(resolversFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load resolvers: %w", err)
+	}
+	if len(resolvers) == 0 {
+		return nil, ErrEmptyResolvers
+	}
+	return resolvers, nil
+}
+
+// massdnsBackend resolves with the massdns binary, keeping its output
+// in the run directory to resume the run
+type massdnsBackend struct {
+	instance *Instance
+	hash     string
+}
+
+// Name describes the backend
+func (b *massdnsBackend) Name() string {
+	return "massdns"
+}
+
+// Resolve runs massdns on the input file and parses its output
+func (b *massdnsBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	instance := b.instance
+	instance.reloadResolvers()
+
+	instance.options.Phases.Set(PhaseMassdns)
+	if len(instance.options.Domains) > 0 {
+		instance.logger.Info().Msgf("Executing massdns on %s\n", strings.Join(instance.options.Domains, ", "))
+	} else {
+		instance.logger.Info().Msgf("Executing massdns\n")
+	}
+
+	stdoutFile := ""
+	if b.hash != "" && fileutil.FileExists(instance.chunkPath(b.hash, ".massdns")) {
+		stdoutFile = instance.chunkPath(b.hash, ".massdns")
+		instance.logger.Info().Msgf("Reusing massdns output of a previous run: %s\n", stdoutFile)
+	} else {
+		// Create a temporary file for the massdns output
+		instance.logger.Info().Msgf("using massdns output directory: %s\n", instance.options.TempDir)
+		var (
+			stderrFile string
+			took       time.Duration
+			err        error
+		)
+		stdoutFile, stderrFile, took, err = instance.RunWithContext(ctx)
+		instance.logger.Info().Msgf("massdns output file: %s\n", stdoutFile)
+		instance.logger.Info().Msgf("massdns error file: %s\n", stderrFile)
+		if err != nil {
+			if ctx.Err() == nil {
+				return fmt.Errorf("%w: %s", ErrMassdnsFailed, err)
+			}
+			// The run was interrupted, keep what massdns resolved so far
+			instance.logger.Info().Msgf("Run interrupted, using partial massdns output\n")
+		}
+
+		instance.logger.Info().Msgf("Massdns execution took %s\n", took)
+
+		// Mark the massdns output of the chunk as completed
+		if b.hash != "" && ctx.Err() == nil {
+			if err := os.Rename(stdoutFile, instance.chunkPath(b.hash, ".massdns")); err != nil {
+				return fmt.Errorf("could not save massdns output: %w", err)
+			}
+			stdoutFile = instance.chunkPath(b.hash, ".massdns")
+		}
+	}
+
+	instance.options.Phases.Set(PhaseParse)
+	instance.logger.Info().Msgf("Started parsing massdns output\n")
+
+	now := time.Now()
+	if err := parser.ParseFileFormat(stdoutFile, onRecord, instance.massdnsFormat()); err != nil {
+		return fmt.Errorf("%w: %w", ErrParsePhase, err)
+	}
+	instance.logger.Info().Msgf("Massdns output parsing completed in %s\n", time.Since(now))
+
+	countReplies := instance.options.ResolverStats && instance.options.Counters != nil
+	if countReplies || instance.options.OnNXDomain != nil || instance.options.RetryTimeouts || instance.options.AdaptiveThreads {
+		replies, err := instance.parseReplies(stdoutFile, countReplies)
+		if err != nil {
+			instance.logger.Error().Msgf("Could not parse the replies of the resolvers: %s\n", err)
+		} else if instance.options.AdaptiveThreads && ctx.Err() == nil {
+			instance.adaptThreads(inputFile, replies)
+		}
+	}
+	return nil
+}
+
+// parseReplies counts the replies of the resolvers in the massdns output
+// if requested, reports the names which don't exist to OnNXDomain and
+// records the names which got a reply. The replies of all the resolvers
+// are returned.
+func (instance *Instance) parseReplies(outputFile string, countReplies bool) (ResolverReplies, error) {
+	var replies ResolverReplies
+	file, err := os.Open(outputFile)
+	if err != nil {
+		return replies, err
+	}
+	defer file.Close()
+
+	err = parser.ParseReplies(file, func(name, resolver, status string) {
+		if countReplies && resolver != "" {
+			instance.options.Counters.countReply(resolver, status)
+		}
+		switch status {
+		case "NOERROR", "NXDOMAIN":
+			replies.Answers++
+		default:
+			replies.Errors++
+		}
+		if status == "NXDOMAIN" && instance.options.OnNXDomain != nil {
+			instance.options.OnNXDomain(name)
+		}
+		instance.markReplied(name)
+	}, parser.ParseOption(instance.options.NDJSON))
+	return replies, err
+}
+
+// nativeBackend resolves with the built-in dns client, querying the
+// resolvers or, when verifying, the trusted resolvers
+type nativeBackend struct {
+	instance *Instance
+	client   dnsclient.Client
+	// verify keeps the hosts having the verified record types only
+	verify bool
+	// retry resolves the names left without reply with the given client
+	retry bool
+}
+
+// Name describes the backend
+func (b *nativeBackend) Name() string {
+	if b.verify || b.retry {
+		return "the trusted resolvers"
+	}
+	return "the native resolver"
+}
+
+// Resolve resolves the hostnames of the input file concurrently
+func (b *nativeBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	instance := b.instance
+	client := b.client
+	switch {
+	case b.verify:
+		instance.options.Phases.Set(PhaseVerify)
+	case b.retry:
+		instance.options.Phases.Set(PhaseMassdns)
+	default:
+		instance.reloadResolvers()
+		instance.options.Phases.Set(PhaseMassdns)
+
+		resolvers, err := instance.massdnsResolvers()
+		if err != nil {
+			return err
+		}
+		var questionTypes []uint16
+		if instance.options.DualStack {
+			questionTypes = []uint16{dns.TypeA, dns.TypeAAAA}
+		}
+		client, err = dnsclient.New(dnsclient.Options{
+			Resolvers:         resolvers,
+			QuestionTypes:     questionTypes,
+			Retries:           instance.options.Retries,
+			Timeout:           instance.options.VerifyTimeout,
+			ResolverRateLimit: instance.options.VerifyRateLimit,
+			Rotation:          instance.options.ResolverRotation,
+			MaxInFlight:       instance.options.ResolverMaxInFlight,
+			Proxy:             instance.options.Proxy,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create dns resolver: %w", err)
+		}
+	}
+	instance.logger.Info().Msgf("Started resolving with %s\n", b.Name())
+	now := time.Now()
+
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer file.Close()
+
+	hostnames := make(chan string)
+	records := make(chan *parser.Record)
+
+	// A single goroutine owns the store so that the ip index is consistent
+	var recordErr error
+	recordsDone := make(chan struct{})
+	go func() {
+		defer close(recordsDone)
+
+		for record := range records {
+			if err := onRecord(record); err != nil && recordErr == nil {
+				recordErr = err
+			}
+		}
+	}()
+
+	workers := instance.options.WildcardsThreads
+	if workers <= 0 {
+		workers = 1
+	}
+	var workersWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+
+			for hostname := range hostnames {
+				instance.options.RateLimiter.Take()
+				resp, err := client.QueryMultiple(hostname)
+				if err != nil {
+					if b.verify {
+						instance.verifyFailures.Add(1)
+					}
+					instance.logger.Debug().Msgf("could not resolve with %s: %s: %s\n", b.Name(), hostname, err)
+					continue
+				}
+				instance.markReplied(hostname)
+				if b.verify && instance.verifiedType(resp) == "" {
+					continue
+				}
+				record := &parser.Record{
+					Domain: hostname,
+					IPs:    append(append([]string{}, resp.A...), resp.AAAA...),
+					CNAMEs: resp.CNAME,
+					Status: resp.StatusCode,
+				}
+				// The ttl of the first answer, a zero ttl being indistinguishable from none
+				if resp.TTL > 0 {
+					ttl := int(resp.TTL)
+					record.TTL = &ttl
+				}
+				if record.Status == "NXDOMAIN" && instance.options.OnNXDomain != nil {
+					instance.options.OnNXDomain(hostname)
+				}
+				// Hosts without answers are kept when they exist, as massdns does
+				if len(record.IPs) == 0 && len(record.CNAMEs) == 0 && record.Status != "NOERROR" {
+					continue
+				}
+				records <- record
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && ctx.Err() == nil {
+		if hostname := strings.TrimSpace(scanner.Text()); hostname != "" {
+			hostnames <- hostname
+		}
+	}
+	close(hostnames)
+	workersWg.Wait()
+	close(records)
+	<-recordsDone
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read input file: %w", err)
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	instance.logger.Info().Msgf("Resolving with %s completed in %s\n", b.Name(), time.Since(now))
+	return nil
+}
+
+// zdnsBackend resolves with the zdns binary found in the path
+type zdnsBackend struct {
+	instance *Instance
+}
+
+// Name describes the backend
+func (b *zdnsBackend) Name() string {
+	return "zdns"
+}
+
+// Resolve runs zdns on the input file and parses its output
+func (b *zdnsBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	instance := b.instance
+	instance.reloadResolvers()
+
+	path, err := exec.LookPath("zdns")
+	if err != nil {
+		return ErrZDNSNotFound
+	}
+	resolvers, err := instance.massdnsResolvers()
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.CreateTemp(instance.options.TempDir, "zdns-output-")
+	if err != nil {
+		return fmt.Errorf("could not create temp file for zdns output: %w", err)
+	}
+	outputFile.Close()
+	defer os.Remove(outputFile.Name())
+
+	instance.options.Phases.Set(PhaseMassdns)
+	instance.logger.Info().Msgf("Executing zdns\n")
+	now := time.Now()
+
+	args := []string{"A", "--output-file", outputFile.Name(), "--name-servers", strings.Join(resolvers, ","), "--threads", strconv.Itoa(instance.options.Threads), "--retries", strconv.Itoa(instance.options.Retries)}
+	cmd := exec.CommandContext(ctx, path, args...)
+	detachProcess(cmd)
+
+	// zdns reads the hostnames from stdin, paced by the limiter
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("could not open zdns input: %w", err)
+	}
+	defer input.Close()
+	paced := instance.pacedInput()
+	if paced {
+		reader := instance.options.RateLimiter.Reader(input)
+		defer reader.Close()
+		cmd.Stdin = reader
+	} else {
+		cmd.Stdin = input
+	}
+
+	err = cmd.Run()
+	if !paced {
+		instance.countQueries(inputFile)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			return fmt.Errorf("%w: %s", ErrZDNSFailed, err)
+		}
+		// The run was interrupted, keep what zdns resolved so far
+		instance.logger.Info().Msgf("Run interrupted, using partial zdns output\n")
+	}
+	instance.logger.Info().Msgf("Zdns execution took %s\n", time.Since(now))
+
+	instance.options.Phases.Set(PhaseParse)
+	if err := parser.ParseFileFormat(outputFile.Name(), onRecord, parser.FormatZDNS); err != nil {
+		return fmt.Errorf("%w: %w", ErrParsePhase, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package massdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+)
+
+// cidrPresets are the named ranges accepted in place of a cidr
+var cidrPresets = map[string][]string{
+	"rfc1918":  {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+	"loopback": {"127.0.0.0/8", "::1/128"},
+	"bogons": {
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15",
+		"198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8", "2001:db8::/32",
+	},
+	// special-use are the bogons and the other ranges of the IANA special-purpose
+	// registries no public name should resolve into
+	"special-use": {
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "::ffff:0:0/96", "100::/64", "2001:db8::/32", "2002::/16",
+		"fc00::/7", "fe80::/10", "ff00::/8",
+	},
+}
+
+// ParseCIDRs parses a list of cidrs, ips and preset names (rfc1918, loopback, bogons, special-use)
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		ranges, ok := cidrPresets[strings.ToLower(value)]
+		if !ok {
+			ranges = []string{value}
+		}
+		for _, cidr := range ranges {
+			// A bare ip excludes only itself
+			if ip := net.ParseIP(cidr); ip != nil {
+				if ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %s: %w", value, err)
+			}
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+// matchExcludedIPs returns true if any ip of the host lands in an excluded range
+func (instance *Instance) matchExcludedIPs(host *store.Host) bool {
+	return matchNetworks(host, instance.excludeCIDRs)
+}
+
+// matchNetworks returns true if any ip of the host lands in one of the networks
+func matchNetworks(host *store.Host, networks []*net.IPNet) bool {
+	for _, value := range host.IPs {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			continue
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reservedIPs returns the ips of the host in the special-use ranges
+func (instance *Instance) reservedIPs(host *store.Host) []string {
+	var reserved []string
+	for _, value := range host.IPs {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			continue
+		}
+		if inNetworks(ip, instance.reservedCIDRs) {
+			reserved = append(reserved, value)
+		}
+	}
+	return reserved
+}
+
+// inNetworks returns true if the ip lands in one of the networks
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package massdns
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"golang.org/x/net/publicsuffix"
+)
+
+// recordThirdParties records the hostname under the apex domains of the
+// cnames of the host which are neither its own apex nor a target domain,
+// the services the host depends on
+func (instance *Instance) recordThirdParties(hostname string, host *store.Host) {
+	if len(host.CNAMEs) == 0 {
+		return
+	}
+	own, _ := serviceApex(hostname)
+
+	instance.thirdPartiesMutex.Lock()
+	defer instance.thirdPartiesMutex.Unlock()
+
+	for _, cname := range host.CNAMEs {
+		apex, err := serviceApex(strings.ToLower(cname))
+		if err != nil || apex == own || instance.inDomains(apex) {
+			continue
+		}
+		hostnames, ok := instance.thirdParties[apex]
+		if !ok {
+			hostnames = make(map[string]struct{})
+			instance.thirdParties[apex] = hostnames
+		}
+		hostnames[hostname] = struct{}{}
+	}
+}
+
+// serviceApex returns the apex domain of the name, or the private suffix
+// the name is under, such as github.io or herokuapp.com, naming the
+// service rather than its customer
+func serviceApex(name string) (string, error) {
+	if suffix, icann := publicsuffix.PublicSuffix(name); !icann && suffix != name && strings.Contains(suffix, ".") {
+		return suffix, nil
+	}
+	return publicsuffix.EffectiveTLDPlusOne(name)
+}
+
+// DumpCNAMEReportToFile writes the third-party apex domains the hosts have
+// cnames to, the most depended upon first, each followed by its hosts
+func (instance *Instance) DumpCNAMEReportToFile(filename string) error {
+	instance.thirdPartiesMutex.Lock()
+	defer instance.thirdPartiesMutex.Unlock()
+
+	apexes := make([]string, 0, len(instance.thirdParties))
+	for apex := range instance.thirdParties {
+		apexes = append(apexes, apex)
+	}
+	sort.Slice(apexes, func(i, j int) bool {
+		if len(instance.thirdParties[apexes[i]]) != len(instance.thirdParties[apexes[j]]) {
+			return len(instance.thirdParties[apexes[i]]) > len(instance.thirdParties[apexes[j]])
+		}
+		return apexes[i] < apexes[j]
+	})
+
+	var buffer strings.Builder
+	for _, apex := range apexes {
+		hostnames := make([]string, 0, len(instance.thirdParties[apex]))
+		for hostname := range instance.thirdParties[apex] {
+			hostnames = append(hostnames, hostname)
+		}
+		sort.Strings(hostnames)
+
+		fmt.Fprintf(&buffer, "%s %d\n", apex, len(hostnames))
+		for _, hostname := range hostnames {
+			buffer.WriteString("  " + hostname + "\n")
+		}
+	}
+	return os.WriteFile(filename, []byte(buffer.String()), 0o644)
+}
@@ -0,0 +1,38 @@
+package massdns
+
+import (
+	"net"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+)
+
+// crowdedIPs returns the ips hosting more hostnames than MaxHostsPerIP with
+// their number of hostnames, such as the parked domains and the wildcard
+// farms the wildcard detection let through, logging every one of them
+func (instance *Instance) crowdedIPs(st store.Store) map[string]int {
+	if instance.options.MaxHostsPerIP <= 0 {
+		return nil
+	}
+
+	crowded := make(map[string]int)
+	st.Iterate(func(ip string, hostnames []string, counter int) {
+		// The cnames are indexed along with the ips
+		if net.ParseIP(ip) == nil || counter <= instance.options.MaxHostsPerIP {
+			return
+		}
+		crowded[ip] = counter
+		instance.logger.Info().Msgf("Found %d hostnames resolving to %s, over the limit of %d hosts per ip\n", counter, ip, instance.options.MaxHostsPerIP)
+	})
+	return crowded
+}
+
+// crowdedOf returns the ips of the host among the crowded ips
+func crowdedOf(host *store.Host, crowded map[string]int) []string {
+	var ips []string
+	for _, ip := range host.IPs {
+		if _, ok := crowded[ip]; ok {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
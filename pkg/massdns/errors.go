@@ -0,0 +1,24 @@
+package massdns
+
+import "errors"
+
+// Errors returned by the instance, wrapped with their cause and
+// matched with errors.Is
+var (
+	// ErrEmptyInput is returned when the input file has no hostname to resolve
+	ErrEmptyInput = errors.New("blank input file specified")
+	// ErrEmptyResolvers is returned when no resolver is left to resolve with
+	ErrEmptyResolvers = errors.New("blank resolvers file")
+	// ErrZDNSNotFound is returned when the zdns backend can't find its binary
+	ErrZDNSNotFound = errors.New("could not find zdns binary")
+	// ErrMassdnsFailed is returned when massdns exits with an error
+	ErrMassdnsFailed = errors.New("could not execute massdns")
+	// ErrZDNSFailed is returned when zdns exits with an error
+	ErrZDNSFailed = errors.New("could not execute zdns")
+	// ErrParsePhase is returned when the resolution output can't be parsed
+	ErrParsePhase = errors.New("could not parse resolution output")
+	// ErrWildcardPhase is returned when the wildcards can't be filtered
+	ErrWildcardPhase = errors.New("could not filter wildcards")
+	// ErrOutputPhase is returned when the output can't be written
+	ErrOutputPhase = errors.New("could not write output")
+)
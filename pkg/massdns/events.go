@@ -0,0 +1,79 @@
+package massdns
+
+import (
+	"sort"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+)
+
+// DropReason is the reason a host was left out of the output
+type DropReason string
+
+// Reasons hosts are dropped for
+const (
+	// DropWildcard drops the hosts resolving only to wildcard ips
+	DropWildcard DropReason = "wildcard"
+	// DropScope drops the hosts out of the scope
+	DropScope DropReason = "scope"
+	// DropQuarantined drops the hosts answered by a quarantined resolver
+	DropQuarantined DropReason = "quarantined"
+	// DropFiltered drops the hosts not matching the answer filters
+	DropFiltered DropReason = "filtered"
+	// DropExcluded drops the hosts resolving into the excluded ranges
+	DropExcluded DropReason = "excluded"
+	// DropReserved drops the hosts answering with special-use addresses
+	DropReserved DropReason = "reserved"
+	// DropCrowded drops the hosts only resolving to ips hosting too many hostnames
+	DropCrowded DropReason = "crowded"
+	// DropUnverified drops the hosts the trusted resolvers did not confirm
+	DropUnverified DropReason = "unverified"
+	// DropUnchecked drops the hosts on ips whose wildcard check was interrupted
+	DropUnchecked DropReason = "unchecked"
+)
+
+// reportWildcard calls OnWildcard the first time the wildcard root is detected
+func (instance *Instance) reportWildcard(root string, ips map[string]struct{}) {
+	if instance.options.OnWildcard == nil || root == "" {
+		return
+	}
+	if _, reported := instance.wildcardRoots.LoadOrStore(root, struct{}{}); reported {
+		return
+	}
+	addresses := make([]string, 0, len(ips))
+	for ip := range ips {
+		addresses = append(addresses, ip)
+	}
+	sort.Strings(addresses)
+	instance.options.OnWildcard(root, addresses)
+}
+
+// reportDropped calls OnDropped for the host left out of the output
+func (instance *Instance) reportDropped(hostname string, reason DropReason) {
+	if instance.options.OnDropped != nil {
+		instance.options.OnDropped(hostname, reason)
+	}
+}
+
+// reportWildcardDrops calls OnDropped for the hostnames of the wildcard
+// ips which are left on no other ip once the wildcards are dropped, the
+// others being still written.
+func (instance *Instance) reportWildcardDrops(st store.Store, hostnames []string) {
+	if instance.options.OnDropped == nil || len(hostnames) == 0 {
+		return
+	}
+	dropped := make(map[string]struct{}, len(hostnames))
+	for _, hostname := range hostnames {
+		dropped[hostname] = struct{}{}
+	}
+	st.Iterate(func(ip string, hostnames []string, counter int) {
+		for _, hostname := range hostnames {
+			delete(dropped, hostname)
+		}
+	})
+	for _, hostname := range hostnames {
+		if _, ok := dropped[hostname]; ok {
+			delete(dropped, hostname)
+			instance.reportDropped(hostname, DropWildcard)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package massdns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/asn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/geoip"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	stringsutil "github.com/projectdiscovery/utils/strings"
+)
+
+// FilterableRcodes are the response codes hosts can be filtered on: the
+// replies without answers never reach the store, the NXDOMAIN ones only
+// with the cnames to missing names
+var FilterableRcodes = []string{"NOERROR", "NXDOMAIN"}
+
+// hasAnswerFilters returns true if any filter on the answers was requested
+func (instance *Instance) hasAnswerFilters() bool {
+	return len(instance.options.FilterRcodes) > 0 || instance.options.FilterCNAMEOnly || instance.options.MinIPs > 0 || instance.options.MinTTL > 0 || instance.options.MaxTTL > 0 || len(instance.excludeCIDRs) > 0 || len(instance.matchCIDRs) > 0 || len(instance.matchASN) > 0 || len(instance.filterASN) > 0 || instance.options.CloudOnly || instance.options.NonCloudOnly
+}
+
+// matchAnswerFilters returns true if the answer details of a hostname
+// satisfy all the filters requested by the user.
+func (instance *Instance) matchAnswerFilters(host *store.Host) bool {
+	if len(instance.options.FilterRcodes) > 0 && !stringsutil.EqualFoldAny(host.Status, instance.options.FilterRcodes...) {
+		return false
+	}
+	if instance.options.FilterCNAMEOnly && len(host.CNAMEs) == 0 {
+		return false
+	}
+	if instance.options.MinIPs > 0 && len(host.IPs) < instance.options.MinIPs {
+		return false
+	}
+	// The hosts whose ttl is unknown can't satisfy the ttl filters
+	if (instance.options.MinTTL > 0 || instance.options.MaxTTL > 0) && host.TTL == nil {
+		return false
+	}
+	if instance.options.MinTTL > 0 && *host.TTL < instance.options.MinTTL {
+		return false
+	}
+	if instance.options.MaxTTL > 0 && *host.TTL > instance.options.MaxTTL {
+		return false
+	}
+	if len(instance.matchCIDRs) > 0 && !matchNetworks(host, instance.matchCIDRs) {
+		return false
+	}
+	if (len(instance.matchASN) > 0 || len(instance.filterASN) > 0) && !instance.matchASNFilters(host) {
+		return false
+	}
+	if instance.options.CloudOnly || instance.options.NonCloudOnly {
+		_, cloud := instance.cloudProvider(host)
+		if cloud != instance.options.CloudOnly {
+			return false
+		}
+	}
+	return true
+}
+
+// matchASNFilters returns true if any ip of the host is announced by a
+// matched asn, if any, and none of them by a filtered one.
+func (instance *Instance) matchASNFilters(host *store.Host) bool {
+	matched := len(instance.matchASN) == 0
+	for _, ip := range host.IPs {
+		number, ok := instance.asnDB.Lookup(ip)
+		if !ok {
+			continue
+		}
+		if _, ok := instance.filterASN[number]; ok {
+			return false
+		}
+		if _, ok := instance.matchASN[number]; ok {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// loadASNFilters loads the asn dataset and the asns to match and filter
+func (instance *Instance) loadASNFilters() error {
+	var err error
+	if instance.matchASN, err = parseASNs(instance.options.MatchASN); err != nil {
+		return err
+	}
+	if instance.filterASN, err = parseASNs(instance.options.FilterASN); err != nil {
+		return err
+	}
+	instance.asnDB, err = asn.Load(instance.options.ASNDatabase)
+	if err != nil {
+		return fmt.Errorf("could not load asn database: %w", err)
+	}
+	return nil
+}
+
+// parseASNs parses a list of asns into a set
+func parseASNs(values []string) (map[uint32]struct{}, error) {
+	asns := make(map[uint32]struct{}, len(values))
+	for _, value := range values {
+		number, err := asn.ParseASN(value)
+		if err != nil {
+			return nil, err
+		}
+		asns[number] = struct{}{}
+	}
+	return asns, nil
+}
+
+// cloudProvider returns the cloud provider hosting any ip of the host
+func (instance *Instance) cloudProvider(host *store.Host) (string, bool) {
+	for _, ip := range host.IPs {
+		if provider, ok := instance.cdnMatcher.Cloud(ip); ok {
+			return provider, true
+		}
+	}
+	return "", false
+}
+
+// needsHost returns true if the output needs the answer details of the hosts
+func (instance *Instance) needsHost() bool {
+	return instance.hasAnswerFilters() || instance.options.Json || instance.options.AXFR || instance.options.Takeover || instance.cdnMatcher != nil || instance.options.ASNInfo || instance.geoDB != nil || instance.options.QuarantineResolvers || instance.options.OnResult != nil || len(instance.options.Sinks) > 0 || instance.options.FlagReserved || instance.options.DropReserved || instance.options.Rebinding || instance.options.MaxHostsPerIP > 0 || instance.options.CNAMEReport || instance.options.DualStack
+}
+
+// asnInfo returns the autonomous systems announcing the ips of the host
+func (instance *Instance) asnInfo(host *store.Host) []IPASN {
+	var infos []IPASN
+	for _, ip := range host.IPs {
+		if info, ok := instance.asnDB.LookupInfo(ip); ok {
+			infos = append(infos, IPASN{IP: ip, Info: info})
+		}
+	}
+	return infos
+}
+
+// geoInfo returns the locations of the ips of the host
+func (instance *Instance) geoInfo(host *store.Host) []IPLocation {
+	var locations []IPLocation
+	for _, ip := range host.IPs {
+		if location, ok := instance.geoDB.Lookup(ip); ok {
+			locations = append(locations, IPLocation{IP: ip, Location: location})
+		}
+	}
+	return locations
+}
+
+// IPLocation is the location of an ip
+type IPLocation struct {
+	IP string `json:"ip"`
+	geoip.Location
+}
+
+// IPASN is the autonomous system announcing an ip
+type IPASN struct {
+	IP string `json:"ip"`
+	asn.Info
+}
+
+// matchScope returns true if the hostname is in the scope, within the
+// depth limits and matches one of the match regular expressions, if any,
+// and none of the filter ones.
+func (instance *Instance) matchScope(hostname string) bool {
+	if !instance.options.Scope.Match(hostname) {
+		return false
+	}
+	if instance.options.MinDepth > 0 || instance.options.MaxDepth > 0 {
+		depth := instance.depth(hostname)
+		if depth < instance.options.MinDepth || (instance.options.MaxDepth > 0 && depth > instance.options.MaxDepth) {
+			return false
+		}
+	}
+	for _, re := range instance.filterRegex {
+		if re.MatchString(hostname) {
+			return false
+		}
+	}
+	if len(instance.matchRegex) == 0 {
+		return true
+	}
+	for _, re := range instance.matchRegex {
+		if re.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// depth returns the number of labels of the hostname below the longest
+// domain it belongs to, 0 for a domain itself, or all its labels if it
+// belongs to none
+func (instance *Instance) depth(hostname string) int {
+	var matched string
+	for _, domain := range instance.options.Domains {
+		if hostname == domain {
+			return 0
+		}
+		if strings.HasSuffix(hostname, "."+domain) && len(domain) > len(matched) {
+			matched = domain
+		}
+	}
+	if matched == "" {
+		return strings.Count(hostname, ".") + 1
+	}
+	return strings.Count(strings.TrimSuffix(hostname, "."+matched), ".") + 1
+}
+
+// inDomains tells whether the hostname is one of the target domains or below one
+func (instance *Instance) inDomains(hostname string) bool {
+	for _, domain := range instance.options.Domains {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRegexes compiles the regular expressions of a scope filter
+func compileRegexes(expressions []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %s: %w", expression, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
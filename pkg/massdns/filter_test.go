@@ -0,0 +1,39 @@
+package massdns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepth(t *testing.T) {
+	instance := &Instance{options: Options{Domains: []string{"example.com", "dev.example.com"}}}
+
+	tests := []struct {
+		hostname string
+		depth    int
+	}{
+		{"example.com", 0},
+		{"www.example.com", 1},
+		{"a.b.example.com", 2},
+		{"dev.example.com", 0},
+		{"api.dev.example.com", 1},
+		{"x.api.dev.example.com", 2},
+		{"www.example.org", 3},
+		{"notexample.com", 2},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.depth, instance.depth(test.hostname), "Got wrong depth of %s", test.hostname)
+	}
+}
+
+func TestMatchScopeDepth(t *testing.T) {
+	instance := &Instance{options: Options{Domains: []string{"example.com"}, MaxDepth: 1}}
+	require.True(t, instance.matchScope("example.com"), "Apex dropped by -max-depth 1")
+	require.True(t, instance.matchScope("www.example.com"), "Subdomain dropped by -max-depth 1")
+	require.False(t, instance.matchScope("a.b.example.com"), "Nested subdomain kept by -max-depth 1")
+
+	instance = &Instance{options: Options{Domains: []string{"example.com"}, MinDepth: 1}}
+	require.False(t, instance.matchScope("example.com"), "Apex kept by -min-depth 1")
+	require.True(t, instance.matchScope("www.example.com"), "Subdomain dropped by -min-depth 1")
+}
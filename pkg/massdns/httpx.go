@@ -0,0 +1,83 @@
+package massdns
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/miekg/dns"
+)
+
+// httpxTargets returns the probing targets for a hostname in a format
+// accepted by httpx. If HTTPS records advertised any port, host:port
+// pairs are returned, otherwise both the https and http urls.
+func httpxTargets(hostname string, ports []uint16) []string {
+	if len(ports) == 0 {
+		return []string{"https://" + hostname, "http://" + hostname}
+	}
+
+	targets := make([]string, 0, len(ports))
+	for _, port := range ports {
+		targets = append(targets, net.JoinHostPort(hostname, strconv.Itoa(int(port))))
+	}
+	return targets
+}
+
+// HTTPSHints are the service parameters advertised by the HTTPS records of a host
+type HTTPSHints struct {
+	// ALPN are the application protocols supported (eg. h2, h3)
+	ALPN []string `json:"alpn,omitempty"`
+	// Ports are the ports the service listens on instead of 443
+	Ports []uint16 `json:"ports,omitempty"`
+	// ECH is set when an encrypted client hello configuration is published
+	ECH bool `json:"ech,omitempty"`
+}
+
+// lookupHTTPSPorts returns the unique ports advertised by the HTTPS records of a hostname
+func lookupHTTPSPorts(client dnsclient.Client, hostname string) []uint16 {
+	if hints := lookupHTTPSHints(client, hostname); hints != nil {
+		return hints.Ports
+	}
+	return nil
+}
+
+// lookupHTTPSHints returns the unique alpn protocols and ports and the ech
+// support advertised by the HTTPS records of a hostname, nil without any
+func lookupHTTPSHints(client dnsclient.Client, hostname string) *HTTPSHints {
+	resp, err := client.QueryOne(hostname)
+	if err != nil || resp == nil || resp.RawResp == nil {
+		return nil
+	}
+
+	hints := &HTTPSHints{}
+	seenALPN := make(map[string]struct{})
+	seenPorts := make(map[uint16]struct{})
+	for _, rr := range resp.RawResp.Answer {
+		https, ok := rr.(*dns.HTTPS)
+		if !ok {
+			continue
+		}
+		for _, kv := range https.Value {
+			switch value := kv.(type) {
+			case *dns.SVCBAlpn:
+				for _, alpn := range value.Alpn {
+					if _, ok := seenALPN[alpn]; !ok {
+						seenALPN[alpn] = struct{}{}
+						hints.ALPN = append(hints.ALPN, alpn)
+					}
+				}
+			case *dns.SVCBPort:
+				if _, ok := seenPorts[value.Port]; !ok {
+					seenPorts[value.Port] = struct{}{}
+					hints.Ports = append(hints.Ports, value.Port)
+				}
+			case *dns.SVCBECHConfig:
+				hints.ECH = true
+			}
+		}
+	}
+	if len(hints.ALPN) == 0 && len(hints.Ports) == 0 && !hints.ECH {
+		return nil
+	}
+	return hints
+}
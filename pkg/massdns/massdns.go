@@ -1,16 +1,122 @@
 package massdns
 
 import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/asn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/cdn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/geoip"
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+	"github.com/ShlomieLiberow/shuffledns/pkg/scope"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
 	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
-	"github.com/projectdiscovery/retryabledns"
+	"github.com/projectdiscovery/gologger"
 )
 
 type Instance struct {
 	options Options
 
+	// logger logs the progress of the runs
+	logger *gologger.Logger
+
 	wildcardStore *wildcards.Store
 
 	wildcardResolver *wildcards.Resolver
+
+	// resolvers are the trusted resolvers used for native lookups
+	resolvers []string
+
+	// outputCreated is set once the output file has been created by a run
+	outputCreated bool
+
+	// matchRegex and filterRegex are the compiled hostname scope filters
+	matchRegex  []*regexp.Regexp
+	filterRegex []*regexp.Regexp
+
+	// excludeCIDRs are the ranges hosts must not resolve into
+	excludeCIDRs []*net.IPNet
+	// matchCIDRs are the ranges hosts must resolve into, if any
+	matchCIDRs []*net.IPNet
+	// reservedCIDRs are the special-use ranges flagged or dropped hosts resolve
+	// into, and rebinding hosts flip to
+	reservedCIDRs []*net.IPNet
+
+	// thirdParties are the hostnames by third-party apex domain their cnames
+	// point to, reported with CNAMEReport
+	thirdParties      map[string]map[string]struct{}
+	thirdPartiesMutex sync.Mutex
+
+	// replied are the names of the input which got a reply, with RetryTimeouts
+	replied      map[string]struct{}
+	repliedMutex sync.Mutex
+
+	// threads is the concurrency of the next massdns run, adapted to the
+	// failure rate of the previous ones with AdaptiveThreads
+	threads atomic.Int64
+
+	// crowdedHosts counts the hosts resolving to ips over MaxHostsPerIP
+	crowdedHosts atomic.Int64
+	// rebindingHosts counts the hosts whose answers flip between public and
+	// special-use addresses
+	rebindingHosts atomic.Int64
+	// reservedHosts counts the hosts answering with special-use addresses
+	reservedHosts atomic.Int64
+	// reserved are the special-use addresses of the hosts answering with some,
+	// by hostname, dumped to a separate file
+	reserved      map[string][]string
+	reservedMutex sync.Mutex
+
+	// geoDB maps the ips to their location
+	geoDB *geoip.Database
+
+	// cdnMatcher maps the ips to the cdn, waf and cloud providers serving them
+	cdnMatcher *cdn.Matcher
+
+	// asnDB maps the ips to the asns matched, filtered and annotated
+	asnDB     *asn.Database
+	matchASN  map[uint32]struct{}
+	filterASN map[uint32]struct{}
+
+	// verifyFailures counts the hosts the trusted resolvers failed to answer
+	verifyFailures atomic.Int64
+
+	// bogusHosts counts the hosts whose answers failed the DNSSEC validation
+	bogusHosts atomic.Int64
+
+	// ipv6OnlyHosts counts the hosts only resolving to ipv6 addresses
+	ipv6OnlyHosts atomic.Int64
+
+	// takeoverCandidates counts the hosts flagged as takeover candidates
+	takeoverCandidates atomic.Int64
+
+	// quarantinedResolvers are the resolvers whose answers disagree with
+	// the trusted resolvers, by address as massdns reports them
+	quarantinedResolvers map[string]struct{}
+
+	// quarantinedHosts counts the hosts dropped as answered by a quarantined resolver
+	quarantinedHosts atomic.Int64
+
+	// wildcardRoots are the wildcard roots reported to OnWildcard
+	wildcardRoots sync.Map
+
+	// registeredDomains caches whether the base domains of name servers are registered
+	registeredDomains sync.Map
+
+	// resolversFile is the copy of the resolvers file given to massdns,
+	// refreshed when the resolvers are reloaded
+	resolversFile       string
+	resolversGeneration int64
+	resolversLoaded     time.Time
+
+	// zonesTransferred is set once the zone transfers have been attempted
+	zonesTransferred bool
 }
 
 type Options struct {
@@ -34,47 +140,300 @@ type Options struct {
 	OutputFile string
 	// Json is format ouput to ndjson format
 	Json bool
+	// HttpxOutput formats output as urls ready to be probed by httpx
+	HttpxOutput bool
+	// HTTPSHints annotates the hosts with the alpn, ports and ech advertised by their HTTPS records in the json output
+	HTTPSHints bool
 	// WildcardsThreads is the number of wildcards concurrent threads
 	WildcardsThreads int
 	// MassdnsRaw perform wildcards filtering from an existing massdns output file
 	MassdnsRaw string
+	// RawInputFormat is the registered parser format of MassdnsRaw, the
+	// massdns output format being used if empty
+	RawInputFormat string
 	// StrictWildcard controls whether the wildcard check should be performed on each result
 	StrictWildcard bool
 	// WildcardOutputFile is the file where the list of wildcards is dumped
 	WildcardOutputFile string
 	// MassDnsCmd supports massdns flags
 	MassDnsCmd string
+	// FilterRcodes only outputs hosts whose reply has one of the response
+	// codes, among the ones of replies with answers in FilterableRcodes
+	FilterRcodes []string
+	// FilterCNAMEOnly only outputs hosts having a CNAME record
+	FilterCNAMEOnly bool
+	// MinIPs only outputs hosts resolving to at least this number of ips
+	MinIPs int
+	// MinTTL only outputs hosts whose lowest answer ttl is at least this number of seconds
+	MinTTL int
+	// MaxTTL only outputs hosts whose lowest answer ttl is at most this number of seconds
+	MaxTTL int
+	// MatchRegex only outputs hostnames matching one of the regular expressions
+	MatchRegex []string
+	// FilterRegex never outputs hostnames matching one of the regular expressions
+	FilterRegex []string
+	// Scope only outputs the hostnames matching its patterns, if any
+	Scope *scope.Scope
+	// MinDepth only outputs hostnames with at least this number of labels below their domain
+	MinDepth int
+	// MaxDepth only outputs hostnames with at most this number of labels below their domain
+	MaxDepth int
+	// ExcludeIPCIDRs are the ranges (or presets) hosts must not resolve into
+	ExcludeIPCIDRs []string
+	// MatchIPCIDRs only outputs hosts resolving into one of the ranges (or presets)
+	MatchIPCIDRs []string
+	// FlagExcluded flags the hosts resolving into excluded ranges instead of dropping them
+	FlagExcluded bool
+	// FlagReserved tags the hosts answering with loopback, link-local, private
+	// or other special-use addresses
+	FlagReserved bool
+	// DropReserved drops the hosts answering with special-use addresses
+	DropReserved bool
+	// MaxHostsPerIP drops the hosts only resolving to ips hosting more
+	// hostnames, whether wildcards or not (0 = unlimited)
+	MaxHostsPerIP int
+	// FlagCrowded tags the hosts resolving to ips over MaxHostsPerIP instead of dropping them
+	FlagCrowded bool
+	// RetryTimeouts resolves the names which got no reply at all with the
+	// trusted resolvers at a conservative rate before dropping them
+	RetryTimeouts bool
+	// AdaptiveThreads halves the concurrency of the next massdns runs when
+	// the failure rate of a run spikes, ramping it back up to Threads
+	AdaptiveThreads bool
+	// CNAMEReport records the third-party apex domains the cnames of the
+	// written hosts point to, for DumpCNAMEReportToFile
+	CNAMEReport bool
+	// Rebinding re-resolves the hosts and flags the ones whose answers flip
+	// between public and special-use addresses in the json output
+	Rebinding bool
+	// MatchASN only outputs hosts resolving into one of the asns
+	MatchASN []string
+	// FilterASN never outputs hosts resolving into one of the asns
+	FilterASN []string
+	// ASNInfo annotates the ips with their asn and org in the json output
+	ASNInfo bool
+	// ASNDatabase is the offline ip to asn dataset
+	ASNDatabase string
+	// GeoIPDatabase is the MaxMind database annotating the ips with their location
+	GeoIPDatabase string
+	// CDN tags the hosts served by a cdn, waf or cloud provider in the json output
+	CDN bool
+	// Cloud tags the hosts whose ips are in the ranges of a cloud provider in the json output
+	Cloud bool
+	// CloudOnly only outputs the hosts whose ips are in the ranges of a cloud provider
+	CloudOnly bool
+	// NonCloudOnly never outputs the hosts whose ips are in the ranges of a cloud provider
+	NonCloudOnly bool
+	// CDNRanges is the file of extra provider ranges, taking precedence over the bundled ones
+	CDNRanges string
+	// AppendOutput appends to the output file instead of truncating it
+	AppendOutput bool
+	// OutputBufferSize is the size in bytes of the buffer of the output file, the default size being used if 0
+	OutputBufferSize int
+	// FlushInterval flushes the sinks at the interval while writing the results, 0 flushing them at the end of the runs only
+	FlushInterval time.Duration
+	// AXFR attempts zone transfers against the name servers of the domains
+	AXFR bool
+	// DNSSEC validates the results with the trusted resolvers, tagging the bogus ones
+	DNSSEC bool
+	// QuarantineResolvers drops the answers of the resolvers disagreeing with the trusted resolvers
+	QuarantineResolvers bool
+	// Takeover flags the hosts whose cname is dangling or points to a takeover-prone service, or delegated to unregistered name servers
+	Takeover bool
+	// DualStack resolves the AAAA records along with the A records, tagging the hosts only resolving to ipv6 addresses
+	DualStack bool
+	// Backend is the built-in backend resolving the input (massdns, native or zdns)
+	Backend string
+	// CustomBackend resolves the input instead of the built-in backends
+	CustomBackend Backend
+	// VerifyOnly resolves the input with the trusted resolvers instead of massdns
+	VerifyOnly bool
+	// Verify re-resolves the results with the trusted resolvers, or the built-in ones without trusted resolvers
+	Verify bool
+	// VerifyTypes are the record types accepted by the trusted verification, a and cname by default
+	VerifyTypes []string
+	// VerifyRetries is the number of retries of the trusted verification queries
+	VerifyRetries int
+	// VerifyTimeout bounds a trusted verification query
+	VerifyTimeout time.Duration
+	// VerifyRateLimit is the max queries per second sent to each trusted resolver
+	VerifyRateLimit int
+	// ResolverRotation is the policy choosing the trusted resolver of each native query
+	ResolverRotation string
+	// ResolverMaxInFlight is the max number of concurrent native queries sent to each trusted resolver
+	ResolverMaxInFlight int
+	// Proxy is the socks5 or http proxy the native dns queries are sent through
+	Proxy string
+	// RateLimiter paces and pauses all the dns queries of the enumeration
+	RateLimiter *ratelimit.Limiter
+	// Pausable feeds the input of massdns and zdns through the RateLimiter
+	// even when unlimited, so that pausing it holds their queries
+	Pausable bool
+	// RunDir is the directory persisting the state of the enumeration to resume it
+	RunDir string
+	// Logger logs the progress of the runs, gologger's default logger being used if nil
+	Logger *gologger.Logger
+	// WildcardStore caches the wildcard ips, shared by the instances given
+	// the same store, a new store being created if nil
+	WildcardStore *wildcards.Store
+	// TrustedClient sends the wildcard queries instead of a new client of the trusted resolvers
+	TrustedClient dnsclient.Client
+	// ReloadSignal requests the reload of the resolvers of the instances given the same signal
+	ReloadSignal *ReloadSignal
+	// Counters count the work of the instance, none being counted if nil
+	Counters *Counters
+	// Phases tracks the pipeline phase of the instance, none being tracked if nil
+	Phases *Phases
+	// ResolverStats counts the replies of every resolver in the massdns output in the Counters
+	ResolverStats bool
 
 	NDJSON bool
 
-	OnResult func(*retryabledns.DNSData)
+	// OnResult is called for every result written to the output
+	OnResult func(*Result)
+	// OnHostname is called for every hostname written to the output
+	OnHostname func(hostname string)
+	// OnWildcard is called once for every wildcard root detected with the
+	// wildcard ips it answered, possibly concurrently
+	OnWildcard func(root string, ips []string)
+	// OnDropped is called for every host left out of the output, possibly concurrently
+	OnDropped func(hostname string, reason DropReason)
+	// OnNXDomain is called for every name answered NXDOMAIN in the massdns output
+	OnNXDomain func(hostname string)
+	// NewStore creates the store of the answers of every massdns run,
+	// a leveldb store in the temporary directory being used if nil
+	NewStore func() (store.Store, error)
+	// NoStdout doesn't print the results to stdout
+	NoStdout bool
+	// OutputWriter is written the results along with the output file
+	OutputWriter io.Writer
+	// Sinks are written the results along with the output file, flushed
+	// at the end of every run and left open
+	Sinks []OutputSink
 }
 
 func New(options Options) (*Instance, error) {
-	var resolvers []string
-	if options.TrustedResolvers != "" {
-		var err error
-		resolvers, err = wildcards.LoadResolversFromFile(options.TrustedResolvers)
-		if err != nil {
+	resolvers, err := loadTrustedResolvers(options.TrustedResolvers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a resolver and load resolverrs from list
+	client := options.TrustedClient
+	if client == nil {
+		if client, err = newTrustedClient(resolvers, options.Retries, options.Proxy); err != nil {
 			return nil, err
 		}
-	} else {
-		resolvers = trustedResolvers
 	}
+	resolver := wildcards.NewResolverWithClient(options.Domains, client)
 
-	// Create a resolver and load resolverrs from list
-	resolver, err := wildcards.NewResolver(options.Domains, options.Retries, resolvers)
-	if err != nil {
-		return nil, err
+	logger := options.Logger
+	if logger == nil {
+		logger = gologger.DefaultLogger
 	}
+	resolver.SetRateLimiter(options.RateLimiter)
+	resolver.SetLogger(logger)
 
-	wildcardStore := wildcards.NewStore()
+	wildcardStore := options.WildcardStore
+	if wildcardStore == nil {
+		wildcardStore = wildcards.NewStore()
+	}
 
 	instance := &Instance{
-		options:          options,
-		wildcardStore:    wildcardStore,
-		wildcardResolver: resolver,
+		options:              options,
+		logger:               logger,
+		wildcardStore:        wildcardStore,
+		wildcardResolver:     resolver,
+		resolvers:            resolvers,
+		outputCreated:        options.AppendOutput,
+		thirdParties:         make(map[string]map[string]struct{}),
+		replied:              make(map[string]struct{}),
+		quarantinedResolvers: make(map[string]struct{}),
+	}
+
+	if instance.matchRegex, err = compileRegexes(options.MatchRegex); err != nil {
+		return nil, err
+	}
+	if instance.filterRegex, err = compileRegexes(options.FilterRegex); err != nil {
+		return nil, err
+	}
+
+	if instance.excludeCIDRs, err = ParseCIDRs(options.ExcludeIPCIDRs); err != nil {
+		return nil, err
+	}
+	if instance.matchCIDRs, err = ParseCIDRs(options.MatchIPCIDRs); err != nil {
+		return nil, err
+	}
+	if options.FlagReserved || options.DropReserved || options.Rebinding {
+		if instance.reservedCIDRs, err = ParseCIDRs([]string{"special-use"}); err != nil {
+			return nil, err
+		}
+		instance.reserved = make(map[string][]string)
+	}
+
+	if len(options.MatchASN) > 0 || len(options.FilterASN) > 0 || options.ASNInfo {
+		if err := instance.loadASNFilters(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.GeoIPDatabase != "" {
+		if instance.geoDB, err = geoip.Load(options.GeoIPDatabase); err != nil {
+			return nil, fmt.Errorf("could not load geoip database: %w", err)
+		}
+	}
+
+	if options.CDN || options.Cloud || options.CloudOnly || options.NonCloudOnly {
+		instance.cdnMatcher = cdn.New()
+		if options.CDNRanges != "" {
+			if err := instance.cdnMatcher.Load(options.CDNRanges); err != nil {
+				return nil, fmt.Errorf("could not load cdn ranges: %w", err)
+			}
+		}
+	}
+
+	if options.RunDir != "" {
+		if err := instance.loadRunState(); err != nil {
+			return nil, err
+		}
 	}
 
 	return instance, nil
 }
+
+// NewTrustedClient creates the client of the trusted resolvers sending the
+// wildcard queries, to be shared by the instances with TrustedClient.
+// The built-in trusted resolvers are used if the file is empty.
+func NewTrustedClient(trustedResolversFile string, retries int, proxy string) (dnsclient.Client, error) {
+	resolvers, err := loadTrustedResolvers(trustedResolversFile)
+	if err != nil {
+		return nil, err
+	}
+	return newTrustedClient(resolvers, retries, proxy)
+}
+
+// loadTrustedResolvers reads the trusted resolvers file, returning the
+// built-in trusted resolvers if it is empty
+func loadTrustedResolvers(file string) ([]string, error) {
+	if file == "" {
+		return trustedResolvers, nil
+	}
+	return wildcards.LoadResolversFromFile(file)
+}
+
+// newTrustedClient creates the client sending the wildcard queries to the resolvers
+func newTrustedClient(resolvers []string, retries int, proxy string) (dnsclient.Client, error) {
+	client, err := dnsclient.New(dnsclient.Options{Resolvers: resolvers, Retries: retries, Proxy: proxy})
+	if err != nil {
+		return nil, fmt.Errorf("could not create dns resolver: %w", err)
+	}
+	return client, nil
+}
+
+// newStore creates the store of the answers of a massdns run
+func (instance *Instance) newStore() (store.Store, error) {
+	if instance.options.NewStore != nil {
+		return instance.options.NewStore()
+	}
+	return store.New(instance.options.TempDir)
+}
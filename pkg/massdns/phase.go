@@ -0,0 +1,80 @@
+package massdns
+
+import (
+	"sync"
+)
+
+// Phase identifies a step of the enumeration pipeline
+type Phase string
+
+const (
+	PhaseGenerate Phase = "generate"
+	PhaseMassdns  Phase = "massdns"
+	PhaseVerify   Phase = "verify"
+	PhaseParse    Phase = "parse"
+	PhaseWildcard Phase = "wildcard"
+	PhaseOutput   Phase = "output"
+)
+
+// Phases tracks the pipeline phase of the instances given it with the
+// options, eg. the instances of a single enumeration, leaving the other
+// instances alone.
+type Phases struct {
+	mutex    sync.Mutex
+	current  Phase
+	watchers map[int]func(Phase)
+	next     int
+}
+
+// Set marks the pipeline phase currently being executed
+func (p *Phases) Set(phase Phase) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if p.current == phase {
+		p.mutex.Unlock()
+		return
+	}
+	p.current = phase
+	callbacks := make([]func(Phase), 0, len(p.watchers))
+	for _, callback := range p.watchers {
+		callbacks = append(callbacks, callback)
+	}
+	p.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(phase)
+	}
+}
+
+// Watch calls the callback with every new phase until stop is called
+func (p *Phases) Watch(callback func(Phase)) (stop func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.watchers == nil {
+		p.watchers = make(map[int]func(Phase))
+	}
+	id := p.next
+	p.next++
+	p.watchers[id] = callback
+	return func() {
+		p.mutex.Lock()
+		delete(p.watchers, id)
+		p.mutex.Unlock()
+	}
+}
+
+// Current returns the pipeline phase currently being executed, none if
+// the phases are nil
+func (p *Phases) Current() Phase {
+	if p == nil {
+		return ""
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.current
+}
@@ -0,0 +1,173 @@
+package massdns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/remeh/sizedwaitgroup"
+)
+
+// poisoningSamples is the number of answers of each resolver compared
+// with the trusted resolvers
+const poisoningSamples = 5
+
+// poisoningMinSamples is the number of compared answers needed to judge a resolver
+const poisoningMinSamples = 3
+
+// poisoningRatio is the rate of disagreeing answers quarantining a resolver
+const poisoningRatio = 0.8
+
+// detectPoisonedResolvers compares a sample of the answers of every
+// resolver with the trusted resolvers, quarantining the resolvers which
+// consistently disagree with them (eg. isp redirect pages or ad walls).
+// The quarantined resolvers are left out of the next massdns runs.
+func (instance *Instance) detectPoisonedResolvers(ctx context.Context, st store.Store) error {
+	client, err := dnsclient.New(dnsclient.Options{
+		Resolvers:         instance.resolvers,
+		Retries:           instance.options.VerifyRetries,
+		Timeout:           instance.options.VerifyTimeout,
+		ResolverRateLimit: instance.options.VerifyRateLimit,
+		Rotation:          instance.options.ResolverRotation,
+		MaxInFlight:       instance.options.ResolverMaxInFlight,
+		Proxy:             instance.options.Proxy,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create dns resolver: %w", err)
+	}
+
+	// Hosts resolving to several ips are seen once per ip
+	seen := make(map[string]struct{})
+	samples := make(map[string][]string)
+	hosts := make(map[string]*store.Host)
+	st.Iterate(func(ip string, hostnames []string, counter int) {
+		for _, hostname := range hostnames {
+			if _, ok := seen[hostname]; ok {
+				continue
+			}
+			seen[hostname] = struct{}{}
+
+			host, err := st.GetHost(hostname)
+			if err != nil || host.Resolver == "" || host.Source != "" || instance.isQuarantined(host) {
+				continue
+			}
+			if len(samples[host.Resolver]) < poisoningSamples {
+				samples[host.Resolver] = append(samples[host.Resolver], hostname)
+				hosts[hostname] = host
+			}
+		}
+	})
+
+	var (
+		mutex    sync.Mutex
+		poisoned int
+	)
+	wg := sizedwaitgroup.New(instance.options.WildcardsThreads)
+	for resolver, hostnames := range samples {
+		if len(hostnames) < poisoningMinSamples {
+			continue
+		}
+		wg.Add()
+		go func(resolver string, hostnames []string) {
+			defer wg.Done()
+
+			var compared, disagreeing int
+			for _, hostname := range hostnames {
+				if ctx.Err() != nil {
+					return
+				}
+				instance.options.RateLimiter.Take()
+				resp, err := client.QueryOne(hostname)
+				if err != nil {
+					continue
+				}
+				compared++
+				if !agreesWithTrusted(hosts[hostname], resp.StatusCode, resp.A, resp.CNAME) {
+					disagreeing++
+				}
+			}
+			if compared < poisoningMinSamples || float64(disagreeing) < float64(compared)*poisoningRatio {
+				return
+			}
+			instance.logger.Info().Msgf("Quarantined resolver %s: %d of %d answers disagreed with the trusted resolvers\n", resolver, disagreeing, compared)
+			mutex.Lock()
+			instance.quarantinedResolvers[resolver] = struct{}{}
+			poisoned++
+			mutex.Unlock()
+		}(resolver, hostnames)
+	}
+	wg.Wait()
+	if poisoned == 0 {
+		return nil
+	}
+
+	// The next massdns runs are given the resolvers left
+	if instance.resolversFile != "" && instance.resolversFile != instance.options.ResolversFile {
+		if err := instance.copyResolvers(); err != nil {
+			instance.logger.Error().Msgf("Could not leave the quarantined resolvers out, keeping them: %s\n", err)
+		}
+	}
+	return nil
+}
+
+// agreesWithTrusted returns true if the answer of the trusted resolvers
+// shares an ip or a cname with the host
+func agreesWithTrusted(host *store.Host, status string, ips, cnames []string) bool {
+	if status == "NXDOMAIN" {
+		return false
+	}
+	for _, ip := range ips {
+		for _, hostIP := range host.IPs {
+			if ip == hostIP {
+				return true
+			}
+		}
+	}
+	for _, cname := range cnames {
+		for _, hostCNAME := range host.CNAMEs {
+			if strings.EqualFold(strings.TrimSuffix(cname, "."), hostCNAME) {
+				return true
+			}
+		}
+	}
+	// Hosts without answers only need to exist
+	return len(host.IPs) == 0 && len(host.CNAMEs) == 0
+}
+
+// isQuarantined returns true if the host was answered by a quarantined resolver
+func (instance *Instance) isQuarantined(host *store.Host) bool {
+	if host.Resolver == "" {
+		return false
+	}
+	_, ok := instance.quarantinedResolvers[host.Resolver]
+	return ok
+}
+
+// dropQuarantined removes the quarantined resolvers from the content of a resolvers file
+func (instance *Instance) dropQuarantined(data []byte) []byte {
+	var kept bytes.Buffer
+	for _, line := range strings.Split(string(data), "\n") {
+		resolver := strings.TrimSpace(line)
+		if resolver != "" {
+			if _, ok := instance.quarantinedResolvers[resolverAddress(resolver)]; ok {
+				continue
+			}
+		}
+		kept.WriteString(line + "\n")
+	}
+	return kept.Bytes()
+}
+
+// resolverAddress returns the address of a resolver of the resolvers file
+// as massdns reports it
+func resolverAddress(resolver string) string {
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		return net.JoinHostPort(resolver, "53")
+	}
+	return resolver
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package massdns
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess runs the command in its own process group, so that the
+// signals sent to the terminal reach shuffledns only, which stops massdns
+// once it has handled them.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
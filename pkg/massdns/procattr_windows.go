@@ -0,0 +1,8 @@
+//go:build windows
+
+package massdns
+
+import "os/exec"
+
+// detachProcess is a no-op since process groups are not used on windows
+func detachProcess(cmd *exec.Cmd) {}
@@ -1,32 +1,41 @@
 package massdns
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ShlomieLiberow/shuffledns/pkg/cdn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
 	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
 	"github.com/ShlomieLiberow/shuffledns/pkg/store"
-	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
-	"github.com/projectdiscovery/dnsx/libs/dnsx"
-	"github.com/projectdiscovery/gologger"
-	folderutil "github.com/projectdiscovery/utils/folder"
-	stringsutil "github.com/projectdiscovery/utils/strings"
+	"github.com/miekg/dns"
+	fileutil "github.com/projectdiscovery/utils/file"
 	"github.com/remeh/sizedwaitgroup"
 )
 
+// wildcardGracePeriod bounds the wildcard filtering of an interrupted run
+const wildcardGracePeriod = 10 * time.Second
+
 // runs massdns binary with the specified options
 func (instance *Instance) RunWithContext(ctx context.Context) (stdout, stderr string, took time.Duration, err error) {
 	start := time.Now()
 
-	stdoutFile, err := os.CreateTemp(instance.options.TempDir, "massdns-stdout-")
+	// Keep the massdns output in the run directory when resuming
+	outputDir := instance.options.TempDir
+	if instance.options.RunDir != "" {
+		outputDir = filepath.Join(instance.options.RunDir, chunksDirName)
+	}
+
+	stdoutFile, err := os.CreateTemp(outputDir, "massdns-stdout-")
 	if err != nil {
 		return "", "", 0, fmt.Errorf("could not create temp file for massdns stdout: %w", err)
 	}
@@ -39,18 +48,71 @@ func (instance *Instance) RunWithContext(ctx context.Context) (stdout, stderr st
 	defer stderrFile.Close()
 
 	// Run the command on a temp file and wait for the output
-	args := []string{"-r", instance.options.ResolversFile, "-o", "F", "--retry", "REFUSED", "--retry", "SERVFAIL", "-t", "A", instance.options.InputFile, "-s", strconv.Itoa(instance.options.Threads)}
+	resolversFile := instance.resolversFile
+	if resolversFile == "" {
+		resolversFile = instance.options.ResolversFile
+	}
+	args := []string{"-r", resolversFile, "-o", "F", "--retry", "REFUSED", "--retry", "SERVFAIL", "-t", "A", "-s", strconv.Itoa(instance.massdnsThreads())}
+	if instance.options.DualStack {
+		args = append(args, "-t", "AAAA")
+	}
 	if instance.options.MassDnsCmd != "" {
 		args = append(args, strings.Split(instance.options.MassDnsCmd, " ")...)
 	}
-	// fmt.Println("Arguments for massdns:", args)
+	// With a limiter the input is paced through stdin, which massdns
+	// reads when no domain list is given
+	paced := instance.pacedInput()
+	if !paced {
+		args = append(args, instance.options.InputFile)
+	}
+	instance.logger.Debug().Msgf("Executing %s %s\n", instance.options.MassdnsPath, strings.Join(args, " "))
 	cmd := exec.CommandContext(ctx, instance.options.MassdnsPath, args...)
 	cmd.Stdout = stdoutFile
 	cmd.Stderr = stderrFile
+	detachProcess(cmd)
+	if paced {
+		inputFile, err := os.Open(instance.options.InputFile)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("could not open massdns input: %w", err)
+		}
+		defer inputFile.Close()
+
+		input := instance.options.RateLimiter.Reader(inputFile)
+		defer input.Close()
+		cmd.Stdin = input
+	}
 	err = cmd.Run()
+	if !paced {
+		instance.countQueries(instance.options.InputFile)
+	}
 	return stdoutFile.Name(), stderrFile.Name(), time.Since(start), err
 }
 
+// pacedInput returns true if the input of massdns and zdns goes through
+// the rate limiter, to pace their queries or hold them while paused.
+// Unlimited runs which can't be paused read it straight from the file.
+func (instance *Instance) pacedInput() bool {
+	return instance.options.RateLimiter.Limited() || (instance.options.RateLimiter != nil && instance.options.Pausable)
+}
+
+// countQueries counts the names of the input file as queries sent, when
+// they didn't go through the rate limiter
+func (instance *Instance) countQueries(inputFile string) {
+	if instance.options.RateLimiter == nil {
+		return
+	}
+	if names, err := countNames(inputFile); err == nil {
+		instance.options.RateLimiter.Count(uint64(names))
+	}
+}
+
+// RunBatch runs the enumeration on an input file, reusing the wildcard
+// state gathered by the previous runs of the instance.
+func (instance *Instance) RunBatch(ctx context.Context, inputFile string) error {
+	instance.options.InputFile = inputFile
+	return instance.Run(ctx)
+}
+
 func (instance *Instance) Run(ctx context.Context) error {
 	// Process a created list or the massdns input
 	inputFile := instance.options.InputFile
@@ -64,152 +126,263 @@ func (instance *Instance) Run(ctx context.Context) error {
 		return err
 	}
 	if blank {
-		return errors.New("blank input file specified")
+		return ErrEmptyInput
 	}
 
-	// Create a store for storing ip metadata
-	shstore, err := store.New(instance.options.TempDir)
+	resolution, err := instance.NewResolution()
 	if err != nil {
-		return fmt.Errorf("could not create store: %w", err)
+		return err
 	}
-	defer shstore.Close()
-
-	// Set the correct target file
-	tmpDir := instance.options.TempDir
+	defer resolution.Close()
 
-	// Check if we need to run massdns
+	// Resolve the input unless the output of a previous resolution is given
 	if instance.options.MassdnsRaw == "" {
-		if len(instance.options.Domains) > 0 {
-			gologger.Info().Msgf("Executing massdns on %s\n", strings.Join(instance.options.Domains, ", "))
-		} else {
-			gologger.Info().Msgf("Executing massdns\n")
+		if err := resolution.Resolve(ctx, inputFile); err != nil {
+			return err
 		}
-
-		// Create a temporary file for the massdns output
-		gologger.Info().Msgf("using massdns output directory: %s\n", tmpDir)
-		stdoutFile, stderrFile, took, err := instance.RunWithContext(ctx)
-		gologger.Info().Msgf("massdns output file: %s\n", stdoutFile)
-		gologger.Info().Msgf("massdns error file: %s\n", stderrFile)
+	} else { // parse the input file
+		instance.options.Phases.Set(PhaseParse)
+		instance.logger.Info().Msgf("Started parsing massdns input\n")
+		now := time.Now()
+		err = instance.parseMassDNSOutputFile(instance.options.MassdnsRaw, instance.options.RawInputFormat, resolution.store)
 		if err != nil {
-			return fmt.Errorf("could not execute massdns: %s", err)
+			return err
 		}
+		instance.logger.Info().Msgf("Massdns input parsing completed in %s\n", time.Since(now))
+	}
+	return resolution.Finish(ctx)
+}
 
-		gologger.Info().Msgf("Massdns execution took %s\n", took)
+// Resolution resolves several input files into a single store, so that
+// the wildcards are filtered across all of them and the output is written
+// once, after the last one was resolved.
+type Resolution struct {
+	instance *Instance
+	store    store.Store
+}
 
-		gologger.Info().Msgf("Started parsing massdns output\n")
+// NewResolution creates a resolution whose inputs are resolved by Resolve
+// and filtered and written by Finish. It must be closed once done.
+func (instance *Instance) NewResolution() (*Resolution, error) {
+	// Create a store for storing ip metadata
+	st, err := instance.newStore()
+	if err != nil {
+		return nil, fmt.Errorf("could not create store: %w", err)
+	}
+	instance.verifyFailures.Store(0)
+	return &Resolution{instance: instance, store: st}, nil
+}
 
-		now := time.Now()
+// Close closes the store of the resolution
+func (resolution *Resolution) Close() {
+	resolution.store.Close()
+}
 
-		err = instance.parseMassDNSOutputDir(tmpDir, shstore)
+// Resolve resolves the input file into the store of the resolution. When
+// resuming, the records of the inputs resolved by a previous run are
+// restored instead.
+func (resolution *Resolution) Resolve(ctx context.Context, inputFile string) error {
+	instance := resolution.instance
+
+	var hash string
+	if instance.options.RunDir != "" {
+		var err error
+		hash, err = hashFile(inputFile)
 		if err != nil {
-			return fmt.Errorf("could not parse massdns output: %w", err)
+			return fmt.Errorf("could not hash input file: %w", err)
+		}
+		if fileutil.FileExists(instance.chunkPath(hash, ".records")) {
+			instance.logger.Info().Msgf("Restoring chunk %s resolved by a previous run\n", hash)
+			return instance.restoreChunk(hash, resolution.store)
 		}
+	}
 
-		gologger.Info().Msgf("Massdns output parsing completed in %s\n", time.Since(now))
-	} else { // parse the input file
-		gologger.Info().Msgf("Started parsing massdns input\n")
+	instance.repliedMutex.Lock()
+	instance.replied = make(map[string]struct{})
+	instance.repliedMutex.Unlock()
+
+	backend, err := instance.backend(hash)
+	if err != nil {
+		return err
+	}
+	chunk, err := instance.newChunkRecords(hash)
+	if err != nil {
+		return err
+	}
+	defer chunk.Close()
+	onRecord := func(record *parser.Record) error {
+		instance.countParsed(1)
+		instance.markReplied(record.Domain)
+		if err := chunk.Write(record); err != nil {
+			return err
+		}
+		return instance.storeRecord(resolution.store, record, "")
+	}
+	// The built-in backends refine the phase as they go
+	instance.options.Phases.Set(PhaseMassdns)
+	if err := backend.Resolve(ctx, inputFile, onRecord); err != nil {
+		return err
+	}
+	// Give the names without any reply a second chance before concluding they don't exist
+	if instance.options.RetryTimeouts && !instance.options.VerifyOnly && ctx.Err() == nil {
+		if err := instance.retryTimeouts(ctx, inputFile, onRecord); err != nil {
+			return fmt.Errorf("could not retry the names without reply: %w", err)
+		}
+	}
+	if ctx.Err() == nil {
+		return chunk.Commit()
+	}
+	return nil
+}
+
+// Finish filters the wildcards of all the inputs resolved and writes
+// the output
+func (resolution *Resolution) Finish(ctx context.Context) error {
+	instance, shstore := resolution.instance, resolution.store
+
+	// Compare the answers of every resolver with the trusted resolvers
+	if instance.options.QuarantineResolvers && !instance.options.VerifyOnly && ctx.Err() == nil {
+		instance.logger.Info().Msgf("Started comparing the answers of the resolvers with the trusted resolvers\n")
 		now := time.Now()
-		err = instance.parseMassDNSOutputFile(instance.options.MassdnsRaw, shstore)
-		if err != nil {
-			return fmt.Errorf("could not parse massdns input: %w", err)
+		if err := instance.detectPoisonedResolvers(ctx, shstore); err != nil {
+			return fmt.Errorf("could not detect poisoned resolvers: %w", err)
 		}
-		gologger.Info().Msgf("Massdns input parsing completed in %s\n", time.Since(now))
+		instance.logger.Info().Msgf("Resolvers comparison completed in %s\n", time.Since(now))
+	}
+
+	// Merge the hostnames of the zones which can be transferred
+	if instance.options.AXFR && ctx.Err() == nil {
+		instance.transferZones(ctx, shstore)
 	}
 
 	// Perform wildcard filtering only if domain name has been specified
 	if len(instance.options.Domains) > 0 {
-		gologger.Info().Msgf("Started removing wildcards records\n")
+		instance.options.Phases.Set(PhaseWildcard)
+		instance.logger.Info().Msgf("Started removing wildcards records\n")
 		now := time.Now()
-		err = instance.filterWildcards(shstore)
+		wildcardCtx := ctx
+		if ctx.Err() != nil {
+			// An abbreviated filtering keeps most wildcards out of the partial output
+			var cancel context.CancelFunc
+			wildcardCtx, cancel = context.WithTimeout(context.Background(), wildcardGracePeriod)
+			defer cancel()
+			instance.logger.Info().Msgf("Run interrupted, filtering wildcards for at most %s\n", wildcardGracePeriod)
+		}
+		err := instance.filterWildcards(wildcardCtx, shstore)
 		if err != nil {
-			return fmt.Errorf("could not filter wildcards: %w", err)
+			return fmt.Errorf("%w: %w", ErrWildcardPhase, err)
+		}
+		instance.logger.Info().Msgf("Wildcard removal completed in %s\n", time.Since(now))
+		if instance.options.RunDir != "" {
+			if err := instance.saveWildcards(); err != nil {
+				return err
+			}
 		}
-		gologger.Info().Msgf("Wildcard removal completed in %s\n", time.Since(now))
 	}
 
-	gologger.Info().Msgf("Finished enumeration, started writing output\n")
+	instance.options.Phases.Set(PhaseOutput)
+	instance.logger.Info().Msgf("Finished enumeration, started writing output\n")
 
 	// Write the final elaborated list out
 	now := time.Now()
-	err = instance.writeOutput(shstore)
-	if err != nil {
-		return fmt.Errorf("could not write output: %w", err)
+	if err := instance.writeOutput(ctx, shstore); err != nil {
+		return fmt.Errorf("%w: %w", ErrOutputPhase, err)
 	}
-	gologger.Info().Msgf("Output written in %s\n", time.Since(now))
+	instance.logger.Info().Msgf("Output written in %s\n", time.Since(now))
 	return nil
 }
 
-func (instance *Instance) parseMassDNSOutputFile(tmpFile string, store *store.Store) error {
-	// Determine if NDJSON parsing is required based on configuration
-	parseOption := parser.ParseOption(instance.options.NDJSON)
+func (instance *Instance) parseMassDNSOutputFile(tmpFile, format string, st store.Store) error {
+	if format == "" {
+		format = instance.massdnsFormat()
+	}
 
 	// at first we need the full structure in memory to elaborate it in parallel
-	err := parser.ParseFile(tmpFile, func(domain string, ips []string) error {
-		if len(ips) > 0 {
-			for _, ip := range ips {
-				if !store.Exists(ip) {
-					if err := store.New(ip, domain); err != nil {
-						return fmt.Errorf("could not create new record: %w", err)
-					}
-					continue
-				}
-
-				if err := store.Update(ip, domain); err != nil {
-					return fmt.Errorf("could not update record: %w", err)
-				}
-			}
-		} else {
-			// If we don't have any IPs, it might be a CNAME record
-			// We'll store it with a special IP format
-			specialIP := "CNAME:" + domain
-			if !store.Exists(specialIP) {
-				if err := store.New(specialIP, domain); err != nil {
-					return fmt.Errorf("could not create new CNAME record: %w", err)
-				}
-			} else {
-				if err := store.Update(specialIP, domain); err != nil {
-					return fmt.Errorf("could not update CNAME record: %w", err)
-				}
-			}
+	// The passive datasets cover every domain, only the records of the
+	// target domains are kept
+	passive := format == parser.FormatFDNS
+	err := parser.ParseFileFormat(tmpFile, func(record *parser.Record) error {
+		if passive && !instance.inDomains(record.Domain) {
+			return nil
 		}
-		return nil
-	}, parseOption)
-
+		instance.countParsed(1)
+		return instance.storeRecord(st, record, "")
+	}, format)
 	if err != nil {
-		return fmt.Errorf("could not parse massdns output: %w", err)
+		return fmt.Errorf("%w: %w", ErrParsePhase, err)
 	}
 
 	return nil
 }
 
-func (instance *Instance) parseMassDNSOutputDir(tmpDir string, store *store.Store) error {
-	tmpFiles, err := folderutil.GetFiles(tmpDir)
-	if err != nil {
-		return fmt.Errorf("could not open massdns output directory: %w", err)
+// massdnsFormat returns the parser format of the massdns output, raw or
+// ndjson based on configuration
+func (instance *Instance) massdnsFormat() string {
+	if instance.options.NDJSON {
+		return parser.FormatMassdnsNDJSON
 	}
+	return parser.FormatMassdns
+}
 
-	for _, tmpFile := range tmpFiles {
-		// just process stdout files
-		if !stringsutil.ContainsAnyI(tmpFile, "stdout") {
-			continue
-		}
-		err = instance.parseMassDNSOutputFile(tmpFile, store)
-		if err != nil {
-			return fmt.Errorf("could not parse massdns output: %w", err)
+// storeRecord stores the answers of a record, indexing the hostname by ip.
+// The source tags hosts not resolved by massdns.
+func (instance *Instance) storeRecord(st store.Store, record *parser.Record, source string) error {
+	domain, ips := record.Domain, record.IPs
+	// The answer details are only kept when the output needs them
+	if instance.needsHost() {
+		if err := st.UpdateHost(domain, &store.Host{Status: record.Status, IPs: ips, CNAMEs: record.CNAMEs, Source: source, Resolver: record.Resolver, TTL: record.TTL}); err != nil {
+			return fmt.Errorf("could not update host record: %w", err)
 		}
 	}
+	if len(ips) > 0 {
+		for _, ip := range ips {
+			if !st.Exists(ip) {
+				if err := st.New(ip, domain); err != nil {
+					return fmt.Errorf("could not create new record: %w", err)
+				}
+				continue
+			}
 
+			if err := st.Update(ip, domain); err != nil {
+				return fmt.Errorf("could not update record: %w", err)
+			}
+		}
+	} else {
+		// If we don't have any IPs, it might be a CNAME record
+		// We'll store it with a special IP format
+		specialIP := "CNAME:" + domain
+		if !st.Exists(specialIP) {
+			if err := st.New(specialIP, domain); err != nil {
+				return fmt.Errorf("could not create new CNAME record: %w", err)
+			}
+		} else {
+			if err := st.Update(specialIP, domain); err != nil {
+				return fmt.Errorf("could not update CNAME record: %w", err)
+			}
+		}
+	}
 	return nil
 }
 
-func (instance *Instance) filterWildcards(st *store.Store) error {
+func (instance *Instance) filterWildcards(ctx context.Context, st store.Store) error {
 	// Start to work in parallel on wildcards
 	wildcardWg := sizedwaitgroup.New(instance.options.WildcardsThreads)
 
 	var allCancelFunc []context.CancelFunc
 
+	// unchecked are the ips whose check was interrupted, their hosts being
+	// possibly wildcards
+	var uncheckedMutex sync.Mutex
+	unchecked := make(map[string]struct{})
+	markUnchecked := func(ip string) {
+		uncheckedMutex.Lock()
+		unchecked[ip] = struct{}{}
+		uncheckedMutex.Unlock()
+	}
+
 	st.Iterate(func(ip string, hostnames []string, counter int) {
-		ipCtx, ipCancelFunc := context.WithCancel(context.Background())
+		// Checks are not started anymore once the run is interrupted
+		ipCtx, ipCancelFunc := context.WithCancel(ctx)
 		allCancelFunc = append(allCancelFunc, ipCancelFunc)
 		// We've stumbled upon a wildcard, just ignore it.
 		if instance.wildcardStore.Has(ip) {
@@ -224,33 +397,39 @@ func (instance *Instance) filterWildcards(st *store.Store) error {
 				go func(ctx context.Context, ipCancelFunc context.CancelFunc, IP string, hostname string) {
 					defer wildcardWg.Done()
 
-					gologger.Info().Msgf("Started filtering wildcards for %s\n", hostname)
+					instance.logger.Info().Msgf("Started filtering wildcards for %s\n", hostname)
 
 					select {
 					case <-ctx.Done():
+						markUnchecked(IP)
 						return
 					default:
 					}
 
-					isWildcard, ips := instance.wildcardResolver.LookupHost(hostname)
-					gologger.Debug().Msgf("isWildcard: %v, ips: %v, hostname: %s\n", isWildcard, ips, hostname)
+					isWildcard, root, ips := instance.wildcardResolver.LookupHost(ctx, hostname)
+					if !isWildcard && ctx.Err() != nil {
+						markUnchecked(IP)
+					}
+					instance.countWildcardCheck()
+					instance.logger.Debug().Msgf("isWildcard: %v, ips: %v, hostname: %s\n", isWildcard, ips, hostname)
+					instance.reportWildcard(root, ips)
 					if len(ips) > 0 {
 						for ip := range ips {
 							// we add the single ip to the wildcard list
 							if err := instance.wildcardStore.Set(ip); err != nil {
-								gologger.Error().Msgf("could not set wildcard ip: %s", err)
+								instance.logger.Error().Msgf("could not set wildcard ip: %s", err)
 							}
-							gologger.Debug().Msgf("Removing wildcard %s\n", ip)
+							instance.logger.Debug().Msgf("Removing wildcard %s\n", ip)
 						}
 					}
 
 					if isWildcard {
 						// we also mark the original ip as wildcard, since at least once it resolved to this host
 						if err := instance.wildcardStore.Set(IP); err != nil {
-							gologger.Error().Msgf("could not set wildcard ip: %s", err)
+							instance.logger.Error().Msgf("could not set wildcard ip: %s", err)
 						}
 						ipCancelFunc()
-						gologger.Debug().Msgf("Removed wildcard %s\n", IP)
+						instance.logger.Debug().Msgf("Removed wildcard %s\n", IP)
 					}
 
 				}(ipCtx, ipCancelFunc, ip, hostname)
@@ -265,108 +444,573 @@ func (instance *Instance) filterWildcards(st *store.Store) error {
 	}
 
 	// drop all wildcard from the store
-	return instance.wildcardStore.Iterate(func(k string) error {
+	var dropped []string
+	err := instance.wildcardStore.Iterate(func(k string) error {
+		if hostnames := st.GetHostnames(k); hostnames != "" {
+			instance.countWildcardDrops(int64(strings.Count(hostnames, ",") + 1))
+			if instance.options.OnDropped != nil {
+				dropped = append(dropped, strings.Split(hostnames, ",")...)
+			}
+		}
 		return st.Delete(k)
 	})
+	if err != nil {
+		return err
+	}
+	instance.reportWildcardDrops(st, dropped)
+	return instance.dropUnchecked(st, unchecked)
+}
+
+// dropUnchecked drops the hosts on the ips whose wildcard check was
+// interrupted, keeping the wildcards they may be out of the partial output
+func (instance *Instance) dropUnchecked(st store.Store, unchecked map[string]struct{}) error {
+	var hosts, ips int
+	for ip := range unchecked {
+		if instance.wildcardStore.Has(ip) {
+			continue
+		}
+		hostnames := st.GetHostnames(ip)
+		if hostnames == "" {
+			continue
+		}
+		for _, hostname := range strings.Split(hostnames, ",") {
+			hosts++
+			instance.reportDropped(hostname, DropUnchecked)
+		}
+		ips++
+		if err := st.Delete(ip); err != nil {
+			return err
+		}
+	}
+	if hosts > 0 {
+		instance.logger.Info().Msgf("Dropped %d hosts on %d ips whose wildcard check was interrupted\n", hosts, ips)
+	}
+	return nil
+}
+
+// outputLine is a formatted line of output for a hostname
+type outputLine struct {
+	data   string
+	result *Result
+}
+
+// Result is a host written to the output
+type Result struct {
+	// Hostname is the resolved hostname
+	Hostname string `json:"hostname"`
+	// Status is the response code of the reply (eg. NOERROR)
+	Status string `json:"status,omitempty"`
+	// IPs are the A records the hostname resolved to, and the AAAA records with dual-stack
+	IPs []string `json:"ips,omitempty"`
+	// IPv6Only is set with dual-stack on the hosts only resolving to ipv6 addresses
+	IPv6Only bool `json:"ipv6_only,omitempty"`
+	// Reserved are the loopback, link-local, private or other special-use addresses the host answered with
+	Reserved []string `json:"reserved,omitempty"`
+	// Rebinding are the addresses of the host seen across the probes when its
+	// answers flip between public and special-use addresses
+	Rebinding []string `json:"rebinding,omitempty"`
+	// Crowded are the ips of the host hosting more hostnames than the limit, with max-hosts-per-ip
+	Crowded []string `json:"crowded,omitempty"`
+	// CNAMEs are the canonical names in the resolution chain
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Source tags hosts obtained elsewhere than from massdns (eg. axfr)
+	Source string `json:"source,omitempty"`
+	// Verified is the record type the trusted resolvers verified the host with, if verified
+	Verified string `json:"verified,omitempty"`
+	// DNSSEC is the status of the DNSSEC validation, if validated
+	DNSSEC string `json:"dnssec,omitempty"`
+	// Excluded is set when the host resolves into excluded ranges
+	Excluded bool `json:"excluded,omitempty"`
+	// TTL is the lowest ttl of the answers, with the ttl filters
+	TTL *int `json:"ttl,omitempty"`
+	// HTTPS are the service hints advertised by the HTTPS records, with the https hints in the json output
+	HTTPS *HTTPSHints `json:"https,omitempty"`
+	// Takeover is the dangling or takeover-prone cname of the host, with takeover detection
+	Takeover *Takeover `json:"takeover,omitempty"`
+	// NSTakeover are the unregistered name servers the host is delegated to, with takeover detection
+	NSTakeover []string `json:"ns_takeover,omitempty"`
+	// ASN are the autonomous systems announcing the ips, with the asn info
+	ASN []IPASN `json:"asn,omitempty"`
+	// GeoIP are the locations of the ips, with a geoip database
+	GeoIP []IPLocation `json:"geoip,omitempty"`
+	// Cloud is the cloud provider hosting the ips, with cloud detection
+	Cloud string `json:"cloud,omitempty"`
+	// CDN is the cdn or waf serving the ips, with cdn detection
+	CDN *cdn.Provider `json:"cdn,omitempty"`
+	// Change is set by the recurring scans on the hosts new or removed
+	// since the previous scan
+	Change string `json:"change,omitempty"`
 }
 
-func (instance *Instance) writeOutput(store *store.Store) error {
-	// Write the unique deduplicated output to the file or stdout
+func (instance *Instance) writeOutput(ctx context.Context, st store.Store) error {
+	// Write the unique deduplicated output to the sinks
 	// depending on what the user has asked.
-	var output *os.File
-	var w *bufio.Writer
-	var err error
+	sinks, closeSinks, err := instance.openSinks()
+	if err != nil {
+		return err
+	}
+	defer closeSinks()
 
-	if instance.options.OutputFile != "" {
-		output, err = os.Create(instance.options.OutputFile)
+	// write count of resolved hosts
+	var resolvedCount atomic.Int64
+
+	var clients resultClients
+
+	// if trusted resolvers are specified or verification is asked, verify the results,
+	// unless they were resolved with the trusted resolvers in the first place
+	if (len(instance.options.TrustedResolvers) > 0 || instance.options.Verify) && !instance.options.VerifyOnly {
+		if len(instance.options.TrustedResolvers) > 0 {
+			instance.logger.Info().Msgf("Trusted resolvers specified, verifying results\n")
+		} else {
+			instance.logger.Info().Msgf("Verifying results with the built-in resolvers\n")
+		}
+		clients.verify, err = instance.newVerifyClient()
 		if err != nil {
-			return fmt.Errorf("could not create massdns output file: %v", err)
+			return err
 		}
-		w = bufio.NewWriter(output)
 	}
 
-	uniqueMap := make(map[string]struct{})
+	// if httpx output or the https hints are requested, lookup HTTPS records
+	// for the advertised ports and protocols
+	if instance.options.HttpxOutput || (instance.options.HTTPSHints && instance.options.Json) {
+		clients.https, err = dnsclient.New(dnsclient.Options{Resolvers: instance.resolvers, QuestionTypes: []uint16{dns.TypeHTTPS}, Proxy: instance.options.Proxy})
+		if err != nil {
+			return fmt.Errorf("could not create dns resolver: %w", err)
+		}
+	}
 
-	// write count of resolved hosts
-	resolvedCount := 0
-
-	// if trusted resolvers are specified verify the results
-	var dnsResolver *dnsx.DNSX
-	if len(instance.options.TrustedResolvers) > 0 {
-		gologger.Info().Msgf("Trusted resolvers specified, verifying results\n")
-		options := dnsx.DefaultOptions
-		resolvers, err := wildcards.LoadResolversFromFile(instance.options.TrustedResolvers)
+	// if rebinding detection is requested, re-resolve the hosts with the trusted resolvers
+	if instance.options.Rebinding && instance.options.Json {
+		questionTypes := []uint16{dns.TypeA}
+		if instance.options.DualStack {
+			questionTypes = append(questionTypes, dns.TypeAAAA)
+		}
+		clients.rebinding, err = dnsclient.New(dnsclient.Options{
+			Resolvers:         instance.resolvers,
+			QuestionTypes:     questionTypes,
+			Retries:           instance.options.VerifyRetries,
+			Timeout:           instance.options.VerifyTimeout,
+			ResolverRateLimit: instance.options.VerifyRateLimit,
+			Rotation:          instance.options.ResolverRotation,
+			MaxInFlight:       instance.options.ResolverMaxInFlight,
+			Proxy:             instance.options.Proxy,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create dns resolver: %w", err)
+		}
+	}
+	instance.rebindingHosts.Store(0)
+
+	// if dnssec validation is requested, check the results with the trusted resolvers
+	if instance.options.DNSSEC {
+		instance.logger.Info().Msgf("Validating the DNSSEC of the results\n")
+		clients.validator, err = dnsclient.NewValidator(dnsclient.Options{
+			Resolvers:         instance.resolvers,
+			Retries:           instance.options.VerifyRetries,
+			Timeout:           instance.options.VerifyTimeout,
+			ResolverRateLimit: instance.options.VerifyRateLimit,
+			Rotation:          instance.options.ResolverRotation,
+			MaxInFlight:       instance.options.ResolverMaxInFlight,
+			Proxy:             instance.options.Proxy,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create dnssec validator: %w", err)
+		}
+	}
+	instance.bogusHosts.Store(0)
+	instance.ipv6OnlyHosts.Store(0)
+	instance.reservedHosts.Store(0)
+
+	// if takeover detection is requested, resolve the cname targets with the trusted resolvers
+	if instance.options.Takeover {
+		clients.takeover, err = dnsclient.New(dnsclient.Options{
+			Resolvers:         instance.resolvers,
+			Retries:           instance.options.VerifyRetries,
+			Timeout:           instance.options.VerifyTimeout,
+			ResolverRateLimit: instance.options.VerifyRateLimit,
+			Rotation:          instance.options.ResolverRotation,
+			MaxInFlight:       instance.options.ResolverMaxInFlight,
+			Proxy:             instance.options.Proxy,
+		})
 		if err != nil {
-			return fmt.Errorf("could not load trusted resolvers: %w", err)
+			return fmt.Errorf("could not create dns resolver: %w", err)
 		}
-		options.BaseResolvers = resolvers
-		dnsResolver, err = dnsx.New(options)
+		clients.delegation, err = dnsclient.New(dnsclient.Options{
+			Resolvers:         instance.resolvers,
+			Retries:           instance.options.VerifyRetries,
+			Timeout:           instance.options.VerifyTimeout,
+			ResolverRateLimit: instance.options.VerifyRateLimit,
+			Rotation:          instance.options.ResolverRotation,
+			MaxInFlight:       instance.options.ResolverMaxInFlight,
+			QuestionTypes:     []uint16{dns.TypeNS},
+			Proxy:             instance.options.Proxy,
+		})
 		if err != nil {
 			return fmt.Errorf("could not create dns resolver: %w", err)
 		}
 	}
+	instance.takeoverCandidates.Store(0)
+	instance.quarantinedHosts.Store(0)
+	instance.crowdedHosts.Store(0)
+
+	// The ips hosting too many hostnames are found before any host is written
+	crowded := instance.crowdedIPs(st)
+
+	queue := make(chan string)
+	results := make(chan outputLine)
+
+	// A single goroutine owns the writer so that lines are never interleaved
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+
+		// The sinks are flushed periodically for the files followed while
+		// written, and not to lose the buffered results on crash
+		var flush <-chan time.Time
+		if instance.options.FlushInterval > 0 {
+			ticker := time.NewTicker(instance.options.FlushInterval)
+			defer ticker.Stop()
+			flush = ticker.C
+		}
 
-	swg := sizedwaitgroup.New(instance.options.WildcardsThreads)
+		for {
+			select {
+			case <-flush:
+				for _, sink := range sinks {
+					if err := sink.Flush(); err != nil {
+						instance.logger.Error().Msgf("Could not write results: %s\n", err)
+					}
+				}
+			case line, ok := <-results:
+				if !ok {
+					return
+				}
+				for _, sink := range sinks {
+					if err := sink.Write(line.result, line.data); err != nil {
+						instance.logger.Error().Msgf("Could not write result: %s\n", err)
+					}
+				}
 
-	store.Iterate(func(ip string, hostnames []string, counter int) {
+				if instance.options.OnHostname != nil {
+					instance.options.OnHostname(line.result.Hostname)
+				}
+				if instance.options.OnResult != nil {
+					instance.options.OnResult(line.result)
+				}
+			}
+		}
+	}()
+
+	workers := instance.options.WildcardsThreads
+	if workers <= 0 {
+		workers = 1
+	}
+	var workersWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+
+			for hostname := range queue {
+				if !instance.matchScope(hostname) {
+					instance.reportDropped(hostname, DropScope)
+					continue
+				}
+				var excluded bool
+				host := &store.Host{}
+				if instance.needsHost() {
+					var err error
+					if host, err = st.GetHost(hostname); err != nil {
+						continue
+					}
+				}
+				if instance.isQuarantined(host) {
+					instance.quarantinedHosts.Add(1)
+					instance.reportDropped(hostname, DropQuarantined)
+					continue
+				}
+				if instance.hasAnswerFilters() {
+					if !instance.matchAnswerFilters(host) {
+						instance.reportDropped(hostname, DropFiltered)
+						continue
+					}
+					// Hosts resolving into excluded ranges are dropped unless flagging was asked
+					excluded = instance.matchExcludedIPs(host)
+					if excluded && !instance.options.FlagExcluded {
+						instance.reportDropped(hostname, DropExcluded)
+						continue
+					}
+				}
+				// Hosts answering with special-use addresses are dropped or tagged
+				var reserved []string
+				if instance.options.FlagReserved || instance.options.DropReserved {
+					if reserved = instance.reservedIPs(host); len(reserved) > 0 {
+						instance.recordReserved(hostname, reserved)
+						if instance.options.DropReserved {
+							instance.reportDropped(hostname, DropReserved)
+							continue
+						}
+					}
+				}
+				// Hosts only resolving to crowded ips are dropped unless flagging was asked
+				var crowdedIPs []string
+				if len(crowded) > 0 {
+					if crowdedIPs = crowdedOf(host, crowded); len(crowdedIPs) > 0 {
+						instance.crowdedHosts.Add(1)
+						if len(crowdedIPs) == len(host.IPs) && !instance.options.FlagCrowded {
+							instance.reportDropped(hostname, DropCrowded)
+							continue
+						}
+					}
+				}
+				// Hosts which could not be verified before the interruption are dropped
+				if clients.verify != nil && ctx.Err() != nil {
+					instance.reportDropped(hostname, DropUnverified)
+					continue
+				}
+				line, ok := instance.formatResult(ctx, clients, hostname, host, excluded, reserved, crowdedIPs)
+				if !ok {
+					continue
+				}
+				if instance.options.CNAMEReport {
+					instance.recordThirdParties(hostname, host)
+				}
+				resolvedCount.Add(1)
+				results <- line
+			}
+		}()
+	}
+
+	st.Iterate(func(ip string, hostnames []string, counter int) {
 		for _, hostname := range hostnames {
-			// Skip if we already printed this subdomain once
-			if _, ok := uniqueMap[hostname]; ok {
+			// Skip the hostnames of several ips already written once, the
+			// store keeping them on disk rather than in memory
+			first, err := st.MarkWritten(hostname)
+			if err != nil {
+				instance.logger.Error().Msgf("Could not deduplicate %s: %s\n", hostname, err)
+			} else if !first {
 				continue
 			}
-			uniqueMap[hostname] = struct{}{}
 
-			swg.Add()
-			go func(hostname string) {
-				defer swg.Done()
+			queue <- hostname
+		}
+	})
 
-				if dnsResolver != nil {
-					if resp, err := dnsResolver.QueryOne(hostname); err != nil || (len(resp.A) == 0 && len(resp.CNAME) == 0) {
-						gologger.Info().Msgf("not resolved with trusted resolver - skipping: %s", hostname)
-						return
-					} else {
-						gologger.Info().Msgf("resolved with trusted resolver: %s", hostname)
+	close(queue)
+	workersWg.Wait()
+	close(results)
+	<-writerDone
 
-						if instance.options.OnResult != nil {
-							instance.options.OnResult(resp)
-						}
-					}
-				}
+	if ctx.Err() != nil {
+		instance.logger.Info().Msgf("Total resolved: %d (partial)\n", resolvedCount.Load())
+	} else {
+		instance.logger.Info().Msgf("Total resolved: %d\n", resolvedCount.Load())
+	}
+	if candidates := instance.takeoverCandidates.Load(); candidates > 0 {
+		instance.logger.Info().Msgf("Flagged %d takeover candidates with dangling or takeover-prone cnames, or unregistered name servers\n", candidates)
+	}
+	if bogus := instance.bogusHosts.Load(); bogus > 0 {
+		instance.logger.Info().Msgf("Flagged %d hosts failing the DNSSEC validation, their answers may be spoofed\n", bogus)
+	}
+	if ipv6Only := instance.ipv6OnlyHosts.Load(); ipv6Only > 0 {
+		instance.logger.Info().Msgf("Found %d hosts only resolving to ipv6 addresses\n", ipv6Only)
+	}
+	if reserved := instance.reservedHosts.Load(); reserved > 0 {
+		if instance.options.DropReserved {
+			instance.logger.Info().Msgf("Dropped %d hosts answering with special-use addresses, often rebinding honeypots or resolver junk\n", reserved)
+		} else {
+			instance.logger.Info().Msgf("Flagged %d hosts answering with special-use addresses, often rebinding honeypots or resolver junk\n", reserved)
+		}
+	}
+	if crowdedHosts := instance.crowdedHosts.Load(); crowdedHosts > 0 {
+		if instance.options.FlagCrowded {
+			instance.logger.Info().Msgf("Flagged %d hosts resolving to the %d ips hosting more than %d hostnames\n", crowdedHosts, len(crowded), instance.options.MaxHostsPerIP)
+		} else {
+			instance.logger.Info().Msgf("Found %d hosts resolving to the %d ips hosting more than %d hostnames, the ones only resolving to them being dropped\n", crowdedHosts, len(crowded), instance.options.MaxHostsPerIP)
+		}
+	}
+	if rebinding := instance.rebindingHosts.Load(); rebinding > 0 {
+		instance.logger.Info().Msgf("Flagged %d hosts whose answers flip between public and private addresses, possible DNS rebinding\n", rebinding)
+	}
+	if quarantined := instance.quarantinedHosts.Load(); quarantined > 0 {
+		instance.logger.Info().Msgf("Dropped %d hosts answered by the %d quarantined resolvers\n", quarantined, len(instance.quarantinedResolvers))
+	}
+	if failures := instance.verifyFailures.Load(); failures > 0 {
+		instance.logger.Info().Msgf("Dropped %d hosts the trusted resolvers failed to answer, consider raising -verify-retries or -verify-timeout\n", failures)
+	}
 
-				var buffer strings.Builder
+	return nil
+}
 
-				if instance.options.Json {
-					hostnameJson, err := json.Marshal(map[string]interface{}{"hostname": hostname})
-					if err != nil {
-						gologger.Error().Msgf("could not marshal output as json: %v", err)
-					}
+// resultClients are the clients checking the results before output, nil
+// when the check was not requested
+type resultClients struct {
+	verify    dnsclient.Client
+	https     dnsclient.Client
+	validator *dnsclient.Validator
+	takeover  dnsclient.Client
+	// delegation resolves the name servers zones are delegated to
+	delegation dnsclient.Client
+	// rebinding re-resolves the hosts looking for flipping answers
+	rebinding dnsclient.Client
+}
 
-					buffer.WriteString(string(hostnameJson))
-					buffer.WriteString("\n")
-				} else {
-					buffer.WriteString(hostname)
-					buffer.WriteString("\n")
-				}
+// formatResult verifies the hostname with the trusted resolver if one
+// is configured and returns the output line for it. Excluded hosts,
+// hosts failing the DNSSEC validation and takeover candidates are marked
+// as such in the output, and the json output records the source of hosts
+// not resolved by massdns. The hosts answering with special-use addresses
+// or resolving to crowded ips are tagged with them. Once ctx is done,
+// the partial results are written without the DNSSEC, takeover and
+// HTTPS lookups.
+func (instance *Instance) formatResult(ctx context.Context, clients resultClients, hostname string, host *store.Host, excluded bool, reserved, crowded []string) (outputLine, bool) {
+	var verifiedBy string
+	if clients.verify != nil {
+		instance.options.RateLimiter.Take()
+		resp, err := clients.verify.QueryMultiple(hostname)
+		if err != nil {
+			instance.verifyFailures.Add(1)
+			instance.logger.Info().Msgf("could not verify with trusted resolver - skipping: %s: %s\n", hostname, err)
+			instance.reportDropped(hostname, DropUnverified)
+			return outputLine{}, false
+		}
+		if verifiedBy = instance.verifiedType(resp); verifiedBy == "" {
+			instance.logger.Info().Msgf("not resolved with trusted resolver - skipping: %s\n", hostname)
+			instance.reportDropped(hostname, DropUnverified)
+			return outputLine{}, false
+		}
+		instance.logger.Info().Msgf("resolved with trusted resolver: %s\n", hostname)
+	}
 
-				data := buffer.String()
+	var dnssec string
+	if clients.validator != nil && ctx.Err() == nil {
+		instance.options.RateLimiter.Take()
+		status, err := clients.validator.Validate(hostname)
+		if err != nil {
+			instance.logger.Debug().Msgf("could not validate dnssec: %s: %s\n", hostname, err)
+		}
+		if dnssec = status; dnssec == dnsclient.DNSSECBogus {
+			instance.bogusHosts.Add(1)
+		}
+	}
 
-				if output != nil {
-					_, _ = w.WriteString(data)
-				}
-				gologger.Silent().Msgf("%s", data)
-				resolvedCount++
-			}(hostname)
+	result := &Result{
+		Hostname: hostname,
+		Status:   host.Status,
+		IPs:      host.IPs,
+		CNAMEs:   host.CNAMEs,
+		Source:   host.Source,
+		Verified: verifiedBy,
+		DNSSEC:   dnssec,
+		Excluded: excluded,
+		Reserved: reserved,
+		Crowded:  crowded,
+	}
+	if host.TTL != nil && (instance.options.MinTTL > 0 || instance.options.MaxTTL > 0) {
+		result.TTL = host.TTL
+	}
+
+	if clients.takeover != nil && ctx.Err() == nil {
+		result.Takeover = instance.detectTakeover(clients.takeover, hostname, host)
+		result.NSTakeover = instance.detectNSTakeover(clients.delegation, hostname, host)
+	}
+
+	if result.IPv6Only = instance.options.DualStack && isIPv6Only(host.IPs); result.IPv6Only {
+		instance.ipv6OnlyHosts.Add(1)
+	}
+
+	if clients.rebinding != nil && ctx.Err() == nil {
+		if result.Rebinding = instance.detectRebinding(clients.rebinding, hostname, host); result.Rebinding != nil {
+			instance.rebindingHosts.Add(1)
+		}
+	}
+
+	if instance.options.Json && clients.https != nil && ctx.Err() == nil {
+		instance.options.RateLimiter.Take()
+		result.HTTPS = lookupHTTPSHints(clients.https, hostname)
+	}
+
+	if instance.options.ASNInfo {
+		result.ASN = instance.asnInfo(host)
+	}
+	if instance.geoDB != nil {
+		result.GeoIP = instance.geoInfo(host)
+	}
+	if instance.options.Cloud {
+		if provider, ok := instance.cloudProvider(host); ok {
+			result.Cloud = provider
+		}
+	}
+	if instance.options.CDN {
+		for _, ip := range host.IPs {
+			if provider, ok := instance.cdnMatcher.Lookup(ip); ok {
+				result.CDN = &provider
+				break
+			}
+		}
+	}
+
+	var buffer strings.Builder
+
+	switch {
+	case instance.options.Json:
+		hostnameJson, err := json.Marshal(result)
+		if err != nil {
+			instance.logger.Error().Msgf("could not marshal output as json: %v", err)
 		}
-	})
 
-	swg.Wait()
+		buffer.WriteString(string(hostnameJson))
+		buffer.WriteString("\n")
+	case instance.options.HttpxOutput:
+		// Hosts in excluded ranges are never worth probing
+		if excluded {
+			instance.reportDropped(hostname, DropExcluded)
+			return outputLine{}, false
+		}
+		var ports []uint16
+		if ctx.Err() == nil {
+			instance.options.RateLimiter.Take()
+			ports = lookupHTTPSPorts(clients.https, hostname)
+		}
+		for _, target := range httpxTargets(hostname, ports) {
+			buffer.WriteString(target)
+			buffer.WriteString("\n")
+		}
+	default:
+		buffer.WriteString(hostname)
+		if excluded {
+			buffer.WriteString(" [excluded]")
+		}
+		if dnssec == dnsclient.DNSSECBogus {
+			buffer.WriteString(" [dnssec-bogus]")
+		}
+		if result.IPv6Only {
+			buffer.WriteString(" [ipv6-only]")
+		}
+		if len(reserved) > 0 {
+			buffer.WriteString(" [reserved:" + strings.Join(reserved, ",") + "]")
+		}
+		if len(crowded) > 0 {
+			buffer.WriteString(" [crowded:" + strings.Join(crowded, ",") + "]")
+		}
+		if result.Takeover != nil {
+			buffer.WriteString(" " + result.Takeover.String())
+		}
+		if len(result.NSTakeover) > 0 {
+			buffer.WriteString(" [ns-takeover:" + strings.Join(result.NSTakeover, ",") + "]")
+		}
+		buffer.WriteString("\n")
+	}
 
-	gologger.Info().Msgf("Total resolved: %d\n", resolvedCount)
+	return outputLine{data: buffer.String(), result: result}, true
+}
 
-	// Close the files and return
-	if output != nil {
-		w.Flush()
-		output.Close()
+// isIPv6Only tells whether the host resolved to ipv6 addresses only
+func isIPv6Only(ips []string) bool {
+	for _, ip := range ips {
+		if !strings.Contains(ip, ":") {
+			return false
+		}
 	}
-	return nil
+	return len(ips) > 0
 }
@@ -0,0 +1,247 @@
+package massdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/cdn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/formatter"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/retryabledns"
+	"github.com/stretchr/testify/require"
+)
+
+// staticBackend resolves every hostname to the same ip
+type staticBackend string
+
+func (b staticBackend) Name() string { return "static" }
+
+func (b staticBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	for _, hostname := range strings.Fields(string(data)) {
+		if err := onRecord(&parser.Record{Domain: hostname, IPs: []string{string(b)}, Status: "NOERROR"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wildcardClient answers every name with the same ip
+type wildcardClient string
+
+func (c wildcardClient) QueryOne(hostname string) (*retryabledns.DNSData, error) {
+	return &retryabledns.DNSData{Host: hostname, A: []string{string(c)}, StatusCode: "NOERROR"}, nil
+}
+
+func (c wildcardClient) QueryMultiple(hostname string) (*retryabledns.DNSData, error) {
+	return c.QueryOne(hostname)
+}
+
+func TestResolutionChunks(t *testing.T) {
+	// No chunk has enough hosts on the wildcard ip to check it on its own
+	dir := t.TempDir()
+	var chunks []string
+	for _, hostnames := range []string{"a.example.com\nb.example.com\nc.example.com\n", "d.example.com\ne.example.com\nf.example.com\n"} {
+		chunk := filepath.Join(dir, "chunk-"+hostnames[:1])
+		require.Nil(t, os.WriteFile(chunk, []byte(hostnames), 0644), "Could not write chunk")
+		chunks = append(chunks, chunk)
+	}
+
+	var written []string
+	dropped := make(map[string]DropReason)
+	instance, err := New(Options{
+		Domains:          []string{"example.com"},
+		TempDir:          dir,
+		WildcardsThreads: 1,
+		NoStdout:         true,
+		CustomBackend:    staticBackend("10.0.0.1"),
+		TrustedClient:    wildcardClient("10.0.0.1"),
+		NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+		OnHostname:       func(hostname string) { written = append(written, hostname) },
+		OnDropped:        func(hostname string, reason DropReason) { dropped[hostname] = reason },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+
+	resolution, err := instance.NewResolution()
+	require.Nil(t, err, "Could not create resolution")
+	defer resolution.Close()
+	for _, chunk := range chunks {
+		require.Nil(t, resolution.Resolve(context.Background(), chunk), "Could not resolve chunk")
+	}
+	require.Empty(t, written, "Wrote hosts before the last chunk")
+	require.Nil(t, resolution.Finish(context.Background()), "Could not finish resolution")
+
+	require.Empty(t, written, "Wrote wildcard hosts")
+	require.Len(t, dropped, 6, "Got unexpected drops")
+	for hostname, reason := range dropped {
+		require.Equal(t, DropWildcard, reason, "Got unexpected drop reason for %s", hostname)
+	}
+}
+
+func TestResultAnnotations(t *testing.T) {
+	// The json output and the results callback carry the same annotations
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	require.Nil(t, os.WriteFile(input, []byte("www.example.com\n"), 0644), "Could not write input")
+	ranges := filepath.Join(dir, "ranges")
+	require.Nil(t, os.WriteFile(ranges, []byte("examplecdn 192.0.2.0/24\n"), 0644), "Could not write cdn ranges")
+	output := filepath.Join(dir, "output")
+
+	var results []*Result
+	instance, err := New(Options{
+		Domains:          []string{"example.com"},
+		TempDir:          dir,
+		InputFile:        input,
+		OutputFile:       output,
+		Json:             true,
+		CDN:              true,
+		CDNRanges:        ranges,
+		WildcardsThreads: 1,
+		NoStdout:         true,
+		CustomBackend:    staticBackend("192.0.2.10"),
+		NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+		OnResult:         func(result *Result) { results = append(results, result) },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+	require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+	require.Len(t, results, 1, "Got unexpected results")
+	require.Equal(t, &cdn.Provider{Name: "examplecdn", Type: "cdn"}, results[0].CDN, "Got wrong cdn provider")
+
+	data, err := os.ReadFile(output)
+	require.Nil(t, err, "Could not read output")
+	require.Equal(t, `{"hostname":"www.example.com","status":"NOERROR","ips":["192.0.2.10"],"cdn":{"name":"examplecdn","type":"cdn"}}`, strings.TrimSpace(string(data)), "Got wrong json output")
+}
+
+func TestStoreRecordHosts(t *testing.T) {
+	// The answer details are only stored when the output needs them
+	record := &parser.Record{Domain: "www.example.com", IPs: []string{"10.0.0.1"}, Status: "NOERROR"}
+	for _, json := range []bool{false, true} {
+		instance, err := New(Options{Domains: []string{"example.com"}, TempDir: t.TempDir(), Json: json})
+		require.Nil(t, err, "Could not create massdns instance")
+
+		st := store.NewMemory()
+		require.Nil(t, instance.storeRecord(st, record, ""), "Could not store record")
+		require.Equal(t, "www.example.com", st.GetHostnames("10.0.0.1"), "Hostname was not indexed by ip")
+		_, err = st.GetHost("www.example.com")
+		require.Equal(t, json, err == nil, "Got unexpected host details with json %v", json)
+	}
+}
+
+func TestDualStackOutput(t *testing.T) {
+	// The hosts only resolving to ipv6 are tagged in the plain output
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	require.Nil(t, os.WriteFile(input, []byte("www.example.com\n"), 0644), "Could not write input")
+	output := filepath.Join(dir, "output")
+
+	instance, err := New(Options{
+		Domains:          []string{"example.com"},
+		TempDir:          dir,
+		InputFile:        input,
+		OutputFile:       output,
+		DualStack:        true,
+		WildcardsThreads: 1,
+		NoStdout:         true,
+		CustomBackend:    staticBackend("2001:db8::1"),
+		NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+	require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+	data, err := os.ReadFile(output)
+	require.Nil(t, err, "Could not read output")
+	require.Equal(t, "www.example.com [ipv6-only]\n", string(data), "Got wrong output")
+}
+
+// indexBackend resolves every hostname to its own ip, by its line in the input
+type indexBackend struct{}
+
+func (b indexBackend) Name() string { return "index" }
+
+func (b indexBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	for i, hostname := range strings.Fields(string(data)) {
+		ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		if err := onRecord(&parser.Record{Domain: hostname, IPs: []string{ip}, Status: "NOERROR"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWriteOutputWorkers(t *testing.T) {
+	// The hosts formatted by the workers are written whole by the single writer
+	const hosts = 5000
+	dir := t.TempDir()
+	var input strings.Builder
+	for i := 0; i < hosts; i++ {
+		fmt.Fprintf(&input, "host%d.example.com\n", i)
+	}
+	inputFile := filepath.Join(dir, "input")
+	require.Nil(t, os.WriteFile(inputFile, []byte(input.String()), 0644), "Could not write input")
+	output := filepath.Join(dir, "output")
+
+	writer := &logWriter{}
+	logger := &gologger.Logger{}
+	logger.SetMaxLevel(levels.LevelInfo)
+	logger.SetFormatter(formatter.NewCLI(true))
+	logger.SetWriter(writer)
+
+	var results int
+	instance, err := New(Options{
+		Domains:          []string{"example.com"},
+		TempDir:          dir,
+		InputFile:        inputFile,
+		OutputFile:       output,
+		Json:             true,
+		WildcardsThreads: 16,
+		NoStdout:         true,
+		Logger:           logger,
+		CustomBackend:    indexBackend{},
+		NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+		OnResult:         func(result *Result) { results++ },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+	require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+	data, err := os.ReadFile(output)
+	require.Nil(t, err, "Could not read output")
+	seen := make(map[string]struct{}, hosts)
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var result Result
+		require.Nil(t, json.Unmarshal([]byte(line), &result), "Got interleaved line %q", line)
+		require.Len(t, result.IPs, 1, "Got unexpected ips for %s", result.Hostname)
+		seen[result.Hostname] = struct{}{}
+	}
+	require.Len(t, seen, hosts, "Got unexpected hosts")
+	require.Equal(t, hosts, results, "Got unexpected results")
+	require.Contains(t, writer.messages, fmt.Sprintf("[INF] Total resolved: %d", hosts), "Got unexpected resolved count")
+}
+
+// logWriter collects the log messages
+type logWriter struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (w *logWriter) Write(data []byte, level levels.Level) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.messages = append(w.messages, string(data))
+}
@@ -0,0 +1,55 @@
+package massdns
+
+import (
+	"net"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+)
+
+// rebindingProbes is the number of times the hosts are re-resolved looking
+// for answers flipping between public and special-use addresses
+const rebindingProbes = 3
+
+// detectRebinding re-resolves the host and returns the addresses it answered
+// with when its answers flip between public and special-use addresses, the
+// behavior of the DNS rebinding services, and nil otherwise
+func (instance *Instance) detectRebinding(client dnsclient.Client, hostname string, host *store.Host) []string {
+	var addresses []string
+	seen := make(map[string]struct{})
+	add := func(ips []string) {
+		for _, ip := range ips {
+			if _, ok := seen[ip]; !ok {
+				seen[ip] = struct{}{}
+				addresses = append(addresses, ip)
+			}
+		}
+	}
+	add(host.IPs)
+	for i := 0; i < rebindingProbes; i++ {
+		instance.options.RateLimiter.Take()
+		resp, err := client.QueryMultiple(hostname)
+		if err != nil || resp == nil {
+			continue
+		}
+		add(resp.A)
+		add(resp.AAAA)
+	}
+
+	var public, reserved bool
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		if inNetworks(ip, instance.reservedCIDRs) {
+			reserved = true
+		} else {
+			public = true
+		}
+	}
+	if !public || !reserved {
+		return nil
+	}
+	return addresses
+}
@@ -0,0 +1,116 @@
+package massdns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
+)
+
+// ReloadSignal makes the instances sharing it reload their resolvers
+// before resolving their next chunk, leaving the other instances alone.
+type ReloadSignal struct {
+	// generation is increased every time a reload of the resolvers is requested
+	generation atomic.Int64
+}
+
+// Request requests a reload of the resolvers
+func (s *ReloadSignal) Request() {
+	s.generation.Add(1)
+}
+
+// load returns the number of reloads requested, none if the signal is nil
+func (s *ReloadSignal) load() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.generation.Load()
+}
+
+// reloadResolvers reloads the resolvers if a reload was requested or the
+// resolvers files were modified since they were loaded. massdns is run on
+// a copy of the resolvers file, so that the file can be rewritten safely
+// and a broken rewrite keeps the previous resolvers.
+func (instance *Instance) reloadResolvers() {
+	if instance.options.ResolversFile == "" {
+		return
+	}
+
+	generation := instance.options.ReloadSignal.load()
+	modTime := instance.resolversModTime()
+	if instance.resolversFile != "" && generation == instance.resolversGeneration && modTime.Equal(instance.resolversLoaded) {
+		return
+	}
+	initial := instance.resolversFile == ""
+	instance.resolversGeneration = generation
+	instance.resolversLoaded = modTime
+
+	if err := instance.copyResolvers(); err != nil {
+		if initial {
+			// The file was validated on start, fall back to using it directly
+			instance.resolversFile = instance.options.ResolversFile
+		}
+		instance.logger.Error().Msgf("Could not reload resolvers, keeping the previous ones: %s\n", err)
+		return
+	}
+	if initial {
+		return
+	}
+
+	if instance.options.TrustedResolvers != "" {
+		resolvers, err := wildcards.LoadResolversFromFile(instance.options.TrustedResolvers)
+		if err == nil && len(resolvers) == 0 {
+			err = errors.New("blank trusted resolvers file")
+		}
+		if err != nil {
+			instance.logger.Error().Msgf("Could not reload trusted resolvers, keeping the previous ones: %s\n", err)
+		} else if resolver, err := wildcards.NewResolver(instance.options.Domains, instance.options.Retries, resolvers, instance.options.Proxy); err == nil {
+			resolver.SetRateLimiter(instance.options.RateLimiter)
+			instance.wildcardResolver = resolver
+			instance.resolvers = resolvers
+		}
+	}
+	instance.logger.Info().Msgf("Reloaded resolvers from %s\n", instance.options.ResolversFile)
+}
+
+// copyResolvers copies the resolvers file to the one given to massdns
+func (instance *Instance) copyResolvers() error {
+	data, err := os.ReadFile(instance.options.ResolversFile)
+	if err != nil {
+		return err
+	}
+	if len(instance.quarantinedResolvers) > 0 {
+		data = instance.dropQuarantined(data)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ErrEmptyResolvers
+	}
+
+	if instance.resolversFile == "" || instance.resolversFile == instance.options.ResolversFile {
+		file, err := os.CreateTemp(instance.options.TempDir, "resolvers-")
+		if err != nil {
+			return fmt.Errorf("could not create resolvers copy: %w", err)
+		}
+		file.Close()
+		instance.resolversFile = file.Name()
+	}
+	return os.WriteFile(instance.resolversFile, data, 0644)
+}
+
+// resolversModTime returns the latest modification time of the resolvers files
+func (instance *Instance) resolversModTime() time.Time {
+	var latest time.Time
+	for _, file := range []string{instance.options.ResolversFile, instance.options.TrustedResolvers} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,43 @@
+package massdns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadSignal(t *testing.T) {
+	dir := t.TempDir()
+	resolversFile := filepath.Join(dir, "resolvers.txt")
+	require.Nil(t, os.WriteFile(resolversFile, []byte("127.0.0.1\n"), 0644), "Could not write resolvers")
+
+	// The instances of another enumeration keep their resolvers
+	signal, other := &ReloadSignal{}, &ReloadSignal{}
+	var instances []*Instance
+	for _, reload := range []*ReloadSignal{signal, signal, other} {
+		instance, err := New(Options{Domains: []string{"example.com"}, ResolversFile: resolversFile, TempDir: dir, ReloadSignal: reload})
+		require.Nil(t, err, "Could not create massdns instance")
+		instance.reloadResolvers()
+		instances = append(instances, instance)
+	}
+
+	// Rewrite the resolvers without changing their modification time
+	modTime := time.Now().Add(-time.Hour)
+	require.Nil(t, os.Chtimes(resolversFile, modTime, modTime), "Could not set resolvers modification time")
+	for _, instance := range instances {
+		instance.reloadResolvers()
+	}
+	require.Nil(t, os.WriteFile(resolversFile, []byte("127.0.0.2\n"), 0644), "Could not rewrite resolvers")
+	require.Nil(t, os.Chtimes(resolversFile, modTime, modTime), "Could not set resolvers modification time")
+
+	signal.Request()
+	for i, expected := range []string{"127.0.0.2\n", "127.0.0.2\n", "127.0.0.1\n"} {
+		instances[i].reloadResolvers()
+		data, err := os.ReadFile(instances[i].resolversFile)
+		require.Nil(t, err, "Could not read resolvers copy")
+		require.Equal(t, expected, string(data), "Got unexpected resolvers for instance %d", i)
+	}
+}
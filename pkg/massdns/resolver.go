@@ -2,8 +2,8 @@ package massdns
 
 // trustedResolvers contains some resolvers used in verification step
 var trustedResolvers = []string{
-	"1.1.1.1",
-	"1.0.0.1",
-	"8.8.8.8",
-	"8.8.4.4",
+	"1.1.1.1:53",
+	"1.0.0.1:53",
+	"8.8.8.8:53",
+	"8.8.4.4:53",
 }
@@ -0,0 +1,111 @@
+package massdns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/miekg/dns"
+)
+
+// retryRateLimit is the max queries per second sent to each trusted
+// resolver by the retry of the names left without reply, when no verify
+// rate limit is configured
+const retryRateLimit = 10
+
+// markReplied records that a reply was received for the name
+func (instance *Instance) markReplied(name string) {
+	if !instance.options.RetryTimeouts {
+		return
+	}
+	instance.repliedMutex.Lock()
+	instance.replied[strings.ToLower(name)] = struct{}{}
+	instance.repliedMutex.Unlock()
+}
+
+// retryTimeouts resolves the names of the input file which got no reply at
+// all, timed out or dropped on the way, with the trusted resolvers at a
+// conservative rate, returning the records found to onRecord
+func (instance *Instance) retryTimeouts(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer input.Close()
+
+	retryFile, err := os.CreateTemp(instance.options.TempDir, "retry-")
+	if err != nil {
+		return fmt.Errorf("could not create retry list: %w", err)
+	}
+	defer os.Remove(retryFile.Name())
+	defer retryFile.Close()
+
+	var pending int
+	writer := bufio.NewWriter(retryFile)
+	scanner := bufio.NewScanner(input)
+	instance.repliedMutex.Lock()
+	for scanner.Scan() {
+		hostname := strings.TrimSpace(scanner.Text())
+		if hostname == "" {
+			continue
+		}
+		if _, ok := instance.replied[strings.ToLower(hostname)]; ok {
+			continue
+		}
+		pending++
+		_, _ = writer.WriteString(hostname + "\n")
+	}
+	instance.repliedMutex.Unlock()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read input file: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("could not write retry list: %w", err)
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	resolvers, err := instance.loadTrustedResolvers()
+	if err != nil {
+		return err
+	}
+	rateLimit := instance.options.VerifyRateLimit
+	if rateLimit <= 0 {
+		rateLimit = retryRateLimit
+	}
+	questionTypes := []uint16{dns.TypeA}
+	if instance.options.DualStack {
+		questionTypes = append(questionTypes, dns.TypeAAAA)
+	}
+	client, err := dnsclient.New(dnsclient.Options{
+		Resolvers:         resolvers,
+		QuestionTypes:     questionTypes,
+		Retries:           instance.options.VerifyRetries,
+		Timeout:           instance.options.VerifyTimeout,
+		ResolverRateLimit: rateLimit,
+		Rotation:          instance.options.ResolverRotation,
+		MaxInFlight:       instance.options.ResolverMaxInFlight,
+		Proxy:             instance.options.Proxy,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create dns resolver: %w", err)
+	}
+
+	instance.logger.Info().Msgf("Retrying %d names left without reply with the trusted resolvers\n", pending)
+	var recovered int
+	backend := &nativeBackend{instance: instance, client: client, retry: true}
+	err = backend.Resolve(ctx, retryFile.Name(), func(record *parser.Record) error {
+		recovered++
+		return onRecord(record)
+	})
+	if err != nil {
+		return err
+	}
+	instance.logger.Info().Msgf("Recovered %d of the %d names left without reply\n", recovered, pending)
+	return nil
+}
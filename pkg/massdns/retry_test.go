@@ -0,0 +1,118 @@
+package massdns
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// partialBackend resolves the hostnames having a reply to their ip, in
+// lowercase like massdns, the other ones getting none as if they timed out
+type partialBackend map[string]string
+
+func (b partialBackend) Name() string { return "partial" }
+
+func (b partialBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	for _, hostname := range strings.Fields(strings.ToLower(string(data))) {
+		ip, ok := b[hostname]
+		if !ok {
+			continue
+		}
+		if err := onRecord(&parser.Record{Domain: hostname, IPs: []string{ip}, Status: "NOERROR"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryRecorder records the names queried from a resolver
+type queryRecorder struct {
+	mutex sync.Mutex
+	names []string
+}
+
+func (r *queryRecorder) record(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.names = append(r.names, strings.TrimSuffix(name, "."))
+}
+
+// Names returns the sorted names queried so far
+func (r *queryRecorder) Names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := append([]string(nil), r.names...)
+	sort.Strings(names)
+	return names
+}
+
+// startRecordingResolver starts a resolver answering the hostnames of the
+// map, and NXDOMAIN to the other names, recording the names queried
+func startRecordingResolver(t *testing.T, answers map[string]string, queries *queryRecorder) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		question := req.Question[0]
+		queries.record(question.Name)
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		if ip, ok := answers[strings.TrimSuffix(question.Name, ".")]; !ok {
+			resp.Rcode = dns.RcodeNameError
+		} else if question.Qtype == dns.TypeA {
+			rr, _ := dns.NewRR(question.Name + " 60 IN A " + ip)
+			resp.Answer = append(resp.Answer, rr)
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestRetryTimeouts(t *testing.T) {
+	// Only the names left without reply are retried with the trusted resolvers
+	queries := &queryRecorder{}
+	builtin := trustedResolvers
+	trustedResolvers = []string{startRecordingResolver(t, map[string]string{"c.example.com": "10.0.0.3"}, queries)}
+	t.Cleanup(func() { trustedResolvers = builtin })
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	require.Nil(t, os.WriteFile(input, []byte("a.example.com\nB.example.com\nc.example.com\nd.example.com\n"), 0644), "Could not write input")
+
+	var hostnames []string
+	instance, err := New(Options{
+		Domains:          []string{"example.com"},
+		TempDir:          dir,
+		InputFile:        input,
+		RetryTimeouts:    true,
+		VerifyRetries:    1,
+		VerifyRateLimit:  100,
+		WildcardsThreads: 1,
+		NoStdout:         true,
+		CustomBackend:    partialBackend{"a.example.com": "10.0.0.1", "b.example.com": "10.0.0.2"},
+		TrustedClient:    wildcardClient("10.0.0.9"),
+		NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+		OnHostname:       func(hostname string) { hostnames = append(hostnames, hostname) },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+	require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+	require.Equal(t, []string{"c.example.com", "d.example.com"}, queries.Names(), "Got unexpected retried names")
+	sort.Strings(hostnames)
+	require.Equal(t, []string{"a.example.com", "b.example.com", "c.example.com"}, hostnames, "Got unexpected hosts")
+}
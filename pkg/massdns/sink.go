@@ -0,0 +1,234 @@
+package massdns
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+// OutputSink is a destination of the results. Write is called for
+// every result from a single goroutine, and Flush from the same goroutine
+// every flush interval and at the end of every massdns run.
+type OutputSink interface {
+	// Write writes a result, line being its output in the output
+	// format (plain, json or httpx) with the trailing newline
+	Write(result *Result, line string) error
+	// Flush writes the buffered results
+	Flush() error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// writerSink writes the output lines of the results to a writer
+type writerSink struct {
+	writer *bufio.Writer
+	closer io.Closer
+}
+
+// NewWriterSink creates a sink writing the output lines of the results
+// to the writer as they come, the writer not being closed by Close
+func NewWriterSink(writer io.Writer) OutputSink {
+	return &writerSink{writer: bufio.NewWriter(writer)}
+}
+
+// NewFileSink creates a sink writing the output lines of the results to
+// the file, appended to its content or replacing it
+func NewFileSink(path string, appendOutput bool) (OutputSink, error) {
+	return NewFileSinkSize(path, appendOutput, 0)
+}
+
+// NewFileSinkSize creates a file sink whose buffer has at least the size
+// in bytes, the default size being used if 0
+func NewFileSinkSize(path string, appendOutput bool, size int) (OutputSink, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendOutput {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{writer: bufio.NewWriterSize(file, size), closer: file}, nil
+}
+
+// Write writes the output line of the result
+func (s *writerSink) Write(result *Result, line string) error {
+	_, err := s.writer.WriteString(line)
+	if err != nil || s.closer != nil {
+		return err
+	}
+	// Results written to another process are not held back
+	return s.writer.Flush()
+}
+
+// Flush writes the buffered lines
+func (s *writerSink) Flush() error {
+	return s.writer.Flush()
+}
+
+// Close flushes the lines and closes the file
+func (s *writerSink) Close() error {
+	err := s.writer.Flush()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// stdoutSink prints the output lines of the results
+type stdoutSink struct {
+	logger *gologger.Logger
+}
+
+// NewStdoutSink creates a sink printing the output lines of the results
+// with the logger, which keeps them apart from the log lines. gologger's
+// default logger is used if nil.
+func NewStdoutSink(logger *gologger.Logger) OutputSink {
+	if logger == nil {
+		logger = gologger.DefaultLogger
+	}
+	return stdoutSink{logger: logger}
+}
+
+// Write prints the output line of the result
+func (s stdoutSink) Write(result *Result, line string) error {
+	s.logger.Print().Msgf("%s", line)
+	return nil
+}
+
+// Flush does nothing as the lines are printed as they come
+func (stdoutSink) Flush() error { return nil }
+
+// Close does nothing as the lines are printed as they come
+func (stdoutSink) Close() error { return nil }
+
+// jsonSink writes the results to a writer as json lines
+type jsonSink struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONSink creates a sink writing the results to the writer as json
+// lines, whatever the output format, the writer not being closed by Close
+func NewJSONSink(writer io.Writer) OutputSink {
+	buffered := bufio.NewWriter(writer)
+	return &jsonSink{writer: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+// Write writes the result as a json line
+func (s *jsonSink) Write(result *Result, line string) error {
+	return s.encoder.Encode(result)
+}
+
+// Flush writes the buffered lines
+func (s *jsonSink) Flush() error {
+	return s.writer.Flush()
+}
+
+// Close flushes the lines
+func (s *jsonSink) Close() error {
+	return s.writer.Flush()
+}
+
+// webhookBatchSize is the number of results posted at once to a webhook
+const webhookBatchSize = 100
+
+// webhookTimeout bounds the requests posting the results to a webhook
+const webhookTimeout = 30 * time.Second
+
+// webhookSink posts the results to an url as json arrays
+type webhookSink struct {
+	url     string
+	client  *http.Client
+	results []*Result
+}
+
+// NewWebhookSink creates a sink posting the results to the url as json
+// arrays, in batches of 100 results and on every flush
+func NewWebhookSink(url string) OutputSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Write adds the result to the batch, posting it once full
+func (s *webhookSink) Write(result *Result, line string) error {
+	s.results = append(s.results, result)
+	if len(s.results) < webhookBatchSize {
+		return nil
+	}
+	return s.Flush()
+}
+
+// Flush posts the batch of results. The batch is dropped if the post fails.
+func (s *webhookSink) Flush() error {
+	if len(s.results) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(s.results)
+	s.results = nil
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not post results: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("could not post results: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Close posts the last batch of results
+func (s *webhookSink) Close() error {
+	return s.Flush()
+}
+
+// openSinks opens the sinks of a run: the output file, the output writer,
+// stdout and the sinks of the options. The returned function flushes them,
+// closing the ones opened for the run only.
+func (instance *Instance) openSinks() ([]OutputSink, func(), error) {
+	var opened []OutputSink
+	if instance.options.OutputFile != "" {
+		// Subsequent runs of the instance append to the output of the first one
+		sink, err := NewFileSinkSize(instance.options.OutputFile, instance.outputCreated, instance.options.OutputBufferSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create massdns output file: %v", err)
+		}
+		instance.outputCreated = true
+		opened = append(opened, sink)
+	}
+	if instance.options.OutputWriter != nil {
+		opened = append(opened, NewWriterSink(instance.options.OutputWriter))
+	}
+	if !instance.options.NoStdout {
+		opened = append(opened, NewStdoutSink(instance.logger))
+	}
+
+	sinks := append(opened, instance.options.Sinks...)
+	closeSinks := func() {
+		for _, sink := range opened {
+			if err := sink.Close(); err != nil {
+				instance.logger.Error().Msgf("Could not write results: %s\n", err)
+			}
+		}
+		for _, sink := range instance.options.Sinks {
+			if err := sink.Flush(); err != nil {
+				instance.logger.Error().Msgf("Could not write results: %s\n", err)
+			}
+		}
+	}
+	return sinks, closeSinks, nil
+}
@@ -0,0 +1,173 @@
+package massdns
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	fileutil "github.com/projectdiscovery/utils/file"
+)
+
+// The run directory contains the state of an enumeration to resume it:
+//
+//	chunks/<hash>.massdns  the massdns output of a completed input chunk
+//	chunks/<hash>.records  the records of a fully resolved chunk
+//	wildcards.txt          the snapshot of the wildcard ips found so far
+const (
+	chunksDirName     = "chunks"
+	wildcardsFileName = "wildcards.txt"
+)
+
+// IsRunStateFile returns true if the path relative to the run directory is
+// a file of the state of the run, the temporary files being left out
+func IsRunStateFile(path string) bool {
+	path = filepath.ToSlash(path)
+	if path == wildcardsFileName {
+		return true
+	}
+	name, ok := strings.CutPrefix(path, chunksDirName+"/")
+	return ok && !strings.Contains(name, "/") && (strings.HasSuffix(name, ".massdns") || strings.HasSuffix(name, ".records"))
+}
+
+// loadRunState creates the run directory or restores the state it contains
+func (instance *Instance) loadRunState() error {
+	chunksDir := filepath.Join(instance.options.RunDir, chunksDirName)
+	if err := os.MkdirAll(chunksDir, 0755); err != nil {
+		return fmt.Errorf("could not create run directory: %w", err)
+	}
+
+	wildcardsFile := filepath.Join(instance.options.RunDir, wildcardsFileName)
+	if fileutil.FileExists(wildcardsFile) {
+		if err := instance.wildcardStore.LoadFromFile(wildcardsFile); err != nil {
+			return fmt.Errorf("could not load wildcards snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// chunkPath returns the path of a file of the chunk in the run directory
+func (instance *Instance) chunkPath(hash, extension string) string {
+	return filepath.Join(instance.options.RunDir, chunksDirName, hash+extension)
+}
+
+// saveWildcards snapshots the wildcard ips found so far
+func (instance *Instance) saveWildcards() error {
+	if instance.wildcardStore.IsEmpty() {
+		return nil
+	}
+	wildcardsFile := filepath.Join(instance.options.RunDir, wildcardsFileName)
+	if err := instance.wildcardStore.SaveToFile(wildcardsFile + ".tmp"); err != nil {
+		return fmt.Errorf("could not save wildcards snapshot: %w", err)
+	}
+	if err := os.Rename(wildcardsFile+".tmp", wildcardsFile); err != nil {
+		return fmt.Errorf("could not save wildcards snapshot: %w", err)
+	}
+	return nil
+}
+
+// chunkRecords saves the records resolved for a chunk of the input, the
+// file being kept once the whole chunk was resolved
+type chunkRecords struct {
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// newChunkRecords creates the records file of the chunk, none being
+// saved if the hash is empty
+func (instance *Instance) newChunkRecords(hash string) (*chunkRecords, error) {
+	if hash == "" {
+		return &chunkRecords{}, nil
+	}
+	path := instance.chunkPath(hash, ".records")
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not save chunk state: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	return &chunkRecords{path: path, file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+// Write saves the record
+func (c *chunkRecords) Write(record *parser.Record) error {
+	if c.file == nil {
+		return nil
+	}
+	if err := c.encoder.Encode(record); err != nil {
+		return fmt.Errorf("could not save chunk state: %w", err)
+	}
+	return nil
+}
+
+// Commit marks the chunk as resolved
+func (c *chunkRecords) Commit() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.writer.Flush()
+	c.file.Close()
+	c.file = nil
+	if err == nil {
+		err = os.Rename(c.path+".tmp", c.path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not save chunk state: %w", err)
+	}
+	return nil
+}
+
+// Close discards the records of a chunk which was not fully resolved
+func (c *chunkRecords) Close() {
+	if c.file == nil {
+		return
+	}
+	c.file.Close()
+	os.Remove(c.path + ".tmp")
+}
+
+// restoreChunk stores the records resolved for a chunk by a previous run
+func (instance *Instance) restoreChunk(hash string, st store.Store) error {
+	file, err := os.Open(instance.chunkPath(hash, ".records"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		record := &parser.Record{}
+		if err := decoder.Decode(record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not restore chunk state: %w", err)
+		}
+		instance.countParsed(1)
+		if err := instance.storeRecord(st, record, ""); err != nil {
+			return err
+		}
+	}
+}
+
+// hashFile returns the hex encoded sha256 of the file content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
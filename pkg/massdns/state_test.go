@@ -0,0 +1,91 @@
+package massdns
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingBackend resolves every hostname to the same ip and records the
+// inputs it was given
+type recordingBackend struct {
+	staticBackend
+	inputs []string
+}
+
+func (b *recordingBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	b.inputs = append(b.inputs, filepath.Base(inputFile))
+	return b.staticBackend.Resolve(ctx, inputFile, onRecord)
+}
+
+func TestResumeChunks(t *testing.T) {
+	// The chunks resolved by a previous run are restored, the others resolved again
+	dir, runDir := t.TempDir(), t.TempDir()
+	chunks := make(map[string]string)
+	for name, hostname := range map[string]string{"resolved": "a.example.com", "interrupted": "b.example.com"} {
+		chunks[name] = filepath.Join(dir, name)
+		require.Nil(t, os.WriteFile(chunks[name], []byte(hostname+"\n"), 0644), "Could not write chunk")
+	}
+	newInstance := func(backend *recordingBackend, onHostname func(string)) *Instance {
+		instance, err := New(Options{
+			Domains:          []string{"example.com"},
+			TempDir:          dir,
+			RunDir:           runDir,
+			WildcardsThreads: 1,
+			NoStdout:         true,
+			CustomBackend:    backend,
+			TrustedClient:    wildcardClient("10.0.0.2"),
+			NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+			OnHostname:       onHostname,
+		})
+		require.Nil(t, err, "Could not create massdns instance")
+		return instance
+	}
+
+	// The first run resolves a chunk and is interrupted while resolving the other
+	first := &recordingBackend{staticBackend: "10.0.0.1"}
+	resolution, err := newInstance(first, nil).NewResolution()
+	require.Nil(t, err, "Could not create resolution")
+	require.Nil(t, resolution.Resolve(context.Background(), chunks["resolved"]), "Could not resolve chunk")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Nil(t, resolution.Resolve(ctx, chunks["interrupted"]), "Could not resolve chunk")
+	resolution.Close()
+
+	resolvedHash, err := hashFile(chunks["resolved"])
+	require.Nil(t, err, "Could not hash chunk")
+	interruptedHash, err := hashFile(chunks["interrupted"])
+	require.Nil(t, err, "Could not hash chunk")
+	require.FileExists(t, filepath.Join(runDir, chunksDirName, resolvedHash+".records"), "Resolved chunk was not committed")
+	require.NoFileExists(t, filepath.Join(runDir, chunksDirName, interruptedHash+".records"), "Interrupted chunk was committed")
+	require.NoFileExists(t, filepath.Join(runDir, chunksDirName, interruptedHash+".records.tmp"), "Interrupted chunk was not discarded")
+
+	// The records of a run which crashed while writing them are left uncommitted
+	stale, err := json.Marshal(&parser.Record{Domain: "stale.example.com", IPs: []string{"10.0.0.1"}, Status: "NOERROR"})
+	require.Nil(t, err, "Could not encode stale record")
+	require.Nil(t, os.WriteFile(filepath.Join(runDir, chunksDirName, interruptedHash+".records.tmp"), stale, 0644), "Could not write stale records")
+
+	// The resumed run only resolves the chunk which was not committed
+	second := &recordingBackend{staticBackend: "10.0.0.1"}
+	var hostnames []string
+	resolution, err = newInstance(second, func(hostname string) { hostnames = append(hostnames, hostname) }).NewResolution()
+	require.Nil(t, err, "Could not create resolution")
+	defer resolution.Close()
+	for _, name := range []string{"resolved", "interrupted"} {
+		require.Nil(t, resolution.Resolve(context.Background(), chunks[name]), "Could not resolve chunk")
+	}
+	require.Nil(t, resolution.Finish(context.Background()), "Could not finish resolution")
+
+	require.Equal(t, []string{"interrupted"}, second.inputs, "Got unexpected resolved chunks")
+	sort.Strings(hostnames)
+	require.Equal(t, []string{"a.example.com", "b.example.com"}, hostnames, "Got unexpected hosts")
+	require.FileExists(t, filepath.Join(runDir, chunksDirName, interruptedHash+".records"), "Resumed chunk was not committed")
+	require.NoFileExists(t, filepath.Join(runDir, chunksDirName, interruptedHash+".records.tmp"), "Stale records were not replaced")
+}
@@ -0,0 +1,114 @@
+package massdns
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counters count the work of the instances given them with the options,
+// eg. the instances of a single enumeration.
+type Counters struct {
+	hostsParsed    atomic.Int64
+	wildcardChecks atomic.Int64
+	wildcardDrops  atomic.Int64
+
+	// replies are the replies of the resolvers in the massdns output,
+	// counted with the ResolverStats option
+	repliesMutex sync.Mutex
+	replies      map[string]*ResolverReplies
+}
+
+// ResolverReplies are the replies of a resolver in the massdns output
+type ResolverReplies struct {
+	// Resolver is the address of the resolver (eg. 8.8.8.8:53)
+	Resolver string `json:"resolver"`
+	// Answers are the NOERROR and NXDOMAIN replies
+	Answers int64 `json:"answers"`
+	// Errors are the other replies, eg. SERVFAIL or REFUSED
+	Errors int64 `json:"errors"`
+}
+
+// ErrorRate returns the ratio of the error replies to all the replies
+func (r ResolverReplies) ErrorRate() float64 {
+	if total := r.Answers + r.Errors; total > 0 {
+		return float64(r.Errors) / float64(total)
+	}
+	return 0
+}
+
+// Resolvers returns the replies of the resolvers counted so far, by
+// decreasing error rate
+func (c *Counters) Resolvers() []ResolverReplies {
+	c.repliesMutex.Lock()
+	defer c.repliesMutex.Unlock()
+
+	resolvers := make([]ResolverReplies, 0, len(c.replies))
+	for _, replies := range c.replies {
+		resolvers = append(resolvers, *replies)
+	}
+	sort.Slice(resolvers, func(i, j int) bool {
+		if rateI, rateJ := resolvers[i].ErrorRate(), resolvers[j].ErrorRate(); rateI != rateJ {
+			return rateI > rateJ
+		}
+		return resolvers[i].Resolver < resolvers[j].Resolver
+	})
+	return resolvers
+}
+
+// countReply counts a reply of the resolver with the response code
+func (c *Counters) countReply(resolver, status string) {
+	c.repliesMutex.Lock()
+	defer c.repliesMutex.Unlock()
+
+	if c.replies == nil {
+		c.replies = make(map[string]*ResolverReplies)
+	}
+	replies, ok := c.replies[resolver]
+	if !ok {
+		replies = &ResolverReplies{Resolver: resolver}
+		c.replies[resolver] = replies
+	}
+	switch status {
+	case "NOERROR", "NXDOMAIN":
+		replies.Answers++
+	default:
+		replies.Errors++
+	}
+}
+
+// HostsParsed returns the number of hosts parsed from the massdns output so far
+func (c *Counters) HostsParsed() int64 {
+	return c.hostsParsed.Load()
+}
+
+// WildcardChecks returns the number of hostnames checked for wildcards so far
+func (c *Counters) WildcardChecks() int64 {
+	return c.wildcardChecks.Load()
+}
+
+// WildcardDrops returns the number of hostnames dropped as wildcards so far
+func (c *Counters) WildcardDrops() int64 {
+	return c.wildcardDrops.Load()
+}
+
+// countParsed counts the hosts parsed by the instance
+func (instance *Instance) countParsed(hosts int64) {
+	if instance.options.Counters != nil {
+		instance.options.Counters.hostsParsed.Add(hosts)
+	}
+}
+
+// countWildcardCheck counts a hostname checked for wildcards by the instance
+func (instance *Instance) countWildcardCheck() {
+	if instance.options.Counters != nil {
+		instance.options.Counters.wildcardChecks.Add(1)
+	}
+}
+
+// countWildcardDrops counts the hostnames dropped as wildcards by the instance
+func (instance *Instance) countWildcardDrops(hosts int64) {
+	if instance.options.Counters != nil {
+		instance.options.Counters.wildcardDrops.Add(hosts)
+	}
+}
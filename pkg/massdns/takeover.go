@@ -0,0 +1,170 @@
+package massdns
+
+import (
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/retryabledns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// takeoverFingerprints maps the services known to allow claiming the
+// resources left behind by their customers to their cname suffixes
+var takeoverFingerprints = []struct {
+	service  string
+	suffixes []string
+}{
+	{"aws-s3", []string{"s3.amazonaws.com"}},
+	{"aws-elastic-beanstalk", []string{"elasticbeanstalk.com"}},
+	{"azure", []string{"azurewebsites.net", "cloudapp.net", "cloudapp.azure.com", "trafficmanager.net", "blob.core.windows.net", "azure-api.net", "azureedge.net"}},
+	{"bitbucket", []string{"bitbucket.io"}},
+	{"canny", []string{"canny.io"}},
+	{"fastly", []string{"fastly.net"}},
+	{"ghost", []string{"ghost.io"}},
+	{"github-pages", []string{"github.io"}},
+	{"heroku", []string{"herokuapp.com", "herokudns.com", "herokussl.com"}},
+	{"helpjuice", []string{"helpjuice.com"}},
+	{"helpscout", []string{"helpscoutdocs.com"}},
+	{"netlify", []string{"netlify.app", "netlify.com"}},
+	{"ngrok", []string{"ngrok.io"}},
+	{"pantheon", []string{"pantheonsite.io"}},
+	{"readme", []string{"readme.io"}},
+	{"shopify", []string{"myshopify.com"}},
+	{"surge", []string{"surge.sh"}},
+	{"unbounce", []string{"unbouncepages.com"}},
+	{"webflow", []string{"proxy.webflow.com", "proxy-ssl.webflow.com"}},
+	{"wordpress", []string{"wordpress.com"}},
+	{"zendesk", []string{"zendesk.com"}},
+}
+
+// Takeover describes a host whose cname may be claimed by a third party
+type Takeover struct {
+	// CNAME is the last target of the cname chain
+	CNAME string `json:"cname"`
+	// Fingerprint is the takeover-prone service the chain points to, if any
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Dangling is set when the target doesn't exist
+	Dangling bool `json:"dangling,omitempty"`
+}
+
+// String returns the marker of the takeover in the plain output
+func (t *Takeover) String() string {
+	var markers []string
+	if t.Fingerprint != "" {
+		markers = append(markers, t.Fingerprint)
+	}
+	if t.Dangling {
+		markers = append(markers, "dangling")
+	}
+	return "[takeover:" + strings.Join(markers, ",") + "]"
+}
+
+// matchTakeoverFingerprint returns the takeover-prone service the cname belongs to
+func matchTakeoverFingerprint(cname string) string {
+	cname = "." + strings.ToLower(cname)
+	for _, fingerprint := range takeoverFingerprints {
+		for _, suffix := range fingerprint.suffixes {
+			if strings.HasSuffix(cname, "."+suffix) {
+				return fingerprint.service
+			}
+		}
+	}
+	return ""
+}
+
+// detectTakeover returns the takeover the cname chain of the host is a
+// candidate to, or nil. Hosts without addresses are dangling when the
+// trusted resolvers don't know their last target.
+func (instance *Instance) detectTakeover(client dnsclient.Client, hostname string, host *store.Host) *Takeover {
+	if len(host.CNAMEs) == 0 {
+		return nil
+	}
+
+	candidate := &Takeover{CNAME: host.CNAMEs[len(host.CNAMEs)-1]}
+	for _, cname := range host.CNAMEs {
+		if candidate.Fingerprint = matchTakeoverFingerprint(cname); candidate.Fingerprint != "" {
+			break
+		}
+	}
+	if len(host.IPs) == 0 {
+		instance.options.RateLimiter.Take()
+		resp, err := client.QueryOne(candidate.CNAME)
+		if err != nil {
+			instance.logger.Debug().Msgf("could not resolve cname target of %s: %s: %s\n", hostname, candidate.CNAME, err)
+		} else {
+			candidate.Dangling = resp.StatusCode == "NXDOMAIN"
+		}
+	}
+
+	if candidate.Fingerprint == "" && !candidate.Dangling {
+		return nil
+	}
+	instance.takeoverCandidates.Add(1)
+	return candidate
+}
+
+// detectNSTakeover returns the name servers the zone of the hostname is
+// delegated to whose base domain is not registered, anyone registering
+// it being able to answer for the zone. Hosts which are not the apex of
+// a zone have no delegation.
+func (instance *Instance) detectNSTakeover(client dnsclient.Client, hostname string, host *store.Host) []string {
+	// The name servers of an alias are the ones of its target
+	if len(host.CNAMEs) > 0 {
+		return nil
+	}
+
+	instance.options.RateLimiter.Take()
+	resp, err := client.QueryOne(hostname)
+	if err != nil {
+		instance.logger.Debug().Msgf("could not resolve name servers of %s: %s\n", hostname, err)
+		return nil
+	}
+
+	var unregistered []string
+	for _, nameserver := range delegatedNameservers(hostname, resp) {
+		base, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(strings.TrimSuffix(nameserver, ".")))
+		if err != nil {
+			continue
+		}
+		if !instance.isRegistered(client, base) {
+			unregistered = append(unregistered, nameserver)
+		}
+	}
+	if len(unregistered) > 0 {
+		instance.takeoverCandidates.Add(1)
+	}
+	return unregistered
+}
+
+// isRegistered returns false if the trusted resolvers don't know the
+// domain. The answers are cached since zones share their name servers.
+func (instance *Instance) isRegistered(client dnsclient.Client, domain string) bool {
+	if registered, ok := instance.registeredDomains.Load(domain); ok {
+		return registered.(bool)
+	}
+
+	instance.options.RateLimiter.Take()
+	resp, err := client.QueryOne(domain)
+	// Domains which could not be checked are not flagged
+	registered := err != nil || resp.StatusCode != "NXDOMAIN"
+	instance.registeredDomains.Store(domain, registered)
+	return registered
+}
+
+// delegatedNameservers returns the name servers answered for the hostname,
+// leaving out the ones of the parent zone some resolvers add as authority
+func delegatedNameservers(hostname string, resp *retryabledns.DNSData) []string {
+	if resp.RawResp == nil {
+		return nil
+	}
+
+	var nameservers []string
+	for _, rr := range resp.RawResp.Answer {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(strings.TrimSuffix(ns.Hdr.Name, "."), hostname) {
+			nameservers = append(nameservers, strings.TrimSuffix(ns.Ns, "."))
+		}
+	}
+	return nameservers
+}
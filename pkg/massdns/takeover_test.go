@@ -0,0 +1,125 @@
+package massdns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/retryabledns"
+	"github.com/stretchr/testify/require"
+)
+
+// zoneClient answers NXDOMAIN to the names which don't exist, and
+// NOERROR to the other ones with the name servers of the zones
+type zoneClient struct {
+	nxdomain    []string
+	nameservers map[string][]string
+}
+
+func (c zoneClient) QueryOne(hostname string) (*retryabledns.DNSData, error) {
+	if slices.Contains(c.nxdomain, hostname) {
+		return &retryabledns.DNSData{Host: hostname, StatusCode: "NXDOMAIN"}, nil
+	}
+	resp := &dns.Msg{}
+	for _, nameserver := range c.nameservers[hostname] {
+		resp.Answer = append(resp.Answer, &dns.NS{Hdr: dns.RR_Header{Name: dns.Fqdn(hostname), Rrtype: dns.TypeNS, Class: dns.ClassINET}, Ns: dns.Fqdn(nameserver)})
+	}
+	return &retryabledns.DNSData{Host: hostname, StatusCode: "NOERROR", RawResp: resp}, nil
+}
+
+func (c zoneClient) QueryMultiple(hostname string) (*retryabledns.DNSData, error) {
+	return c.QueryOne(hostname)
+}
+
+func TestDetectTakeover(t *testing.T) {
+	client := zoneClient{nxdomain: []string{"gone.example.net", "gone.s3.amazonaws.com"}}
+	tests := []struct {
+		name     string
+		host     *store.Host
+		takeover *Takeover
+	}{
+		{
+			name:     "dangling",
+			host:     &store.Host{CNAMEs: []string{"gone.example.net"}},
+			takeover: &Takeover{CNAME: "gone.example.net", Dangling: true},
+		},
+		{
+			name:     "fingerprint",
+			host:     &store.Host{CNAMEs: []string{"www.example.net", "site.herokuapp.com"}, IPs: []string{"10.0.0.1"}},
+			takeover: &Takeover{CNAME: "site.herokuapp.com", Fingerprint: "heroku"},
+		},
+		{
+			name:     "dangling fingerprint",
+			host:     &store.Host{CNAMEs: []string{"gone.s3.amazonaws.com"}},
+			takeover: &Takeover{CNAME: "gone.s3.amazonaws.com", Fingerprint: "aws-s3", Dangling: true},
+		},
+		{
+			name: "clean",
+			host: &store.Host{CNAMEs: []string{"lb.example.net"}, IPs: []string{"10.0.0.1"}},
+		},
+		{
+			name: "existing target",
+			host: &store.Host{CNAMEs: []string{"lb.example.net"}},
+		},
+		{
+			name: "no cname",
+			host: &store.Host{IPs: []string{"10.0.0.1"}},
+		},
+	}
+	for _, test := range tests {
+		instance := &Instance{logger: gologger.DefaultLogger}
+		takeover := instance.detectTakeover(client, "www.example.com", test.host)
+		require.Equal(t, test.takeover, takeover, "Got unexpected takeover for %s", test.name)
+		candidates := int64(0)
+		if test.takeover != nil {
+			candidates = 1
+		}
+		require.Equal(t, candidates, instance.takeoverCandidates.Load(), "Got unexpected candidates for %s", test.name)
+	}
+}
+
+func TestTakeoverString(t *testing.T) {
+	require.Equal(t, "[takeover:aws-s3,dangling]", (&Takeover{Fingerprint: "aws-s3", Dangling: true}).String(), "Got unexpected marker")
+	require.Equal(t, "[takeover:dangling]", (&Takeover{Dangling: true}).String(), "Got unexpected marker")
+}
+
+func TestDetectNSTakeover(t *testing.T) {
+	client := zoneClient{
+		nxdomain: []string{"lapsed-dns.net"},
+		nameservers: map[string][]string{
+			"example.com":     {"ns1.lapsed-dns.net", "ns1.example.net"},
+			"dev.example.com": {"ns1.example.net", "ns2.example.net"},
+		},
+	}
+	tests := []struct {
+		name         string
+		hostname     string
+		host         *store.Host
+		unregistered []string
+	}{
+		{name: "unregistered", hostname: "example.com", host: &store.Host{IPs: []string{"10.0.0.1"}}, unregistered: []string{"ns1.lapsed-dns.net"}},
+		{name: "registered", hostname: "dev.example.com", host: &store.Host{IPs: []string{"10.0.0.1"}}},
+		{name: "not delegated", hostname: "www.example.com", host: &store.Host{IPs: []string{"10.0.0.1"}}},
+		{name: "alias", hostname: "example.com", host: &store.Host{CNAMEs: []string{"lb.example.net"}, IPs: []string{"10.0.0.1"}}},
+	}
+	for _, test := range tests {
+		instance := &Instance{logger: gologger.DefaultLogger}
+		unregistered := instance.detectNSTakeover(client, test.hostname, test.host)
+		require.Equal(t, test.unregistered, unregistered, "Got unexpected name servers for %s", test.name)
+		candidates := int64(0)
+		if len(test.unregistered) > 0 {
+			candidates = 1
+		}
+		require.Equal(t, candidates, instance.takeoverCandidates.Load(), "Got unexpected candidates for %s", test.name)
+	}
+
+	// The unregistered name servers are marked in the plain output
+	instance := &Instance{logger: gologger.DefaultLogger}
+	line, ok := instance.formatResult(context.Background(), resultClients{takeover: client, delegation: client}, "example.com", &store.Host{Status: "NOERROR", IPs: []string{"10.0.0.1"}}, false, nil, nil)
+	require.True(t, ok, "Could not format result")
+	require.Equal(t, "example.com [ns-takeover:ns1.lapsed-dns.net]\n", line.data, "Got unexpected output")
+	require.Equal(t, []string{"ns1.lapsed-dns.net"}, line.result.NSTakeover, "Got unexpected result")
+}
@@ -1,7 +1,10 @@
 package massdns
 
 import (
+	"context"
 	"os"
+	"sort"
+	"strings"
 )
 
 // IsEmptyFile checks if the file is empty.
@@ -18,6 +21,50 @@ func (instance *Instance) DumpWildcardsToFile(filename string) error {
 	return instance.wildcardStore.SaveToFile(filename)
 }
 
+// recordReserved counts the host answering with special-use addresses and
+// keeps them for the separate report
+func (instance *Instance) recordReserved(hostname string, ips []string) {
+	instance.reservedHosts.Add(1)
+
+	instance.reservedMutex.Lock()
+	defer instance.reservedMutex.Unlock()
+	instance.reserved[hostname] = ips
+}
+
+// DumpReservedToFile writes the hosts answering with special-use addresses
+// to the file, one "hostname ip,ip" line per host sorted by hostname
+func (instance *Instance) DumpReservedToFile(filename string) error {
+	instance.reservedMutex.Lock()
+	defer instance.reservedMutex.Unlock()
+
+	hostnames := make([]string, 0, len(instance.reserved))
+	for hostname := range instance.reserved {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	var buffer strings.Builder
+	for _, hostname := range hostnames {
+		buffer.WriteString(hostname + " " + strings.Join(instance.reserved[hostname], ",") + "\n")
+	}
+	return os.WriteFile(filename, []byte(buffer.String()), 0o644)
+}
+
+// TrustedResolvers returns the resolvers used for native lookups
+func (instance *Instance) TrustedResolvers() []string {
+	return instance.resolvers
+}
+
+// HasWildcard returns true if host is the root of a wildcard, hosts
+// not being checked once ctx is done. The roots are reported to OnWildcard.
+func (instance *Instance) HasWildcard(ctx context.Context, host string) bool {
+	if !instance.wildcardResolver.HasWildcard(ctx, host) {
+		return false
+	}
+	instance.reportWildcard(host, nil)
+	return true
+}
+
 func (instance *Instance) LoadWildcardsFromFile(filename string) error {
 	return instance.wildcardStore.LoadFromFile(filename)
 }
@@ -0,0 +1,102 @@
+package massdns
+
+import (
+	"fmt"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
+	"github.com/miekg/dns"
+	"github.com/projectdiscovery/retryabledns"
+)
+
+// VerifyTypes are the record types accepted by the trusted verification
+var VerifyTypes = []string{"a", "aaaa", "cname"}
+
+// defaultVerifyTypes are the record types accepted when none are configured
+var defaultVerifyTypes = []string{"a", "cname"}
+
+// verifyTypes returns the record types accepted by the trusted verification
+func (instance *Instance) verifyTypes() []string {
+	if len(instance.options.VerifyTypes) == 0 {
+		return defaultVerifyTypes
+	}
+	return instance.options.VerifyTypes
+}
+
+// verifyQuestionTypes returns the queries needed to verify the record
+// types. The CNAME records are part of the answers to the A queries.
+func (instance *Instance) verifyQuestionTypes() []uint16 {
+	var questionTypes []uint16
+	var hasA, hasAAAA bool
+	for _, recordType := range instance.verifyTypes() {
+		switch recordType {
+		case "a", "cname":
+			hasA = true
+		case "aaaa":
+			hasAAAA = true
+		}
+	}
+	if hasA {
+		questionTypes = append(questionTypes, dns.TypeA)
+	}
+	if hasAAAA {
+		questionTypes = append(questionTypes, dns.TypeAAAA)
+	}
+	return questionTypes
+}
+
+// verifiedType returns the first accepted record type found in the
+// answers of the trusted resolvers, or an empty string if none was.
+func (instance *Instance) verifiedType(resp *retryabledns.DNSData) string {
+	for _, recordType := range instance.verifyTypes() {
+		var records []string
+		switch recordType {
+		case "a":
+			records = resp.A
+		case "aaaa":
+			records = resp.AAAA
+		case "cname":
+			records = resp.CNAME
+		}
+		if len(records) > 0 {
+			return recordType
+		}
+	}
+	return ""
+}
+
+// newVerifyClient creates the client of the trusted verification, querying
+// the trusted resolvers or the built-in ones if none were given.
+func (instance *Instance) newVerifyClient() (dnsclient.Client, error) {
+	resolvers, err := instance.loadTrustedResolvers()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dnsclient.New(dnsclient.Options{
+		Resolvers:         resolvers,
+		QuestionTypes:     instance.verifyQuestionTypes(),
+		Retries:           instance.options.VerifyRetries,
+		Timeout:           instance.options.VerifyTimeout,
+		ResolverRateLimit: instance.options.VerifyRateLimit,
+		Rotation:          instance.options.ResolverRotation,
+		MaxInFlight:       instance.options.ResolverMaxInFlight,
+		Proxy:             instance.options.Proxy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create dns resolver: %w", err)
+	}
+	return client, nil
+}
+
+// loadTrustedResolvers returns the trusted resolvers, or the built-in ones if none were given
+func (instance *Instance) loadTrustedResolvers() ([]string, error) {
+	if instance.options.TrustedResolvers == "" {
+		return trustedResolvers, nil
+	}
+	resolvers, err := wildcards.LoadResolversFromFile(instance.options.TrustedResolvers)
+	if err != nil {
+		return nil, fmt.Errorf("could not load trusted resolvers: %w", err)
+	}
+	return resolvers, nil
+}
@@ -0,0 +1,150 @@
+package massdns
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startResolver starts a resolver answering the hostname, and NXDOMAIN to the other names
+func startResolver(t *testing.T, hostname, ip string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		if req.Question[0].Name == dns.Fqdn(hostname) && req.Question[0].Qtype == dns.TypeA {
+			rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A " + ip)
+			resp.Answer = append(resp.Answer, rr)
+		} else if req.Question[0].Name != dns.Fqdn(hostname) {
+			resp.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestVerifyBuiltinResolvers(t *testing.T) {
+	// Without trusted resolvers -verify queries the built-in ones
+	builtin := trustedResolvers
+	trustedResolvers = []string{startResolver(t, "www.example.com", "10.0.0.1")}
+	t.Cleanup(func() { trustedResolvers = builtin })
+
+	dir := t.TempDir()
+	massdnsOutput := filepath.Join(dir, "massdns.txt")
+	err := os.WriteFile(massdnsOutput, []byte(`;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+www.example.com. 300 IN A 10.0.0.1
+
+;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 2
+
+;; ANSWER SECTION:
+poisoned.example.com. 300 IN A 10.0.0.2
+`), 0644)
+	require.Nil(t, err, "Could not write massdns output")
+
+	dropped := make(map[string]DropReason)
+	var hostnames []string
+	instance, err := New(Options{
+		Domains:    []string{"example.com"},
+		MassdnsRaw: massdnsOutput,
+		TempDir:    dir,
+		OutputFile: filepath.Join(dir, "output.txt"),
+		Verify:     true,
+		NoStdout:   true,
+		NewStore:   func() (store.Store, error) { return store.NewMemory(), nil },
+		OnHostname: func(hostname string) { hostnames = append(hostnames, hostname) },
+		OnDropped:  func(hostname string, reason DropReason) { dropped[hostname] = reason },
+	})
+	require.Nil(t, err, "Could not create massdns instance")
+	require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+	require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected verified hosts")
+	require.Equal(t, map[string]DropReason{"poisoned.example.com": DropUnverified}, dropped, "Got unexpected dropped hosts")
+}
+
+// startFlakyResolver starts a resolver ignoring the first queries, as if
+// they were lost, and answering the following ones with the ip
+func startFlakyResolver(t *testing.T, ip string, lost int64) string {
+	var queries atomic.Int64
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if queries.Add(1) <= lost {
+			return
+		}
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A " + ip)
+		resp.Answer = append(resp.Answer, rr)
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestVerifyRetries(t *testing.T) {
+	// The hosts are verified as long as the trusted resolvers answer within the retries
+	const lost = 2
+	tests := []struct {
+		retries  int
+		verified bool
+	}{
+		{retries: lost + 1, verified: true},
+		{retries: lost, verified: false},
+	}
+	builtin := trustedResolvers
+	t.Cleanup(func() { trustedResolvers = builtin })
+	for _, test := range tests {
+		trustedResolvers = []string{startFlakyResolver(t, "10.0.0.1", lost)}
+
+		dir := t.TempDir()
+		input := filepath.Join(dir, "input")
+		require.Nil(t, os.WriteFile(input, []byte("www.example.com\n"), 0644), "Could not write input")
+
+		var hostnames []string
+		dropped := make(map[string]DropReason)
+		instance, err := New(Options{
+			Domains:          []string{"example.com"},
+			TempDir:          dir,
+			InputFile:        input,
+			Verify:           true,
+			VerifyRetries:    test.retries,
+			VerifyTimeout:    100 * time.Millisecond,
+			VerifyRateLimit:  100,
+			WildcardsThreads: 1,
+			NoStdout:         true,
+			CustomBackend:    staticBackend("10.0.0.1"),
+			TrustedClient:    wildcardClient("10.0.0.9"),
+			NewStore:         func() (store.Store, error) { return store.NewMemory(), nil },
+			OnHostname:       func(hostname string) { hostnames = append(hostnames, hostname) },
+			OnDropped:        func(hostname string, reason DropReason) { dropped[hostname] = reason },
+		})
+		require.Nil(t, err, "Could not create massdns instance")
+		require.Nil(t, instance.Run(context.Background()), "Could not run massdns instance")
+
+		if test.verified {
+			require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected verified hosts with %d retries", test.retries)
+			require.Empty(t, dropped, "Got unexpected dropped hosts with %d retries", test.retries)
+			require.Zero(t, instance.verifyFailures.Load(), "Got unexpected verify failures with %d retries", test.retries)
+		} else {
+			require.Empty(t, hostnames, "Got unexpected verified hosts with %d retries", test.retries)
+			require.Equal(t, map[string]DropReason{"www.example.com": DropUnverified}, dropped, "Got unexpected dropped hosts with %d retries", test.retries)
+			require.Equal(t, int64(1), instance.verifyFailures.Load(), "Got unexpected verify failures with %d retries", test.retries)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcsScope is the oauth scope of the objects of the buckets
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// GCSOptions configures a Google Cloud Storage store
+type GCSOptions struct {
+	Bucket      string             // Bucket is the name of the bucket
+	Prefix      string             // Prefix is the prefix of the keys of the store
+	Endpoint    string             // Endpoint is the url of the xml api, https://storage.googleapis.com being used if empty
+	TokenSource oauth2.TokenSource // TokenSource authenticates the requests, the application default credentials being used if nil
+}
+
+// NewGCS creates a store of a Google Cloud Storage bucket, served by its
+// S3 compatible xml api. The requests are authenticated with the oauth
+// tokens of the credentials instead of HMAC keys, the application default
+// credentials being the service account of the instance, the workload
+// identity or the file of GOOGLE_APPLICATION_CREDENTIALS.
+func NewGCS(ctx context.Context, options GCSOptions) (*S3, error) {
+	tokens := options.TokenSource
+	if tokens == nil {
+		credentials, err := google.FindDefaultCredentials(ctx, gcsScope)
+		if err != nil {
+			return nil, fmt.Errorf("could not find google credentials: %w", err)
+		}
+		tokens = credentials.TokenSource
+	}
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+
+	return NewS3(ctx, S3Options{Bucket: options.Bucket, Prefix: options.Prefix, Config: &aws.Config{
+		Region:       "auto",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String(endpoint),
+		HTTPClient:   &http.Client{Transport: &oauth2.Transport{Source: tokens}},
+	}})
+}
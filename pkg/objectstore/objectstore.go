@@ -0,0 +1,76 @@
+// Package objectstore keeps files in the buckets of object storages, for
+// the run states checkpointed by instances which may disappear.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when the object doesn't exist
+var ErrNotFound = errors.New("object not found")
+
+// Store is a prefix of a bucket, the keys being relative to the prefix
+type Store interface {
+	// Put uploads the file to the key
+	Put(ctx context.Context, key, file string) error
+	// Get downloads the object of the key to the file
+	Get(ctx context.Context, key, file string) error
+	// List returns the keys of the objects under the prefix
+	List(ctx context.Context) ([]string, error)
+}
+
+// New creates the store of the url, by scheme: s3://bucket/prefix for
+// S3 and the compatible storages given by AWS_ENDPOINT_URL, with the
+// credentials of the default chain of the AWS sdk, and gs://bucket/prefix
+// for Google Cloud Storage, with the application default credentials.
+func New(ctx context.Context, rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object storage url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, errors.New("no bucket specified")
+	}
+
+	bucket, prefix := u.Host, strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		return NewS3(ctx, S3Options{Bucket: bucket, Prefix: prefix})
+	case "gs":
+		return NewGCS(ctx, GCSOptions{Bucket: bucket, Prefix: prefix})
+	default:
+		return nil, fmt.Errorf("unsupported object storage scheme %q", u.Scheme)
+	}
+}
+
+// prefixedKey returns the object key of the key of a store
+func prefixedKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// download writes the object being read to the file, replacing it once
+// the whole object is read
+func download(object io.Reader, file string) error {
+	output, err := os.Create(file + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, object); err != nil {
+		output.Close()
+		os.Remove(file + ".tmp")
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
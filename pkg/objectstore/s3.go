@@ -0,0 +1,129 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Options configures an S3 compatible store
+type S3Options struct {
+	Bucket string      // Bucket is the name of the bucket
+	Prefix string      // Prefix is the prefix of the keys of the store
+	Config *aws.Config // Config configures the client, the default configuration of the sdk being loaded if nil
+}
+
+// S3 is a store of an S3 compatible storage. The buckets of the custom
+// endpoints are addressed in the path, the AWS ones in the host.
+type S3 struct {
+	options S3Options
+	client  *s3.Client
+}
+
+// NewS3 creates a store of the bucket, the credentials, region and
+// endpoint being read from the environment, the shared configuration
+// files, the web identity token or the instance metadata when the
+// options have no configuration
+func NewS3(ctx context.Context, options S3Options) (*S3, error) {
+	if options.Bucket == "" {
+		return nil, errors.New("no bucket specified")
+	}
+
+	var cfg aws.Config
+	if options.Config != nil {
+		cfg = options.Config.Copy()
+	} else {
+		loaded, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not load aws configuration: %w", err)
+		}
+		cfg = loaded
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = o.BaseEndpoint != nil
+	})
+	return &S3{options: options, client: client}, nil
+}
+
+// Put uploads the file to the key
+func (s *S3) Put(ctx context.Context, key, file string) error {
+	body, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	info, err := body.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.options.Bucket),
+		Key:           aws.String(s.key(key)),
+		Body:          body,
+		ContentLength: aws.Int64(info.Size()),
+	})
+	if err != nil {
+		return fmt.Errorf("could not put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get downloads the object of the key to the file
+func (s *S3) Get(ctx context.Context, key, file string) error {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.options.Bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		var responseErr *awshttp.ResponseError
+		if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("could not get %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	if err := download(output.Body, file); err != nil {
+		return fmt.Errorf("could not get %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the keys of the objects under the prefix
+func (s *S3) List(ctx context.Context) ([]string, error) {
+	prefix := s.key("")
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.options.Bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var keys []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(object.Key), prefix))
+		}
+	}
+	return keys, nil
+}
+
+// key returns the object key of the key of the store
+func (s *S3) key(key string) string {
+	return prefixedKey(s.options.Prefix, key)
+}
@@ -0,0 +1,126 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// fakeS3 is a bucket of objects served in the path
+type fakeS3 struct {
+	// authorization is the prefix of the authorization header of the requests
+	authorization string
+
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+// fakeS3List is the page of a ListObjectsV2 request
+type fakeS3List struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Contents    []fakeS3Object
+	IsTruncated bool
+}
+
+type fakeS3Object struct {
+	Key string
+}
+
+func (f *fakeS3) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.Header.Get("Authorization"), f.authorization) {
+		http.Error(rw, "unauthorized", http.StatusForbidden)
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/bucket"), "/")
+	switch {
+	case req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		f.objects[key] = data
+	case key == "" && req.URL.Query().Get("list-type") == "2":
+		var keys []string
+		for key := range f.objects {
+			if strings.HasPrefix(key, req.URL.Query().Get("prefix")) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var list fakeS3List
+		for _, key := range keys {
+			list.Contents = append(list.Contents, fakeS3Object{Key: key})
+		}
+		_ = xml.NewEncoder(rw).Encode(list)
+	default:
+		data, ok := f.objects[key]
+		if !ok {
+			rw.Header().Set("Content-Type", "application/xml")
+			rw.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(rw, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		_, _ = rw.Write(data)
+	}
+}
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{authorization: "AWS4-HMAC-SHA256 Credential=key/", objects: make(map[string][]byte)})
+	defer server.Close()
+
+	ctx := context.Background()
+	s, err := NewS3(ctx, S3Options{Bucket: "bucket", Prefix: "jobs/1", Config: &aws.Config{
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+	}})
+	require.Nil(t, err, "Could not create store")
+	testStore(t, s)
+}
+
+func TestGCS(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{authorization: "Bearer token", objects: make(map[string][]byte)})
+	defer server.Close()
+
+	s, err := NewGCS(context.Background(), GCSOptions{
+		Bucket:      "bucket",
+		Prefix:      "jobs/1",
+		Endpoint:    server.URL,
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+	})
+	require.Nil(t, err, "Could not create store")
+	testStore(t, s)
+}
+
+// testStore puts, lists and gets an object of the store
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "state.txt")
+	require.Nil(t, os.WriteFile(file, []byte("chunk\n"), 0644), "Could not write file")
+	require.Nil(t, s.Put(ctx, "chunks/a b.done", file), "Could not put object")
+
+	keys, err := s.List(ctx)
+	require.Nil(t, err, "Could not list objects")
+	require.Equal(t, []string{"chunks/a b.done"}, keys, "Got unexpected keys")
+
+	downloaded := filepath.Join(dir, "downloaded.txt")
+	require.Nil(t, s.Get(ctx, "chunks/a b.done", downloaded), "Could not get object")
+	data, err := os.ReadFile(downloaded)
+	require.Nil(t, err, "Could not read downloaded object")
+	require.Equal(t, "chunk\n", string(data), "Got unexpected object")
+
+	require.ErrorIs(t, s.Get(ctx, "missing", downloaded), ErrNotFound, "Got a missing object")
+}
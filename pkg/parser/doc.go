@@ -5,5 +5,9 @@
 // Only a subset of information, more specifically Name and
 // IP address is parsed from the output. It correctly handles
 // CNAME record entries outputting the first name and the subsequent
-// A records. NS records are ignored in the current implementation.
+// A and AAAA records. NS records are ignored in the current implementation.
+//
+// The outputs of other resolvers (dnsx, zdns) are parsed by the parsers
+// registered under their format name, and new formats are added by
+// registering a Parser.
 package parser
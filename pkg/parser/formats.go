@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// dnsxRecord is a line of the dnsx json output
+type dnsxRecord struct {
+	Host       string   `json:"host"`
+	A          []string `json:"a"`
+	CNAME      []string `json:"cname"`
+	StatusCode string   `json:"status_code"`
+	Resolver   []string `json:"resolver"`
+	TTL        *int     `json:"ttl"`
+}
+
+// parseDNSX parses the dnsx json output (`dnsx -json -resp`)
+func parseDNSX(reader io.Reader, onRecord OnRecordFN) error {
+	return parseJSONLines(reader, onRecord, func(line []byte) (*Record, error) {
+		var dnsx dnsxRecord
+		if err := json.Unmarshal(line, &dnsx); err != nil {
+			return nil, err
+		}
+		record := &Record{
+			Domain: strings.TrimSuffix(dnsx.Host, "."),
+			IPs:    dnsx.A,
+			Status: dnsx.StatusCode,
+			TTL:    dnsx.TTL,
+		}
+		for _, cname := range dnsx.CNAME {
+			record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(cname, "."))
+		}
+		if len(dnsx.Resolver) > 0 {
+			record.Resolver = dnsx.Resolver[0]
+		}
+		return record, nil
+	})
+}
+
+// zdnsRecord is a line of the zdns json output
+type zdnsRecord struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Data   struct {
+		Answers []struct {
+			Type   string `json:"type"`
+			Answer string `json:"answer"`
+			TTL    *int   `json:"ttl"`
+		} `json:"answers"`
+		Resolver string `json:"resolver"`
+	} `json:"data"`
+}
+
+// parseZDNS parses the zdns json output (eg. `zdns A`)
+func parseZDNS(reader io.Reader, onRecord OnRecordFN) error {
+	return parseJSONLines(reader, onRecord, func(line []byte) (*Record, error) {
+		var zdns zdnsRecord
+		if err := json.Unmarshal(line, &zdns); err != nil {
+			return nil, err
+		}
+		record := &Record{
+			Domain:   strings.TrimSuffix(zdns.Name, "."),
+			Status:   zdns.Status,
+			Resolver: zdns.Data.Resolver,
+		}
+		for _, answer := range zdns.Data.Answers {
+			switch answer.Type {
+			case "A", "AAAA":
+				record.IPs = append(record.IPs, answer.Answer)
+			case "CNAME":
+				record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(answer.Answer, "."))
+			default:
+				continue
+			}
+			if answer.TTL != nil {
+				record.setTTL(*answer.TTL)
+			}
+		}
+		return record, nil
+	})
+}
+
+// fdnsRecord is a line of a Rapid7 Forward DNS (FDNS) dataset
+type fdnsRecord struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// parseFDNS parses a Rapid7 Forward DNS dataset, one answer per line.
+// The answers of a hostname are returned as separate records, and the
+// records other than a, aaaa and cname are skipped.
+func parseFDNS(reader io.Reader, onRecord OnRecordFN) error {
+	return parseJSONLines(reader, onRecord, func(line []byte) (*Record, error) {
+		var fdns fdnsRecord
+		if err := json.Unmarshal(line, &fdns); err != nil {
+			return nil, err
+		}
+		record := &Record{Domain: strings.ToLower(strings.TrimSuffix(fdns.Name, "."))}
+		switch strings.ToLower(fdns.Type) {
+		case "a", "aaaa":
+			record.IPs = []string{fdns.Value}
+		case "cname":
+			record.CNAMEs = []string{strings.ToLower(strings.TrimSuffix(fdns.Value, "."))}
+		}
+		return record, nil
+	})
+}
+
+// parseJSONLines parses one json record per line, returning the records
+// with answers or a NOERROR status to onRecord
+func parseJSONLines(reader io.Reader, onRecord OnRecordFN, parseLine func(line []byte) (*Record, error)) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		record, err := parseLine(line)
+		if err != nil {
+			return err
+		}
+		if record.Domain == "" {
+			continue
+		}
+		if len(record.IPs) == 0 && len(record.CNAMEs) == 0 && record.Status != "NOERROR" {
+			continue
+		}
+		if err := onRecord(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -2,12 +2,40 @@ package parser
 
 import (
 	"bufio"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
+// Record is a single resolved name parsed from massdns output
+type Record struct {
+	// Domain is the queried name
+	Domain string
+	// IPs are the A and AAAA records the name resolved to
+	IPs []string
+	// CNAMEs are the canonical names in the resolution chain
+	CNAMEs []string
+	// Status is the response code of the reply (eg. NOERROR)
+	Status string
+	// Resolver is the resolver which answered (eg. 8.8.8.8:53)
+	Resolver string
+	// TTL is the lowest ttl of the answers, nil if the format has none
+	TTL *int
+}
+
+// setTTL keeps the lowest ttl of the answers of the record
+func (r *Record) setTTL(ttl int) {
+	if r.TTL == nil || ttl < *r.TTL {
+		r.TTL = &ttl
+	}
+}
+
+type OnRecordFN func(record *Record) error
+
 type OnResultFN func(domain string, ip []string) error
 
 type DNSRecord struct {
@@ -43,7 +71,7 @@ const (
 	ParseNDJSON   ParseOption = true
 )
 
-func ParseFile(filename string, callback OnResultFN, option ParseOption) error {
+func ParseFile(filename string, callback OnRecordFN, option ParseOption) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -53,16 +81,85 @@ func ParseFile(filename string, callback OnResultFN, option ParseOption) error {
 	return Parse(file, callback, option)
 }
 
-func Parse(reader io.Reader, callback OnResultFN, ndjson ParseOption) error {
+func Parse(reader io.Reader, callback OnRecordFN, ndjson ParseOption) error {
 	if ndjson {
 		return parseNDJSON(reader, callback)
 	}
 	return parseRaw(reader, callback)
 }
 
-// parseRaw parses the massdns output returning the found
-// domain and ip pair to a onResult function.
-func parseRaw(reader io.Reader, onResult OnResultFN) error {
+// ParseFileFormat parses the file with the parser registered under the
+// format name, decompressing the gzipped files
+func ParseFileFormat(filename string, callback OnRecordFN, format string) error {
+	parser, err := Lookup(format)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decompress(file)
+	if err != nil {
+		return err
+	}
+	return parser.Parse(reader, callback)
+}
+
+// decompress returns a reader decompressing the gzipped content of the
+// reader, detected from its magic number, or the content itself
+func decompress(reader io.Reader) (io.Reader, error) {
+	bufReader := bufio.NewReader(reader)
+	magic, err := bufReader.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return bufReader, nil
+	}
+	gzipReader, err := gzip.NewReader(bufReader)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress: %w", err)
+	}
+	return gzipReader, nil
+}
+
+// ParseReader parses massdns output detecting its format (full, simple
+// or ndjson) from the first non-empty line, and returns the found
+// domain and ip pairs to a onResult function.
+func ParseReader(reader io.Reader, onResult OnResultFN) error {
+	callback := func(record *Record) error {
+		return onResult(record.Domain, record.IPs)
+	}
+
+	bufReader := bufio.NewReader(reader)
+	for {
+		b, err := bufReader.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if b[0] != '\n' && b[0] != '\r' && b[0] != ' ' {
+			break
+		}
+		_, _ = bufReader.ReadByte()
+	}
+
+	first, _ := bufReader.Peek(1)
+	switch first[0] {
+	case '{':
+		return parseNDJSON(bufReader, callback)
+	case ';':
+		return parseRaw(bufReader, callback)
+	default:
+		return parseSimple(bufReader, callback)
+	}
+}
+
+// parseRaw parses the massdns full output returning the
+// found records to a onRecord function.
+func parseRaw(reader io.Reader, onRecord OnRecordFN) error {
 	var (
 		// Some boolean various needed for state management
 		answerStart bool
@@ -70,8 +167,9 @@ func parseRaw(reader io.Reader, onResult OnResultFN) error {
 		nsStart     bool
 
 		// Result variables to store the results
-		domain string
-		ip     []string
+		status   string
+		resolver string
+		record   = &Record{}
 	)
 
 	// Parse the input line by line and act on what the line means
@@ -87,6 +185,18 @@ func parseRaw(reader io.Reader, onResult OnResultFN) error {
 			continue
 		}
 
+		// The header line carries the response code of the
+		// reply, keep it for the record being parsed.
+		if strings.HasPrefix(text, ";; ->>HEADER<<-") {
+			status = parseHeaderStatus(text)
+			continue
+		}
+		// The server line names the resolver of the reply
+		if server, ok := strings.CutPrefix(text, ";; Server: "); ok {
+			resolver = strings.TrimSpace(server)
+			continue
+		}
+
 		// Empty line represents a separator between DNS reply
 		// due to `-o Snl` option set in massdns. Thus it can be
 		// interpreted as a DNS answer header.
@@ -95,13 +205,15 @@ func parseRaw(reader io.Reader, onResult OnResultFN) error {
 		// bool state to default, and return the results to the
 		// consumer via the callback.
 		if text[0] == ';' && text[1] == ';' && text[2] == ' ' && text[3] == 'A' && text[4] == 'N' {
-			if domain != "" {
+			if record.Domain != "" {
 				cnameStart, nsStart = false, false
-				if err := onResult(domain, ip); err != nil {
+				if err := onRecord(record); err != nil {
 					return err
 				}
-				domain, ip = "", nil
+				record = &Record{}
 			}
+			record.Status = status
+			record.Resolver = resolver
 			answerStart = true
 			continue
 		}
@@ -131,19 +243,26 @@ func parseRaw(reader io.Reader, onResult OnResultFN) error {
 				// up recursive CNAME records.
 				if !cnameStart {
 					nsStart = false
-					domain = strings.TrimSuffix(parts[0], ".")
+					record.Domain = strings.TrimSuffix(parts[0], ".")
 					cnameStart = true
 				}
-			case "A":
-				// If we have an A record, check if it's not after
+				record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(parts[4], "."))
+				if ttl, err := strconv.Atoi(parts[1]); err == nil {
+					record.setTTL(ttl)
+				}
+			case "A", "AAAA":
+				// If we have an A or AAAA record, check if it's not after
 				// an NS record. If not, append it to the ips.
 				//
 				// Also if we aren't inside a CNAME block, set the domain too.
 				if !nsStart {
-					if !cnameStart && domain == "" {
-						domain = strings.TrimSuffix(parts[0], ".")
+					if !cnameStart && record.Domain == "" {
+						record.Domain = strings.TrimSuffix(parts[0], ".")
+					}
+					record.IPs = append(record.IPs, parts[4])
+					if ttl, err := strconv.Atoi(parts[1]); err == nil {
+						record.setTTL(ttl)
 					}
-					ip = append(ip, parts[4])
 				}
 			}
 		}
@@ -156,56 +275,113 @@ func parseRaw(reader io.Reader, onResult OnResultFN) error {
 
 	// Final callback to deliver the last piece of result
 	// if there's any.
-	if domain != "" {
-		if err := onResult(domain, ip); err != nil {
+	if record.Domain != "" {
+		if err := onRecord(record); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func parseNDJSON(reader io.Reader, onResult OnResultFN) error {
+// parseHeaderStatus extracts the response code from a massdns header line
+// like ";; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1234"
+func parseHeaderStatus(text string) string {
+	_, after, ok := strings.Cut(text, "status: ")
+	if !ok {
+		return ""
+	}
+	status, _, _ := strings.Cut(after, ",")
+	return strings.TrimSpace(status)
+}
+
+// parseSimple parses the massdns simple output (`-o S`) where each
+// line contains a name, a record type and its data. Replies are
+// separated by empty lines.
+func parseSimple(reader io.Reader, onRecord OnRecordFN) error {
+	record := &Record{}
+
+	flush := func() error {
+		if record.Domain == "" {
+			return nil
+		}
+		if err := onRecord(record); err != nil {
+			return err
+		}
+		record = &Record{}
+		return nil
+	}
+
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
-		var record DNSRecord
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(parts) != 3 {
+			continue
+		}
+
+		name := strings.TrimSuffix(parts[0], ".")
+		switch parts[1] {
+		case "CNAME":
+			if record.Domain == "" {
+				record.Domain = name
+			}
+			record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(parts[2], "."))
+		case "A", "AAAA":
+			if record.Domain == "" {
+				record.Domain = name
+			}
+			record.IPs = append(record.IPs, parts[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+func parseNDJSON(reader io.Reader, onRecord OnRecordFN) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var dnsRecord DNSRecord
 		text := scanner.Text()
 
 		// Unmarshal the JSON line into the DNSRecord struct
-		if err := json.Unmarshal([]byte(text), &record); err != nil {
+		if err := json.Unmarshal([]byte(text), &dnsRecord); err != nil {
 			return err // Handle or log error as appropriate
 		}
 
-		domain := strings.TrimSuffix(record.Name, ".")
-		var ips []string
-		var hasCNAME bool
+		record := &Record{
+			Domain:   strings.TrimSuffix(dnsRecord.Name, "."),
+			Status:   dnsRecord.Status,
+			Resolver: dnsRecord.Resolver,
+		}
 
-		// Check for A records and CNAME records in answers
-		for _, answer := range record.Data.Answers {
+		// Check for A, AAAA and CNAME records in answers
+		for _, answer := range dnsRecord.Data.Answers {
 			switch answer.Type {
-			case "A":
-				ips = append(ips, answer.Data)
+			case "A", "AAAA":
+				record.IPs = append(record.IPs, answer.Data)
+				record.setTTL(answer.TTL)
 			case "CNAME":
-				hasCNAME = true
-				// For CNAME records with no A records, we'll pass an empty IP slice
-				if len(ips) == 0 {
-					if err := onResult(domain, []string{}); err != nil {
-						return err
-					}
-				}
+				record.CNAMEs = append(record.CNAMEs, strings.TrimSuffix(answer.Data, "."))
+				record.setTTL(answer.TTL)
 			}
 		}
 
-		// If we found any A records, send them
-		if len(ips) > 0 {
-			if err := onResult(domain, ips); err != nil {
-				return err
-			}
-		} else if !hasCNAME && record.Status == "NOERROR" {
-			// If no A records and no CNAME, but status is NOERROR,
-			// still send the domain with empty IPs
-			if err := onResult(domain, []string{}); err != nil {
-				return err
-			}
+		// Records without address or CNAME answers are only sent
+		// if the status is NOERROR, with empty IPs
+		if len(record.IPs) == 0 && len(record.CNAMEs) == 0 && record.Status != "NOERROR" {
+			continue
+		}
+		if err := onRecord(record); err != nil {
+			return err
 		}
 	}
 
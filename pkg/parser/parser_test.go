@@ -1,6 +1,11 @@
 package parser
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -77,3 +82,157 @@ bugbounty-local.herokudns.io. A 185.199.111.153`
 	require.Equal(t, "docs.bugbounty.com", domain, "Could not get domain")
 	require.Equal(t, []string{"185.199.111.153"}, ip, "Could not get ip")
 }
+
+func TestParserParseFullRecord(t *testing.T) {
+	sampleData := `;; Server: 8.8.8.8:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 12345
+;; flags: qr rd ra ; QUERY: 1, ANSWER: 2, AUTHORITY: 0, ADDITIONAL: 0
+
+;; QUESTION SECTION:
+docs.hackerone.com. IN A
+
+;; ANSWER SECTION:
+docs.hackerone.com. 300 IN CNAME hacker0x01.github.io.
+hacker0x01.github.io. 300 IN A 185.199.111.153`
+
+	var records []*Record
+	err := Parse(strings.NewReader(sampleData), func(record *Record) error {
+		records = append(records, record)
+		return nil
+	}, ParseStandard)
+	require.Nil(t, err, "Could not parse sample data")
+	require.Len(t, records, 1, "Could not get record")
+	require.Equal(t, "docs.hackerone.com", records[0].Domain, "Could not get domain")
+	require.Equal(t, []string{"185.199.111.153"}, records[0].IPs, "Could not get ip")
+	require.Equal(t, []string{"hacker0x01.github.io"}, records[0].CNAMEs, "Could not get cname")
+	require.Equal(t, "NOERROR", records[0].Status, "Could not get status")
+	require.Equal(t, "8.8.8.8:53", records[0].Resolver, "Could not get resolver")
+}
+
+func TestParserParseAAAARecord(t *testing.T) {
+	sampleData := `;; Server: 8.8.8.8:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 12345
+;; flags: qr rd ra ; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0
+
+;; QUESTION SECTION:
+v6.hackerone.com. IN AAAA
+
+;; ANSWER SECTION:
+v6.hackerone.com. 300 IN AAAA 2606:4700::6812:1a0b`
+
+	var records []*Record
+	err := Parse(strings.NewReader(sampleData), func(record *Record) error {
+		records = append(records, record)
+		return nil
+	}, ParseStandard)
+	require.Nil(t, err, "Could not parse sample data")
+	require.Len(t, records, 1, "Could not get record")
+	require.Equal(t, "v6.hackerone.com", records[0].Domain, "Could not get domain")
+	require.Equal(t, []string{"2606:4700::6812:1a0b"}, records[0].IPs, "Could not get ipv6")
+}
+
+func TestParserParseTTL(t *testing.T) {
+	sampleData := `;; Server: 8.8.8.8:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+docs.hackerone.com. 300 IN CNAME hacker0x01.github.io.
+hacker0x01.github.io. 60 IN A 185.199.111.153`
+
+	var records []*Record
+	err := Parse(strings.NewReader(sampleData), func(record *Record) error {
+		records = append(records, record)
+		return nil
+	}, ParseStandard)
+	require.Nil(t, err, "Could not parse sample data")
+	require.Len(t, records, 1, "Could not get record")
+	require.NotNil(t, records[0].TTL, "Could not get ttl")
+	require.Equal(t, 60, *records[0].TTL, "Could not get lowest ttl")
+}
+
+func TestParserFormats(t *testing.T) {
+	tests := map[string]string{
+		FormatDNSX: `{"host":"www.example.com","resolver":["1.1.1.1:53"],"a":["10.0.0.1"],"cname":["cdn.example.net"],"status_code":"NOERROR"}
+{"host":"missing.example.com","resolver":["1.1.1.1:53"],"status_code":"NXDOMAIN"}`,
+		FormatZDNS: `{"name":"www.example.com","status":"NOERROR","data":{"answers":[{"type":"CNAME","answer":"cdn.example.net."},{"type":"A","answer":"10.0.0.1"}],"resolver":"1.1.1.1:53"}}
+{"name":"missing.example.com","status":"NXDOMAIN","data":{"resolver":"1.1.1.1:53"}}`,
+	}
+	for format, sampleData := range tests {
+		parser, err := Lookup(format)
+		require.Nil(t, err, "Could not lookup %s parser", format)
+
+		var records []*Record
+		err = parser.Parse(strings.NewReader(sampleData), func(record *Record) error {
+			records = append(records, record)
+			return nil
+		})
+		require.Nil(t, err, "Could not parse %s output", format)
+		require.Equal(t, []*Record{{
+			Domain:   "www.example.com",
+			IPs:      []string{"10.0.0.1"},
+			CNAMEs:   []string{"cdn.example.net"},
+			Status:   "NOERROR",
+			Resolver: "1.1.1.1:53",
+		}}, records, "Got unexpected %s records", format)
+	}
+
+	_, err := Lookup("unknown")
+	require.NotNil(t, err, "Found unknown parser")
+
+	Register("lines", ParserFunc(func(reader io.Reader, onRecord OnRecordFN) error {
+		return onRecord(&Record{Domain: "www.example.com"})
+	}))
+	require.Contains(t, Formats(), "lines", "Registered parser is not listed")
+}
+
+func TestParserParseFDNS(t *testing.T) {
+	sampleData := `{"timestamp":"1700000000","name":"www.example.com","type":"cname","value":"cdn.example.net"}
+{"timestamp":"1700000000","name":"cdn.example.net","type":"a","value":"10.0.0.1"}
+{"timestamp":"1700000000","name":"example.com","type":"mx","value":"mail.example.com"}
+`
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(sampleData))
+	require.Nil(t, err, "Could not compress dataset")
+	require.Nil(t, writer.Close(), "Could not compress dataset")
+
+	filename := filepath.Join(t.TempDir(), "fdns_a.json.gz")
+	require.Nil(t, os.WriteFile(filename, compressed.Bytes(), 0o600), "Could not write dataset")
+
+	var records []*Record
+	err = ParseFileFormat(filename, func(record *Record) error {
+		records = append(records, record)
+		return nil
+	}, FormatFDNS)
+	require.Nil(t, err, "Could not parse fdns dataset")
+	require.Equal(t, []*Record{
+		{Domain: "www.example.com", CNAMEs: []string{"cdn.example.net"}},
+		{Domain: "cdn.example.net", IPs: []string{"10.0.0.1"}},
+	}, records, "Got unexpected fdns records")
+}
+
+func TestParserParseReplies(t *testing.T) {
+	sampleData := `;; Server: 8.8.8.8:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 12345
+
+;; QUESTION SECTION:
+www.example.com. IN A
+
+;; Server: 1.1.1.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NXDOMAIN, id: 12346
+
+;; QUESTION SECTION:
+dev.example.com. IN A
+`
+	var replies []string
+	onReply := func(name, resolver, status string) {
+		replies = append(replies, name+" "+resolver+" "+status)
+	}
+	require.Nil(t, ParseReplies(strings.NewReader(sampleData), onReply, ParseStandard), "Could not parse sample data")
+	require.Equal(t, []string{"www.example.com 8.8.8.8:53 NOERROR", "dev.example.com 1.1.1.1:53 NXDOMAIN"}, replies, "Got unexpected replies")
+
+	replies = nil
+	sampleData = `{"name":"www.example.com.","type":"A","class":"IN","status":"REFUSED","data":{},"resolver":"9.9.9.9:53"}`
+	require.Nil(t, ParseReplies(strings.NewReader(sampleData), onReply, ParseNDJSON), "Could not parse ndjson sample data")
+	require.Equal(t, []string{"www.example.com 9.9.9.9:53 REFUSED"}, replies, "Got unexpected ndjson replies")
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Parser parses the records of a resolver output format
+type Parser interface {
+	// Parse parses the reader returning the found records to onRecord
+	Parse(reader io.Reader, onRecord OnRecordFN) error
+}
+
+// ParserFunc is a function implementing Parser
+type ParserFunc func(reader io.Reader, onRecord OnRecordFN) error
+
+// Parse calls the function
+func (f ParserFunc) Parse(reader io.Reader, onRecord OnRecordFN) error {
+	return f(reader, onRecord)
+}
+
+// Names of the built-in formats
+const (
+	// FormatMassdns is the massdns full output (`-o Snl`)
+	FormatMassdns = "massdns"
+	// FormatMassdnsSimple is the massdns simple output (`-o S`)
+	FormatMassdnsSimple = "massdns-simple"
+	// FormatMassdnsNDJSON is the massdns ndjson output (`-o J`)
+	FormatMassdnsNDJSON = "massdns-ndjson"
+	// FormatDNSX is the dnsx json output (`-json`)
+	FormatDNSX = "dnsx"
+	// FormatZDNS is the zdns json output
+	FormatZDNS = "zdns"
+	// FormatFDNS is a Rapid7 Forward DNS (FDNS) dataset
+	FormatFDNS = "fdns"
+)
+
+var (
+	parsersMutex sync.RWMutex
+	parsers      = map[string]Parser{
+		FormatMassdns:       ParserFunc(parseRaw),
+		FormatMassdnsSimple: ParserFunc(parseSimple),
+		FormatMassdnsNDJSON: ParserFunc(parseNDJSON),
+		FormatDNSX:          ParserFunc(parseDNSX),
+		FormatZDNS:          ParserFunc(parseZDNS),
+		FormatFDNS:          ParserFunc(parseFDNS),
+	}
+)
+
+// Register makes the parser available under the format name,
+// replacing the parser previously registered under it
+func Register(format string, parser Parser) {
+	parsersMutex.Lock()
+	defer parsersMutex.Unlock()
+
+	parsers[format] = parser
+}
+
+// Lookup returns the parser registered under the format name
+func Lookup(format string) (Parser, error) {
+	parsersMutex.RLock()
+	defer parsersMutex.RUnlock()
+
+	parser, ok := parsers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return parser, nil
+}
+
+// Formats returns the names of the registered formats, sorted
+func Formats() []string {
+	parsersMutex.RLock()
+	defer parsersMutex.RUnlock()
+
+	formats := make([]string, 0, len(parsers))
+	for format := range parsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// OnReplyFN is called with the queried name, the resolver and the
+// response code of every reply of the massdns output
+type OnReplyFN func(name, resolver, status string)
+
+// ParseReplies parses the queried name, the resolver and the response
+// code of every reply of the massdns full or ndjson output, including the
+// error replies left out of the records
+func ParseReplies(reader io.Reader, onReply OnReplyFN, ndjson ParseOption) error {
+	scanner := bufio.NewScanner(reader)
+	if ndjson {
+		for scanner.Scan() {
+			var reply struct {
+				Name     string `json:"name"`
+				Status   string `json:"status"`
+				Resolver string `json:"resolver"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+				return err
+			}
+			onReply(strings.TrimSuffix(reply.Name, "."), reply.Resolver, reply.Status)
+		}
+		return scanner.Err()
+	}
+
+	// The server and header lines come before the question of the reply
+	var (
+		resolver, status string
+		question         bool
+	)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, ";; Server: "):
+			resolver = strings.TrimSpace(strings.TrimPrefix(text, ";; Server: "))
+		case strings.HasPrefix(text, ";; ->>HEADER<<-"):
+			status = parseHeaderStatus(text)
+		case text == ";; QUESTION SECTION:":
+			question = true
+		case question && text != "" && !strings.HasPrefix(text, ";"):
+			name, _, _ := strings.Cut(text, " ")
+			onReply(strings.TrimSuffix(name, "."), resolver, status)
+			resolver, status, question = "", "", false
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,7 @@
+// Package patterns infers naming patterns from discovered subdomains
+// and synthesizes new candidates following them, in the style of regulator.
+//
+// Subdomains are split into word and number tokens and the separators
+// between them. Subdomains sharing the same shape form a pattern, whose
+// tokens are recombined and whose number ranges are filled in.
+package patterns
@@ -0,0 +1,258 @@
+package patterns
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// minGroupSize is the number of hostnames sharing a shape needed to infer a pattern
+	minGroupSize = 2
+	// maxNumberRange is the widest number range expanded between observed bounds
+	maxNumberRange = 50
+	// maxPatternCandidates is the max number of candidates synthesized by a pattern
+	maxPatternCandidates = 2000
+)
+
+const (
+	wordSlot   = 'W'
+	numberSlot = 'N'
+)
+
+// Synthesizer infers naming patterns from discovered hostnames and
+// synthesizes new candidates following them.
+type Synthesizer struct {
+	known  map[string]struct{}
+	groups map[string]*group
+	order  []string
+}
+
+// group contains the hostnames of a domain sharing the same shape
+type group struct {
+	domain string
+	shape  string
+	slots  [][]string
+}
+
+// New creates a new patterns synthesizer
+func New() *Synthesizer {
+	return &Synthesizer{
+		known:  make(map[string]struct{}),
+		groups: make(map[string]*group),
+	}
+}
+
+// Add adds a discovered hostname belonging to domain to the analysis
+func (s *Synthesizer) Add(hostname, domain string) {
+	subdomain := strings.TrimSuffix(hostname, "."+domain)
+	if subdomain == hostname || subdomain == "" {
+		return
+	}
+	if _, ok := s.known[hostname]; ok {
+		return
+	}
+	s.known[hostname] = struct{}{}
+
+	shape, values := tokenize(subdomain)
+	key := domain + "|" + shape
+	g, ok := s.groups[key]
+	if !ok {
+		g = &group{domain: domain, shape: shape, slots: make([][]string, len(values))}
+		s.groups[key] = g
+		s.order = append(s.order, key)
+	}
+	for i, value := range values {
+		g.slots[i] = append(g.slots[i], value)
+	}
+}
+
+// Generate calls the callback for every new candidate synthesized from
+// the patterns inferred so far. Known hostnames are never returned.
+func (s *Synthesizer) Generate(callback func(candidate string)) {
+	seen := make(map[string]struct{})
+
+	for _, key := range s.order {
+		g := s.groups[key]
+		if len(g.slots) == 0 || len(g.slots[0]) < minGroupSize {
+			continue
+		}
+
+		// Values for each slot of the shape
+		values := make([][]string, len(g.slots))
+		total := 1
+		for i, observed := range g.slots {
+			if g.slotType(i) == numberSlot {
+				values[i] = expandNumbers(observed)
+			} else {
+				values[i] = dedupe(observed)
+			}
+			total *= len(values[i])
+			if total > maxPatternCandidates {
+				break
+			}
+		}
+		if total > maxPatternCandidates {
+			continue
+		}
+
+		g.combine(values, func(subdomain string) {
+			candidate := subdomain + "." + g.domain
+			if _, ok := s.known[candidate]; ok {
+				return
+			}
+			if _, ok := seen[candidate]; ok {
+				return
+			}
+			seen[candidate] = struct{}{}
+			callback(candidate)
+		})
+	}
+}
+
+// slotType returns the type of the slot at index in the shape
+func (g *group) slotType(index int) rune {
+	var current int
+	for _, c := range g.shape {
+		if c != wordSlot && c != numberSlot {
+			continue
+		}
+		if current == index {
+			return c
+		}
+		current++
+	}
+	return 0
+}
+
+// combine calls the callback with the subdomains built from every
+// combination of the slot values following the group shape.
+func (g *group) combine(values [][]string, callback func(subdomain string)) {
+	indexes := make([]int, len(values))
+	for {
+		var builder strings.Builder
+		var slot int
+		for _, c := range g.shape {
+			if c == wordSlot || c == numberSlot {
+				builder.WriteString(values[slot][indexes[slot]])
+				slot++
+				continue
+			}
+			builder.WriteRune(c)
+		}
+		callback(builder.String())
+
+		// Advance to the next combination
+		i := len(indexes) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(values[i]) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return
+		}
+	}
+}
+
+// Tokenize splits a subdomain into its shape and the values of its word
+// and number slots, as the patterns are inferred from
+func Tokenize(subdomain string) (string, []string) {
+	return tokenize(subdomain)
+}
+
+// tokenize splits a subdomain into a shape made of word and number slots
+// and the separators between them, returning the values of the slots.
+// For example "api-dev01.eu" has shape "W-WN.W".
+func tokenize(subdomain string) (string, []string) {
+	var (
+		shape  strings.Builder
+		values []string
+	)
+
+	for i := 0; i < len(subdomain); {
+		c := subdomain[i]
+		if c == '-' || c == '.' || c == '_' {
+			shape.WriteByte(c)
+			i++
+			continue
+		}
+
+		j := i
+		digits := isDigit(c)
+		for j < len(subdomain) && isDigit(subdomain[j]) == digits && !isSeparator(subdomain[j]) {
+			j++
+		}
+		if digits {
+			shape.WriteRune(numberSlot)
+		} else {
+			shape.WriteRune(wordSlot)
+		}
+		values = append(values, subdomain[i:j])
+		i = j
+	}
+	return shape.String(), values
+}
+
+// expandNumbers returns every number between the lowest and highest
+// observed ones if the range is small enough, otherwise the observed
+// numbers. The zero padding is kept if all numbers share the same width.
+func expandNumbers(observed []string) []string {
+	observed = dedupe(observed)
+
+	width := len(observed[0])
+	min, max := -1, -1
+	for _, value := range observed {
+		if len(value) != width {
+			width = 0
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return observed
+		}
+		if min == -1 || number < min {
+			min = number
+		}
+		if number > max {
+			max = number
+		}
+	}
+	if max-min > maxNumberRange {
+		return observed
+	}
+
+	numbers := make([]string, 0, max-min+1)
+	for number := min; number <= max; number++ {
+		value := strconv.Itoa(number)
+		if len(value) < width {
+			value = strings.Repeat("0", width-len(value)) + value
+		}
+		numbers = append(numbers, value)
+	}
+	return numbers
+}
+
+// dedupe returns the sorted unique values
+func dedupe(values []string) []string {
+	unique := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, ok := unique[value]; ok {
+			continue
+		}
+		unique[value] = struct{}{}
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSeparator(c byte) bool {
+	return c == '-' || c == '.' || c == '_'
+}
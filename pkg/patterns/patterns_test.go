@@ -0,0 +1,30 @@
+package patterns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynthesizerGenerate(t *testing.T) {
+	synthesizer := New()
+	synthesizer.Add("api-dev01.example.com", "example.com")
+	synthesizer.Add("web-prod03.example.com", "example.com")
+	synthesizer.Add("www.example.com", "example.com")
+
+	var candidates []string
+	synthesizer.Generate(func(candidate string) {
+		candidates = append(candidates, candidate)
+	})
+
+	require.Contains(t, candidates, "api-prod01.example.com", "Could not combine tokens")
+	require.Contains(t, candidates, "web-dev02.example.com", "Could not fill number range")
+	require.NotContains(t, candidates, "api-dev01.example.com", "Got known hostname")
+	require.Len(t, candidates, 2*2*3-2, "Got unexpected candidates")
+}
+
+func TestTokenize(t *testing.T) {
+	shape, values := tokenize("api-dev01.eu")
+	require.Equal(t, "W-WN.W", shape, "Could not get shape")
+	require.Equal(t, []string{"api", "dev", "01", "eu"}, values, "Could not get values")
+}
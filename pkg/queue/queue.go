@@ -0,0 +1,44 @@
+// Package queue transports the enumeration jobs of a fleet of workers
+// and their results.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Message is a job popped from a queue
+type Message struct {
+	// Data is the job as it was pushed to the queue
+	Data []byte
+}
+
+// Queue is a queue of jobs and results shared by the workers
+type Queue interface {
+	// Pop blocks until a job is received, returning an error once ctx is
+	// done. The job is held by the worker until acknowledged or requeued.
+	Pop(ctx context.Context) (*Message, error)
+	// Ack removes a done job from the queue
+	Ack(ctx context.Context, message *Message) error
+	// Requeue gives back a job which could not be done to the other workers
+	Requeue(ctx context.Context, message *Message) error
+	// Push pushes the result of a job
+	Push(ctx context.Context, data []byte) error
+	// Close closes the connection to the queue
+	Close() error
+}
+
+// New connects to the queue of the url, by scheme (redis, rediss)
+func New(rawURL string) (Queue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue url: %w", err)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return NewRedis(u)
+	default:
+		return nil, fmt.Errorf("unsupported queue scheme %q", u.Scheme)
+	}
+}
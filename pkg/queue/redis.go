@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Default keys of the redis lists
+const (
+	// DefaultJobsKey is the list the jobs are popped from
+	DefaultJobsKey = "shuffledns:jobs"
+	// DefaultResultsKey is the list the results are pushed to
+	DefaultResultsKey = "shuffledns:results"
+)
+
+// redisPopTimeout is the time a pop blocks on the server before ctx is checked again
+const redisPopTimeout = time.Second
+
+// Redis is a queue of redis lists. The jobs popped are moved to a
+// processing list until acknowledged, where the jobs of the workers which
+// died stay to be requeued by hand.
+type Redis struct {
+	client     *redis.Client
+	jobs       string
+	processing string
+	results    string
+}
+
+// NewRedis creates a queue of the redis server of the url
+// (redis://[user:password@]host[:port][/db][?jobs=key&results=key]).
+// The connection is established by the first command.
+func NewRedis(u *url.URL) (*Redis, error) {
+	r := &Redis{jobs: DefaultJobsKey, results: DefaultResultsKey}
+
+	// The keys of the lists are not options of the client
+	query := u.Query()
+	if jobs := query.Get("jobs"); jobs != "" {
+		r.jobs = jobs
+	}
+	if results := query.Get("results"); results != "" {
+		r.results = results
+	}
+	query.Del("jobs")
+	query.Del("results")
+	clientURL := *u
+	clientURL.RawQuery = query.Encode()
+
+	options, err := redis.ParseURL(clientURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	r.client = redis.NewClient(options)
+	r.processing = r.jobs + ":processing"
+	return r, nil
+}
+
+// Pop moves the next job to the processing list
+func (r *Redis) Pop(ctx context.Context) (*Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := r.client.BLMove(ctx, r.jobs, r.processing, "LEFT", "RIGHT", redisPopTimeout).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Message{Data: data}, nil
+	}
+}
+
+// Ack removes the job from the processing list
+func (r *Redis) Ack(ctx context.Context, message *Message) error {
+	return r.client.LRem(ctx, r.processing, 1, message.Data).Err()
+}
+
+// Requeue moves the job back to the front of the jobs list
+func (r *Redis) Requeue(ctx context.Context, message *Message) error {
+	if err := r.client.LPush(ctx, r.jobs, message.Data).Err(); err != nil {
+		return err
+	}
+	return r.Ack(ctx, message)
+}
+
+// Push appends the result to the results list
+func (r *Redis) Push(ctx context.Context, data []byte) error {
+	return r.client.RPush(ctx, r.results, data).Err()
+}
+
+// Close closes the connections
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
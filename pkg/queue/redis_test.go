@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisQueue(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	_, err := server.RPush("jobs", `{"id":"1"}`, `{"id":"2"}`)
+	require.Nil(t, err, "Could not push jobs")
+
+	u, err := url.Parse("redis://:secret@" + server.Addr() + "?jobs=jobs&results=results")
+	require.Nil(t, err, "Could not parse url")
+	q, err := NewRedis(u)
+	require.Nil(t, err, "Could not create queue")
+	defer q.Close()
+
+	list := func(key string) []string {
+		if !server.Exists(key) {
+			return nil
+		}
+		items, err := server.List(key)
+		require.Nil(t, err, "Could not read list %s", key)
+		return items
+	}
+
+	ctx := context.Background()
+	first, err := q.Pop(ctx)
+	require.Nil(t, err, "Could not pop job")
+	require.Equal(t, `{"id":"1"}`, string(first.Data), "Got wrong job")
+	require.Equal(t, []string{`{"id":"1"}`}, list("jobs:processing"), "Job not held while processed")
+
+	require.Nil(t, q.Push(ctx, []byte(`{"id":"1","results":[]}`)), "Could not push result")
+	require.Nil(t, q.Ack(ctx, first), "Could not ack job")
+	require.Equal(t, []string{`{"id":"1","results":[]}`}, list("results"), "Got wrong results")
+	require.Empty(t, list("jobs:processing"), "Job still held once acknowledged")
+
+	second, err := q.Pop(ctx)
+	require.Nil(t, err, "Could not pop job")
+	require.Nil(t, q.Requeue(ctx, second), "Could not requeue job")
+	require.Equal(t, []string{`{"id":"2"}`}, list("jobs"), "Job not requeued")
+
+	// Pop gives up once ctx is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = q.Pop(cancelled)
+	require.ErrorIs(t, err, context.Canceled, "Popped with a done context")
+
+	u.User = url.UserPassword("", "wrong")
+	q, err = NewRedis(u)
+	require.Nil(t, err, "Could not create queue")
+	defer q.Close()
+	require.NotNil(t, q.Push(ctx, []byte("{}")), "Pushed without authentication")
+}
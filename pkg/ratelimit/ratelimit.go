@@ -0,0 +1,121 @@
+// Package ratelimit paces the dns queries sent by every phase of an
+// enumeration below a single queries per second ceiling, and allows
+// pausing them all at once.
+package ratelimit
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limiter spaces the queries evenly so that their rate never exceeds
+// the ceiling, and holds them while paused. A nil Limiter never waits.
+type Limiter struct {
+	mutex    sync.Mutex
+	resumed  *sync.Cond
+	paused   bool
+	interval time.Duration
+	next     time.Time
+	taken    atomic.Uint64
+}
+
+// New creates a limiter allowing qps queries per second, unlimited if qps is not positive
+func New(qps int) *Limiter {
+	limiter := &Limiter{}
+	limiter.resumed = sync.NewCond(&limiter.mutex)
+	if qps > 0 {
+		limiter.interval = time.Second / time.Duration(qps)
+	}
+	return limiter
+}
+
+// Take waits until the next query can be sent
+func (l *Limiter) Take() {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	for l.paused {
+		l.resumed.Wait()
+	}
+	if l.interval == 0 {
+		l.mutex.Unlock()
+		l.taken.Add(1)
+		return
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	l.taken.Add(1)
+}
+
+// Limited returns true if the queries are paced
+func (l *Limiter) Limited() bool {
+	return l != nil && l.interval > 0
+}
+
+// Count counts queries sent without going through Take
+func (l *Limiter) Count(queries uint64) {
+	if l != nil {
+		l.taken.Add(queries)
+	}
+}
+
+// Taken returns the number of queries let through so far
+func (l *Limiter) Taken() uint64 {
+	if l == nil {
+		return 0
+	}
+	return l.taken.Load()
+}
+
+// Pause holds the queries until Resume is called
+func (l *Limiter) Pause() {
+	l.mutex.Lock()
+	l.paused = true
+	l.mutex.Unlock()
+}
+
+// Resume releases the queries held by Pause
+func (l *Limiter) Resume() {
+	l.mutex.Lock()
+	l.paused = false
+	l.mutex.Unlock()
+	l.resumed.Broadcast()
+}
+
+// Paused returns true if the queries are held
+func (l *Limiter) Paused() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.paused
+}
+
+// Reader returns a reader pacing the lines of r, one query per line.
+// It must be closed to release the pacing goroutine.
+func (l *Limiter) Reader(r io.Reader) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			l.Take()
+			if _, err := pipeWriter.Write(append(scanner.Bytes(), '\n')); err != nil {
+				return
+			}
+		}
+		pipeWriter.CloseWithError(scanner.Err())
+	}()
+	return pipeReader
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterTake(t *testing.T) {
+	limiter := New(100)
+
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		limiter.Take()
+	}
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "Queries were not paced")
+	require.Equal(t, uint64(11), limiter.Taken(), "Got unexpected query count")
+}
+
+func TestLimiterReader(t *testing.T) {
+	reader := New(1000).Reader(strings.NewReader("a.example.com\nb.example.com\n"))
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.Nil(t, err, "Could not read paced lines")
+	require.Equal(t, "a.example.com\nb.example.com\n", string(data), "Got unexpected lines")
+}
+
+func TestLimiterPause(t *testing.T) {
+	limiter := New(0)
+	limiter.Pause()
+	require.True(t, limiter.Paused(), "Limiter was not paused")
+
+	taken := make(chan struct{})
+	go func() {
+		limiter.Take()
+		close(taken)
+	}()
+
+	select {
+	case <-taken:
+		require.Fail(t, "Query was not held while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.Resume()
+	select {
+	case <-taken:
+	case <-time.After(time.Second):
+		require.Fail(t, "Query was not released on resume")
+	}
+}
+
+func TestLimiterLimited(t *testing.T) {
+	require.True(t, New(100).Limited(), "Limiter with a rate is not limited")
+	require.False(t, New(0).Limited(), "Unlimited limiter is limited")
+
+	var limiter *Limiter
+	require.False(t, limiter.Limited(), "Nil limiter is limited")
+	limiter.Count(1)
+
+	limiter = New(0)
+	limiter.Take()
+	limiter.Count(10)
+	require.Equal(t, uint64(11), limiter.Taken(), "Queries sent around the limiter were not counted")
+}
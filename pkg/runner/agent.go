@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The reconnection backoff of the agents once the controller is lost
+const (
+	agentRetryMin = time.Second
+	agentRetryMax = time.Minute
+)
+
+// Types of the messages sent by the agents to the controller
+const (
+	// AgentProgress carries the progress of the running job
+	AgentProgress = "progress"
+	// AgentResult carries a host found by the running job
+	AgentResult = "result"
+	// AgentDone carries the statistics and the error of a finished job
+	AgentDone = "done"
+)
+
+// AgentMessage is sent by an agent to the controller about a job
+type AgentMessage struct {
+	// Type is the type of the message (progress, result or done)
+	Type string `json:"type"`
+	// ID is the id of the job
+	ID string `json:"id"`
+	// Progress is the progress of the job, for the progress messages
+	Progress *Progress `json:"progress,omitempty"`
+	// Result is the host found, for the result messages
+	Result *Result `json:"result,omitempty"`
+	// Stats are the statistics of the job, for the done messages
+	Stats *RunStats `json:"stats,omitempty"`
+	// Error is set when the job failed, the results being partial
+	Error string `json:"error,omitempty"`
+}
+
+// serveAgent runs the jobs sent by the controller, on top of the options
+// of the command line, until interrupted
+func serveAgent(options *Options) error {
+	config, err := agentConfig(options.Agent, options.AgentToken)
+	if err != nil {
+		return err
+	}
+
+	runner, err := New(options)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	if options.Dashboard != "" {
+		if runner.dashboard, _, err = serveDashboard(options.Dashboard, options.DashboardToken, runner.logger); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runner.serveAgent(ctx, config)
+}
+
+// agentConfig creates the websocket configuration of the controller url
+func agentConfig(controller, token string) (*websocket.Config, error) {
+	location, err := url.Parse(controller)
+	if err != nil {
+		return nil, fmt.Errorf("invalid controller url: %w", err)
+	}
+	origin := *location
+	switch location.Scheme {
+	case "ws":
+		origin.Scheme = "http"
+	case "wss":
+		origin.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported controller scheme %q, use ws or wss", location.Scheme)
+	}
+	origin.Path, origin.RawQuery = "", ""
+
+	config, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid controller url: %w", err)
+	}
+	if token != "" {
+		config.Header.Set("Authorization", "Bearer "+token)
+	}
+	return config, nil
+}
+
+// serveAgent connects to the controller and runs the jobs it sends until
+// ctx is done, reconnecting with an increasing delay when the connection
+// is lost. The job interrupted by a lost connection is left to the
+// controller to send again.
+func (r *Runner) serveAgent(ctx context.Context, config *websocket.Config) error {
+	retry := agentRetryMin
+	for {
+		connected, err := r.runAgent(ctx, config)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			retry = agentRetryMin
+		}
+		r.logger.Warning().Msgf("Lost controller %s: %s, reconnecting in %s\n", config.Location, err, retry)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, agentRetryMax)
+	}
+}
+
+// runAgent runs the jobs sent over a connection to the controller one
+// after the other until the connection is lost, streaming back their
+// progress and results
+func (r *Runner) runAgent(ctx context.Context, config *websocket.Config) (connected bool, err error) {
+	conn, err := config.DialContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	// The connection is closed once lost or ctx is done, interrupting the job
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	r.logger.Info().Msgf("Connected to controller %s, waiting for jobs\n", config.Location)
+
+	// The jobs are read while one runs, to notice the lost connection
+	jobs := make(chan []byte)
+	go func() {
+		for {
+			var data []byte
+			if err := websocket.Message.Receive(conn, &data); err != nil {
+				cancel(err)
+				return
+			}
+			select {
+			case jobs <- data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The messages are sent by the writer goroutine of the enumeration and
+	// the progress reports, websocket frames being written atomically
+	send := func(message *AgentMessage) {
+		if err := websocket.JSON.Send(conn, message); err != nil {
+			cancel(err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, context.Cause(ctx)
+		case data := <-jobs:
+			// The invalid jobs are answered by runJob
+			var job Job
+			_ = json.Unmarshal(data, &job)
+			result := r.runJob(ctx, data, func(options *Options) {
+				onResult := options.OnResult
+				options.OnResult = func(found *Result) {
+					onResult(found)
+					send(&AgentMessage{Type: AgentResult, ID: job.ID, Result: found})
+				}
+				options.OnProgress = func(progress Progress) {
+					send(&AgentMessage{Type: AgentProgress, ID: job.ID, Progress: &progress})
+				}
+			})
+			if ctx.Err() != nil {
+				r.logger.Info().Msgf("Interrupted job %s\n", result.ID)
+				return true, context.Cause(ctx)
+			}
+			send(&AgentMessage{Type: AgentDone, ID: result.ID, Stats: result.Stats, Error: result.Error})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/alterations"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// onHostname records the hostnames written to the output, which
+// are used as seeds for the alterations pass, and passes them on to
+// the OnHostname callback of the options.
+func (r *Runner) onHostname(hostname string) {
+	r.discoveredMutex.Lock()
+	r.discovered = append(r.discovered, hostname)
+	r.discoveredMutex.Unlock()
+
+	if r.options.OnHostname != nil {
+		r.options.OnHostname(hostname)
+	}
+}
+
+// matchDomain returns the longest target domain the hostname belongs to
+func matchDomain(hostname string, domains []string) string {
+	var matched string
+	for _, domain := range domains {
+		if strings.HasSuffix(hostname, "."+domain) && len(domain) > len(matched) {
+			matched = domain
+		}
+	}
+	return matched
+}
+
+// runAlterations generates the permutations of the hostnames discovered by
+// the first pass and resolves them reusing the wildcard state of the client.
+func (r *Runner) runAlterations(instance *massdns.Instance) {
+	var words []string
+	if len(r.options.AlterationsWordlist) > 0 {
+		err := readWordlists(r.options.AlterationsWordlist, func(word string) {
+			words = append(words, word)
+		})
+		if err != nil {
+			r.logError("Could not read alterations wordlist: %s\n", err)
+			return
+		}
+	}
+
+	generator := alterations.New(words)
+	r.resolveVariants(instance, "alterations", generator.Generate)
+}
+
+// runAffixes resolves the hostnames discovered so far with the prefixes
+// prepended and the suffixes appended to their first label.
+func (r *Runner) runAffixes(instance *massdns.Instance) {
+	r.resolveVariants(instance, "affixes", func(hostname, domain string, callback func(candidate string)) {
+		alterations.Affix(hostname, domain, r.options.AltPrefixes, r.options.AltSuffixes, callback)
+	})
+}
+
+// resolveVariants generates the variants of the hostnames discovered so
+// far and of the seeds with generate and resolves the ones not discovered
+// yet, name describing the variants in the logs.
+func (r *Runner) resolveVariants(instance *massdns.Instance, name string, generate func(hostname, domain string, callback func(candidate string))) {
+	r.discoveredMutex.Lock()
+	discovered := make([]string, len(r.discovered), len(r.discovered)+len(r.seeds))
+	copy(discovered, r.discovered)
+	discovered = append(discovered, r.seeds...)
+	r.discoveredMutex.Unlock()
+
+	if len(discovered) == 0 {
+		r.logger.Info().Msgf("No hostnames discovered, skipping %s\n", name)
+		return
+	}
+
+	file, err := os.CreateTemp(r.tempDir, name+"-")
+	if err != nil {
+		r.logError("Could not create %s list (%s): %s\n", name, r.tempDir, err)
+		return
+	}
+	writer := r.newCandidateWriter(file)
+
+	r.phases.Set(massdns.PhaseGenerate)
+	r.logger.Info().Msgf("Started generating %s of %d hostnames\n", name, len(discovered))
+
+	now := time.Now()
+	seen := make(map[string]struct{}, len(discovered))
+	for _, hostname := range discovered {
+		seen[hostname] = struct{}{}
+	}
+
+	generated := make(map[string]struct{}, len(discovered))
+	for _, hostname := range discovered {
+		if _, ok := generated[hostname]; ok {
+			continue
+		}
+		generated[hostname] = struct{}{}
+		domain := matchDomain(hostname, r.options.Domains)
+		if domain == "" {
+			continue
+		}
+		generate(hostname, domain, func(candidate string) {
+			if _, ok := seen[candidate]; ok {
+				return
+			}
+			seen[candidate] = struct{}{}
+			writer.Write(candidate)
+		})
+	}
+	writer.Flush()
+	file.Close()
+
+	r.logger.Info().Msgf("Generating %d %s took %s at %s\n", writer.written, name, time.Since(now), file.Name())
+	if writer.written == 0 {
+		return
+	}
+
+	if err := instance.RunBatch(r.ctx, file.Name()); err != nil {
+		r.logError("Could not run massdns on %s: %s\n", name, err)
+	}
+}
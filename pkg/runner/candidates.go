@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/scope"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/projectdiscovery/gologger"
+)
+
+const (
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+// isValidHostname returns true if the hostname follows the dns label rules:
+// at most 253 characters, labels of 1 to 63 letters, digits, hyphens or
+// underscores, not starting nor ending with a hyphen.
+func isValidHostname(hostname string) bool {
+	if hostname == "" || len(hostname) > maxHostnameLength {
+		return false
+	}
+
+	var labelLength int
+	for i := 0; i < len(hostname); i++ {
+		c := hostname[i]
+		switch {
+		case c == '.':
+			if labelLength == 0 || hostname[i-1] == '-' {
+				return false
+			}
+			labelLength = 0
+			continue
+		case c == '-':
+			if labelLength == 0 {
+				return false
+			}
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			return false
+		}
+		labelLength++
+		if labelLength > maxLabelLength {
+			return false
+		}
+	}
+	return labelLength > 0 && hostname[len(hostname)-1] != '-'
+}
+
+// candidateWriter writes the candidates of a massdns input file,
+// skipping and counting the ones which are not valid hostnames.
+type candidateWriter struct {
+	logger *gologger.Logger
+	// generated counts the valid candidates of the enumeration
+	generated *atomic.Int64
+	nxdomains *nxdomainCache
+	negative  *store.NegativeCache
+	scope     *scope.Scope
+	writer    *bufio.Writer
+	written   int
+	invalid   int
+	outside   int
+	pruned    int
+	known     int
+}
+
+// newCandidateWriter creates a buffered candidate writer
+func (r *Runner) newCandidateWriter(w io.Writer) *candidateWriter {
+	return &candidateWriter{logger: r.logger, generated: r.candidates, nxdomains: r.nxdomains, negative: r.shared.negativeCache, scope: r.scope, writer: bufio.NewWriter(w)}
+}
+
+// Write writes the candidate and returns true if it is a valid hostname
+// in the scope which may exist
+func (c *candidateWriter) Write(candidate string) bool {
+	if !c.accept(candidate) {
+		return false
+	}
+	c.write(candidate)
+	return true
+}
+
+// accept returns true if the candidate is a valid hostname in the scope
+// which may exist, counting the skipped ones by reason
+func (c *candidateWriter) accept(candidate string) bool {
+	if !isValidHostname(candidate) {
+		c.logger.Debug().Msgf("Skipping invalid candidate %s\n", candidate)
+		c.invalid++
+		return false
+	}
+	if !c.scope.Match(candidate) {
+		c.outside++
+		return false
+	}
+	if c.nxdomains.covers(candidate) {
+		c.pruned++
+		return false
+	}
+	if c.negative != nil && c.negative.Covers(candidate) {
+		c.known++
+		return false
+	}
+	return true
+}
+
+// write writes an accepted candidate
+func (c *candidateWriter) write(candidate string) {
+	_, _ = c.writer.WriteString(candidate + "\n")
+	c.written++
+	c.generated.Add(1)
+}
+
+// Flush flushes the buffered candidates and reports the skipped ones
+func (c *candidateWriter) Flush() error {
+	c.report()
+	return c.writer.Flush()
+}
+
+// report logs the number of candidates skipped by reason
+func (c *candidateWriter) report() {
+	if c.invalid > 0 {
+		c.logger.Info().Msgf("Skipped %d invalid candidates\n", c.invalid)
+	}
+	if c.outside > 0 {
+		c.logger.Info().Msgf("Skipped %d candidates out of the scope\n", c.outside)
+	}
+	if c.pruned > 0 {
+		c.logger.Info().Msgf("Skipped %d candidates below names which don't exist\n", c.pruned)
+	}
+	if c.known > 0 {
+		c.logger.Info().Msgf("Skipped %d candidates known not to exist by the negative cache\n", c.known)
+	}
+}
+
+// chunkSize is the number of candidates resolved per massdns run when
+// the candidates are generated lazily or resolved in chunks
+const chunkSize = 100000
+
+// candidateChunker writes the candidates to chunk files which are resolved
+// as soon as they are full, so that large cross-products are generated
+// lazily instead of being materialized on disk up front. The candidates
+// are skipped by the candidate writer of the chunk files.
+type candidateChunker struct {
+	*candidateWriter
+	ctx     context.Context
+	tempDir string
+	prefix  string
+	onChunk func(path string) error
+
+	file   *os.File
+	size   int
+	chunks int
+	err    error
+}
+
+// newCandidateChunker creates a chunker calling onChunk for every chunk file
+func (r *Runner) newCandidateChunker(prefix string, onChunk func(path string) error) *candidateChunker {
+	return &candidateChunker{candidateWriter: r.newCandidateWriter(io.Discard), ctx: r.ctx, tempDir: r.tempDir, prefix: prefix, onChunk: onChunk}
+}
+
+// Write writes the candidate and returns true if it is a valid hostname
+// in the scope which may exist, the names below the ones answered
+// NXDOMAIN by the previous chunks being skipped when pruning, and the
+// ones of the negative cache. The current chunk is
+// resolved once it is full. Candidates are discarded once the deadline
+// is reached.
+func (c *candidateChunker) Write(candidate string) bool {
+	if c.err != nil || c.ctx.Err() != nil {
+		return false
+	}
+	if !c.accept(candidate) {
+		return false
+	}
+
+	if c.file == nil {
+		c.file, c.err = os.CreateTemp(c.tempDir, c.prefix)
+		if c.err != nil {
+			return false
+		}
+		c.writer.Reset(c.file)
+	}
+	c.write(candidate)
+	c.size++
+
+	if c.size >= chunkSize {
+		c.err = c.resolveChunk()
+	}
+	return true
+}
+
+// resolveChunk closes the current chunk file and resolves it
+func (c *candidateChunker) resolveChunk() error {
+	path := c.file.Name()
+	defer os.Remove(path)
+
+	err := c.writer.Flush()
+	c.file.Close()
+	size := c.size
+	c.file, c.size = nil, 0
+	if err != nil {
+		return err
+	}
+
+	c.chunks++
+	c.logger.Info().Msgf("Resolving chunk %d of %d candidates\n", c.chunks, size)
+	return c.onChunk(path)
+}
+
+// Close resolves the last partial chunk and reports the skipped candidates
+func (c *candidateChunker) Close() error {
+	if c.err == nil && c.file != nil && c.ctx.Err() == nil {
+		c.err = c.resolveChunk()
+	}
+	c.report()
+	return c.err
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/projectdiscovery/gologger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValidHostname(t *testing.T) {
+	for _, hostname := range []string{"www.example.com", "_dmarc.example.com", "a-b.example.com", "1.example.com"} {
+		require.True(t, isValidHostname(hostname), "Got invalid hostname %s", hostname)
+	}
+	for _, hostname := range []string{
+		"",
+		"-www.example.com",
+		"www-.example.com",
+		"www..example.com",
+		"www.example.com.",
+		"ww w.example.com",
+		"www!.example.com",
+		strings.Repeat("a", 64) + ".example.com",
+		strings.Repeat("a.", 127) + "com",
+	} {
+		require.False(t, isValidHostname(hostname), "Got valid hostname %s", hostname)
+	}
+}
+
+func TestCandidateChunker(t *testing.T) {
+	dir := t.TempDir()
+	runner := &Runner{tempDir: dir, shared: newShared(dir), ctx: context.Background(), logger: gologger.DefaultLogger, candidates: &atomic.Int64{}}
+
+	var sizes []int
+	chunker := runner.newCandidateChunker("test-", func(path string) error {
+		data, err := os.ReadFile(path)
+		require.Nil(t, err, "Could not read chunk")
+		sizes = append(sizes, strings.Count(string(data), "\n"))
+		return nil
+	})
+	for i := 0; i <= chunkSize; i++ {
+		chunker.Write(fmt.Sprintf("w%d.example.com", i))
+	}
+	chunker.Write("-invalid.example.com")
+	require.Nil(t, chunker.Close(), "Could not close chunker")
+
+	require.Equal(t, []int{chunkSize, 1}, sizes, "Got unexpected chunks")
+	require.Equal(t, 1, chunker.invalid, "Got unexpected invalid count")
+}
+
+func TestCandidateChunkerPruning(t *testing.T) {
+	dir := t.TempDir()
+	runner := &Runner{tempDir: dir, shared: newShared(dir), ctx: context.Background(), logger: gologger.DefaultLogger, candidates: &atomic.Int64{}, nxdomains: newNXDomainCache()}
+	runner.nxdomains.add("Internal.example.com")
+	negative, err := store.OpenNegativeCache(filepath.Join(dir, "negative"), time.Hour)
+	require.Nil(t, err, "Could not open negative cache")
+	defer negative.Close()
+	require.Nil(t, negative.Add("dead.example.com"), "Could not cache name")
+	runner.shared.negativeCache = negative
+
+	var candidates []string
+	chunker := runner.newCandidateChunker("test-", func(path string) error {
+		data, err := os.ReadFile(path)
+		require.Nil(t, err, "Could not read chunk")
+		candidates = strings.Fields(string(data))
+		return nil
+	})
+	for _, candidate := range []string{"internal.example.com", "api.internal.example.com", "a.b.INTERNAL.example.com", "dead.example.com", "api.example.com"} {
+		chunker.Write(candidate)
+	}
+	require.Nil(t, chunker.Close(), "Could not close chunker")
+
+	require.Equal(t, []string{"internal.example.com", "api.example.com"}, candidates, "Got unexpected candidates")
+	require.Equal(t, 2, chunker.pruned, "Got unexpected pruned count")
+	require.Equal(t, 1, chunker.known, "Got unexpected negative cache count")
+}
+
+func TestImportNames(t *testing.T) {
+	dir := t.TempDir()
+	subfinder := filepath.Join(dir, "subfinder")
+	require.Nil(t, os.Mkdir(subfinder, 0o755), "Could not create subfinder directory")
+	err := os.WriteFile(filepath.Join(subfinder, "example.com.txt"), []byte("www.example.com\nAPI.example.com\n"), 0o600)
+	require.Nil(t, err, "Could not write subfinder output")
+	err = os.WriteFile(filepath.Join(subfinder, "example.com.json"), []byte(`{"host":"dev.example.com","input":"example.com","source":"crtsh"}`+"\n"), 0o600)
+	require.Nil(t, err, "Could not write subfinder json output")
+	amass := filepath.Join(dir, "amass.txt")
+	err = os.WriteFile(amass, []byte("www.example.com (FQDN) --> a_record --> 192.0.2.1 (IPAddress)\nmail.example.org (FQDN)\n"), 0o600)
+	require.Nil(t, err, "Could not write amass output")
+
+	var hostnames []string
+	err = importNames([]string{subfinder, amass}, []string{"example.com"}, func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	})
+	require.Nil(t, err, "Could not import names")
+	require.ElementsMatch(t, []string{"dev.example.com", "www.example.com", "api.example.com"}, hostnames, "Could not get imported names")
+}
+
+func TestCountLabels(t *testing.T) {
+	hostnames := []string{"api-dev.example.com", "api-prod.example.com", "web01.example.com", "web02.example.com", "api-dev.example.com", "www.example.org"}
+	frequencies := countLabels(hostnames, []string{"example.com"})
+	require.Len(t, frequencies, 1, "Counted labels of other domains")
+
+	require.Equal(t, []labelCount{{"api", 2}, {"web", 2}, {"dev", 1}}, mostCommon(frequencies["example.com"].tokens, 3), "Got unexpected tokens")
+	require.Equal(t, []labelCount{{"W-W", 2}, {"WN", 2}}, mostCommon(frequencies["example.com"].patterns, 3), "Got unexpected patterns")
+}
+
+func TestAppendRegistrable(t *testing.T) {
+	seen := make(map[string]struct{})
+	domains := appendRegistrable(nil, seen, []string{"_spf.google.com", "dmarc.agari.com", "spf.protection.outlook.com"})
+	domains = appendRegistrable(domains, seen, []string{"_netblocks.Google.com", "com"})
+	require.Equal(t, []string{"google.com", "agari.com", "outlook.com"}, domains, "Could not get the registrable third-party domains")
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// chaosEndpoint is the url of the Chaos api listing the subdomains of a domain
+var chaosEndpoint = "https://dns.projectdiscovery.io/dns/%s/subdomains"
+
+// chaosTimeout bounds a request to the Chaos api, the datasets of large
+// domains taking a while to be sent
+const chaosTimeout = 5 * time.Minute
+
+// chaosResponse are the subdomains of a domain in the Chaos dataset
+type chaosResponse struct {
+	Domain string `json:"domain"`
+	// Subdomains are the labels below the domain, not the hostnames
+	Subdomains []string `json:"subdomains"`
+}
+
+// fetchChaos returns the hostnames of the Chaos dataset below the domain
+func fetchChaos(ctx context.Context, client *http.Client, key, domain string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(chaosEndpoint, url.PathEscape(domain)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var response chaosResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("could not decode chaos response: %w", err)
+	}
+	hostnames := make([]string, 0, len(response.Subdomains))
+	for _, subdomain := range response.Subdomains {
+		// The wildcard entries of the dataset can't be resolved
+		if subdomain == "" || subdomain == "*" {
+			continue
+		}
+		hostnames = append(hostnames, subdomain+"."+domain)
+	}
+	return hostnames, nil
+}
+
+// chaosSeeds writes the subdomains of the target domains known to the
+// Chaos dataset as candidates, the ones resolving seeding the next passes
+func (r *Runner) chaosSeeds(write func(candidate string) bool) {
+	if !r.options.Chaos {
+		return
+	}
+
+	client := &http.Client{Timeout: chaosTimeout}
+	for _, domain := range r.options.Domains {
+		if r.ctx.Err() != nil {
+			return
+		}
+		hostnames, err := fetchChaos(r.ctx, client, r.options.ChaosKey, domain)
+		if err != nil {
+			r.logError("Could not fetch the chaos subdomains of %s: %s\n", domain, err)
+			continue
+		}
+
+		var written int
+		for _, hostname := range hostnames {
+			if write(hostname) {
+				written++
+			}
+		}
+		r.logger.Info().Msgf("Fetched %d subdomains of %s from chaos\n", written, domain)
+	}
+}
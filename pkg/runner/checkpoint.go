@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/objectstore"
+)
+
+// checkpointTimeout bounds the last upload of the run state, once the
+// run is over or interrupted
+const checkpointTimeout = time.Minute
+
+// checkpointer keeps the run state in an object storage, so that the run
+// of an instance which disappeared is resumed by another one
+type checkpointer struct {
+	store objectstore.Store
+	// dir is the run directory when neither -resume nor -project is given
+	dir string
+
+	mutex sync.Mutex
+	// uploaded are the versions of the files in the storage, by path
+	// relative to the run directory
+	uploaded map[string]fileVersion
+}
+
+// fileVersion tells whether a file changed since it was uploaded
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+// newCheckpointer creates the checkpointer of the storage url, the run
+// directory being created in the temporary directory if needed
+func newCheckpointer(rawURL, tempDir string) (*checkpointer, error) {
+	store, err := objectstore.New(context.Background(), rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not open checkpoint storage: %w", err)
+	}
+	return &checkpointer{
+		store:    store,
+		dir:      filepath.Join(tempDir, "checkpoint"),
+		uploaded: make(map[string]fileVersion),
+	}, nil
+}
+
+// restore downloads the files of the storage missing from the run
+// directory, returning their number
+func (c *checkpointer) restore(ctx context.Context, dir string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	keys, err := c.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var restored int
+	for _, key := range keys {
+		if !massdns.IsRunStateFile(key) {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(key))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return restored, err
+		}
+		if err := c.store.Get(ctx, key, path); err != nil {
+			return restored, err
+		}
+		if info, err := os.Stat(path); err == nil {
+			c.uploaded[key] = fileVersion{size: info.Size(), modTime: info.ModTime()}
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// save uploads the files of the run directory changed since the previous
+// upload, returning their number
+func (c *checkpointer) save(ctx context.Context, dir string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var saved int
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The run directory is created by the first chunk
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil || entry.IsDir() || !massdns.IsRunStateFile(key) {
+			return nil
+		}
+		key = filepath.ToSlash(key)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		version := fileVersion{size: info.Size(), modTime: info.ModTime()}
+		if c.uploaded[key] == version {
+			return nil
+		}
+		if err := c.store.Put(ctx, key, path); err != nil {
+			return err
+		}
+		c.uploaded[key] = version
+		saved++
+		return nil
+	})
+	return saved, err
+}
+
+// trackCheckpoint restores the run state from the storage and uploads it
+// every checkpoint interval until the returned function is called, which
+// uploads it a last time
+func (r *Runner) trackCheckpoint() (stop func(), err error) {
+	dir := r.resumeDir()
+	restored, err := r.checkpoint.restore(r.ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not restore checkpoint: %w", err)
+	}
+	if restored > 0 {
+		r.logger.Info().Msgf("Restored %d run state files from %s\n", restored, r.options.Checkpoint)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if r.options.CheckpointInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(r.options.CheckpointInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if saved, err := r.checkpoint.save(context.Background(), dir); err != nil {
+						r.logError("Could not save checkpoint: %s\n", err)
+					} else if saved > 0 {
+						r.logger.Verbose().Msgf("Checkpointed %d run state files\n", saved)
+					}
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(done)
+		wg.Wait()
+
+		// The run state is saved even once interrupted, to be resumed
+		ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+		defer cancel()
+		saved, err := r.checkpoint.save(ctx, dir)
+		if err != nil {
+			r.logError("Could not save checkpoint: %s\n", err)
+			return
+		}
+		r.logger.Info().Msgf("Checkpointed %d run state files to %s\n", saved, r.options.Checkpoint)
+	}, nil
+}
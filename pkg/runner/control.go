@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// startControls starts accepting the runtime control commands
+// from the control socket and the terminal, if requested.
+func (r *Runner) startControls() {
+	// The controls outlive the runs, being started by the first one
+	r.controls.Do(func() {
+		if r.options.ControlSocket != "" {
+			if err := r.serveControlSocket(); err != nil {
+				r.logError("Could not listen on control socket: %s\n", err)
+			}
+		}
+		if r.options.Interactive {
+			go r.readTerminalCommands()
+		}
+	})
+}
+
+// handleCommand executes a runtime control command and returns its reply
+func (r *Runner) handleCommand(command string) string {
+	switch strings.ToLower(strings.TrimSpace(command)) {
+	case "p", "pause":
+		r.limiter.Pause()
+		return "Paused resolution"
+	case "r", "resume":
+		r.limiter.Resume()
+		return "Resumed resolution"
+	case "s", "stats":
+		return r.stats()
+	case "k", "skip":
+		// Paused queries must be released for the run to finish
+		r.limiter.Resume()
+		r.cancel(errSkipped)
+		return "Skipping to the output phase"
+	default:
+		return "Unknown command, use pause, resume, stats or skip"
+	}
+}
+
+// stats returns a snapshot of the progress of the enumeration
+func (r *Runner) stats() string {
+	progress := r.progress()
+
+	state := "running"
+	if progress.Paused {
+		state = "paused"
+	}
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	return fmt.Sprintf("Phase: %s, state: %s, queries: %d, found: %d, wildcards dropped: %d, memory: %dMB, elapsed: %s",
+		progress.Phase, state, progress.Queries, progress.Found, progress.WildcardDrops, memory.Alloc/1024/1024, progress.Elapsed.Round(time.Second))
+}
+
+// serveControlSocket accepts commands on a unix socket, one per line
+func (r *Runner) serveControlSocket() error {
+	// Remove the socket left by a previous run
+	_ = os.Remove(r.options.ControlSocket)
+
+	listener, err := net.Listen("unix", r.options.ControlSocket)
+	if err != nil {
+		return err
+	}
+	r.controlListener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if strings.TrimSpace(scanner.Text()) == "" {
+						continue
+					}
+					_, _ = fmt.Fprintln(conn, r.handleCommand(scanner.Text()))
+				}
+			}(conn)
+		}
+	}()
+	return nil
+}
+
+// readTerminalCommands reads the commands typed in the terminal, which
+// is used instead of stdin since stdin may carry the input hostnames.
+func (r *Runner) readTerminalCommands() {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		r.logError("Could not open terminal for interactive commands: %s\n", err)
+		return
+	}
+	defer tty.Close()
+
+	scanner := bufio.NewScanner(tty)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		r.logger.Info().Msgf("%s\n", r.handleCommand(scanner.Text()))
+	}
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultCTEndpoint is the crt.sh search of the certificates of the subdomains
+const defaultCTEndpoint = "https://crt.sh/?q=%25.{domain}&output=json"
+
+// ctTimeout bounds a certificate transparency search, crt.sh being slow
+// to answer for the domains with many certificates
+const ctTimeout = 5 * time.Minute
+
+// fetchCT returns the hostnames below the domain named by the certificates
+// of the certificate transparency search. The names are read from every
+// string of a json response, such as the name_value of crt.sh or the
+// dns_names of certspotter, and from the body of the other responses.
+func fetchCT(ctx context.Context, client *http.Client, endpoint, domain string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(endpoint, "{domain}", url.QueryEscape(domain)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostnames []string
+	seen := make(map[string]struct{})
+	onToken := func(token string) {
+		hostname := strings.ToLower(strings.Trim(token, ".-"))
+		if _, ok := seen[hostname]; ok {
+			return
+		}
+		if (hostname != domain && !strings.HasSuffix(hostname, "."+domain)) || !isValidHostname(hostname) {
+			return
+		}
+		seen[hostname] = struct{}{}
+		hostnames = append(hostnames, hostname)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return hostnames, scanHostnameTokens(bytes.NewReader(body), onToken)
+	}
+	walkStrings(decoded, func(value string) {
+		// The wildcard names seed the level below them
+		_ = scanHostnameTokens(strings.NewReader(value), onToken)
+	})
+	return hostnames, nil
+}
+
+// walkStrings calls callback for every string of a decoded json value
+func walkStrings(value interface{}, callback func(value string)) {
+	switch value := value.(type) {
+	case string:
+		callback(value)
+	case []interface{}:
+		for _, item := range value {
+			walkStrings(item, callback)
+		}
+	case map[string]interface{}:
+		for _, item := range value {
+			walkStrings(item, callback)
+		}
+	}
+}
+
+// ctSeeds writes the subdomains of the target domains named by the
+// certificate transparency logs as candidates, and keeps them as seeds of
+// the alteration passes whether they resolve or not
+func (r *Runner) ctSeeds(write func(candidate string) bool) {
+	if !r.options.CT {
+		return
+	}
+
+	client := &http.Client{Timeout: ctTimeout}
+	for _, domain := range r.options.Domains {
+		if r.ctx.Err() != nil {
+			return
+		}
+		hostnames, err := fetchCT(r.ctx, client, r.options.CTEndpoint, domain)
+		if err != nil {
+			r.logError("Could not search the certificates of %s: %s\n", domain, err)
+			continue
+		}
+
+		var subdomains []string
+		var written int
+		for _, hostname := range hostnames {
+			if hostname == domain {
+				continue
+			}
+			subdomains = append(subdomains, hostname)
+			if write(hostname) {
+				written++
+			}
+		}
+		r.discoveredMutex.Lock()
+		r.seeds = append(r.seeds, subdomains...)
+		r.discoveredMutex.Unlock()
+		r.logger.Info().Msgf("Found %d subdomains of %s in the certificate transparency logs\n", written, domain)
+	}
+}
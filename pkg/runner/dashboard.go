@@ -0,0 +1,310 @@
+package runner
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+// dashboardMaxJobs is the number of jobs listed by the dashboard, the
+// oldest finished ones being forgotten
+const dashboardMaxJobs = 100
+
+// Status of the jobs listed by the dashboard
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// dashboard is the web page listing the jobs of the daemon modes, their
+// live progress and their results
+type dashboard struct {
+	// token is the secret the requests must send, empty if the dashboard
+	// is only served on the loopback interface
+	token string
+
+	mutex  sync.Mutex
+	jobs   []*dashboardJob
+	nextID int
+	// scheduled are the next scans of the scheduled targets
+	scheduled map[string]time.Time
+}
+
+// dashboardJob is a scan or a job of the queue
+type dashboardJob struct {
+	ID       int           `json:"id"`
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Progress Progress      `json:"progress"`
+	Found    int           `json:"found"`
+	Error    string        `json:"error,omitempty"`
+
+	results []*Result
+}
+
+// serveDashboard serves the dashboard on the address in the background.
+// Without token, it is only served on the loopback interface.
+func serveDashboard(address, token string, logger *gologger.Logger) (*dashboard, net.Addr, error) {
+	address = localAddress(address)
+	if token == "" {
+		host, _, err := net.SplitHostPort(address)
+		if ip := net.ParseIP(host); err != nil || (host != "localhost" && (ip == nil || !ip.IsLoopback())) {
+			return nil, nil, errors.New("a dashboard token is required to serve the dashboard on a non-loopback address")
+		}
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not listen on %s: %w", address, err)
+	}
+
+	d := &dashboard{token: token, scheduled: make(map[string]time.Time)}
+	server := &http.Server{Handler: d, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error().Msgf("Could not serve dashboard: %s\n", err)
+		}
+	}()
+
+	logger.Info().Msgf("Serving dashboard on http://%s/\n", listener.Addr())
+	return d, listener.Addr(), nil
+}
+
+// start lists a job as running
+func (d *dashboard) start(name string) *dashboardJob {
+	if d == nil {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.nextID++
+	job := &dashboardJob{ID: d.nextID, Name: name, Status: jobRunning, Started: time.Now()}
+	d.jobs = append(d.jobs, job)
+
+	// Forget the oldest finished jobs
+	for i := 0; len(d.jobs) > dashboardMaxJobs && i < len(d.jobs); {
+		if d.jobs[i].Status == jobRunning {
+			i++
+			continue
+		}
+		d.jobs = append(d.jobs[:i], d.jobs[i+1:]...)
+	}
+	return job
+}
+
+// track returns the option updating the progress of the job, leaving
+// the options as they are when the dashboard is disabled
+func (d *dashboard) track(job *dashboardJob) Option {
+	return func(options *Options) {
+		if d == nil {
+			return
+		}
+		onProgress := options.OnProgress
+		options.OnProgress = func(progress Progress) {
+			d.mutex.Lock()
+			job.Progress, job.Found = progress, progress.Found
+			d.mutex.Unlock()
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+	}
+}
+
+// finish records the results of the job
+func (d *dashboard) finish(job *dashboardJob, results []*Result, err error) {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	job.Status, job.Duration = jobDone, time.Since(job.Started)
+	if err != nil {
+		job.Status, job.Error = jobFailed, err.Error()
+	}
+	job.results = results
+	job.Found = len(results)
+}
+
+// schedule records the next scan of a scheduled target
+func (d *dashboard) schedule(name string, next time.Time) {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	d.scheduled[name] = next
+	d.mutex.Unlock()
+}
+
+// dashboardState is the content of the dashboard
+type dashboardState struct {
+	Jobs      []dashboardJob      `json:"jobs"`
+	Scheduled []dashboardSchedule `json:"scheduled,omitempty"`
+}
+
+// dashboardSchedule is the next scan of a scheduled target
+type dashboardSchedule struct {
+	Name string    `json:"name"`
+	Next time.Time `json:"next"`
+}
+
+// state returns a copy of the jobs, the latest first, and the next scans
+func (d *dashboard) state() dashboardState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	state := dashboardState{Jobs: make([]dashboardJob, 0, len(d.jobs))}
+	for i := len(d.jobs) - 1; i >= 0; i-- {
+		job := *d.jobs[i]
+		if job.Status == jobRunning {
+			job.Duration = time.Since(job.Started)
+		}
+		job.results = nil
+		state.Jobs = append(state.Jobs, job)
+	}
+	for name, next := range d.scheduled {
+		state.Scheduled = append(state.Scheduled, dashboardSchedule{Name: name, Next: next})
+	}
+	sort.Slice(state.Scheduled, func(i, j int) bool {
+		return state.Scheduled[i].Next.Before(state.Scheduled[j].Next)
+	})
+	return state
+}
+
+// results returns the results of a finished job
+func (d *dashboard) results(id int) ([]*Result, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, job := range d.jobs {
+		if job.ID == id && job.Status != jobRunning {
+			return job.results, true
+		}
+	}
+	return nil, false
+}
+
+// ServeHTTP serves the page, the json api and the results downloads
+func (d *dashboard) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !d.authorized(req) {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="shuffledns"`)
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch path := req.URL.Path; {
+	case path == "/":
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(rw, d.state()); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+	case path == "/api/jobs":
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(d.state())
+	case strings.HasPrefix(path, "/jobs/"):
+		d.serveResults(rw, req, strings.TrimPrefix(path, "/jobs/"))
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// authorized tells if the request sends the token as a bearer token or
+// as the password of a basic auth, for the browsers
+func (d *dashboard) authorized(req *http.Request) bool {
+	if d.token == "" {
+		return true
+	}
+	if _, password, ok := req.BasicAuth(); ok {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(d.token)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+d.token)) == 1
+}
+
+// serveResults serves the results of a job as text (<id>/results.txt)
+// or json lines (<id>/results.json)
+func (d *dashboard) serveResults(rw http.ResponseWriter, req *http.Request, path string) {
+	idPart, file, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idPart)
+	if err != nil || (file != "results.txt" && file != "results.json") {
+		http.NotFound(rw, req)
+		return
+	}
+	results, ok := d.results(id)
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=job-%d-%s", id, file))
+	if file == "results.json" {
+		rw.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(rw)
+		for _, result := range results {
+			_ = encoder.Encode(result)
+		}
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, result := range results {
+		fmt.Fprintln(rw, result.Hostname)
+	}
+}
+
+// dashboardTemplate is the page of the dashboard, refreshed every 5 seconds
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"round": func(duration time.Duration) time.Duration { return duration.Round(time.Second) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>shuffledns</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.running { color: #1a6; } .failed { color: #c22; }
+</style>
+</head>
+<body>
+<h1>shuffledns</h1>
+{{if .Scheduled}}
+<h2>Scheduled</h2>
+<table>
+<tr><th>Target</th><th>Next scan</th></tr>
+{{range .Scheduled}}<tr><td>{{.Name}}</td><td>{{.Next.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Jobs</h2>
+{{if .Jobs}}
+<table>
+<tr><th>#</th><th>Name</th><th>Status</th><th>Started</th><th>Duration</th><th>Phase</th><th>Candidates</th><th>Queries</th><th>Found</th><th>Results</th></tr>
+{{range .Jobs}}<tr>
+<td>{{.ID}}</td><td>{{.Name}}</td>
+<td class="{{.Status}}">{{.Status}}{{if .Error}}: {{.Error}}{{end}}</td>
+<td>{{.Started.Format "2006-01-02 15:04:05"}}</td><td>{{round .Duration}}</td>
+<td>{{.Progress.Phase}}</td><td>{{.Progress.Candidates}}</td><td>{{.Progress.Queries}}</td><td>{{.Found}}</td>
+<td>{{if ne .Status "running"}}<a href="/jobs/{{.ID}}/results.txt">txt</a> <a href="/jobs/{{.ID}}/results.json">json</a>{{end}}</td>
+</tr>
+{{end}}</table>
+{{else}}
+<p>No jobs yet.</p>
+{{end}}
+</body>
+</html>
+`))
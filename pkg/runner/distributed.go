@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/distributed"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+)
+
+// serveWorker runs the worker node resolving the shares of the
+// coordinators with the local massdns until interrupted
+func serveWorker(options *Options) error {
+	massdnsPath := options.MassdnsPath
+	if massdnsPath == "" {
+		if massdnsPath = findBinary(); massdnsPath == "" {
+			return ErrMassdnsNotFound
+		}
+	}
+
+	worker, err := distributed.NewWorker(distributed.WorkerOptions{
+		MassdnsPath:   massdnsPath,
+		Threads:       options.Threads,
+		ResolversFile: options.ResolversFile,
+		MassDnsCmd:    options.MassDnsCmd,
+		NDJSON:        options.NDJSON,
+		TempDir:       options.Directory,
+		Token:         options.WorkerToken,
+		RateLimiter:   ratelimit.New(options.RateLimit),
+		Logger:        options.logger(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return worker.ListenAndServe(ctx, options.Worker)
+}
+
+// backend returns the backend resolving the candidates instead of the
+// built-in ones, the coordinator of the worker nodes when workers are given
+func (r *Runner) backend() (massdns.Backend, error) {
+	if r.options.CustomBackend != nil || len(r.options.Workers) == 0 {
+		return r.options.CustomBackend, nil
+	}
+	return distributed.NewCoordinator(distributed.CoordinatorOptions{
+		Workers:       r.options.Workers,
+		ResolversFile: r.options.ResolversFile,
+		Token:         r.options.WorkerToken,
+		TempDir:       r.tempDir,
+		Logger:        r.logger,
+	})
+}
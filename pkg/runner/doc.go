@@ -1,2 +1,33 @@
 // Package runner executes the enumeration process.
+//
+// Besides the command line, the runner can be embedded in other Go
+// programs, configured with options instead of flags:
+//
+//	r, err := runner.NewWithOptions(
+//		runner.WithMode(runner.BruteForce),
+//		runner.WithDomains("example.com"),
+//		runner.WithWordlist("wordlist.txt"),
+//		runner.WithResolvers("resolvers.txt"),
+//		runner.WithOutputWriter(io.Discard),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//
+//	results, errs := r.Results(ctx)
+//	for hostname := range results {
+//		fmt.Println(hostname)
+//	}
+//	return <-errs
+//
+// The Options can also be copied from DefaultOptions, validated with
+// Validate and given to New. Run with the OnHostname callback of the
+// options can be used instead of the results channel. The progress is
+// logged with gologger's DefaultLogger, or the logger given with
+// WithLogger to silence, redirect or format the logs of the runner.
+//
+// A runner can run several enumerations, one after the other with Run,
+// or concurrently with Enumerate, reusing its wildcard cache, validated
+// resolvers and trusted clients.
 package runner
@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	fileutil "github.com/projectdiscovery/utils/file"
+	"gopkg.in/yaml.v3"
+)
+
+// domainResolvers are the resolver lists assigned to a target domain
+type domainResolvers struct {
+	Resolvers        string `yaml:"resolvers"`
+	TrustedResolvers string `yaml:"trusted-resolvers"`
+}
+
+// resolverGroup is a set of target domains sharing the same resolvers
+type resolverGroup struct {
+	domains          []string
+	resolvers        string
+	trustedResolvers string
+}
+
+// loadDomainResolvers reads the yaml file mapping target domains to resolvers
+func loadDomainResolvers(file string) (map[string]domainResolvers, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]domainResolvers
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse domain resolvers: %w", err)
+	}
+
+	mapping := make(map[string]domainResolvers, len(config))
+	for domain, resolvers := range config {
+		if resolvers.Resolvers != "" && !fileutil.FileExists(resolvers.Resolvers) {
+			return nil, fmt.Errorf("resolver file of %s doesn't exists", domain)
+		}
+		if resolvers.TrustedResolvers != "" && !fileutil.FileExists(resolvers.TrustedResolvers) {
+			return nil, fmt.Errorf("trusted resolver file of %s doesn't exists", domain)
+		}
+		mapping[sanitizeHostname(domain)] = resolvers
+	}
+	return mapping, nil
+}
+
+// resolverGroups groups the target domains by the resolvers assigned to
+// them. The domains without any assignment use the default resolvers and
+// form the first group. The mapped domains are the targets if none was given.
+func (r *Runner) resolverGroups(mapping map[string]domainResolvers) []*resolverGroup {
+	domains := []string(r.options.Domains)
+	if len(domains) == 0 {
+		for domain := range mapping {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+	}
+
+	groups := []*resolverGroup{{resolvers: r.options.ResolversFile, trustedResolvers: r.options.TrustedResolvers}}
+	byResolvers := make(map[string]*resolverGroup)
+	for _, domain := range domains {
+		resolvers, ok := mapping[domain]
+		if !ok {
+			groups[0].domains = append(groups[0].domains, domain)
+			continue
+		}
+		if resolvers.Resolvers == "" {
+			resolvers.Resolvers = r.options.ResolversFile
+		}
+		if resolvers.TrustedResolvers == "" {
+			resolvers.TrustedResolvers = r.options.TrustedResolvers
+		}
+
+		key := resolvers.Resolvers + "|" + resolvers.TrustedResolvers
+		group, ok := byResolvers[key]
+		if !ok {
+			group = &resolverGroup{resolvers: resolvers.Resolvers, trustedResolvers: resolvers.TrustedResolvers}
+			byResolvers[key] = group
+			groups = append(groups, group)
+		}
+		group.domains = append(group.domains, domain)
+	}
+	return groups
+}
+
+// splitByGroup splits the resolution list into a list per resolver group,
+// hostnames outside every target domain belonging to the default group.
+func (r *Runner) splitByGroup(inputFile string, groups []*resolverGroup) ([]string, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read resolution list: %w", err)
+	}
+	defer input.Close()
+
+	files := make([]*os.File, len(groups))
+	writers := make([]*bufio.Writer, len(groups))
+	paths := make([]string, len(groups))
+	for i := range groups {
+		files[i], err = os.CreateTemp(r.tempDir, "massdns-group-")
+		if err != nil {
+			return nil, fmt.Errorf("could not create resolution list (%s): %w", r.tempDir, err)
+		}
+		defer files[i].Close()
+		writers[i] = bufio.NewWriter(files[i])
+		paths[i] = files[i].Name()
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		hostname := scanner.Text()
+
+		index, matched := 0, ""
+		for i, group := range groups {
+			for _, domain := range group.domains {
+				if (hostname == domain || strings.HasSuffix(hostname, "."+domain)) && len(domain) > len(matched) {
+					index, matched = i, domain
+				}
+			}
+		}
+		_, _ = writers[index].WriteString(hostname + "\n")
+	}
+	for _, writer := range writers {
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// processResolverGroups runs the enumeration of every group of target
+// domains with the resolvers assigned to it, in a single invocation.
+func (r *Runner) processResolverGroups() error {
+	mapping, err := loadDomainResolvers(r.options.DomainResolvers)
+	if err != nil {
+		return fmt.Errorf("could not read domain resolvers: %w", err)
+	}
+	groups := r.resolverGroups(mapping)
+
+	// The resolution list is read once and dispatched to the groups
+	var inputs []string
+	if r.options.Mode != string(BruteForce) {
+		resolveFile, err := r.readResolutionList()
+		if err != nil {
+			return err
+		}
+		if inputs, err = r.splitByGroup(resolveFile, groups); err != nil {
+			return err
+		}
+	}
+
+	var (
+		runs int
+		errs []error
+	)
+	for i, group := range groups {
+		options := *r.options
+		options.Domains = group.domains
+		options.ResolversFile = group.resolvers
+		options.TrustedResolvers = group.trustedResolvers
+		// The groups after the first one append to the same output
+		options.appendOutput = runs > 0
+		runner := r.derive(&options)
+
+		if inputs == nil {
+			if len(group.domains) == 0 {
+				continue
+			}
+			r.logger.Info().Msgf("Bruteforcing %s with resolvers %s\n", strings.Join(group.domains, ", "), group.resolvers)
+			err = runner.processDomain()
+		} else {
+			if blank, err := massdns.IsEmptyFile(inputs[i]); err != nil || blank {
+				continue
+			}
+			r.logger.Info().Msgf("Resolving hostnames of %s with resolvers %s\n", describeDomains(group.domains), group.resolvers)
+			err = runner.runMassdns(inputs[i])
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		runs++
+	}
+	return errors.Join(errs...)
+}
+
+// describeDomains returns the domains of a group for logging
+func describeDomains(domains []string) string {
+	if len(domains) == 0 {
+		return "other domains"
+	}
+	return strings.Join(domains, ", ")
+}
@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/ShlomieLiberow/shuffledns/pkg/wildcards"
+)
+
+// shared are the resources reused by the successive and concurrent
+// enumerations of a runner, for long-lived services embedding it
+type shared struct {
+	// tempDir is the temporary directory of the runner, outliving the enumerations
+	tempDir string
+	// wildcardStore caches the wildcard ips found by every enumeration
+	wildcardStore *wildcards.Store
+	// negativeCache keeps the names which don't exist across the runs, nil if none
+	negativeCache *store.NegativeCache
+	// reloadSignal reloads the resolvers of the massdns instances of the runner
+	reloadSignal *massdns.ReloadSignal
+
+	mutex sync.Mutex
+	// trustedClients are the clients sending the wildcard queries, by
+	// trusted resolvers file, retries and proxy
+	trustedClients map[string]dnsclient.Client
+	// validatedResolvers are the copies of the resolvers files keeping the
+	// resolvers which survived the validation, by resolvers file
+	validatedResolvers map[string]string
+}
+
+// newShared creates the shared resources of a runner
+func newShared(tempDir string) *shared {
+	return &shared{
+		tempDir:            tempDir,
+		wildcardStore:      wildcards.NewStore(),
+		reloadSignal:       &massdns.ReloadSignal{},
+		trustedClients:     make(map[string]dnsclient.Client),
+		validatedResolvers: make(map[string]string),
+	}
+}
+
+// trustedClient returns the client of the trusted resolvers of the
+// options, created once. The massdns instances create their own client
+// if it can't be created, nil being returned.
+func (s *shared) trustedClient(options *Options) dnsclient.Client {
+	key := options.TrustedResolvers + "|" + strconv.Itoa(options.Retries) + "|" + options.Proxy
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if client, ok := s.trustedClients[key]; ok {
+		return client
+	}
+	client, err := massdns.NewTrustedClient(options.TrustedResolvers, options.Retries, options.Proxy)
+	if err != nil {
+		return nil
+	}
+	s.trustedClients[key] = client
+	return client
+}
+
+// validated returns the validated copy of the resolvers file, if any
+func (s *shared) validated(resolversFile string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path, ok := s.validatedResolvers[resolversFile]
+	return path, ok
+}
+
+// setValidated records the validated copy of the resolvers file
+func (s *shared) setValidated(resolversFile, path string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.validatedResolvers[resolversFile] = path
+	// The copy is already validated when given again
+	s.validatedResolvers[path] = path
+}
+
+// reset starts the state of an enumeration afresh, after the first one
+func (r *Runner) reset() {
+	if !r.ran {
+		r.ran = true
+		return
+	}
+	r.start = time.Now()
+	r.ctx, r.cancel = context.WithCancelCause(context.Background())
+	r.candidates, r.counters = &atomic.Int64{}, &massdns.Counters{}
+
+	r.discoveredMutex.Lock()
+	r.discovered = nil
+	r.discoveredMutex.Unlock()
+
+	r.runStats.mutex.Lock()
+	r.runStats.finished, r.runStats.errors, r.runStats.dropped = time.Time{}, 0, nil
+	r.runStats.mutex.Unlock()
+}
+
+// Enumerate runs an enumeration configured by the opts on top of the
+// options of the runner, eg. with other domains and wordlists, and
+// returns its statistics. The enumerations reuse the wildcard cache, the
+// validated resolvers and the trusted clients of the runner, and may run
+// concurrently, each with its own results, callbacks and statistics. The
+// runtime controls are left to Run.
+func (r *Runner) Enumerate(ctx context.Context, opts ...Option) (RunStats, error) {
+	options := *r.options
+	// The options and the validation must not write to the slices of the runner
+	options.Domains = slices.Clone(options.Domains)
+	options.Wordlist = slices.Clone(options.Wordlist)
+	options.Sinks = slices.Clone(options.Sinks)
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.ControlSocket, options.Interactive = "", false
+	if err := options.Validate(); err != nil {
+		return RunStats{}, err
+	}
+
+	runner, err := r.enumeration(&options)
+	if err != nil {
+		return RunStats{}, err
+	}
+	defer runner.Close()
+
+	err = runner.Run(ctx)
+	return runner.Stats(), err
+}
+
+// enumeration creates a runner of the options sharing the resources of
+// r, with its own temporary directory, state and sinks
+func (r *Runner) enumeration(options *Options) (*Runner, error) {
+	dir, err := os.MkdirTemp(r.tempDir, "enumeration-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create enumeration directory: %w", err)
+	}
+
+	runner := r.derive(options)
+	runner.tempDir = dir
+	runner.ctx, runner.cancel = context.WithCancelCause(context.Background())
+	runner.candidates, runner.counters, runner.phases = &atomic.Int64{}, &massdns.Counters{}, &massdns.Phases{}
+	// The json log lines are tagged with the phases of the runner owning the logger
+	if options.LogJSON && runner.logger != r.logger {
+		runner.logger.SetFormatter(newJSONFormatter(runner.phases))
+	}
+	runner.sinks = options.Sinks[len(r.options.Sinks):]
+	// The enumerations are not recorded in the project nor the checkpoint of the runner
+	runner.project, runner.checkpoint = "", nil
+
+	if options.ValidateResolvers && options.Mode != string(Verify) {
+		if err := runner.preflightResolvers(); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if err := runner.tuneThreads(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if options.Webhook != "" && options.Webhook != r.options.Webhook {
+		sink := massdns.NewWebhookSink(options.Webhook)
+		options.Sinks = append(options.Sinks, sink)
+		runner.sinks = append(runner.sinks, sink)
+	}
+	return runner, nil
+}
+
+// derive creates a runner of the options running within the enumeration
+// of r, sharing its resources, context, counters and phases
+func (r *Runner) derive(options *Options) *Runner {
+	return &Runner{
+		tempDir:    r.tempDir,
+		options:    options,
+		logger:     options.logger(),
+		ctx:        r.ctx,
+		cancel:     r.cancel,
+		start:      time.Now(),
+		limiter:    r.limiter,
+		shared:     r.shared,
+		candidates: r.candidates,
+		counters:   r.counters,
+		phases:     r.phases,
+		project:    r.project,
+		checkpoint: r.checkpoint,
+		nxdomains:  r.nxdomains,
+		scope:      r.scope,
+	}
+}
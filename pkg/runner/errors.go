@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"errors"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// Errors returned by the runner, wrapped with their cause and matched
+// with errors.Is instead of their messages
+var (
+	// ErrInvalidOptions is returned by Validate for options which can't be run
+	ErrInvalidOptions = errors.New("invalid options")
+	// ErrMassdnsNotFound is returned when the massdns binary can't be found
+	ErrMassdnsNotFound = errors.New("could not find massdns binary")
+	// ErrNoValidResolvers is returned when none of the resolvers answered correctly
+	ErrNoValidResolvers = errors.New("none of the resolvers answered correctly")
+
+	// ErrZDNSNotFound is returned when the zdns binary can't be found
+	ErrZDNSNotFound = massdns.ErrZDNSNotFound
+	// ErrEmptyInput is returned when there is no hostname to resolve
+	ErrEmptyInput = massdns.ErrEmptyInput
+	// ErrEmptyResolvers is returned when no resolver is left to resolve with
+	ErrEmptyResolvers = massdns.ErrEmptyResolvers
+	// ErrMassdnsFailed is returned when massdns exits with an error
+	ErrMassdnsFailed = massdns.ErrMassdnsFailed
+	// ErrZDNSFailed is returned when zdns exits with an error
+	ErrZDNSFailed = massdns.ErrZDNSFailed
+	// ErrParsePhase is returned when the resolution output can't be parsed
+	ErrParsePhase = massdns.ErrParsePhase
+	// ErrWildcardPhase is returned when the wildcards can't be filtered
+	ErrWildcardPhase = massdns.ErrWildcardPhase
+	// ErrOutputPhase is returned when the output can't be written
+	ErrOutputPhase = massdns.ErrOutputPhase
+)
+
+// invalidOptionsError is a validation error matching ErrInvalidOptions,
+// keeping the message of the error
+type invalidOptionsError struct {
+	err error
+}
+
+// Error returns the message of the validation error
+func (e *invalidOptionsError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns ErrInvalidOptions and the validation error
+func (e *invalidOptionsError) Unwrap() []error {
+	return []error{ErrInvalidOptions, e.err}
+}
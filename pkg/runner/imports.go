@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importNames reads the hostnames below the domains from the files and
+// the files of the directories, calling callback once for every hostname.
+//
+// The hostnames are extracted from the runs of hostname characters of the
+// files whatever their format, so that the plain and json outputs of
+// subfinder and amass, the graph exports of amass and its sqlite
+// databases are read alike.
+func importNames(paths, domains []string, callback func(hostname string)) error {
+	seen := make(map[string]struct{})
+	onToken := func(token string) {
+		hostname := strings.ToLower(strings.Trim(token, ".-"))
+		if _, ok := seen[hostname]; ok {
+			return
+		}
+		if matchDomain(hostname, domains) == "" || !isValidHostname(hostname) {
+			return
+		}
+		seen[hostname] = struct{}{}
+		callback(hostname)
+	}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			return scanHostnameTokens(file, onToken)
+		})
+		if err != nil {
+			return fmt.Errorf("could not import %s: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// scanHostnameTokens calls onToken for every run of letters, digits,
+// dots, hyphens and underscores of the reader
+func scanHostnameTokens(reader io.Reader, onToken func(token string)) error {
+	buffered := bufio.NewReader(reader)
+	var token strings.Builder
+	// Longer runs can't be hostnames
+	var overflow bool
+	flush := func() {
+		if token.Len() > 0 && !overflow {
+			onToken(token.String())
+		}
+		token.Reset()
+		overflow = false
+	}
+	for {
+		c, err := buffered.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+			if token.Len() < maxHostnameLength {
+				token.WriteByte(c)
+			} else {
+				overflow = true
+			}
+			continue
+		}
+		flush()
+	}
+	flush()
+	return nil
+}
+
+// importSeeds writes the hostnames imported from the previous enumerations
+// as candidates, the ones resolving seeding the next passes
+func (r *Runner) importSeeds(write func(candidate string) bool) error {
+	if len(r.options.Import) == 0 {
+		return nil
+	}
+
+	var imported int
+	err := importNames(r.options.Import, r.options.Domains, func(hostname string) {
+		if write(hostname) {
+			imported++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	r.logger.Info().Msgf("Imported %d hostnames from %s\n", imported, strings.Join(r.options.Import, ", "))
+	return nil
+}
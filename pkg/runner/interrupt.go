@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyInterrupt stops launching new work on the first Ctrl-C and lets
+// the run write the results found so far. The default behavior is
+// restored afterwards, so a second Ctrl-C exits immediately.
+func (r *Runner) notifyInterrupt() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	// The preemption of spot instances checkpoints the run state
+	if r.checkpoint != nil {
+		signal.Notify(signals, syscall.SIGTERM)
+	}
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			r.logger.Info().Msgf("Interrupted, writing the partial results (press Ctrl-C again to exit immediately)\n")
+			// Paused queries must be released for the run to finish
+			r.limiter.Resume()
+			r.cancel(errInterrupted)
+		case <-r.ctx.Done():
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/patterns"
+)
+
+// labelReportSize is the number of tokens and patterns reported per domain
+const labelReportSize = 100
+
+// labelCount is a label token or pattern with its number of occurrences
+type labelCount struct {
+	value string
+	count int
+}
+
+// labelFrequencies are the label tokens and patterns of the subdomains of a domain
+type labelFrequencies struct {
+	tokens   map[string]int
+	patterns map[string]int
+}
+
+// countLabels counts the word tokens and the patterns of the subdomains of
+// the hostnames by target domain, each hostname once. The patterns are the
+// shapes of the subdomains, W standing for a word and N for a number.
+func countLabels(hostnames, domains []string) map[string]*labelFrequencies {
+	frequencies := make(map[string]*labelFrequencies)
+	seen := make(map[string]struct{}, len(hostnames))
+	for _, hostname := range hostnames {
+		if _, ok := seen[hostname]; ok {
+			continue
+		}
+		seen[hostname] = struct{}{}
+
+		domain := matchDomain(hostname, domains)
+		if domain == "" {
+			continue
+		}
+		domainFrequencies, ok := frequencies[domain]
+		if !ok {
+			domainFrequencies = &labelFrequencies{tokens: make(map[string]int), patterns: make(map[string]int)}
+			frequencies[domain] = domainFrequencies
+		}
+
+		shape, values := patterns.Tokenize(strings.TrimSuffix(hostname, "."+domain))
+		domainFrequencies.patterns[shape]++
+		for _, value := range values {
+			if !isNumber(value) {
+				domainFrequencies.tokens[value]++
+			}
+		}
+	}
+	return frequencies
+}
+
+// mostCommon returns the most common values of the counts, ties sorted by value
+func mostCommon(counts map[string]int, size int) []labelCount {
+	sorted := make([]labelCount, 0, len(counts))
+	for value, count := range counts {
+		sorted = append(sorted, labelCount{value: value, count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].value < sorted[j].value
+	})
+	if len(sorted) > size {
+		sorted = sorted[:size]
+	}
+	return sorted
+}
+
+// isNumber tells whether the token is made of digits only
+func isNumber(token string) bool {
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+	return token != ""
+}
+
+// writeLabelReport writes the most common label tokens and patterns of the
+// hostnames discovered by the run to the label report file, by domain
+func (r *Runner) writeLabelReport() {
+	r.discoveredMutex.Lock()
+	frequencies := countLabels(r.discovered, r.options.Domains)
+	r.discoveredMutex.Unlock()
+
+	domains := make([]string, 0, len(frequencies))
+	for domain := range frequencies {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var report strings.Builder
+	for _, domain := range domains {
+		fmt.Fprintf(&report, "# %s\n\n## tokens\n", domain)
+		for _, token := range mostCommon(frequencies[domain].tokens, labelReportSize) {
+			fmt.Fprintf(&report, "%s %d\n", token.value, token.count)
+		}
+		report.WriteString("\n## patterns\n")
+		for _, pattern := range mostCommon(frequencies[domain].patterns, labelReportSize) {
+			fmt.Fprintf(&report, "%s %d\n", pattern.value, pattern.count)
+		}
+		report.WriteString("\n")
+	}
+
+	if err := os.WriteFile(r.options.LabelReport, []byte(report.String()), 0644); err != nil {
+		r.logError("Could not write label report: %s\n", err)
+		return
+	}
+	r.logger.Info().Msgf("Wrote the label report of %d domains to %s\n", len(domains), r.options.LabelReport)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package runner
+
+import "syscall"
+
+// openFilesLimit returns the soft limit of open files of the process, 0 if unknown
+func openFilesLimit() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	if limit.Cur > 1<<30 {
+		return 1 << 30
+	}
+	return int(limit.Cur)
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package runner
+
+// openFilesLimit returns 0 since windows has no open files limit to honor
+func openFilesLimit() int { return 0 }
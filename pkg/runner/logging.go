@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/projectdiscovery/gologger/formatter"
+	"github.com/projectdiscovery/gologger/levels"
+)
+
+// jsonFormatter formats log events as json lines tagged with
+// the pipeline phase that emitted them.
+type jsonFormatter struct {
+	json   *formatter.JSON
+	phases *massdns.Phases
+}
+
+// newJSONFormatter creates a formatter tagging the events with the phases
+func newJSONFormatter(phases *massdns.Phases) *jsonFormatter {
+	return &jsonFormatter{json: &formatter.JSON{}, phases: phases}
+}
+
+var _ formatter.Formatter = &jsonFormatter{}
+
+// Format formats the log event data into bytes
+func (f *jsonFormatter) Format(event *formatter.LogEvent) ([]byte, error) {
+	// Results are written as is so that stdout stays pipeable
+	if event.Level == levels.LevelSilent {
+		return []byte(event.Message), nil
+	}
+	if phase := f.phases.Current(); phase != "" {
+		if _, ok := event.Metadata["phase"]; !ok {
+			event.Metadata["phase"] = string(phase)
+		}
+	}
+	return f.json.Format(event)
+}
@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/mailpolicy"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// runMailPolicy analyzes the SPF and DMARC policies of the target domains,
+// writing their summaries to the mail policy file, and resolves the
+// hostnames below the domains they reference. The registrable domains of
+// the third-party names referenced are written to the mail policy domains
+// file, as targets for the next enumerations.
+func (r *Runner) runMailPolicy(instance *massdns.Instance) {
+	client, err := dnsclient.New(dnsclient.Options{Resolvers: instance.TrustedResolvers(), QuestionTypes: []uint16{dns.TypeTXT}, Proxy: r.options.Proxy})
+	if err != nil {
+		r.logError("Could not create dns resolver: %s\n", err)
+		return
+	}
+
+	output, err := os.Create(r.options.MailPolicy)
+	if err != nil {
+		r.logError("Could not create mail policy file: %s\n", err)
+		return
+	}
+	defer output.Close()
+
+	file, err := os.CreateTemp(r.tempDir, "mailpolicy-")
+	if err != nil {
+		r.logError("Could not create mail policy list (%s): %s\n", r.tempDir, err)
+		return
+	}
+	writer := r.newCandidateWriter(file)
+	thirdParty := make(map[string]struct{})
+	var domains []string
+
+	encoder := json.NewEncoder(output)
+	for _, domain := range r.options.Domains {
+		if r.ctx.Err() != nil {
+			break
+		}
+		policy := mailpolicy.Analyze(domain, r.lookupTXT(client, domain), r.lookupTXT(client, "_dmarc."+domain))
+		if policy == nil {
+			r.logger.Info().Msgf("No SPF or DMARC policy found for %s\n", domain)
+			continue
+		}
+		if err := encoder.Encode(policy); err != nil {
+			r.logError("Could not write mail policy of %s: %s\n", domain, err)
+		}
+		for _, candidate := range policy.Candidates {
+			writer.Write(candidate)
+		}
+		if len(policy.ThirdParty) > 0 {
+			r.logger.Info().Msgf("Mail policies of %s reference third-party domains: %s\n", domain, strings.Join(policy.ThirdParty, ", "))
+		}
+		domains = appendRegistrable(domains, thirdParty, policy.ThirdParty)
+	}
+	writer.Flush()
+	file.Close()
+
+	if r.options.MailPolicyDomains != "" {
+		if err := os.WriteFile(r.options.MailPolicyDomains, []byte(strings.Join(append(domains, ""), "\n")), 0o644); err != nil {
+			r.logError("Could not write mail policy domains: %s\n", err)
+		} else {
+			r.logger.Info().Msgf("Wrote %d third-party domains referenced by the mail policies to %s\n", len(domains), r.options.MailPolicyDomains)
+		}
+	}
+
+	r.logger.Info().Msgf("Mail policies reference %d hostnames below the target domains\n", writer.written)
+	if writer.written == 0 {
+		return
+	}
+
+	if err := instance.RunBatch(r.ctx, file.Name()); err != nil {
+		r.logError("Could not run massdns on mail policy hostnames: %s\n", err)
+	}
+}
+
+// appendRegistrable appends the registrable domains of the names not seen yet
+func appendRegistrable(domains []string, seen map[string]struct{}, names []string) []string {
+	for _, name := range names {
+		domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(name))
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[domain]; ok {
+			continue
+		}
+		seen[domain] = struct{}{}
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// lookupTXT returns the TXT records of the name, none if it could not be resolved
+func (r *Runner) lookupTXT(client dnsclient.Client, name string) []string {
+	r.limiter.Take()
+	resp, err := client.QueryOne(name)
+	if err != nil || resp == nil {
+		r.logger.Debug().Msgf("Could not lookup the TXT records of %s: %s\n", name, err)
+		return nil
+	}
+	return resp.TXT
+}
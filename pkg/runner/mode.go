@@ -5,4 +5,7 @@ type Mode string
 const (
 	BruteForce Mode = "bruteforce"
 	Resolve    Mode = "resolve"
+	Filter     Mode = "filter"
+	TLD        Mode = "tld"
+	Verify     Mode = "verify"
 )
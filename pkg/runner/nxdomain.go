@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"strings"
+	"sync"
+)
+
+// nxdomainCacheSize bounds the number of names kept by the nxdomain cache
+const nxdomainCacheSize = 1000000
+
+// nxdomainCache keeps the names answered NXDOMAIN by the previous massdns
+// runs of the enumeration, the names below them not existing either
+type nxdomainCache struct {
+	mutex sync.RWMutex
+	names map[string]struct{}
+}
+
+// newNXDomainCache creates an empty nxdomain cache
+func newNXDomainCache() *nxdomainCache {
+	return &nxdomainCache{names: make(map[string]struct{})}
+}
+
+// add caches the name, once the cache isn't full
+func (c *nxdomainCache) add(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.names) < nxdomainCacheSize {
+		c.names[strings.ToLower(name)] = struct{}{}
+	}
+}
+
+// covers returns true if a parent of the hostname is cached, nil caches
+// covering nothing
+func (c *nxdomainCache) covers(hostname string) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if len(c.names) == 0 {
+		return false
+	}
+	hostname = strings.ToLower(hostname)
+	for i := strings.IndexByte(hostname, '.'); i >= 0; i = strings.IndexByte(hostname, '.') {
+		hostname = hostname[i+1:]
+		if _, ok := c.names[hostname]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// onNXDomain returns the callback caching the names answered NXDOMAIN by
+// massdns in the nxdomain and the negative caches, nil if there are none
+func (r *Runner) onNXDomain() func(hostname string) {
+	nxdomains, negative := r.nxdomains, r.shared.negativeCache
+	if nxdomains == nil && negative == nil {
+		return nil
+	}
+	return func(hostname string) {
+		if nxdomains != nil {
+			nxdomains.add(hostname)
+		}
+		if negative != nil {
+			if err := negative.Add(hostname); err != nil {
+				r.logger.Debug().Msgf("Could not cache %s: %s\n", hostname, err)
+			}
+		}
+	}
+}
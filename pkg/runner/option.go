@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"io"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/projectdiscovery/gologger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures the options of a runner created with NewWithOptions
+type Option func(*Options)
+
+// NewWithOptions creates a runner configured by the opts on top of the
+// DefaultOptions, validated as the command line flags are.
+func NewWithOptions(opts ...Option) (*Runner, error) {
+	options := DefaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return New(&options)
+}
+
+// WithMode sets the execution mode
+func WithMode(mode Mode) Option {
+	return func(options *Options) {
+		options.Mode = string(mode)
+	}
+}
+
+// WithDomains sets the domains to find or resolve subdomains for
+func WithDomains(domains ...string) Option {
+	return func(options *Options) {
+		options.Domains = append(options.Domains, domains...)
+	}
+}
+
+// WithWordlist adds the wordlist files merged for the bruteforce
+func WithWordlist(files ...string) Option {
+	return func(options *Options) {
+		options.Wordlist = append(options.Wordlist, files...)
+	}
+}
+
+// WithSubdomainsList sets the file of the hostnames to resolve
+func WithSubdomainsList(file string) Option {
+	return func(options *Options) {
+		options.SubdomainsList = file
+	}
+}
+
+// WithResolvers sets the file of the resolvers given to massdns
+func WithResolvers(file string) Option {
+	return func(options *Options) {
+		options.ResolversFile = file
+	}
+}
+
+// WithInput reads the hostnames to resolve or verify from the reader, one per line
+func WithInput(reader io.Reader) Option {
+	return func(options *Options) {
+		options.Input = reader
+	}
+}
+
+// WithHostnames resolves or verifies the hostnames instead of reading them from a file
+func WithHostnames(hostnames ...string) Option {
+	return WithInput(strings.NewReader(strings.Join(hostnames, "\n") + "\n"))
+}
+
+// WithTrustedResolvers sets the file of the resolvers used for the native queries
+func WithTrustedResolvers(file string) Option {
+	return func(options *Options) {
+		options.TrustedResolvers = file
+	}
+}
+
+// WithStore keeps the store of the answers and the other temporary
+// data of the enumeration in the directory
+func WithStore(directory string) Option {
+	return func(options *Options) {
+		options.Directory = directory
+	}
+}
+
+// WithOutputWriter writes the results to the writer instead of stdout
+func WithOutputWriter(writer io.Writer) Option {
+	return func(options *Options) {
+		options.OutputWriter = writer
+		options.NoStdout = true
+	}
+}
+
+// WithSink writes the results to the sinks along with the output,
+// the sinks being closed when the runner is
+func WithSink(sinks ...OutputSink) Option {
+	return func(options *Options) {
+		options.Sinks = append(options.Sinks, sinks...)
+	}
+}
+
+// WithBackend resolves the candidates with the backend instead of massdns
+func WithBackend(backend massdns.Backend) Option {
+	return func(options *Options) {
+		options.CustomBackend = backend
+	}
+}
+
+// WithOnHostname calls the callback for every hostname written to the output
+func WithOnHostname(callback func(hostname string)) Option {
+	return func(options *Options) {
+		options.OnHostname = callback
+	}
+}
+
+// WithOnResult calls the callback for every result written to the output
+func WithOnResult(callback func(result *Result)) Option {
+	return func(options *Options) {
+		options.OnResult = callback
+	}
+}
+
+// WithOnWildcard calls the callback for every wildcard root detected
+func WithOnWildcard(callback func(root string, ips []string)) Option {
+	return func(options *Options) {
+		options.OnWildcard = callback
+	}
+}
+
+// WithOnDropped calls the callback for every host left out of the output
+func WithOnDropped(callback func(hostname string, reason DropReason)) Option {
+	return func(options *Options) {
+		options.OnDropped = callback
+	}
+}
+
+// WithOnProgress calls the callback on every phase change and every second during the run
+func WithOnProgress(callback func(progress Progress)) Option {
+	return func(options *Options) {
+		options.OnProgress = callback
+	}
+}
+
+// WithStoreBackend creates the store of the answers of every massdns
+// run with newStore instead of using leveldb
+func WithStoreBackend(newStore func() (store.Store, error)) Option {
+	return func(options *Options) {
+		options.NewStore = newStore
+	}
+}
+
+// WithLogger logs the progress of the enumeration with the logger
+// instead of gologger's default logger
+func WithLogger(logger *gologger.Logger) Option {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+// WithTracerProvider traces the enumerations and their phases with the provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(options *Options) {
+		options.TracerProvider = provider
+	}
+}
@@ -1,48 +1,232 @@
 package runner
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
 
 	"github.com/projectdiscovery/goflags"
 	"github.com/projectdiscovery/gologger"
-	"github.com/projectdiscovery/retryabledns"
+	"github.com/projectdiscovery/gologger/writer"
+	fileutil "github.com/projectdiscovery/utils/file"
+	folderutil "github.com/projectdiscovery/utils/folder"
 	updateutils "github.com/projectdiscovery/utils/update"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultConfigLocation is the config file read when none is specified
+var defaultConfigLocation = filepath.Join(folderutil.AppConfigDirOrDefault(".", "shuffledns"), "config.yaml")
+
+// Result is a host written to the output, passed to OnResult
+type Result = massdns.Result
+
+// OutputSink is a destination of the results, given to WithSink
+type OutputSink = massdns.OutputSink
+
+// DropReason is the reason a host was left out of the output, passed to OnDropped
+type DropReason = massdns.DropReason
+
 // Options contains the configuration options for tuning
 // the active dns resolving process.
 type Options struct {
-	Directory          string              // Directory is a directory for temporary data
-	Domains            goflags.StringSlice // Domains is the list of domains to find subdomains
-	SubdomainsList     string              // SubdomainsList is the file containing list of hosts to resolve
-	ResolversFile      string              // ResolversFile is the file containing resolvers to use for enumeration
-	TrustedResolvers   string              // TrustedResolvers is the file containing trusted resolvers
-	Wordlist           string              // Wordlist is a wordlist to use for enumeration
-	MassdnsPath        string              // MassdnsPath contains the path to massdns binary
-	Output             string              // Output is the file to write found subdomains to.
-	Json               bool                // Json is the format for making output as ndjson
-	Silent             bool                // Silent suppresses any extra text and only writes found host:port to screen
-	Version            bool                // Version specifies if we should just show version and exit
-	Retries            int                 // Retries is the number of retries for dns enumeration
-	Verbose            bool                // Verbose flag indicates whether to show verbose output or not
-	NoColor            bool                // No-Color disables the colored output
-	Threads            int                 // Thread controls the number of parallel host to enumerate
-	MassdnsRaw         string              // MassdnsRaw perform wildcards filtering from an existing massdns output file
-	WildcardThreads    int                 // WildcardsThreads controls the number of parallel host to check for wildcard
-	StrictWildcard     bool                // StrictWildcard flag indicates whether wildcard check has to be performed on each found subdomains
-	WildcardOutputFile string              // StrictWildcard flag indicates whether wildcard check has to be performed on each found subdomains
-	MassDnsCmd         string              // Supports massdns flags(example -i)
-	DisableUpdateCheck bool                // DisableUpdateCheck disable automatic update check
-	Mode               string
-	NDJSON             bool // NDJSON specifies that the input should be parsed as NDJSON
-
-	OnResult func(*retryabledns.DNSData)
+	Config              string              // Config is the path to a yaml/json configuration file
+	Profile             string              // Profile is the name of the profile to apply
+	Directory           string              // Directory is a directory for temporary data
+	Domains             goflags.StringSlice // Domains is the list of domains to find subdomains
+	BaseNames           goflags.StringSlice // BaseNames are the names to combine with top level domains
+	TLDList             string              // TLDList is the file containing top level domains to try
+	SubdomainsList      string              // SubdomainsList is the file containing list of hosts to resolve
+	ResolversFile       string              // ResolversFile is the file containing resolvers to use for enumeration
+	TrustedResolvers    string              // TrustedResolvers is the file containing trusted resolvers
+	Proxy               string              // Proxy is the socks5 or http proxy the native dns queries are sent through
+	Wordlist            goflags.StringSlice // Wordlist are the wordlists to merge for enumeration
+	Import              goflags.StringSlice // Import are the outputs and databases of other tools (amass, subfinder) whose hostnames are resolved along with the wordlist
+	Chaos               bool                // Chaos resolves the subdomains of the Chaos dataset along with the wordlist
+	ChaosKey            string              // ChaosKey is the key of the Chaos api
+	CT                  bool                // CT resolves the subdomains named by the certificate transparency logs along with the wordlist, seeding the alterations
+	CTEndpoint          string              // CTEndpoint is the url of the certificate transparency search, {domain} being replaced by the target domain
+	MassdnsPath         string              // MassdnsPath contains the path to massdns binary
+	Backend             string              // Backend resolves the candidates (massdns, native, zdns)
+	Output              string              // Output is the file to write found subdomains to.
+	Json                bool                // Json is the format for making output as ndjson
+	HttpxOutput         bool                // HttpxOutput writes results as urls ready to be probed by httpx
+	Webhook             string              // Webhook is the url the results are posted to as json arrays
+	OutputBufferSize    int                 // OutputBufferSize is the size in bytes of the buffer of the output file
+	FlushInterval       time.Duration       // FlushInterval is the interval between the flushes of the output while writing the results, 0 to flush at the end only
+	Silent              bool                // Silent suppresses any extra text and only writes found host:port to screen
+	Version             bool                // Version specifies if we should just show version and exit
+	Retries             int                 // Retries is the number of retries for dns enumeration
+	RetryTimeouts       bool                // RetryTimeouts resolves the names which got no reply at all with the trusted resolvers before dropping them
+	Verbose             bool                // Verbose flag indicates whether to show verbose output or not
+	NoColor             bool                // No-Color disables the colored output
+	LogJSON             bool                // LogJSON writes log messages as json lines
+	NoProgress          bool                // NoProgress doesn't show the progress bar on the terminal
+	StatusInterval      time.Duration       // StatusInterval is the interval between the status lines logged without the progress bar, 0 to disable them
+	Threads             int                 // Thread controls the number of parallel host to enumerate
+	RateLimit           int                 // RateLimit is the maximum number of dns queries per second across all phases
+	MassdnsRaw          string              // MassdnsRaw perform wildcards filtering from an existing massdns output file
+	WildcardThreads     int                 // WildcardsThreads controls the number of parallel host to check for wildcard
+	AutoThreads         bool                // AutoThreads derives the thread counts left to zero from the number of resolvers
+	AdaptiveThreads     bool                // AdaptiveThreads backs off the massdns threads when the failure rate of a chunk spikes
+	StrictWildcard      bool                // StrictWildcard flag indicates whether wildcard check has to be performed on each found subdomains
+	CNAMEReport         string              // CNAMEReport is the file the third-party apex domains the cnames of the hosts point to are reported to
+	LabelReport         string              // LabelReport is the file the most common label tokens and patterns of the discovered hostnames are written to
+	WildcardOutputFile  string              // StrictWildcard flag indicates whether wildcard check has to be performed on each found subdomains
+	MassDnsCmd          string              // Supports massdns flags(example -i)
+	FilterRcodes        goflags.StringSlice // FilterRcodes only outputs hosts whose reply has one of the response codes
+	FilterCNAMEOnly     bool                // FilterCNAMEOnly only outputs hosts having a CNAME record
+	MinIPs              int                 // MinIPs only outputs hosts resolving to at least this number of ips
+	MinTTL              int                 // MinTTL only outputs hosts whose lowest answer ttl is at least this number of seconds
+	MaxTTL              int                 // MaxTTL only outputs hosts whose lowest answer ttl is at most this number of seconds
+	MatchRegex          goflags.StringSlice // MatchRegex only outputs hostnames matching one of the regular expressions
+	FilterRegex         goflags.StringSlice // FilterRegex never outputs hostnames matching one of the regular expressions
+	ScopeFile           string              // ScopeFile is the file of the hostname patterns the candidates and the results must match
+	ScopeBurp           string              // ScopeBurp is the Burp Suite or ZAP scope export the candidates and the results must match
+	MinDepth            int                 // MinDepth only outputs hostnames with at least this number of labels below the target domain
+	MaxDepth            int                 // MaxDepth only outputs hostnames with at most this number of labels below the target domain
+	ExcludeIPCIDRs      goflags.StringSlice // ExcludeIPCIDRs are the ranges (or presets) hosts must not resolve into
+	MatchIPCIDRs        goflags.StringSlice // MatchIPCIDRs only outputs hosts resolving into one of the ranges (or presets)
+	FlagExcluded        bool                // FlagExcluded flags the hosts resolving into excluded ranges instead of dropping them
+	MaxHostsPerIP       int                 // MaxHostsPerIP drops the hosts only resolving to ips hosting more hostnames (0 = unlimited)
+	FlagCrowded         bool                // FlagCrowded flags the hosts resolving to ips over MaxHostsPerIP instead of dropping them
+	FlagReserved        bool                // FlagReserved tags the hosts answering with loopback, link-local, private or other special-use addresses
+	DropReserved        bool                // DropReserved drops the hosts answering with special-use addresses
+	ReservedOutput      string              // ReservedOutput is the file the hosts answering with special-use addresses are reported to
+	MatchASN            goflags.StringSlice // MatchASN only outputs hosts resolving into one of the asns
+	FilterASN           goflags.StringSlice // FilterASN never outputs hosts resolving into one of the asns
+	ASNInfo             bool                // ASNInfo annotates the ips with their asn and org in the json output
+	ASNDatabase         string              // ASNDatabase is the offline ip to asn dataset in the iptoasn tsv format
+	GeoIPDatabase       string              // GeoIPDatabase is the MaxMind database annotating the ips with their location
+	CDN                 bool                // CDN tags the hosts served by a cdn, waf or cloud provider in the json output
+	CDNRanges           string              // CDNRanges is the file of extra provider ranges
+	Cloud               bool                // Cloud tags the hosts hosted by a cloud provider in the json output
+	HTTPSHints          bool                // HTTPSHints annotates the hosts with the alpn, ports and ech advertised by their HTTPS records in the json output
+	Rebinding           bool                // Rebinding re-resolves the hosts and flags the ones whose answers flip between public and private addresses in the json output
+	CloudOnly           bool                // CloudOnly only outputs the hosts hosted by a cloud provider
+	NonCloudOnly        bool                // NonCloudOnly never outputs the hosts hosted by a cloud provider
+	DisableUpdateCheck  bool                // DisableUpdateCheck disable automatic update check
+	UpdateResolvers     bool                // UpdateResolvers fetches and validates a fresh public resolvers list
+	ValidateResolvers   bool                // ValidateResolvers drops the dead or misbehaving resolvers before the run
+	BenchmarkResolvers  bool                // BenchmarkResolvers ranks the resolvers by success rate and latency
+	Mode                string
+	NDJSON              bool                // NDJSON specifies that the input should be parsed as NDJSON
+	RawInputFormat      string              // RawInputFormat is the format of the raw input file (massdns, massdns-simple, massdns-ndjson, dnsx, zdns, fdns)
+	Recursive           bool                // Recursive bruteforces the levels below the discovered subdomains
+	Depth               int                 // Depth is the number of levels to bruteforce recursively
+	Alterations         bool                // Alterations resolves permutations of the discovered subdomains in a second pass
+	AlterationsWordlist goflags.StringSlice // AlterationsWordlist are the wordlists used to generate alterations
+	AltPrefixes         goflags.StringSlice // AltPrefixes are prepended to the first label of the discovered subdomains in an extra pass
+	AltSuffixes         goflags.StringSlice // AltSuffixes are appended to the first label of the discovered subdomains in an extra pass
+	Patterns            bool                // Patterns resolves candidates synthesized from the naming patterns of the discovered subdomains
+	AXFR                bool                // AXFR attempts zone transfers against the name servers of the target domains
+	MailPolicy          string              // MailPolicy is the file the SPF and DMARC summaries of the target domains are written to, their hostnames being resolved
+	MailPolicyDomains   string              // MailPolicyDomains is the file the registrable third-party domains referenced by the mail policies are written to
+	ControlSocket       string              // ControlSocket is the unix socket accepting runtime control commands
+	Interactive         bool                // Interactive reads runtime control commands from the terminal
+	Verify              bool                // Verify re-resolves the results with reliable resolvers
+	DualStack           bool                // DualStack resolves the AAAA records along with the A records, tagging the hosts only resolving to ipv6 addresses
+	DNSSEC              bool                // DNSSEC validates the results with the trusted resolvers, tagging the bogus ones
+	QuarantineResolvers bool                // QuarantineResolvers drops the answers of the resolvers disagreeing with the trusted resolvers
+	ResolverStats       bool                // ResolverStats reports the answers and the error rate of every resolver in the massdns output
+	TrimResolvers       string              // TrimResolvers is the file the resolvers replying with at most TrimErrorRate errors are written to
+	TrimErrorRate       int                 // TrimErrorRate is the percentage of error replies above which the resolvers are trimmed
+	PruneNXDomain       bool                // PruneNXDomain skips the candidates below the names answered NXDOMAIN by the previous massdns runs
+	NegativeCache       string              // NegativeCache is the directory of the names answered NXDOMAIN kept across the runs, their candidates being skipped
+	NegativeCacheTTL    time.Duration       // NegativeCacheTTL is how long the names are kept in the negative cache
+	Takeover            bool                // Takeover flags the hosts whose cname is dangling or points to a takeover-prone service, or delegated to unregistered name servers
+	VerifyTypes         goflags.StringSlice // VerifyTypes are the record types accepted by the trusted verification
+	VerifyRetries       int                 // VerifyRetries is the number of retries of the trusted verification queries
+	VerifyTimeout       time.Duration       // VerifyTimeout bounds a trusted verification query
+	VerifyRateLimit     int                 // VerifyRateLimit is the max queries per second sent to each trusted resolver
+	ResolverRotation    string              // ResolverRotation is the policy choosing the trusted resolver of each native query
+	ResolverMaxInFlight int                 // ResolverMaxInFlight is the max concurrent native queries sent to each trusted resolver
+	Deadline            time.Duration       // Deadline bounds the whole enumeration, writing the results found so far when reached
+	Resume              string              // Resume is the directory storing the run state to resume an interrupted enumeration
+	Project             string              // Project is the name of the project keeping the state and the results of the runs
+	Checkpoint          string              // Checkpoint is the object storage url the run state is checkpointed to
+	CheckpointInterval  time.Duration       // CheckpointInterval is the interval between the uploads of the run state
+	DomainResolvers     string              // DomainResolvers is the yaml file assigning resolvers to target domains
+	Stream              bool                // Stream resolves hostnames read continuously from stdin in batches
+	BatchSize           int                 // BatchSize is the number of hostnames resolved per batch in stream mode
+	BatchInterval       time.Duration       // BatchInterval is the max time to wait before resolving a partial batch
+	Worker              string              // Worker is the address a worker node resolving the shares of a coordinator listens on
+	Workers             goflags.StringSlice // Workers are the worker nodes the candidates are split across
+	WorkerToken         string              // WorkerToken is the secret shared by the coordinator and the workers
+	Queue               string              // Queue is the url of the queue the enumeration jobs are pulled from
+	Schedule            string              // Schedule is the yaml file of the targets scanned on a schedule
+	Agent               string              // Agent is the websocket url of the controller the jobs are received from
+	AgentToken          string              // AgentToken is the secret sent to the controller
+	Dashboard           string              // Dashboard is the address the web dashboard of the daemon modes is served on
+	DashboardToken      string              // DashboardToken is the secret the requests to the dashboard must send
+	OTLPEndpoint        string              // OTLPEndpoint is the OpenTelemetry collector the spans of the phases are exported to
+	Pprof               string              // Pprof is the address the net/http/pprof endpoints are served on
+
+	// OnResult is called for every result written to the output
+	OnResult func(*Result)
+	// OnHostname is called for every hostname written to the output
+	OnHostname func(hostname string)
+	// OnWildcard is called once for every wildcard root detected with the wildcard ips it answered
+	OnWildcard func(root string, ips []string)
+	// OnDropped is called for every host left out of the output with the
+	// reason, never concurrently
+	OnDropped func(hostname string, reason DropReason)
+	// OnProgress is called on every phase change and every second during Run
+	OnProgress func(Progress)
+	// NewStore creates the store of the answers of every massdns run, a
+	// leveldb store in the temporary directory being used if nil
+	NewStore func() (store.Store, error)
+	// NoStdout doesn't print the results, which are only written to the output file and passed to OnHostname
+	NoStdout bool
+	// OutputWriter is written the results along with the output file
+	OutputWriter io.Writer
+	// Input is read the hostnames to resolve or verify, one per line,
+	// instead of the subdomains list or stdin
+	Input io.Reader
+	// Sinks are written the results along with the output file, and closed by Close
+	Sinks []OutputSink
+	// CustomBackend resolves the candidates instead of the built-in backends
+	CustomBackend massdns.Backend
+	// Logger logs the progress of the enumeration, gologger's default logger being used if nil
+	Logger *gologger.Logger
+	// TracerProvider traces the enumerations and their phases, a provider
+	// exporting to OTLPEndpoint or the collector of the OTEL_* variables
+	// being created if nil
+	TracerProvider trace.TracerProvider
+
+	// appendOutput appends to the output of a previous enumeration of the invocation
+	appendOutput bool
+	// progressBar draws the progress on the terminal of the command line
+	progressBar *progressBar
 }
 
+// DefaultOptions are the defaults of the command line flags, to be
+// copied by the programs embedding the runner
 var DefaultOptions = Options{
-	Threads:         10000,
-	Retries:         5,
-	WildcardThreads: 250,
+	Threads:            10000,
+	Retries:            5,
+	VerifyRetries:      5,
+	VerifyTypes:        goflags.StringSlice{"a", "cname"},
+	ResolverRotation:   dnsclient.RotationRoundRobin,
+	Backend:            massdns.BackendMassdns,
+	WildcardThreads:    250,
+	BatchSize:          1000,
+	BatchInterval:      10 * time.Second,
+	Depth:              1,
+	CheckpointInterval: time.Minute,
+	StatusInterval:     30 * time.Second,
+	TrimErrorRate:      20,
+	NegativeCacheTTL:   7 * 24 * time.Hour,
+	OutputBufferSize:   4096,
+	FlushInterval:      5 * time.Second,
+	CTEndpoint:         defaultCTEndpoint,
 }
 
 // ParseOptions parses the command line flags provided by a user
@@ -55,39 +239,151 @@ func ParseOptions() *Options {
 	flagSet.CreateGroup("input", "Input",
 		flagSet.StringSliceVarP(&options.Domains, "domain", "d", nil, "Domain to find or resolve subdomains for", goflags.FileCommaSeparatedStringSliceOptions),
 		flagSet.StringVarP(&options.SubdomainsList, "list", "l", "", "File containing list of subdomains to resolve"),
-		flagSet.StringVarP(&options.Wordlist, "wordlist", "w", "", "File containing words to bruteforce for domain"),
+		flagSet.StringSliceVarP(&options.BaseNames, "base-name", "bn", nil, "Base name to try against top level domains (tld mode)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.StringVarP(&options.TLDList, "tld-list", "tl", "", "File containing top level domains to try (tld mode)"),
+		flagSet.StringSliceVarP(&options.Wordlist, "wordlist", "w", nil, "Files containing words to bruteforce for domain (comma-separated, merged and deduplicated)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.BoolVar(&options.Chaos, "chaos", false, "Resolve the subdomains of the ProjectDiscovery Chaos dataset along with the wordlist"),
+		flagSet.StringVarP(&options.ChaosKey, "chaos-key", "ck", "", "Key of the Chaos api (default $PDCP_API_KEY or $CHAOS_KEY)"),
+		flagSet.BoolVar(&options.CT, "ct", false, "Resolve the subdomains named by the certificate transparency logs along with the wordlist, seeding the alterations"),
+		flagSet.StringVarP(&options.CTEndpoint, "ct-endpoint", "cte", defaultCTEndpoint, "Url of the certificate transparency search, {domain} being replaced by the target domain"),
+		flagSet.StringSliceVarP(&options.Import, "import", "im", nil, "Amass databases and exports or subfinder outputs and output directories whose hostnames are resolved and seed the next passes (comma-separated)", goflags.CommaSeparatedStringSliceOptions),
 		flagSet.StringVarP(&options.ResolversFile, "resolver", "r", "", "File containing list of resolvers for enumeration"),
+		flagSet.BoolVarP(&options.ValidateResolvers, "validate-resolvers", "vres", false, "Drop the dead or misbehaving resolvers before the run"),
+		flagSet.BoolVarP(&options.BenchmarkResolvers, "benchmark-resolvers", "bres", false, "Rank the resolvers by success rate and latency, writing the reliable ones to the output"),
 		flagSet.StringVarP(&options.TrustedResolvers, "trusted-resolver", "tr", "", "File containing list of trusted resolvers"),
+		flagSet.StringVarP(&options.DomainResolvers, "domain-resolvers", "dr", "", "YAML file assigning resolvers and trusted resolvers to target domains"),
+		flagSet.StringVar(&options.Proxy, "proxy", "", "Socks5 or http proxy for the wildcard and trusted dns queries over tcp (socks5://host:port, http://host:port)"),
 		flagSet.StringVarP(&options.MassdnsRaw, "raw-input", "ri", "", "Validate raw full massdns output"),
-		flagSet.StringVar(&options.Mode, "mode", "", "Execution mode (bruteforce, resolve, filter)"),
+		flagSet.StringVar(&options.Mode, "mode", "", "Execution mode (bruteforce, resolve, filter, tld, verify)"),
 		flagSet.BoolVar(&options.NDJSON, "ndjson", false, "Parse input as NDJSON"),
+		flagSet.StringVarP(&options.RawInputFormat, "raw-input-format", "rif", "", "Format of the raw input (massdns, massdns-simple, massdns-ndjson, dnsx, zdns, fdns)"),
+		flagSet.BoolVar(&options.Stream, "stream", false, "Resolve hostnames read continuously from stdin in batches"),
+		flagSet.IntVarP(&options.BatchSize, "batch-size", "bs", 1000, "Number of hostnames resolved per batch in stream mode"),
+		flagSet.DurationVarP(&options.BatchInterval, "batch-interval", "bi", 10*time.Second, "Max time to wait before resolving a partial batch in stream mode"),
+		flagSet.BoolVar(&options.Recursive, "recursive", false, "Bruteforce the levels below the discovered subdomains"),
+		flagSet.IntVar(&options.Depth, "depth", 1, "Number of levels to bruteforce recursively"),
+		flagSet.BoolVarP(&options.Alterations, "alterations", "alt", false, "Resolve permutations of the discovered subdomains in a second pass"),
+		flagSet.StringSliceVarP(&options.AlterationsWordlist, "alterations-wordlist", "aw", nil, "Files containing words used for alterations (comma-separated)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.AltPrefixes, "alt-prefixes", "apx", nil, "Words prepended to the first label of the discovered subdomains, resolved in an extra pass (comma-separated or file, e.g. -apx=dev-,stg-)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.AltSuffixes, "alt-suffixes", "asx", nil, "Words appended to the first label of the discovered subdomains, resolved in an extra pass (comma-separated or file, e.g. -asx=-dev,01)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.BoolVarP(&options.Patterns, "patterns", "pt", false, "Resolve candidates synthesized from the naming patterns of the discovered subdomains"),
+		flagSet.BoolVar(&options.AXFR, "axfr", false, "Attempt zone transfers against the name servers of the target domains"),
+		flagSet.StringVarP(&options.MailPolicy, "mail-policy", "mlp", "", "File to write the SPF and DMARC summaries of the target domains to, the hostnames they reference being resolved"),
+		flagSet.StringVarP(&options.MailPolicyDomains, "mail-policy-domains", "mlpd", "", "File to write the third-party domains referenced by the mail policies to, as targets for the next enumerations"),
 	)
 
 	flagSet.CreateGroup("rate-limit", "Rate-Limit",
 		flagSet.IntVar(&options.Threads, "t", 10000, "Number of concurrent massdns resolves"),
+		flagSet.IntVarP(&options.RateLimit, "rate-limit", "rl", 0, "Maximum number of dns queries per second across all phases (0 = unlimited)"),
+		flagSet.IntVarP(&options.VerifyRateLimit, "verify-rate-limit", "vrl", 0, "Max queries per second sent to each trusted resolver (0 = unlimited)"),
+		flagSet.StringVarP(&options.ResolverRotation, "resolver-rotation", "rrot", dnsclient.RotationRoundRobin, "Policy choosing the trusted resolver of each native query (round-robin, random, weighted)"),
+		flagSet.IntVarP(&options.ResolverMaxInFlight, "resolver-max-inflight", "rmif", 0, "Max concurrent native queries sent to each trusted resolver (0 = unlimited)"),
+	)
+
+	flagSet.CreateGroup("filter", "Filter",
+		flagSet.StringSliceVarP(&options.FilterRcodes, "filter-rcode", "frc", nil, "Only output hosts with the given response codes (noerror, or nxdomain for the cnames to missing names)", goflags.NormalizedStringSliceOptions),
+		flagSet.BoolVarP(&options.FilterCNAMEOnly, "filter-cname-only", "fco", false, "Only output hosts having a CNAME record"),
+		flagSet.IntVar(&options.MinIPs, "min-ips", 0, "Only output hosts resolving to at least this number of ips"),
+		flagSet.IntVar(&options.MinTTL, "min-ttl", 0, "Only output hosts whose lowest answer ttl is at least this number of seconds"),
+		flagSet.IntVar(&options.MaxTTL, "max-ttl", 0, "Only output hosts whose lowest answer ttl is at most this number of seconds (e.g. 60 for dynamic or load-balanced hosts)"),
+		flagSet.StringSliceVarP(&options.MatchRegex, "match-regex", "mr", nil, `Only output hostnames matching the go regex, e.g. (^|\.)sandbox\. (file or multiple flags)`, goflags.FileStringSliceOptions),
+		flagSet.StringSliceVarP(&options.FilterRegex, "filter-regex", "fr", nil, `Never output hostnames matching the go regex, e.g. (^|\.)sandbox\. (file or multiple flags)`, goflags.FileStringSliceOptions),
+		flagSet.StringVarP(&options.ScopeFile, "scope", "sc", "", "File of the hostname patterns in scope (*.example.com, app.*.example.net, !excluded.example.com), the other candidates and results being dropped"),
+		flagSet.StringVarP(&options.ScopeBurp, "scope-burp", "sb", "", "Burp Suite project options (json) or ZAP context (xml) export whose scope the candidates and results must match"),
+		flagSet.IntVar(&options.MinDepth, "min-depth", 0, "Only output hostnames with at least this number of labels below the target domain (e.g. 1 for www.example.com)"),
+		flagSet.IntVar(&options.MaxDepth, "max-depth", 0, "Only output hostnames with at most this number of labels below the target domain (0 = unlimited)"),
+		flagSet.StringSliceVarP(&options.ExcludeIPCIDRs, "exclude-ip-cidr", "eic", nil, "Drop hosts resolving into the cidrs or presets (rfc1918,loopback,bogons,special-use)", goflags.FileNormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.MatchIPCIDRs, "match-ip-cidr", "mic", nil, "Only output hosts resolving into the cidrs or presets (rfc1918,loopback,bogons,special-use)", goflags.FileNormalizedStringSliceOptions),
+		flagSet.BoolVarP(&options.FlagExcluded, "flag-excluded", "fe", false, "Flag hosts resolving into excluded cidrs instead of dropping them"),
+		flagSet.IntVarP(&options.MaxHostsPerIP, "max-hosts-per-ip", "mhpi", 0, "Drop hosts only resolving to ips hosting more hostnames, such as parked domains and wildcard farms (0 = unlimited)"),
+		flagSet.BoolVarP(&options.FlagCrowded, "flag-crowded", "fcr", false, "Flag hosts resolving to ips over max-hosts-per-ip instead of dropping them"),
+		flagSet.BoolVarP(&options.FlagReserved, "flag-reserved", "frs", false, "Tag hosts answering with loopback, link-local, private or other special-use addresses"),
+		flagSet.BoolVarP(&options.DropReserved, "drop-reserved", "drs", false, "Drop hosts answering with loopback, link-local, private or other special-use addresses"),
+		flagSet.StringVarP(&options.ReservedOutput, "reserved-output", "rso", "", "File to report the hosts answering with special-use addresses to"),
+		flagSet.StringSliceVarP(&options.MatchASN, "match-asn", "masn", nil, "Only output hosts resolving into the asns (AS13335,...)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.FilterASN, "filter-asn", "fasn", nil, "Never output hosts resolving into the asns (AS13335,...)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.BoolVarP(&options.CloudOnly, "cloud-only", "clo", false, "Only output hosts resolving into the ranges of a cloud provider"),
+		flagSet.BoolVarP(&options.NonCloudOnly, "non-cloud-only", "nclo", false, "Only output hosts not resolving into the ranges of a cloud provider"),
+		flagSet.StringVarP(&options.ASNDatabase, "asn-db", "adb", "", "Offline ip to asn dataset in the iptoasn.com tsv format (plain or .gz)"),
 	)
 
 	flagSet.CreateGroup("update", "Update",
 		flagSet.CallbackVarP(GetUpdateCallback(), "update", "up", "update shuffledns to latest version"),
 		flagSet.BoolVarP(&options.DisableUpdateCheck, "disable-update-check", "duc", false, "disable automatic shuffledns update check"),
+		flagSet.BoolVarP(&options.UpdateResolvers, "update-resolvers", "ur", false, "fetch and validate the public resolvers, writing the valid ones to the -r file (default $HOME/.config/shuffledns/resolvers.txt)"),
 	)
 
 	flagSet.CreateGroup("output", "Output",
-		flagSet.StringVarP(&options.Output, "output", "o", "", "File to write output to (optional)"),
+		flagSet.StringVarP(&options.Output, "output", "o", "", "File to write output to (optional, - for stdout)"),
 		flagSet.BoolVarP(&options.Json, "json", "j", false, "Make output format as ndjson"),
+		flagSet.BoolVarP(&options.HttpxOutput, "httpx-output", "ho", false, "Make output format as http/https urls for httpx"),
+		flagSet.BoolVarP(&options.ASNInfo, "asn-info", "ai", false, "Annotate the ips of the hosts with their asn and org in the json output (requires -asn-db)"),
+		flagSet.StringVarP(&options.GeoIPDatabase, "geoip-db", "gdb", "", "MaxMind city or country database (.mmdb) annotating the ips with their location in the json output"),
+		flagSet.BoolVar(&options.CDN, "cdn", false, "Tag the hosts served by a cdn, waf or cloud provider in the json output"),
+		flagSet.BoolVar(&options.Cloud, "cloud", false, "Tag the hosts hosted by a cloud provider (aws, azure, google...) in the json output"),
+		flagSet.BoolVarP(&options.HTTPSHints, "https-hints", "hth", false, "Annotate the hosts with the alpn, ports and ech advertised by their HTTPS records in the json output"),
+		flagSet.BoolVarP(&options.Rebinding, "rebinding", "rbd", false, "Re-resolve the hosts and flag the ones whose answers flip between public and private addresses in the json output"),
+		flagSet.StringVarP(&options.CDNRanges, "cdn-ranges", "cr", "", "File of extra provider ranges taking precedence over the bundled ones (provider cidr per line)"),
+		flagSet.BoolVarP(&options.Takeover, "takeover", "to", false, "Flag hosts whose cname is dangling or points to a takeover-prone service, or delegated to unregistered name servers"),
 		flagSet.StringVarP(&options.WildcardOutputFile, "wildcard-output", "wo", "", "Dump wildcard ips to output file"),
+		flagSet.StringVarP(&options.CNAMEReport, "cname-report", "cnr", "", "File to report the third-party apex domains the cnames of the hosts point to, with their hosts"),
+		flagSet.StringVarP(&options.LabelReport, "label-report", "lr", "", "File to write the most common label tokens and patterns of the discovered hostnames to, by domain"),
+		flagSet.StringVarP(&options.Webhook, "webhook", "wh", "", "Url to post the results to as json arrays"),
+		flagSet.IntVarP(&options.OutputBufferSize, "output-buffer", "ob", 4096, "Size in bytes of the buffer of the output file"),
+		flagSet.DurationVarP(&options.FlushInterval, "flush-interval", "fi", 5*time.Second, "Interval between the flushes of the output while writing the results (0 to flush at the end only)"),
 	)
 
 	flagSet.CreateGroup("configs", "Configurations",
+		flagSet.StringVar(&options.Config, "config", "", "Path to the shuffledns configuration file (default $HOME/.config/shuffledns/config.yaml)"),
 		flagSet.StringVarP(&options.MassdnsPath, "massdns", "m", "", "Path to the massdns binary"),
+		flagSet.StringVarP(&options.Backend, "backend", "be", massdns.BackendMassdns, "Backend resolving the candidates (massdns, native, zdns)"),
 		flagSet.StringVarP(&options.MassDnsCmd, "massdns-cmd", "mcmd", "", "Optional massdns commands to run (example '-i 10')"),
 		flagSet.StringVar(&options.Directory, "directory", "", "Temporary directory for enumeration"),
+		flagSet.StringVar(&options.Resume, "resume", "", "Directory storing the run state to resume an interrupted enumeration"),
+		flagSet.StringVarP(&options.Checkpoint, "checkpoint", "cp", "", "Object storage the run state is checkpointed to and resumed from (s3://bucket/prefix, gs://bucket/prefix)"),
+		flagSet.DurationVarP(&options.CheckpointInterval, "checkpoint-interval", "cpi", time.Minute, "Interval between the checkpoints of the run state"),
+		flagSet.StringVarP(&options.Project, "project", "pj", "", "Project keeping the run state, wildcards, results and changes of the runs (in $HOME/.config/shuffledns/projects)"),
+		flagSet.StringVar(&options.Profile, "profile", "", "Named profile from the config file to apply (built-in: stealth, fast-vps, thorough)"),
+		flagSet.StringVarP(&options.ControlSocket, "control-socket", "cs", "", "Unix socket accepting the pause, resume, stats and skip commands"),
+		flagSet.BoolVarP(&options.Interactive, "interactive", "i", false, "Read the pause, resume, stats and skip commands from the terminal"),
 	)
 
 	flagSet.CreateGroup("optimizations", "Optimizations",
 		flagSet.IntVar(&options.Retries, "retries", 5, "Number of retries for dns enumeration"),
+		flagSet.BoolVarP(&options.RetryTimeouts, "retry-timeouts", "rto", false, "Retry the names which got no reply at all with the trusted resolvers at a conservative rate"),
 		flagSet.BoolVarP(&options.StrictWildcard, "strict-wildcard", "sw", false, "Perform wildcard check on all found subdomains"),
 		flagSet.IntVar(&options.WildcardThreads, "wt", 250, "Number of concurrent wildcard checks"),
+		flagSet.BoolVarP(&options.AutoThreads, "auto-threads", "at", false, "Derive the massdns and wildcard threads from the number of resolvers and the open files limit (-t and -wt override)"),
+		flagSet.BoolVarP(&options.AdaptiveThreads, "adaptive-threads", "adt", false, "Resolve in chunks, halving the massdns threads when the servfail and timeout rate of a chunk spikes and ramping them back up"),
+		flagSet.BoolVar(&options.Verify, "verify", false, "Re-resolve the results with reliable resolvers to drop false positives (the trusted resolvers, or built-in ones)"),
+		flagSet.BoolVarP(&options.DualStack, "dual-stack", "ds", false, "Resolve the AAAA records along with the A records, tagging the hosts only resolving to ipv6 addresses"),
+		flagSet.BoolVar(&options.DNSSEC, "dnssec", false, "Validate the dnssec of the results with the trusted resolvers, tagging the bogus ones"),
+		flagSet.BoolVarP(&options.QuarantineResolvers, "quarantine-resolvers", "qres", false, "Quarantine the resolvers whose answers disagree with the trusted resolvers, dropping their results"),
+		flagSet.BoolVarP(&options.ResolverStats, "resolver-stats", "rst", false, "Report the answers and the error rate of every resolver in the massdns output at the end of the run"),
+		flagSet.StringVarP(&options.TrimResolvers, "trim-resolvers", "trr", "", "Write the resolvers which replied with at most -trim-error-rate errors to the file at the end of the run"),
+		flagSet.IntVarP(&options.TrimErrorRate, "trim-error-rate", "ter", 20, "Percentage of error replies (servfail, refused...) above which the resolvers are trimmed"),
+		flagSet.BoolVarP(&options.PruneNXDomain, "prune-nxdomain", "pnx", false, "Skip the candidates below the names answered NXDOMAIN by the previous chunks and passes"),
+		flagSet.StringVarP(&options.NegativeCache, "negative-cache", "ngc", "", "Directory keeping the names answered NXDOMAIN across the runs, the candidates at or below them being skipped"),
+		flagSet.DurationVarP(&options.NegativeCacheTTL, "negative-cache-ttl", "ngt", 7*24*time.Hour, "Time the names are kept in the negative cache"),
+		flagSet.StringSliceVarP(&options.VerifyTypes, "verify-types", "vty", []string{"a", "cname"}, "Record types accepted by the trusted verification (a,aaaa,cname)", goflags.NormalizedStringSliceOptions),
+		flagSet.IntVarP(&options.VerifyRetries, "verify-retries", "vr", 5, "Number of retries of the trusted verification queries"),
+		flagSet.DurationVarP(&options.VerifyTimeout, "verify-timeout", "vt", 0, "Timeout of a trusted verification query (default 5s)"),
+		flagSet.DurationVar(&options.Deadline, "deadline", 0, "Maximum duration of the whole enumeration, the results found so far are written when reached (e.g. 2h)"),
+	)
+
+	flagSet.CreateGroup("distributed", "Distributed",
+		flagSet.StringVar(&options.Worker, "worker", "", "Run as a worker node resolving the shares of a coordinator, listening on the address (e.g. :8053)"),
+		flagSet.StringSliceVar(&options.Workers, "workers", nil, "Worker nodes to split the candidates and resolvers across (host:port, comma-separated)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.StringVarP(&options.WorkerToken, "worker-token", "wtk", "", "Secret shared by the coordinator and the workers (required by -worker)"),
+	)
+
+	flagSet.CreateGroup("daemon", "Daemon",
+		flagSet.StringVarP(&options.Schedule, "schedule", "sch", "", "Run as a daemon scanning the targets of the yaml file on their schedule, writing the new and removed hosts"),
+		flagSet.StringVarP(&options.Queue, "queue", "q", "", "Run the enumeration jobs pulled from the queue, pushing back their results (redis://host:6379/0?jobs=key&results=key)"),
+		flagSet.StringVar(&options.Agent, "agent", "", "Run the jobs received from the controller websocket, streaming back their progress and results (ws://host/path or wss://)"),
+		flagSet.StringVarP(&options.AgentToken, "agent-token", "atk", "", "Secret sent to the controller as a bearer token"),
+		flagSet.StringVar(&options.Dashboard, "dashboard", "", "Serve a web dashboard of the jobs, their progress and results on the address (-schedule, -queue, -agent)"),
+		flagSet.StringVarP(&options.DashboardToken, "dashboard-token", "dtk", "", "Secret required by the dashboard as a bearer token or basic auth password (required off loopback)"),
 	)
 
 	flagSet.CreateGroup("debug", "Debug",
@@ -95,15 +391,68 @@ func ParseOptions() *Options {
 		flagSet.BoolVar(&options.Version, "version", false, "Show version of shuffledns"),
 		flagSet.BoolVar(&options.Verbose, "v", false, "Show Verbose output"),
 		flagSet.BoolVarP(&options.NoColor, "no-color", "nc", false, "Don't Use colors in output"),
+		flagSet.BoolVarP(&options.LogJSON, "log-json", "lj", false, "Write log messages as json lines"),
+		flagSet.BoolVarP(&options.NoProgress, "no-progress", "np", false, "Don't show the progress bar on the terminal"),
+		flagSet.DurationVarP(&options.StatusInterval, "status-interval", "si", 30*time.Second, "Interval between the status lines logged when stderr is not a terminal (0 to disable)"),
+		flagSet.StringVar(&options.Pprof, "pprof", "", "Serve the net/http/pprof endpoints on the address during the run, a bare :port being bound to 127.0.0.1 (e.g. :6060)"),
+		flagSet.StringVarP(&options.OTLPEndpoint, "otlp-endpoint", "otlp", "", "OpenTelemetry collector to export the spans of the phases to over otlp/http (e.g. http://localhost:4318)"),
 	)
 
+	// The config file is merged by Parse into the flags left to their
+	// defaults, command line flags taking precedence over it
+	configFile, err := configFilePath(os.Args[1:])
+	if err != nil {
+		gologger.Fatal().Msgf("Could not read config file: %s\n", err)
+	}
+	flagSet.SetConfigFilePath(configFile)
 	_ = flagSet.Parse()
 
+	// Parse ignores the errors of the config file, merging it again reports them
+	if options.Config != "" {
+		if err := flagSet.MergeConfigFile(options.Config); err != nil {
+			gologger.Fatal().Msgf("Could not read config file %s: %s\n", options.Config, err)
+		}
+	}
+
+	if options.Profile != "" {
+		if err := applyProfile(flagSet, options.Profile, configFile); err != nil {
+			gologger.Fatal().Msgf("Could not apply profile: %s\n", err)
+		}
+	}
+
+	if options.AutoThreads {
+		if err := resetAutoThreads(flagSet, options, configFile); err != nil {
+			gologger.Fatal().Msgf("Could not auto-tune threads: %s\n", err)
+		}
+	}
+
 	// Read the inputs and configure the logging
 	options.configureOutput()
 
+	// Draw the progress below the log lines when shown on a terminal
+	if !options.NoProgress && !options.Silent && !options.LogJSON && isTerminal(os.Stderr) {
+		options.progressBar = newProgressBar(os.Stderr)
+		gologger.DefaultLogger.SetWriter(options.progressBar.writer(writer.NewCLI()))
+	}
+
+	// Profile the memory and cpu of the whole invocation
+	if options.Pprof != "" {
+		if _, err := servePprof(options.Pprof, options.logger()); err != nil {
+			gologger.Fatal().Msgf("Could not serve pprof: %s\n", err)
+		}
+	}
+
+	// Fall back to the keys of the other ProjectDiscovery tools
+	if options.ChaosKey == "" {
+		if options.ChaosKey = os.Getenv("PDCP_API_KEY"); options.ChaosKey == "" {
+			options.ChaosKey = os.Getenv("CHAOS_KEY")
+		}
+	}
+
 	// Show the user the banner
-	showBanner()
+	if !options.LogJSON {
+		showBanner()
+	}
 
 	if options.Version {
 		gologger.Info().Msgf("Current Version: %s\n", version)
@@ -121,12 +470,115 @@ func ParseOptions() *Options {
 		}
 	}
 
+	if options.UpdateResolvers {
+		if err := updateResolvers(options); err != nil {
+			gologger.Fatal().Msgf("Could not update resolvers: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
+	// Fall back to the resolvers written by -update-resolvers
+	if options.ResolversFile == "" && fileutil.FileExists(defaultResolversLocation) {
+		options.ResolversFile = defaultResolversLocation
+		gologger.Info().Msgf("Using the resolvers of %s\n", defaultResolversLocation)
+	}
+
+	if options.BenchmarkResolvers {
+		if options.ResolversFile == "" {
+			gologger.Fatal().Msgf("Program exiting: no resolvers file to benchmark specified\n")
+		}
+		if err := benchmarkResolvers(options); err != nil {
+			gologger.Fatal().Msgf("Could not benchmark resolvers: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
+	if options.Worker != "" {
+		if err := serveWorker(options); err != nil {
+			gologger.Fatal().Msgf("Could not run worker: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
+	if options.Schedule != "" {
+		if err := serveSchedule(options); err != nil {
+			gologger.Fatal().Msgf("Could not run schedule: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
+	if options.Queue != "" {
+		if err := serveQueue(options); err != nil {
+			gologger.Fatal().Msgf("Could not run jobs: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
+	if options.Agent != "" {
+		if err := serveAgent(options); err != nil {
+			gologger.Fatal().Msgf("Could not run agent: %s\n", err)
+		}
+		os.Exit(0)
+	}
+
 	// Validate the options passed by the user and if any
 	// invalid options have been used, exit.
-	err := options.validateOptions()
-	if err != nil {
+	if err := options.Validate(); err != nil {
 		gologger.Fatal().Msgf("Program exiting: %s\n", err)
 	}
 
 	return options
 }
+
+// logger returns the logger of the enumeration
+func (options *Options) logger() *gologger.Logger {
+	if options.Logger != nil {
+		return options.Logger
+	}
+	return gologger.DefaultLogger
+}
+
+// hasInput returns true if the hostnames to resolve or verify are given
+func (options *Options) hasInput() bool {
+	return options.SubdomainsList != "" || options.Input != nil || fileutil.HasStdin()
+}
+
+// hasAffixes returns true if the discovered hostnames are resolved with
+// alteration prefixes or suffixes
+func (options *Options) hasAffixes() bool {
+	return len(options.AltPrefixes) > 0 || len(options.AltSuffixes) > 0
+}
+
+// usesMassdns returns true if the candidates are resolved with massdns
+func (options *Options) usesMassdns() bool {
+	return options.CustomBackend == nil && len(options.Workers) == 0 && (options.Backend == "" || options.Backend == massdns.BackendMassdns)
+}
+
+// configFilePath returns the config file given with -config in the
+// arguments, or the default one. It must be known before the flags are
+// parsed, since the default one would be merged first otherwise.
+func configFilePath(args []string) (string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", errors.New("no config file given to -config")
+			}
+			value = args[i+1]
+		}
+		if !fileutil.FileExists(value) {
+			return "", fmt.Errorf("%s does not exist", value)
+		}
+		return value, nil
+	}
+	return defaultConfigLocation, nil
+}
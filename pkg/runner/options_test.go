@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projectdiscovery/goflags"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFilePath(t *testing.T) {
+	dir := t.TempDir()
+	defaultConfig := filepath.Join(dir, "default.yaml")
+	require.Nil(t, os.WriteFile(defaultConfig, []byte("retries: 3\n"), 0644), "Could not write config")
+	config := filepath.Join(dir, "config.yaml")
+	require.Nil(t, os.WriteFile(config, []byte("retries: 7\n"), 0644), "Could not write config")
+
+	defer func(location string) { defaultConfigLocation = location }(defaultConfigLocation)
+	defaultConfigLocation = defaultConfig
+
+	// Parse merges the config file into the flags left to their defaults
+	parse := func(args ...string) *Options {
+		options := &Options{}
+		flagSet := goflags.NewFlagSet()
+		flagSet.StringVar(&options.Config, "config", "", "")
+		flagSet.IntVar(&options.Retries, "retries", 5, "")
+		path, err := configFilePath(args)
+		require.Nil(t, err, "Could not get config file")
+		require.Nil(t, flagSet.CommandLine.Parse(args), "Could not parse flags")
+		require.Nil(t, flagSet.MergeConfigFile(path), "Could not merge config file")
+		return options
+	}
+	require.Equal(t, 3, parse().Retries, "Default config file was not merged")
+	require.Equal(t, 7, parse("-config", config).Retries, "Default config file took precedence over -config")
+	require.Equal(t, 7, parse("--config="+config).Retries, "Default config file took precedence over -config")
+	require.Equal(t, 9, parse("-config", config, "-retries", "9").Retries, "Config file took precedence over the command line")
+
+	_, err := configFilePath([]string{"-config", filepath.Join(dir, "missing.yaml")})
+	require.NotNil(t, err, "Accepted missing config file")
+}
+
+func TestApplyProfile(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(config, []byte(`t: 700
+profiles:
+  custom:
+    t: 100
+    wt: 50
+    retries: 10
+    strict-wildcard: true
+`), 0644)
+	require.Nil(t, err, "Could not write config")
+
+	options := &Options{}
+	flagSet := goflags.NewFlagSet()
+	flagSet.IntVar(&options.Threads, "t", 10000, "Number of concurrent massdns resolves")
+	// Flags sharing their usage are not aliases
+	flagSet.IntVar(&options.WildcardThreads, "wt", 250, "Number of concurrent massdns resolves")
+	flagSet.IntVar(&options.Retries, "retries", 5, "Number of retries for dns enumeration")
+	flagSet.BoolVarP(&options.StrictWildcard, "strict-wildcard", "sw", false, "Perform wildcard check on all found subdomains")
+	require.Nil(t, flagSet.CommandLine.Parse([]string{"-sw=false"}), "Could not parse flags")
+	require.Nil(t, flagSet.MergeConfigFile(config), "Could not merge config file")
+
+	// The command line takes precedence over the config file, which takes precedence over the profile
+	require.Nil(t, applyProfile(flagSet, "custom", config), "Could not apply profile")
+	require.False(t, options.StrictWildcard, "Profile took precedence over the short flag")
+	require.Equal(t, 700, options.Threads, "Profile took precedence over the config file")
+	require.Equal(t, 10, options.Retries, "Profile was not applied")
+	require.Equal(t, 50, options.WildcardThreads, "Profile was not applied to a flag sharing the usage of a preset one")
+}
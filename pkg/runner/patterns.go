@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/patterns"
+)
+
+// runPatterns infers the naming patterns of the hostnames discovered so far
+// and resolves the candidates synthesized from them, reusing the wildcard
+// state of the client.
+func (r *Runner) runPatterns(instance *massdns.Instance) {
+	r.discoveredMutex.Lock()
+	discovered := make([]string, len(r.discovered))
+	copy(discovered, r.discovered)
+	r.discoveredMutex.Unlock()
+
+	if len(discovered) == 0 {
+		r.logger.Info().Msgf("No hostnames discovered, skipping patterns\n")
+		return
+	}
+
+	file, err := os.CreateTemp(r.tempDir, "patterns-")
+	if err != nil {
+		r.logError("Could not create patterns list (%s): %s\n", r.tempDir, err)
+		return
+	}
+	writer := r.newCandidateWriter(file)
+
+	r.phases.Set(massdns.PhaseGenerate)
+	r.logger.Info().Msgf("Started inferring patterns of %d hostnames\n", len(discovered))
+
+	now := time.Now()
+	synthesizer := patterns.New()
+	for _, hostname := range discovered {
+		if domain := matchDomain(hostname, r.options.Domains); domain != "" {
+			synthesizer.Add(hostname, domain)
+		}
+	}
+
+	synthesizer.Generate(func(candidate string) {
+		writer.Write(candidate)
+	})
+	writer.Flush()
+	file.Close()
+
+	r.logger.Info().Msgf("Synthesizing %d candidates took %s at %s\n", writer.written, time.Since(now), file.Name())
+	if writer.written == 0 {
+		return
+	}
+
+	if err := instance.RunBatch(r.ctx, file.Name()); err != nil {
+		r.logError("Could not run massdns on patterns: %s\n", err)
+	}
+}
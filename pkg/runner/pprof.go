@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+// servePprof serves the net/http/pprof endpoints on the address in the
+// background, returning the address listened on. The command line of the
+// run is left out, as it may hold the tokens of the flags.
+func servePprof(address string, logger *gologger.Logger) (net.Addr, error) {
+	listener, err := net.Listen("tcp", localAddress(address))
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error().Msgf("Could not serve pprof: %s\n", err)
+		}
+	}()
+
+	logger.Info().Msgf("Serving pprof on http://%s/debug/pprof/\n", listener.Addr())
+	return listener.Addr(), nil
+}
+
+// localAddress binds the address without host, such as :6060, to the
+// loopback interface instead of every interface
+func localAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != "" {
+		return address
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
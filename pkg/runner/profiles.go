@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/projectdiscovery/goflags"
+	fileutil "github.com/projectdiscovery/utils/file"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a named set of flag values
+type Profile map[string]interface{}
+
+// builtinProfiles are the profiles available without defining them
+// in the config file. A profile with the same name in the config
+// file takes precedence over the built-in one.
+var builtinProfiles = map[string]Profile{
+	"stealth": {
+		"t":          500,
+		"retries":    10,
+		"wt":         25,
+		"rate-limit": 200,
+	},
+	"fast-vps": {
+		"t":       20000,
+		"retries": 3,
+		"wt":      500,
+	},
+	"thorough": {
+		"t":                  5000,
+		"retries":            10,
+		"wt":                 250,
+		"rate-limit":         2000,
+		"strict-wildcard":    true,
+		"verify":             true,
+		"validate-resolvers": true,
+	},
+}
+
+// profilesConfig is the part of the config file holding the profiles
+type profilesConfig struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// loadProfiles returns the built-in profiles merged with the ones
+// defined in the config file.
+func loadProfiles(configFile string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(builtinProfiles))
+	for name, profile := range builtinProfiles {
+		profiles[name] = profile
+	}
+	if !fileutil.FileExists(configFile) {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var config profilesConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for name, profile := range config.Profiles {
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// applyProfile sets the flag values of the named profile. Flags given
+// on the command line or in the config file, by their long or short
+// name, always take precedence over the profile ones.
+func applyProfile(flagSet *goflags.FlagSet, name, configFile string) error {
+	profiles, err := loadProfiles(configFile)
+	if err != nil {
+		return fmt.Errorf("could not read profiles: %w", err)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+
+	preset, err := presetFlags(flagSet, configFile)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	for key, value := range profile {
+		fl := flagSet.CommandLine.Lookup(key)
+		if fl == nil {
+			return fmt.Errorf("unknown flag %s in profile %s", key, name)
+		}
+		if _, ok := preset[key]; ok {
+			continue
+		}
+		if err := setFlagValue(fl, value); err != nil {
+			return fmt.Errorf("invalid value for %s in profile %s: %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// presetFlags returns the names of the flags given on the command line or
+// in the config file, along with their aliases
+func presetFlags(flagSet *goflags.FlagSet, configFile string) (map[string]struct{}, error) {
+	// goflags registers the short and long names of a flag with the same value
+	aliases := make(map[flag.Value][]string)
+	flagSet.CommandLine.VisitAll(func(fl *flag.Flag) {
+		aliases[fl.Value] = append(aliases[fl.Value], fl.Name)
+	})
+	preset := make(map[string]struct{})
+	markPreset := func(fl *flag.Flag) {
+		for _, name := range aliases[fl.Value] {
+			preset[name] = struct{}{}
+		}
+	}
+
+	flagSet.CommandLine.Visit(markPreset)
+	if fileutil.FileExists(configFile) {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		var config map[string]interface{}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
+		for key := range config {
+			if fl := flagSet.CommandLine.Lookup(key); fl != nil {
+				markPreset(fl)
+			}
+		}
+	}
+	return preset, nil
+}
+
+// setFlagValue sets a flag from a value decoded from yaml
+func setFlagValue(fl *flag.Flag, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := fl.Value.Set(fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return errors.New("empty value")
+	default:
+		return fl.Value.Set(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// progressInterval is the interval between the progress events of a phase
+const progressInterval = time.Second
+
+// Progress is a snapshot of the progress of the enumeration, passed to OnProgress
+type Progress struct {
+	// Phase is the pipeline phase being executed
+	Phase massdns.Phase
+	// Candidates is the number of candidates generated
+	Candidates int64
+	// Queries is the number of dns queries let through the rate limiter
+	Queries uint64
+	// Parsed is the number of hosts parsed from the massdns output
+	Parsed int64
+	// WildcardChecks is the number of hostnames checked for wildcards
+	WildcardChecks int64
+	// WildcardDrops is the number of hostnames dropped as wildcards
+	WildcardDrops int64
+	// Found is the number of hostnames written to the output
+	Found int
+	// Paused is set while the queries are paused
+	Paused bool
+	// Elapsed is the time since the enumeration started
+	Elapsed time.Duration
+}
+
+// progress returns a snapshot of the progress of the enumeration
+func (r *Runner) progress() Progress {
+	r.discoveredMutex.Lock()
+	found := len(r.discovered)
+	r.discoveredMutex.Unlock()
+
+	return Progress{
+		Phase:          r.phases.Current(),
+		Candidates:     r.candidates.Load(),
+		Queries:        r.limiter.Taken(),
+		Parsed:         r.counters.HostsParsed(),
+		WildcardChecks: r.counters.WildcardChecks(),
+		WildcardDrops:  r.counters.WildcardDrops(),
+		Found:          found,
+		Paused:         r.limiter.Paused(),
+		Elapsed:        time.Since(r.start),
+	}
+}
+
+// reportProgress calls OnProgress on every phase change and every
+// progress interval until the returned function is called, which
+// reports the final progress.
+func (r *Runner) reportProgress() (stop func()) {
+	var mutex sync.Mutex
+	report := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		r.options.OnProgress(r.progress())
+	}
+
+	stopWatching := r.phases.Watch(func(massdns.Phase) { report() })
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		stopWatching()
+		close(done)
+		wg.Wait()
+		report()
+	}
+}
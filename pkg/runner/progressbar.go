@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/gologger/writer"
+)
+
+// progressBarWidth is the number of cells of the bar
+const progressBarWidth = 20
+
+// progressBar draws the progress of the resolution and wildcard phases on
+// the last line of the terminal, the log lines being written above it
+type progressBar struct {
+	mutex  sync.Mutex
+	output io.Writer
+	// line is the line drawn, empty when cleared
+	line string
+
+	// The queries of the previous update, for the queries per second
+	queries uint64
+	updated time.Time
+	qps     float64
+}
+
+// newProgressBar creates a progress bar drawn on the output
+func newProgressBar(output io.Writer) *progressBar {
+	return &progressBar{output: output}
+}
+
+// isTerminal tells whether the file is a terminal rather than a pipe or
+// a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update draws the progress, the bar being cleared out of the resolution
+// and wildcard phases
+func (b *progressBar) update(progress Progress) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// The queries per second are smoothed over the updates
+	now := time.Now()
+	if !b.updated.IsZero() && progress.Queries >= b.queries {
+		if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+			current := float64(progress.Queries-b.queries) / elapsed
+			if b.qps == 0 {
+				b.qps = current
+			} else {
+				b.qps = b.qps*0.7 + current*0.3
+			}
+		}
+	}
+	b.queries, b.updated = progress.Queries, now
+
+	b.draw(b.render(progress))
+}
+
+// render returns the line of the progress
+func (b *progressBar) render(progress Progress) string {
+	var line string
+	switch progress.Phase {
+	case massdns.PhaseMassdns, massdns.PhaseVerify:
+		done, total := int64(progress.Queries), progress.Candidates
+		if done > total {
+			done = total
+		}
+		var ratio float64
+		if total > 0 {
+			ratio = float64(done) / float64(total)
+		}
+		cells := int(ratio * progressBarWidth)
+		eta := "-"
+		if b.qps > 0 && total > done {
+			eta = (time.Duration(float64(total-done)/b.qps) * time.Second).Round(time.Second).String()
+		}
+		line = fmt.Sprintf("%-9s [%s%s] %3.0f%% %s/%s | %s qps | ETA %s", progress.Phase,
+			strings.Repeat("#", cells), strings.Repeat("-", progressBarWidth-cells), ratio*100,
+			formatCount(done), formatCount(total), formatCount(int64(b.qps)), eta)
+	case massdns.PhaseWildcard:
+		line = fmt.Sprintf("%-9s %s checked | %s dropped | %s qps", progress.Phase,
+			formatCount(progress.WildcardChecks), formatCount(progress.WildcardDrops), formatCount(int64(b.qps)))
+	default:
+		return ""
+	}
+	if progress.Paused {
+		line += " | paused"
+	}
+	return line
+}
+
+// draw replaces the line drawn with the line, the mutex being held
+func (b *progressBar) draw(line string) {
+	if line == b.line {
+		return
+	}
+	if line == "" {
+		fmt.Fprint(b.output, "\r\033[K")
+	} else {
+		fmt.Fprintf(b.output, "\r\033[K%s", line)
+	}
+	b.line = line
+}
+
+// clear removes the bar from the terminal
+func (b *progressBar) clear() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.draw("")
+}
+
+// writer returns the log writer clearing the bar before the log lines
+// of next, and drawing it again below them
+func (b *progressBar) writer(next writer.Writer) writer.Writer {
+	return &progressWriter{bar: b, next: next}
+}
+
+// progressWriter is a log writer keeping the progress bar below the logs
+type progressWriter struct {
+	bar  *progressBar
+	next writer.Writer
+}
+
+// Write writes the log line above the progress bar
+func (w *progressWriter) Write(data []byte, level levels.Level) {
+	w.bar.mutex.Lock()
+	defer w.bar.mutex.Unlock()
+
+	line := w.bar.line
+	w.bar.draw("")
+	w.next.Write(data, level)
+	w.bar.draw(line)
+}
+
+// showProgressBar draws the progress of the run until the returned
+// function is called, which removes the bar
+func (r *Runner) showProgressBar() (stop func()) {
+	bar := r.options.progressBar
+	onProgress := r.options.OnProgress
+	r.options.OnProgress = func(progress Progress) {
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		bar.update(progress)
+	}
+	return func() {
+		r.options.OnProgress = onProgress
+		bar.clear()
+	}
+}
+
+// formatCount formats the count with a k or M suffix once large
+func formatCount(count int64) string {
+	switch {
+	case count >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(count)/1_000_000)
+	case count >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(count)/1_000)
+	default:
+		return fmt.Sprint(count)
+	}
+}
@@ -0,0 +1,187 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	fileutil "github.com/projectdiscovery/utils/file"
+	folderutil "github.com/projectdiscovery/utils/folder"
+)
+
+// defaultProjectsLocation is the directory of the projects named by -project
+var defaultProjectsLocation = filepath.Join(folderutil.AppConfigDirOrDefault(".", "shuffledns"), "projects")
+
+// The project directory keeps the state of the runs of an engagement:
+//
+//	run/                 the run state resuming an interrupted enumeration
+//	wildcards.txt        the wildcard ips found by the previous runs
+//	results.json         the hosts found by the last complete run
+//	changes/<time>.json  the hosts new and removed by a run
+//	schedule/            the results of the scheduled targets
+const (
+	projectRunDirName       = "run"
+	projectWildcardsName    = "wildcards.txt"
+	projectResultsName      = "results.json"
+	projectChangesDirName   = "changes"
+	projectScheduleDirName  = "schedule"
+	projectChangesTimestamp = "20060102-150405"
+)
+
+// validName returns true if the name of a project or target can be used
+// as a file name
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// projectDir returns the directory of the project, empty if none
+func (options *Options) projectDir() string {
+	if options.Project == "" {
+		return ""
+	}
+	return filepath.Join(defaultProjectsLocation, options.Project)
+}
+
+// openProject creates the project directory and restores the wildcard
+// ips found by its previous runs
+func (r *Runner) openProject() error {
+	if !validName(r.options.Project) {
+		return fmt.Errorf("invalid project name %q", r.options.Project)
+	}
+	dir := r.options.projectDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create project directory: %w", err)
+	}
+	wildcardsFile := filepath.Join(dir, projectWildcardsName)
+	if fileutil.FileExists(wildcardsFile) {
+		if err := r.shared.wildcardStore.LoadFromFile(wildcardsFile); err != nil {
+			return fmt.Errorf("could not load project wildcards: %w", err)
+		}
+	}
+	r.project = dir
+	r.logger.Info().Msgf("Using project %s in %s\n", r.options.Project, dir)
+	return nil
+}
+
+// resumeDir returns the directory of the run state, the one of the
+// project or of the checkpoint if -resume is not given, empty if the run
+// is not resumable
+func (r *Runner) resumeDir() string {
+	switch {
+	case r.options.Resume != "":
+		return r.options.Resume
+	case r.options.Mode == string(Verify) || r.options.Stream:
+		return ""
+	case r.project != "":
+		return filepath.Join(r.project, projectRunDirName)
+	case r.checkpoint != nil:
+		return r.checkpoint.dir
+	}
+	return ""
+}
+
+// trackProject collects the hosts found by the run until the returned
+// function is called with the error of the run, which records them in
+// the project along with the changes since its previous run
+func (r *Runner) trackProject() (stop func(err error)) {
+	var (
+		mutex   sync.Mutex
+		current = make(map[string]*Result)
+	)
+	// The hostnames of the chunks replayed by a resumed run have no result
+	onHostname, onResult := r.options.OnHostname, r.options.OnResult
+	r.options.OnHostname = func(hostname string) {
+		mutex.Lock()
+		if _, ok := current[hostname]; !ok {
+			current[hostname] = &Result{Hostname: hostname}
+		}
+		mutex.Unlock()
+		if onHostname != nil {
+			onHostname(hostname)
+		}
+	}
+	r.options.OnResult = func(result *Result) {
+		mutex.Lock()
+		current[result.Hostname] = result
+		mutex.Unlock()
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+
+	return func(err error) {
+		r.options.OnHostname, r.options.OnResult = onHostname, onResult
+
+		if !r.shared.wildcardStore.IsEmpty() {
+			if err := r.saveProjectWildcards(); err != nil {
+				r.logError("Could not save project wildcards: %s\n", err)
+			}
+		}
+		if err != nil || context.Cause(r.ctx) != nil {
+			r.logger.Info().Msgf("Run is partial, keeping the previous results of project %s\n", r.options.Project)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err := r.saveProjectResults(current); err != nil {
+			r.logError("Could not save project results: %s\n", err)
+		}
+	}
+}
+
+// saveProjectWildcards snapshots the wildcard ips found so far
+func (r *Runner) saveProjectWildcards() error {
+	wildcardsFile := filepath.Join(r.project, projectWildcardsName)
+	if err := r.shared.wildcardStore.SaveToFile(wildcardsFile + ".tmp"); err != nil {
+		return err
+	}
+	return os.Rename(wildcardsFile+".tmp", wildcardsFile)
+}
+
+// saveProjectResults writes the changes since the previous run of the
+// project and replaces its results. The run state of the project is
+// cleared, the run being complete.
+func (r *Runner) saveProjectResults(current map[string]*Result) error {
+	resultsFile := filepath.Join(r.project, projectResultsName)
+	previous, err := loadTargetState(resultsFile)
+	if err != nil {
+		return err
+	}
+
+	if previous == nil {
+		r.logger.Info().Msgf("Recorded %d hosts in project %s\n", len(current), r.options.Project)
+	} else {
+		changes := diffResults(previous, current)
+		var added int
+		for _, change := range changes {
+			if change.Change == ChangeNew {
+				added++
+			}
+		}
+		r.logger.Info().Msgf("Project %s: %d new and %d removed hosts since the previous run\n", r.options.Project, added, len(changes)-added)
+
+		if len(changes) > 0 {
+			changesDir := filepath.Join(r.project, projectChangesDirName)
+			if err := os.MkdirAll(changesDir, 0755); err != nil {
+				return fmt.Errorf("could not create changes directory: %w", err)
+			}
+			changesFile := filepath.Join(changesDir, r.start.Format(projectChangesTimestamp)+".json")
+			if err := saveResults(changesFile, changes); err != nil {
+				return err
+			}
+		}
+	}
+	if err := saveTargetState(resultsFile, current); err != nil {
+		return err
+	}
+
+	if r.options.Resume == "" {
+		if err := os.RemoveAll(filepath.Join(r.project, projectRunDirName)); err != nil {
+			return fmt.Errorf("could not clear run state: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/queue"
+)
+
+// queueRetryInterval is the time waited before pulling again from a failing queue
+const queueRetryInterval = 5 * time.Second
+
+// Job is an enumeration pulled from the queue by -queue
+type Job struct {
+	// ID identifies the result of the job
+	ID string `json:"id"`
+	// Mode is the execution mode of the enumeration
+	Mode string `json:"mode"`
+	// Domains are the domains to find or resolve subdomains for
+	Domains []string `json:"domains,omitempty"`
+	// Wordlist are the wordlist files of the worker to bruteforce with
+	Wordlist []string `json:"wordlist,omitempty"`
+	// Hostnames are the hostnames to resolve or verify
+	Hostnames []string `json:"hostnames,omitempty"`
+}
+
+// JobResult is pushed to the queue once a job is done
+type JobResult struct {
+	// ID is the id of the job
+	ID string `json:"id"`
+	// Results are the hosts found by the enumeration
+	Results []*Result `json:"results"`
+	// Stats are the statistics of the enumeration
+	Stats *RunStats `json:"stats,omitempty"`
+	// Error is set when the enumeration failed, the results being partial
+	Error string `json:"error,omitempty"`
+}
+
+// serveQueue runs the enumeration jobs pulled from the queue, on top of
+// the options of the command line, until interrupted
+func serveQueue(options *Options) error {
+	q, err := queue.New(options.Queue)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	runner, err := New(options)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	if options.Dashboard != "" {
+		if runner.dashboard, _, err = serveDashboard(options.Dashboard, options.DashboardToken, runner.logger); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runner.ServeJobs(ctx, q)
+}
+
+// ServeJobs runs the jobs of the queue one after the other until ctx is
+// done, pushing back their results. The job interrupted by ctx is
+// requeued for the other workers. The runner should be created with New,
+// its options needing no domain nor wordlist.
+func (r *Runner) ServeJobs(ctx context.Context, q queue.Queue) error {
+	r.logger.Info().Msgf("Waiting for jobs\n")
+	for {
+		message, err := q.Pop(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			r.logger.Error().Msgf("Could not pull job: %s\n", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(queueRetryInterval):
+			}
+			continue
+		}
+
+		result := r.runJob(ctx, message.Data)
+		if ctx.Err() != nil {
+			r.logger.Info().Msgf("Interrupted, requeuing job %s\n", result.ID)
+			if err := q.Requeue(context.Background(), message); err != nil {
+				return fmt.Errorf("could not requeue job %s: %w", result.ID, err)
+			}
+			return nil
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("could not marshal result of job %s: %w", result.ID, err)
+		}
+		if err := q.Push(ctx, data); err != nil {
+			r.logError("Could not push result of job %s, requeuing it: %s\n", result.ID, err)
+			if err := q.Requeue(ctx, message); err != nil {
+				r.logError("Could not requeue job %s: %s\n", result.ID, err)
+			}
+			continue
+		}
+		if err := q.Ack(ctx, message); err != nil {
+			r.logError("Could not acknowledge job %s: %s\n", result.ID, err)
+		}
+	}
+}
+
+// runJob runs the enumeration of a job configured by the opts, the
+// results being collected instead of written to the output of the
+// command line
+func (r *Runner) runJob(ctx context.Context, data []byte, extra ...Option) *JobResult {
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return &JobResult{Results: []*Result{}, Error: fmt.Sprintf("invalid job: %s", err)}
+	}
+	result := &JobResult{ID: job.ID, Results: []*Result{}}
+
+	var mutex sync.Mutex
+	opts := []Option{
+		WithMode(Mode(job.Mode)),
+		WithOutputWriter(io.Discard),
+		WithOnResult(func(found *Result) {
+			mutex.Lock()
+			result.Results = append(result.Results, found)
+			mutex.Unlock()
+		}),
+		func(options *Options) {
+			options.Output, options.Domains, options.Wordlist = "", job.Domains, job.Wordlist
+		},
+	}
+	if len(job.Hostnames) > 0 {
+		opts = append(opts, WithHostnames(job.Hostnames...))
+	}
+	opts = append(opts, extra...)
+
+	r.logger.Info().Msgf("Running job %s\n", job.ID)
+	dashboardJob := r.dashboard.start(job.ID)
+	opts = append(opts, r.dashboard.track(dashboardJob))
+	stats, err := r.Enumerate(ctx, opts...)
+	result.Stats = &stats
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.dashboard.finish(dashboardJob, result.Results, err)
+	r.logger.Info().Msgf("Job %s found %d hosts in %s\n", job.ID, len(result.Results), stats.Duration)
+	return result
+}
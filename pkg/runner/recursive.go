@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/remeh/sizedwaitgroup"
+)
+
+// runRecursive brute forces the hostnames discovered by the previous pass
+// with the wordlist, one level at a time, up to the configured depth.
+// Hostnames which are the root of a wildcard are not brute forced.
+func (r *Runner) runRecursive(instance *massdns.Instance) {
+	var words []string
+	err := readWordlists(r.options.Wordlist, func(word string) {
+		words = append(words, word)
+	})
+	if err != nil {
+		r.logError("Could not read bruteforce wordlist: %s\n", err)
+		return
+	}
+
+	// seeds of each level are the hostnames discovered by the previous one
+	var start int
+	for level := 1; level <= r.options.Depth; level++ {
+		r.discoveredMutex.Lock()
+		seeds := make([]string, len(r.discovered)-start)
+		copy(seeds, r.discovered[start:])
+		start = len(r.discovered)
+		r.discoveredMutex.Unlock()
+
+		seeds = r.dropWildcardRoots(instance, seeds)
+		if len(seeds) == 0 {
+			r.logger.Info().Msgf("No hostnames left to bruteforce at depth %d\n", level)
+			return
+		}
+
+		r.phases.Set(massdns.PhaseGenerate)
+		r.logger.Info().Msgf("Started generating bruteforce permutation for %d hostnames at depth %d\n", len(seeds), level)
+
+		resolution, err := instance.NewResolution()
+		if err != nil {
+			r.logError("Could not run massdns at depth %d: %s\n", level, err)
+			return
+		}
+
+		now := time.Now()
+		chunker := r.newCandidateChunker("recursive-", func(path string) error {
+			return resolution.Resolve(r.ctx, path)
+		})
+		for _, word := range words {
+			for _, seed := range seeds {
+				chunker.Write(word + "." + seed)
+			}
+		}
+		err = chunker.Close()
+		if finishErr := resolution.Finish(r.ctx); err == nil {
+			err = finishErr
+		}
+		resolution.Close()
+		if err != nil {
+			r.logError("Could not run massdns at depth %d: %s\n", level, err)
+			return
+		}
+
+		r.logger.Info().Msgf("Resolving %d permutations at depth %d took %s\n", chunker.written, level, time.Since(now))
+	}
+}
+
+// dropWildcardRoots removes the hostnames below which every name resolves
+func (r *Runner) dropWildcardRoots(instance *massdns.Instance, hostnames []string) []string {
+	var (
+		mutex    sync.Mutex
+		filtered []string
+	)
+
+	swg := sizedwaitgroup.New(r.options.WildcardThreads)
+	for _, hostname := range hostnames {
+		if r.ctx.Err() != nil {
+			break
+		}
+		swg.Add()
+		go func(hostname string) {
+			defer swg.Done()
+
+			if instance.HasWildcard(r.ctx, hostname) {
+				r.logger.Debug().Msgf("Skipping wildcard root %s\n", hostname)
+				return
+			}
+			mutex.Lock()
+			filtered = append(filtered, hostname)
+			mutex.Unlock()
+		}(hostname)
+	}
+	swg.Wait()
+
+	return filtered
+}
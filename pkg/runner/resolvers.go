@@ -0,0 +1,283 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	folderutil "github.com/projectdiscovery/utils/folder"
+	"github.com/rs/xid"
+)
+
+// publicResolversURL is the maintained list of public resolvers
+const publicResolversURL = "https://raw.githubusercontent.com/trickest/resolvers/main/resolvers.txt"
+
+// defaultResolversLocation is the resolvers file written by -update-resolvers,
+// used when no resolvers file is given
+var defaultResolversLocation = filepath.Join(folderutil.AppConfigDirOrDefault(".", "shuffledns"), "resolvers.txt")
+
+// resolverCheckTimeout bounds the queries validating a resolver
+const resolverCheckTimeout = 3 * time.Second
+
+// resolverCheckThreads is the number of resolvers validated concurrently
+const resolverCheckThreads = 100
+
+// resolverCheckHost is a hostname with a well known address
+var resolverCheckHost, resolverCheckAddress = "one.one.one.one", "1.1.1.1"
+
+// updateResolvers fetches the public resolvers list and writes the
+// resolvers answering correctly to the resolvers file, or to the
+// default location when none was given.
+func updateResolvers(options *Options) error {
+	path := options.ResolversFile
+	if path == "" {
+		path = defaultResolversLocation
+	}
+
+	options.logger().Info().Msgf("Fetching public resolvers from %s\n", publicResolversURL)
+	resolvers, err := fetchResolvers(publicResolversURL)
+	if err != nil {
+		return fmt.Errorf("could not fetch resolvers: %w", err)
+	}
+
+	options.logger().Info().Msgf("Validating %d resolvers\n", len(resolvers))
+	valid := validateResolvers(resolvers)
+	if len(valid) == 0 {
+		return fmt.Errorf("%w, %d were checked", ErrNoValidResolvers, len(resolvers))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create resolvers directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(valid, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not write resolvers: %w", err)
+	}
+	options.logger().Info().Msgf("Wrote %d valid resolvers out of %d to %s\n", len(valid), len(resolvers), path)
+	return nil
+}
+
+// preflightResolvers drops the resolvers of the resolvers file which are
+// dead or misbehaving, massdns then using a copy of the surviving ones.
+// Resolvers files are validated once by the enumerations of a runner.
+func (r *Runner) preflightResolvers() error {
+	if path, ok := r.shared.validated(r.options.ResolversFile); ok {
+		r.options.ResolversFile = path
+		return nil
+	}
+
+	resolvers, err := readResolvers(r.options.ResolversFile)
+	if err != nil {
+		return fmt.Errorf("could not read resolvers: %w", err)
+	}
+
+	r.logger.Info().Msgf("Validating %d resolvers before the run\n", len(resolvers))
+	valid := validateResolvers(resolvers)
+	if len(valid) == 0 {
+		return fmt.Errorf("%w, %d were checked", ErrNoValidResolvers, len(resolvers))
+	}
+	r.logger.Info().Msgf("%d resolvers out of %d survived the validation\n", len(valid), len(resolvers))
+
+	file, err := os.CreateTemp(r.shared.tempDir, "resolvers-valid-")
+	if err != nil {
+		return fmt.Errorf("could not write resolvers: %w", err)
+	}
+	_, err = file.WriteString(strings.Join(valid, "\n") + "\n")
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("could not write resolvers: %w", err)
+	}
+	r.shared.setValidated(r.options.ResolversFile, file.Name())
+	r.options.ResolversFile = file.Name()
+	return nil
+}
+
+// readResolvers reads a resolvers file, one per line
+func readResolvers(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseResolvers(file)
+}
+
+// parseResolvers reads the resolvers of a list, skipping the comments
+func parseResolvers(reader io.Reader) ([]string, error) {
+	var resolvers []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if resolver := strings.TrimSpace(scanner.Text()); resolver != "" && !strings.HasPrefix(resolver, "#") {
+			resolvers = append(resolvers, resolver)
+		}
+	}
+	return resolvers, scanner.Err()
+}
+
+// fetchResolvers downloads a list of resolvers, one per line
+func fetchResolvers(url string) ([]string, error) {
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return parseResolvers(resp.Body)
+}
+
+// resolverBenchmarkProbes is the number of queries measuring a resolver
+const resolverBenchmarkProbes = 5
+
+// resolverMinSuccess is the success rate below which benchmarked resolvers are trimmed
+const resolverMinSuccess = 0.8
+
+// resolverScore is the measured behavior of a resolver
+type resolverScore struct {
+	resolver string
+	// latency is the mean latency of the successful probes
+	latency time.Duration
+	// success is the rate of probes answered correctly
+	success float64
+	// lying is set when the resolver answers hostnames which don't exist
+	lying bool
+}
+
+// benchmarkResolvers measures the resolvers of the resolvers file, writing them
+// ranked by success rate and latency, without the lying and unreliable
+// ones, to the output file or stdout.
+func benchmarkResolvers(options *Options) error {
+	resolvers, err := readResolvers(options.ResolversFile)
+	if err != nil {
+		return fmt.Errorf("could not read resolvers: %w", err)
+	}
+
+	options.logger().Info().Msgf("Benchmarking %d resolvers\n", len(resolvers))
+	scores := scoreResolvers(resolvers, resolverBenchmarkProbes)
+
+	var ranked []resolverScore
+	var lying int
+	for _, score := range scores {
+		if score.lying {
+			lying++
+			continue
+		}
+		if score.success >= resolverMinSuccess {
+			ranked = append(ranked, score)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].success != ranked[j].success {
+			return ranked[i].success > ranked[j].success
+		}
+		return ranked[i].latency < ranked[j].latency
+	})
+	options.logger().Info().Msgf("Kept %d resolvers out of %d, %d were lying\n", len(ranked), len(resolvers), lying)
+
+	var buffer strings.Builder
+	for _, score := range ranked {
+		options.logger().Verbose().Msgf("%s: latency %s, success %.0f%%\n", score.resolver, score.latency.Round(time.Millisecond), score.success*100)
+		buffer.WriteString(score.resolver + "\n")
+	}
+	switch options.Output {
+	case "":
+		options.logger().Print().Msgf("%s", buffer.String())
+		return nil
+	case "-":
+		_, err := os.Stdout.WriteString(buffer.String())
+		return err
+	}
+	if err := os.WriteFile(options.Output, []byte(buffer.String()), 0644); err != nil {
+		return fmt.Errorf("could not write resolvers: %w", err)
+	}
+	return nil
+}
+
+// validateResolvers returns the resolvers answering correctly, in order
+func validateResolvers(resolvers []string) []string {
+	var valid []string
+	for _, score := range scoreResolvers(resolvers, 1) {
+		if score.success == 1 && !score.lying {
+			valid = append(valid, score.resolver)
+		}
+	}
+	return valid
+}
+
+// scoreResolvers measures the resolvers concurrently, returning the scores in order
+func scoreResolvers(resolvers []string, probes int) []resolverScore {
+	scores := make([]resolverScore, len(resolvers))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < resolverCheckThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				scores[index] = scoreResolver(resolvers[index], probes)
+			}
+		}()
+	}
+	for index := range resolvers {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return scores
+}
+
+// scoreResolver measures how the resolver answers a well known hostname,
+// and whether it hijacks the hostnames which don't exist. Resolvers which
+// never answer are not checked for hijacking.
+func scoreResolver(resolver string, probes int) resolverScore {
+	score := resolverScore{resolver: resolver}
+	address := resolver
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+	client := &dns.Client{Timeout: resolverCheckTimeout}
+
+	var succeeded int
+	var total time.Duration
+	for i := 0; i < probes; i++ {
+		msg := &dns.Msg{}
+		msg.SetQuestion(dns.Fqdn(resolverCheckHost), dns.TypeA)
+		resp, rtt, err := client.Exchange(msg, address)
+		if err != nil || resp.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok && a.A.String() == resolverCheckAddress {
+				succeeded++
+				total += rtt
+				break
+			}
+		}
+	}
+	if succeeded == 0 {
+		return score
+	}
+	score.success = float64(succeeded) / float64(probes)
+	score.latency = total / time.Duration(succeeded)
+
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(xid.New().String()+"."+resolverCheckHost), dns.TypeA)
+	resp, _, err := client.Exchange(msg, address)
+	score.lying = err == nil && resp.Rcode != dns.RcodeNameError
+	return score
+}
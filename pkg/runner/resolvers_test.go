@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startResolver starts a resolver answering the check hostname, and
+// every other hostname too when hijacking
+func startResolver(t *testing.T, hijacking bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		if req.Question[0].Name == dns.Fqdn(resolverCheckHost) || hijacking {
+			rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A " + resolverCheckAddress)
+			resp.Answer = append(resp.Answer, rr)
+		} else {
+			resp.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestValidateResolvers(t *testing.T) {
+	valid := startResolver(t, false)
+	hijacking := startResolver(t, true)
+
+	resolvers := validateResolvers([]string{hijacking, valid, "127.0.0.1:1"})
+	require.Equal(t, []string{valid}, resolvers, "Got unexpected valid resolvers")
+}
+
+func TestBenchmarkResolvers(t *testing.T) {
+	valid := startResolver(t, false)
+	hijacking := startResolver(t, true)
+
+	dir := t.TempDir()
+	resolversFile := filepath.Join(dir, "resolvers.txt")
+	err := os.WriteFile(resolversFile, []byte(hijacking+"\n"+valid+"\n127.0.0.1:1\n"), 0644)
+	require.Nil(t, err, "Could not write resolvers")
+
+	options := &Options{ResolversFile: resolversFile, Output: filepath.Join(dir, "ranked.txt")}
+	require.Nil(t, benchmarkResolvers(options), "Could not benchmark resolvers")
+	ranked, err := readResolvers(options.Output)
+	require.Nil(t, err, "Could not read ranked resolvers")
+	require.Equal(t, []string{valid}, ranked, "Got unexpected ranked resolvers")
+}
+
+func TestTrimResolvers(t *testing.T) {
+	dir := t.TempDir()
+	resolversFile := filepath.Join(dir, "resolvers.txt")
+	require.Nil(t, os.WriteFile(resolversFile, []byte("8.8.8.8\n1.1.1.1:53\n9.9.9.9\n# comment\n"), 0644), "Could not write resolvers")
+
+	output := filepath.Join(dir, "trimmed.txt")
+	kept, total, err := trimResolvers(resolversFile, output, []massdns.ResolverReplies{
+		{Resolver: "8.8.8.8:53", Answers: 9, Errors: 1},
+		{Resolver: "1.1.1.1:53", Answers: 1, Errors: 9},
+	}, 0.2)
+	require.Nil(t, err, "Could not trim resolvers")
+	require.Equal(t, 1, kept, "Got unexpected kept resolvers")
+	require.Equal(t, 3, total, "Got unexpected total resolvers")
+	data, err := os.ReadFile(output)
+	require.Nil(t, err, "Could not read trimmed resolvers")
+	require.Equal(t, "8.8.8.8\n", string(data), "Got unexpected trimmed resolvers")
+}
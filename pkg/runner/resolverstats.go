@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// resolverReportSize is the number of worst resolvers logged at the end
+// of the runs, the others being logged in verbose mode
+const resolverReportSize = 10
+
+// reportResolvers logs the replies of the resolvers in the massdns output
+// of the run, worst first, and writes the trimmed resolvers file
+func (r *Runner) reportResolvers() {
+	resolvers := r.counters.Resolvers()
+	if len(resolvers) == 0 {
+		return
+	}
+	maxRate := float64(r.options.TrimErrorRate) / 100
+
+	if r.options.ResolverStats {
+		var failing int
+		for _, replies := range resolvers {
+			if replies.ErrorRate() > maxRate {
+				failing++
+			}
+		}
+		r.logger.Info().Msgf("%d resolvers replied, %d with more than %d%% errors\n", len(resolvers), failing, r.options.TrimErrorRate)
+		for i, replies := range resolvers {
+			event := r.logger.Info()
+			if i >= resolverReportSize {
+				event = r.logger.Verbose()
+			}
+			event.Msgf("Resolver %s: %d answers, %d errors (%.1f%%)\n", replies.Resolver, replies.Answers, replies.Errors, replies.ErrorRate()*100)
+		}
+	}
+
+	if r.options.TrimResolvers != "" {
+		kept, total, err := trimResolvers(r.options.ResolversFile, r.options.TrimResolvers, resolvers, maxRate)
+		if err != nil {
+			r.logError("Could not write trimmed resolvers: %s\n", err)
+			return
+		}
+		r.logger.Info().Msgf("Wrote %d resolvers out of %d to %s\n", kept, total, r.options.TrimResolvers)
+	}
+}
+
+// trimResolvers writes the resolvers of the resolvers file which replied
+// with at most maxRate errors to the output file, leaving out the ones
+// which didn't reply at all
+func trimResolvers(resolversFile, output string, resolvers []massdns.ResolverReplies, maxRate float64) (kept, total int, err error) {
+	lines, err := readResolvers(resolversFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	replies := make(map[string]massdns.ResolverReplies, len(resolvers))
+	for _, resolver := range resolvers {
+		replies[resolver.Resolver] = resolver
+	}
+
+	var trimmed []string
+	for _, line := range lines {
+		address := line
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		if resolver, ok := replies[address]; ok && resolver.ErrorRate() <= maxRate {
+			trimmed = append(trimmed, line)
+		}
+	}
+	if err := os.WriteFile(output, []byte(strings.Join(trimmed, "\n")+"\n"), 0644); err != nil {
+		return 0, 0, err
+	}
+	return len(trimmed), len(lines), nil
+}
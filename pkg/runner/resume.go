@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// runChunks resolves the input file split in chunks, so that an interrupted
+// enumeration resumes from the first chunk which was not completed, and the
+// adaptive concurrency reacts to the failure rate of every chunk. The
+// wildcards are filtered across all the chunks.
+func (r *Runner) runChunks(instance *massdns.Instance, inputFile string) error {
+	chunks, err := r.splitChunks(inputFile)
+	if err != nil {
+		return err
+	}
+
+	if r.resumeDir() != "" {
+		r.logger.Info().Msgf("Resolving %d chunks with run state in %s\n", len(chunks), r.resumeDir())
+	} else {
+		r.logger.Info().Msgf("Resolving %d chunks\n", len(chunks))
+	}
+	resolution, err := instance.NewResolution()
+	if err != nil {
+		return err
+	}
+	defer resolution.Close()
+
+	// The wildcards are filtered and the output written once every
+	// chunk is resolved, with the hosts resolved so far if one fails
+	var runErr error
+	for i, chunk := range chunks {
+		if err := resolution.Resolve(r.ctx, chunk); err != nil {
+			runErr = fmt.Errorf("could not run chunk %d: %w", i+1, err)
+			break
+		}
+	}
+	if err := resolution.Finish(r.ctx); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// splitChunks splits the input file in chunks of chunkSize lines
+func (r *Runner) splitChunks(inputFile string) ([]string, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open input file: %w", err)
+	}
+	defer input.Close()
+
+	var (
+		chunks []string
+		file   *os.File
+		writer *bufio.Writer
+		lines  int
+	)
+	closeChunk := func() {
+		if file != nil {
+			writer.Flush()
+			file.Close()
+			file = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		if file == nil {
+			file, err = os.CreateTemp(r.tempDir, "chunk-")
+			if err != nil {
+				return nil, fmt.Errorf("could not create chunk: %w", err)
+			}
+			writer = bufio.NewWriter(file)
+			chunks = append(chunks, file.Name())
+		}
+		_, _ = writer.WriteString(scanner.Text() + "\n")
+
+		lines++
+		if lines%chunkSize == 0 {
+			closeChunk()
+		}
+	}
+	closeChunk()
+
+	return chunks, scanner.Err()
+}
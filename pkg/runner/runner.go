@@ -1,42 +1,157 @@
 package runner
 
 import (
-	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+	"github.com/ShlomieLiberow/shuffledns/pkg/scope"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/ShlomieLiberow/shuffledns/pkg/tracing"
 	"github.com/projectdiscovery/gologger"
 	fileutil "github.com/projectdiscovery/utils/file"
-	"github.com/rs/xid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	errDeadline    = errors.New("deadline reached")
+	errSkipped     = errors.New("skipped to the output phase")
+	errInterrupted = errors.New("interrupted")
 )
 
 // Runner is a client for running the enumeration process.
 type Runner struct {
 	tempDir string
 	options *Options
+
+	// logger logs the progress of the enumeration
+	logger *gologger.Logger
+
+	// ctx is done once the enumeration is interrupted, the cause
+	// telling whether the deadline was reached or the user skipped
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	start  time.Time
+
+	// limiter paces the dns queries of every phase
+	limiter *ratelimit.Limiter
+
+	// controlListener accepts the runtime control commands
+	controlListener net.Listener
+	controls        sync.Once
+
+	// shared are the resources reused by the enumerations of the runner
+	shared *shared
+	// sinks are the sinks closed by Close, the ones of the runners derived
+	// from another one being left to it
+	sinks []OutputSink
+
+	// ran is set once the runner has run an enumeration
+	ran bool
+
+	discoveredMutex sync.Mutex
+	discovered      []string
+
+	// tracerProvider is the provider created from the OTLP endpoint, shut
+	// down by Close, nil if the options give one or none
+	tracerProvider *sdktrace.TracerProvider
+
+	// droppedMutex serializes the OnDropped calls of the output workers
+	droppedMutex sync.Mutex
+
+	// candidates and counters count the work of the enumeration
+	candidates *atomic.Int64
+	counters   *massdns.Counters
+	// phases tracks the pipeline phase of the enumeration
+	phases *massdns.Phases
+
+	// runStats are the statistics returned by Stats
+	runStats runStats
+
+	// dashboard lists the jobs of the daemon modes, nil if not served
+	dashboard *dashboard
+
+	// project is the directory of the project recording the runs, empty if none
+	project string
+	// checkpoint keeps the run state in an object storage, nil if none
+	checkpoint *checkpointer
+	// nxdomains are the names answered NXDOMAIN during the run, nil if
+	// the candidates below them are not pruned
+	nxdomains *nxdomainCache
+	// seeds are the hostnames found outside of the resolution, such as in
+	// the certificate transparency logs, generating alterations whether
+	// they resolve or not
+	seeds []string
+	// scope are the patterns the candidates and the results must match, nil if none
+	scope *scope.Scope
 }
 
 // New creates a new client for running enumeration process.
 func New(options *Options) (*Runner, error) {
 	runner := &Runner{
-		options: options,
+		options:    options,
+		logger:     options.logger(),
+		candidates: &atomic.Int64{},
+		counters:   &massdns.Counters{},
+		phases:     &massdns.Phases{},
 	}
 
 	// Setup the massdns binary path if none was give.
 	// If no valid path found, return an error
-	if options.MassdnsPath == "" {
-		options.MassdnsPath = runner.findBinary()
+	if options.MassdnsPath == "" && options.Mode != string(Verify) && options.usesMassdns() {
+		options.MassdnsPath = findBinary()
 		if options.MassdnsPath == "" {
-			return nil, errors.New("could not find massdns binary")
+			return nil, ErrMassdnsNotFound
+		}
+		runner.logger.Debug().Msgf("Discovered massdns binary at %s\n", options.MassdnsPath)
+	}
+	if options.Backend == massdns.BackendZDNS && options.CustomBackend == nil && options.Mode != string(Verify) {
+		if _, err := exec.LookPath("zdns"); err != nil {
+			return nil, ErrZDNSNotFound
 		}
-		gologger.Debug().Msgf("Discovered massdns binary at %s\n", options.MassdnsPath)
+	}
+
+	if options.ScopeFile != "" {
+		loaded, err := scope.Load(options.ScopeFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read scope file: %w", err)
+		}
+		runner.scope = loaded
+	}
+	if options.ScopeBurp != "" {
+		loaded, err := scope.LoadExport(options.ScopeBurp)
+		if err != nil {
+			return nil, fmt.Errorf("could not read scope export: %w", err)
+		}
+		// The patterns of both files are in the scope
+		if runner.scope != nil {
+			runner.scope.Merge(loaded)
+		} else {
+			runner.scope = loaded
+		}
+	}
+
+	// Tag the json log lines with the phases of the runner
+	if options.LogJSON {
+		runner.logger.SetFormatter(newJSONFormatter(runner.phases))
+	}
+
+	// Export the spans of the phases to the collector
+	if options.TracerProvider == nil && (options.OTLPEndpoint != "" || tracing.Configured()) {
+		provider, err := tracing.NewProvider(context.Background(), options.OTLPEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		options.TracerProvider, runner.tracerProvider = provider, provider
 	}
 
 	// Create a temporary directory that will be removed at the end
@@ -46,18 +161,79 @@ func New(options *Options) (*Runner, error) {
 		return nil, err
 	}
 	runner.tempDir = dir
+	runner.shared = newShared(dir)
+
+	if options.Project != "" {
+		if err := runner.openProject(); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if options.Checkpoint != "" {
+		if runner.checkpoint, err = newCheckpointer(options.Checkpoint, dir); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	// Drop the dead resolvers before they tank the resolution rate
+	if options.ValidateResolvers && options.Mode != string(Verify) {
+		if err := runner.preflightResolvers(); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if err := runner.tuneThreads(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if options.NegativeCache != "" {
+		if runner.shared.negativeCache, err = store.OpenNegativeCache(options.NegativeCache, options.NegativeCacheTTL); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("could not open negative cache: %w", err)
+		}
+	}
+	runner.limiter = ratelimit.New(options.RateLimit)
+
+	if options.Webhook != "" {
+		options.Sinks = append(options.Sinks, massdns.NewWebhookSink(options.Webhook))
+	}
+	runner.sinks = options.Sinks
+
+	runner.start = time.Now()
+	runner.ctx, runner.cancel = context.WithCancelCause(context.Background())
 
 	return runner, nil
 }
 
 // Close releases all the resources and cleans up
 func (r *Runner) Close() {
+	r.cancel(nil)
+	if r.controlListener != nil {
+		r.controlListener.Close()
+	}
+	for _, sink := range r.sinks {
+		if err := sink.Close(); err != nil {
+			r.logger.Error().Msgf("Could not write results: %s\n", err)
+		}
+	}
+	// The shared resources are released by the runner which created them
+	if r.shared != nil && r.shared.tempDir == r.tempDir && r.shared.negativeCache != nil {
+		r.shared.negativeCache.Close()
+	}
+	if r.tracerProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		if err := r.tracerProvider.Shutdown(ctx); err != nil {
+			r.logger.Warning().Msgf("Could not export traces: %s\n", err)
+		}
+		cancel()
+	}
 	os.RemoveAll(r.tempDir)
 }
 
 // findBinary searches for massdns binary in various pre-defined paths
 // only linux and macos paths are supported rn
-func (r *Runner) findBinary() string {
+func findBinary() string {
 	otherCommonLocations := []string{
 		"/usr/bin/massdns",
 		"/usr/local/bin/massdns",
@@ -78,128 +254,421 @@ func (r *Runner) findBinary() string {
 	return file
 }
 
-// RunEnumeration sets up the input layer for giving input to massdns
-// binary and runs the actual enumeration
+// RunEnumeration runs the enumeration for the command line, writing
+// the partial results on Ctrl-C and handling the runtime signals.
 func (r *Runner) RunEnumeration() {
-	// Handle only wildcard filtering
-	if r.options.MassdnsRaw != "" {
-		r.processSubdomains()
-		return
+	r.notifyInterrupt()
+	r.notifySignals()
+
+	if err := r.Run(context.Background()); err != nil {
+		r.logger.Error().Msgf("%s\n", err)
 	}
+}
 
-	// Handle a domain to bruteforce with wordlist
-	if r.options.Wordlist != "" {
-		r.processDomain()
-		return
+// Run sets up the input layer for giving input to massdns binary and
+// runs the actual enumeration. Once ctx is done, no new work is started
+// and the results found so far are written. Run can be called again
+// once it returned, reusing the wildcard cache, the validated resolvers
+// and the trusted clients; Enumerate runs concurrent enumerations.
+func (r *Runner) Run(ctx context.Context) (err error) {
+	r.reset()
+	if r.options.Deadline > 0 {
+		deadline := time.AfterFunc(r.options.Deadline, func() {
+			r.cancel(errDeadline)
+		})
+		defer deadline.Stop()
+	}
+
+	interrupt := func() {
+		// Paused queries must be released for the run to finish
+		r.limiter.Resume()
+		r.cancel(errInterrupted)
+	}
+	// A context done beforehand interrupts the run before it starts
+	if ctx.Err() != nil {
+		interrupt()
+	}
+	stop := context.AfterFunc(ctx, interrupt)
+	defer stop()
+
+	// The span of the run ends once the statistics are final
+	stopTrace := r.trace(ctx)
+	defer func() { stopTrace(err) }()
+	stopStats := r.trackStats()
+	defer func() { stopStats(err) }()
+	if r.project != "" {
+		stopProject := r.trackProject()
+		defer func() { stopProject(err) }()
+	}
+	if r.checkpoint != nil {
+		stopCheckpoint, err := r.trackCheckpoint()
+		if err != nil {
+			return err
+		}
+		defer stopCheckpoint()
+	}
+	if r.options.ResolverStats || r.options.TrimResolvers != "" {
+		defer r.reportResolvers()
+	}
+	if r.options.PruneNXDomain {
+		r.nxdomains = newNXDomainCache()
+	}
+	switch {
+	case r.options.progressBar != nil:
+		defer r.showProgressBar()()
+	case r.options.StatusInterval > 0:
+		defer r.logStatus()()
+	}
+	if r.options.OnProgress != nil {
+		defer r.reportProgress()()
 	}
+	r.startControls()
 
+	switch {
+	// Handle the base names to try against top level domains
+	case r.options.Mode == string(TLD):
+		return r.processTLDs()
+	// Handle only wildcard filtering
+	case r.options.MassdnsRaw != "":
+		return r.runMassdns("")
+	// Handle hostnames streamed continuously on stdin
+	case r.options.Stream:
+		return r.processStream()
+	// Handle the target domains assigned to specific resolvers
+	case r.options.DomainResolvers != "":
+		return r.processResolverGroups()
+	// Handle a domain to bruteforce with wordlist
+	case len(r.options.Wordlist) > 0:
+		return r.processDomain()
 	// Handle a list of subdomains to resolve
-	if r.options.SubdomainsList != "" || fileutil.HasStdin() {
-		r.processSubdomains()
-		return
+	case r.options.hasInput():
+		return r.processSubdomains()
 	}
+	return nil
 }
 
-// processDomain processes the bruteforce for a domain using a wordlist
-func (r *Runner) processDomain() {
-	resolveFile := filepath.Join(r.tempDir, xid.New().String())
-	file, err := os.Create(resolveFile)
-	if err != nil {
-		gologger.Error().Msgf("Could not create bruteforce list (%s): %s\n", r.tempDir, err)
-		return
+// Results runs the enumeration in the background, sending the found
+// hostnames to the returned channel, which is closed once the run ends.
+// The error of the run, if any, is then sent to the error channel.
+func (r *Runner) Results(ctx context.Context) (<-chan string, <-chan error) {
+	results := make(chan string)
+	errs := make(chan error, 1)
+
+	onHostname := r.options.OnHostname
+	r.options.OnHostname = func(hostname string) {
+		if onHostname != nil {
+			onHostname(hostname)
+		}
+		select {
+		case results <- hostname:
+		case <-ctx.Done():
+		}
 	}
-	writer := bufio.NewWriter(file)
 
-	// Read the input wordlist for bruteforce generation
-	inputFile, err := os.Open(r.options.Wordlist)
+	go func() {
+		defer close(errs)
+		err := r.Run(ctx)
+		r.options.OnHostname = onHostname
+		close(results)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return results, errs
+}
+
+// processDomain processes the bruteforce for a domain using a wordlist.
+// The permutations are generated lazily and resolved chunk by chunk.
+func (r *Runner) processDomain() error {
+	instance, err := r.newMassdns("")
 	if err != nil {
-		gologger.Error().Msgf("Could not read bruteforce wordlist (%s): %s\n", r.options.Wordlist, err)
-		file.Close()
-		return
+		return fmt.Errorf("could not create massdns client: %w", err)
 	}
 
-	gologger.Info().Msgf("Started generating bruteforce permutation\n")
+	r.phases.Set(massdns.PhaseGenerate)
+	r.logger.Info().Msgf("Started generating bruteforce permutation\n")
+
+	// Every chunk is resolved into the same store, the wildcards being
+	// filtered and the output written once the last one is resolved
+	resolution, err := instance.NewResolution()
+	if err != nil {
+		return fmt.Errorf("could not run massdns: %w", err)
+	}
+	defer resolution.Close()
 
 	now := time.Now()
-	// Create permutation for domain with wordlist
-	scanner := bufio.NewScanner(inputFile)
-	for scanner.Scan() {
-		// RFC4343 - case insensitive domain
-		text := strings.ToLower(scanner.Text())
-		if text == "" {
-			continue
-		}
+	chunker := r.newCandidateChunker("bruteforce-", func(path string) error {
+		return resolution.Resolve(r.ctx, path)
+	})
+	// Create permutation for domain with the merged wordlists. The chunks
+	// already resolved are still filtered and written if the candidates
+	// can't all be read.
+	var inputErr error
+	err = readWordlists(r.options.Wordlist, func(word string) {
 		for _, domain := range r.options.Domains {
-			_, _ = writer.WriteString(text + "." + domain + "\n")
+			chunker.Write(word + "." + domain)
 		}
+	})
+	if err != nil {
+		inputErr = fmt.Errorf("could not read bruteforce wordlist: %w", err)
+	} else if err := r.importSeeds(chunker.Write); err != nil {
+		inputErr = err
+	} else {
+		r.chaosSeeds(chunker.Write)
+		r.ctSeeds(chunker.Write)
+	}
+	runErr := chunker.Close()
+	if err := resolution.Finish(r.ctx); err != nil && runErr == nil {
+		runErr = err
+	}
+	if runErr != nil {
+		r.logger.Error().Msgf("Could not run massdns: %s\n", runErr)
 	}
-	writer.Flush()
-	inputFile.Close()
-	file.Close()
 
-	gologger.Info().Msgf("Generating permutations took %s at %s\n", time.Since(now), resolveFile)
+	r.logger.Info().Msgf("Resolving %d permutations took %s\n", chunker.written, time.Since(now))
 
-	// Run the actual massdns enumeration process
-	r.runMassdns(resolveFile)
+	r.runPasses(instance)
+	if inputErr != nil {
+		return inputErr
+	}
+	if runErr != nil {
+		return fmt.Errorf("could not run massdns: %w", runErr)
+	}
+	return nil
 }
 
 // processSubdomain processes the resolving for a list of subdomains
-func (r *Runner) processSubdomains() {
-	var resolveFile string
+func (r *Runner) processSubdomains() error {
+	resolveFile, err := r.readResolutionList()
+	if err != nil {
+		return err
+	}
 
-	// If there is stdin, write the resolution list to the file
-	if fileutil.HasStdin() && r.options.SubdomainsList == "" {
-		file, err := os.CreateTemp(r.tempDir, "massdns-stdin-")
+	// Run the actual massdns enumeration process
+	return r.runMassdns(resolveFile)
+}
+
+// readResolutionList reads the resolution list from stdin, the input
+// reader or the file provided by the user, and returns the path of its
+// sanitized copy.
+func (r *Runner) readResolutionList() (string, error) {
+	reader := r.input()
+	if r.options.SubdomainsList != "" {
+		file, err := os.Open(r.options.SubdomainsList)
 		if err != nil {
-			gologger.Error().Msgf("Could not create resolution list (%s): %s\n", r.tempDir, err)
-			return
+			return "", fmt.Errorf("could not read resolution list: %w", err)
 		}
-		_, _ = io.Copy(file, os.Stdin)
-		file.Close()
-		resolveFile = file.Name()
-	} else {
-		// Use the file if user has provided one
-		resolveFile = r.options.SubdomainsList
+		defer file.Close()
+		reader = file
 	}
 
-	// Run the actual massdns enumeration process
-	r.runMassdns(resolveFile)
+	// Normalize dirty input lines to bare hostnames
+	resolveFile, changed, err := r.sanitizeList(reader)
+	if err != nil {
+		return "", err
+	}
+	if changed > 0 {
+		r.logger.Info().Msgf("Sanitized %d input lines\n", changed)
+	}
+	return resolveFile, nil
+}
+
+// input returns the reader of the input hostnames, stdin if none was given
+func (r *Runner) input() io.Reader {
+	if r.options.Input != nil {
+		return r.options.Input
+	}
+	return os.Stdin
 }
 
 // runMassdns runs the massdns tool on the list of inputs
-func (r *Runner) runMassdns(inputFile string) {
-	massdns, err := massdns.New(massdns.Options{
-		Domains:            r.options.Domains,
-		Retries:            r.options.Retries,
-		MassdnsPath:        r.options.MassdnsPath,
-		Threads:            r.options.Threads,
-		WildcardsThreads:   r.options.WildcardThreads,
-		InputFile:          inputFile,
-		ResolversFile:      r.options.ResolversFile,
-		TrustedResolvers:   r.options.TrustedResolvers,
-		TempDir:            r.tempDir,
-		OutputFile:         r.options.Output,
-		Json:               r.options.Json,
-		MassdnsRaw:         r.options.MassdnsRaw,
-		StrictWildcard:     r.options.StrictWildcard,
-		WildcardOutputFile: r.options.WildcardOutputFile,
-		MassDnsCmd:         r.options.MassDnsCmd,
-		OnResult:           r.options.OnResult,
-		NDJSON:             r.options.NDJSON,
-	})
+func (r *Runner) runMassdns(inputFile string) error {
+	massdns, err := r.newMassdns(inputFile)
 	if err != nil {
-		gologger.Error().Msgf("Could not create massdns client: %s\n", err)
-		return
+		return fmt.Errorf("could not create massdns client: %w", err)
 	}
 
-	err = massdns.Run(context.Background())
+	// Resolve the input in chunks which are skipped once completed, or
+	// whose failure rate adapts the concurrency of the next ones. The
+	// chunks are resolved into the same store, filtered and written once.
+	if (r.resumeDir() != "" || r.options.AdaptiveThreads) && r.options.MassdnsRaw == "" {
+		err = r.runChunks(massdns, inputFile)
+	} else {
+		err = massdns.Run(r.ctx)
+	}
 	if err != nil {
-		gologger.Error().Msgf("Could not run massdns: %s\n", err)
+		r.logger.Error().Msgf("Could not run massdns: %s\n", err)
+	}
+
+	r.runPasses(massdns)
+	if err != nil {
+		return fmt.Errorf("could not run massdns: %w", err)
+	}
+	return nil
+}
+
+// runPasses runs the passes seeded by the hostnames discovered so far
+// and finalizes the enumeration.
+func (r *Runner) runPasses(instance *massdns.Instance) {
+	// Resolve the hostnames referenced by the mail policies of the domains
+	if r.options.MailPolicy != "" && r.ctx.Err() == nil {
+		r.runMailPolicy(instance)
+	}
+
+	// Bruteforce the levels below the discovered hostnames
+	if r.options.Recursive && r.ctx.Err() == nil {
+		r.runRecursive(instance)
+	}
+
+	// Resolve the permutations of the discovered hostnames in a second pass
+	if r.options.Alterations && r.ctx.Err() == nil {
+		r.runAlterations(instance)
+	}
+
+	// Resolve the discovered hostnames with the prefixes and suffixes
+	if r.options.hasAffixes() && r.ctx.Err() == nil {
+		r.runAffixes(instance)
+	}
+
+	// Resolve the candidates following the naming patterns of the discovered hostnames
+	if r.options.Patterns && r.ctx.Err() == nil {
+		r.runPatterns(instance)
 	}
 
 	if r.options.WildcardOutputFile != "" {
-		_ = massdns.DumpWildcardsToFile(r.options.WildcardOutputFile)
+		_ = instance.DumpWildcardsToFile(r.options.WildcardOutputFile)
 	}
+	if r.options.ReservedOutput != "" {
+		if err := instance.DumpReservedToFile(r.options.ReservedOutput); err != nil {
+			r.logError("Could not write the reserved hosts: %s\n", err)
+		}
+	}
+	if r.options.CNAMEReport != "" {
+		if err := instance.DumpCNAMEReportToFile(r.options.CNAMEReport); err != nil {
+			r.logError("Could not write the cname report: %s\n", err)
+		}
+	}
+	if r.options.LabelReport != "" {
+		r.writeLabelReport()
+	}
+
+	r.warnPartial()
+	r.logger.Info().Msgf("Finished resolving.\n")
+}
 
-	gologger.Info().Msgf("Finished resolving.\n")
+// warnPartial warns that the results are partial if the enumeration was interrupted
+func (r *Runner) warnPartial() {
+	switch context.Cause(r.ctx) {
+	case errDeadline:
+		r.logger.Info().Msgf("Deadline of %s reached, the results are partial\n", r.options.Deadline)
+	case errSkipped:
+		r.logger.Info().Msgf("Skipped to the output phase, the results are partial\n")
+	case errInterrupted:
+		switch {
+		case r.options.Resume != "":
+			r.logger.Info().Msgf("Interrupted, the results are partial, run again with -resume %s to continue\n", r.options.Resume)
+		case r.resumeDir() != "":
+			r.logger.Info().Msgf("Interrupted, the results are partial, run again with -project %s to continue\n", r.options.Project)
+		default:
+			r.logger.Info().Msgf("Interrupted, the results are partial, use -resume to be able to continue interrupted runs\n")
+		}
+	}
+}
+
+// newMassdns creates a massdns client for the input file with the runner options
+func (r *Runner) newMassdns(inputFile string) (*massdns.Instance, error) {
+	backend, err := r.backend()
+	if err != nil {
+		return nil, err
+	}
+	return massdns.New(massdns.Options{
+		Domains:             r.options.Domains,
+		Retries:             r.options.Retries,
+		MassdnsPath:         r.options.MassdnsPath,
+		Threads:             r.options.Threads,
+		WildcardsThreads:    r.options.WildcardThreads,
+		InputFile:           inputFile,
+		ResolversFile:       r.options.ResolversFile,
+		TrustedResolvers:    r.options.TrustedResolvers,
+		Proxy:               r.options.Proxy,
+		AXFR:                r.options.AXFR,
+		Verify:              r.options.Verify,
+		DNSSEC:              r.options.DNSSEC,
+		QuarantineResolvers: r.options.QuarantineResolvers,
+		Takeover:            r.options.Takeover,
+		VerifyOnly:          r.options.Mode == string(Verify),
+		VerifyTypes:         r.options.VerifyTypes,
+		VerifyRetries:       r.options.VerifyRetries,
+		VerifyTimeout:       r.options.VerifyTimeout,
+		VerifyRateLimit:     r.options.VerifyRateLimit,
+		ResolverRotation:    r.options.ResolverRotation,
+		ResolverMaxInFlight: r.options.ResolverMaxInFlight,
+		TempDir:             r.tempDir,
+		OutputFile:          r.options.Output,
+		Json:                r.options.Json,
+		HttpxOutput:         r.options.HttpxOutput,
+		MassdnsRaw:          r.options.MassdnsRaw,
+		RawInputFormat:      r.options.RawInputFormat,
+		StrictWildcard:      r.options.StrictWildcard,
+		WildcardOutputFile:  r.options.WildcardOutputFile,
+		MassDnsCmd:          r.options.MassDnsCmd,
+		FilterRcodes:        r.options.FilterRcodes,
+		FilterCNAMEOnly:     r.options.FilterCNAMEOnly,
+		MinIPs:              r.options.MinIPs,
+		MinTTL:              r.options.MinTTL,
+		MaxTTL:              r.options.MaxTTL,
+		MatchRegex:          r.options.MatchRegex,
+		FilterRegex:         r.options.FilterRegex,
+		Scope:               r.scope,
+		MinDepth:            r.options.MinDepth,
+		MaxDepth:            r.options.MaxDepth,
+		ExcludeIPCIDRs:      r.options.ExcludeIPCIDRs,
+		MatchIPCIDRs:        r.options.MatchIPCIDRs,
+		FlagExcluded:        r.options.FlagExcluded,
+		MaxHostsPerIP:       r.options.MaxHostsPerIP,
+		FlagCrowded:         r.options.FlagCrowded,
+		FlagReserved:        r.options.FlagReserved,
+		DropReserved:        r.options.DropReserved,
+		MatchASN:            r.options.MatchASN,
+		FilterASN:           r.options.FilterASN,
+		ASNInfo:             r.options.ASNInfo,
+		ASNDatabase:         r.options.ASNDatabase,
+		GeoIPDatabase:       r.options.GeoIPDatabase,
+		CDN:                 r.options.CDN,
+		CDNRanges:           r.options.CDNRanges,
+		Cloud:               r.options.Cloud,
+		HTTPSHints:          r.options.HTTPSHints,
+		Rebinding:           r.options.Rebinding,
+		CNAMEReport:         r.options.CNAMEReport != "",
+		RetryTimeouts:       r.options.RetryTimeouts,
+		AdaptiveThreads:     r.options.AdaptiveThreads,
+		CloudOnly:           r.options.CloudOnly,
+		NonCloudOnly:        r.options.NonCloudOnly,
+		RunDir:              r.resumeDir(),
+		AppendOutput:        r.options.appendOutput,
+		OutputBufferSize:    r.options.OutputBufferSize,
+		FlushInterval:       r.options.FlushInterval,
+		RateLimiter:         r.limiter,
+		Pausable:            r.options.ControlSocket != "" || r.options.Interactive,
+		OnResult:            r.options.OnResult,
+		NDJSON:              r.options.NDJSON,
+		NoStdout:            r.options.NoStdout,
+		OutputWriter:        r.options.OutputWriter,
+		Sinks:               r.options.Sinks,
+		DualStack:           r.options.DualStack,
+		Backend:             r.options.Backend,
+		CustomBackend:       backend,
+		OnHostname:          r.onHostname,
+		OnWildcard:          r.options.OnWildcard,
+		OnDropped:           r.onDropped,
+		OnNXDomain:          r.onNXDomain(),
+		NewStore:            r.options.NewStore,
+		Logger:              r.logger,
+		WildcardStore:       r.shared.wildcardStore,
+		TrustedClient:       r.shared.trustedClient(r.options),
+		ReloadSignal:        r.shared.reloadSignal,
+		Counters:            r.counters,
+		Phases:              r.phases,
+		ResolverStats:       r.options.ResolverStats || r.options.TrimResolvers != "",
+	})
 }
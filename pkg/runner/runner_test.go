@@ -0,0 +1,1130 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/objectstore"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/ShlomieLiberow/shuffledns/pkg/queue"
+	"github.com/ShlomieLiberow/shuffledns/pkg/store"
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/formatter"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/retryabledns"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/net/websocket"
+)
+
+// newFilterRunner creates a runner filtering a massdns output resolving a single host
+func newFilterRunner(t *testing.T, opts ...Option) *Runner {
+	dir := t.TempDir()
+	resolversFile := filepath.Join(dir, "resolvers.txt")
+	require.Nil(t, os.WriteFile(resolversFile, []byte("127.0.0.1\n"), 0644), "Could not write resolvers")
+	massdnsOutput := filepath.Join(dir, "massdns.txt")
+	err := os.WriteFile(massdnsOutput, []byte(`;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+www.example.com. 300 IN A 10.0.0.1
+`), 0644)
+	require.Nil(t, err, "Could not write massdns output")
+
+	opts = append([]Option{
+		WithMode(Filter),
+		WithDomains("example.com"),
+		WithResolvers(resolversFile),
+		WithStore(dir),
+		func(options *Options) {
+			options.MassdnsRaw = massdnsOutput
+			options.MassdnsPath = "massdns"
+			options.NoStdout = true
+		},
+	}, opts...)
+	runner, err := NewWithOptions(opts...)
+	require.Nil(t, err, "Could not create runner")
+	t.Cleanup(runner.Close)
+	return runner
+}
+
+func TestRunnerResults(t *testing.T) {
+	var hostnames []string
+	results, errs := newFilterRunner(t).Results(context.Background())
+	for hostname := range results {
+		hostnames = append(hostnames, hostname)
+	}
+	require.Nil(t, <-errs, "Could not run enumeration")
+	require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected results")
+}
+
+func TestRunnerCancelled(t *testing.T) {
+	// The results found before the cancellation are still written
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var hostnames []string
+	runner := newFilterRunner(t, WithOnHostname(func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	}))
+	require.Nil(t, runner.Run(ctx), "Could not run enumeration")
+	require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected results")
+	require.ErrorIs(t, context.Cause(runner.ctx), errInterrupted, "Run was not interrupted")
+}
+
+func TestNewWithOptions(t *testing.T) {
+	_, err := NewWithOptions(WithMode(BruteForce), WithDomains("example.com"))
+	require.NotNil(t, err, "Created runner without wordlist")
+
+	var output bytes.Buffer
+	runner := newFilterRunner(t, WithOutputWriter(&output))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, "www.example.com\n", output.String(), "Got unexpected output")
+
+	runner = newFilterRunner(t, func(options *Options) {
+		options.Output = "-"
+	})
+	require.Equal(t, os.Stdout, runner.options.OutputWriter, "Output - is not written to stdout")
+	require.Empty(t, runner.options.Output, "Output - is written to a file")
+}
+
+func TestRunnerOnResult(t *testing.T) {
+	var results []*Result
+	runner := newFilterRunner(t, WithOnResult(func(result *Result) {
+		results = append(results, result)
+	}))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, []*Result{{Hostname: "www.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}}}, results, "Got unexpected results")
+}
+
+func TestRunnerOnDropped(t *testing.T) {
+	dropped := make(map[string]DropReason)
+	var hostnames []string
+	runner := newFilterRunner(t, WithOnDropped(func(hostname string, reason DropReason) {
+		dropped[hostname] = reason
+	}), WithOnHostname(func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	}), func(options *Options) {
+		options.ExcludeIPCIDRs = []string{"10.0.0.0/8"}
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Empty(t, hostnames, "Wrote excluded host")
+	require.Equal(t, map[string]DropReason{"www.example.com": massdns.DropExcluded}, dropped, "Got unexpected drops")
+}
+
+func TestRunnerFilterRcode(t *testing.T) {
+	// The NXDOMAIN replies are kept with the cnames to missing names
+	massdnsOutput := filepath.Join(t.TempDir(), "massdns.txt")
+	err := os.WriteFile(massdnsOutput, []byte(`;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+www.example.com. 300 IN A 10.0.0.1
+
+;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NXDOMAIN, id: 2
+
+;; ANSWER SECTION:
+old.example.com. 300 IN CNAME missing.example.net.
+`), 0644)
+	require.Nil(t, err, "Could not write massdns output")
+
+	var hostnames []string
+	runner := newFilterRunner(t, WithOnHostname(func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	}), func(options *Options) {
+		options.MassdnsRaw = massdnsOutput
+		options.FilterRcodes = []string{"nxdomain"}
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, []string{"old.example.com"}, hostnames, "Got unexpected results")
+
+	// The replies without answers are not kept
+	options := *runner.options
+	options.FilterRcodes = []string{"servfail"}
+	require.ErrorContains(t, options.Validate(), "can't be filtered", "Accepted response code of replies without answers")
+}
+
+func TestRunnerRegex(t *testing.T) {
+	massdnsOutput := filepath.Join(t.TempDir(), "massdns.txt")
+	err := os.WriteFile(massdnsOutput, []byte(`;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+api.example.com. 300 IN A 10.0.0.1
+
+;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 2
+
+;; ANSWER SECTION:
+api.sandbox.example.com. 300 IN A 10.0.0.2
+
+;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 3
+
+;; ANSWER SECTION:
+www.example.com. 300 IN A 10.0.0.3
+`), 0644)
+	require.Nil(t, err, "Could not write massdns output")
+
+	dropped := make(map[string]DropReason)
+	var hostnames []string
+	runner := newFilterRunner(t, WithOnHostname(func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	}), WithOnDropped(func(hostname string, reason DropReason) {
+		dropped[hostname] = reason
+	}), func(options *Options) {
+		options.MassdnsRaw = massdnsOutput
+		options.MatchRegex = []string{`^(api|app)[0-9]*\.`}
+		options.FilterRegex = []string{`(^|\.)sandbox\.`}
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, []string{"api.example.com"}, hostnames, "Got unexpected results")
+	require.Equal(t, map[string]DropReason{"api.sandbox.example.com": massdns.DropScope, "www.example.com": massdns.DropScope}, dropped, "Got unexpected dropped hosts")
+
+	// The expressions are regular expressions, not globs
+	options := *runner.options
+	options.FilterRegex = []string{"*.sandbox.*"}
+	require.ErrorContains(t, options.Validate(), "not globs", "Accepted glob as regex")
+}
+
+func TestRunnerReserved(t *testing.T) {
+	var results []*Result
+	reservedOutput := filepath.Join(t.TempDir(), "reserved.txt")
+	runner := newFilterRunner(t, WithOnResult(func(result *Result) {
+		results = append(results, result)
+	}), func(options *Options) {
+		options.FlagReserved = true
+		options.ReservedOutput = reservedOutput
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Len(t, results, 1, "Could not get flagged host")
+	require.Equal(t, []string{"10.0.0.1"}, results[0].Reserved, "Could not flag reserved address")
+	data, err := os.ReadFile(reservedOutput)
+	require.Nil(t, err, "Could not read reserved output")
+	require.Equal(t, "www.example.com 10.0.0.1\n", string(data), "Got unexpected reserved output")
+
+	dropped := make(map[string]DropReason)
+	runner = newFilterRunner(t, WithOnDropped(func(hostname string, reason DropReason) {
+		dropped[hostname] = reason
+	}), func(options *Options) {
+		options.DropReserved = true
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, map[string]DropReason{"www.example.com": massdns.DropReserved}, dropped, "Got unexpected drops")
+}
+
+func TestRunnerCNAMEReport(t *testing.T) {
+	dir := t.TempDir()
+	massdnsOutput := filepath.Join(dir, "massdns.txt")
+	err := os.WriteFile(massdnsOutput, []byte(`;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 1
+
+;; ANSWER SECTION:
+docs.example.com. 300 IN CNAME example.github.io.
+example.github.io. 300 IN A 185.199.111.153
+
+;; Server: 127.0.0.1:53
+;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 2
+
+;; ANSWER SECTION:
+www.example.com. 300 IN CNAME cdn.example.com.
+cdn.example.com. 300 IN A 10.0.0.1
+`), 0644)
+	require.Nil(t, err, "Could not write massdns output")
+
+	report := filepath.Join(dir, "cnames.txt")
+	runner := newFilterRunner(t, func(options *Options) {
+		options.MassdnsRaw = massdnsOutput
+		options.CNAMEReport = report
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	data, err := os.ReadFile(report)
+	require.Nil(t, err, "Could not read cname report")
+	require.Equal(t, "github.io 1\n  docs.example.com\n", string(data), "Got unexpected cname report")
+}
+
+func TestRunnerOnProgress(t *testing.T) {
+	var events []Progress
+	runner := newFilterRunner(t, WithOnProgress(func(progress Progress) {
+		events = append(events, progress)
+	}))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.NotEmpty(t, events, "Got no progress")
+
+	var phases []massdns.Phase
+	for _, event := range events {
+		phases = append(phases, event.Phase)
+	}
+	require.Contains(t, phases, massdns.PhaseParse, "Got no parse phase")
+	last := events[len(events)-1]
+	require.Equal(t, massdns.PhaseOutput, last.Phase, "Got unexpected final phase")
+	require.Equal(t, 1, last.Found, "Got unexpected final progress")
+}
+
+func TestRunnerStoreBackend(t *testing.T) {
+	var stores int
+	var hostnames []string
+	runner := newFilterRunner(t, WithStoreBackend(func() (store.Store, error) {
+		stores++
+		return store.NewMemory(), nil
+	}), WithOnHostname(func(hostname string) {
+		hostnames = append(hostnames, hostname)
+	}))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, 1, stores, "Store backend was not used")
+	require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected results")
+}
+
+func TestRunnerSinks(t *testing.T) {
+	var posted []*Result
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&posted), "Could not decode posted results")
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+	runner := newFilterRunner(t, WithSink(massdns.NewJSONSink(&output)), func(options *Options) {
+		options.Webhook = server.URL
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, `{"hostname":"www.example.com","status":"NOERROR","ips":["10.0.0.1"]}`+"\n", output.String(), "Got unexpected json output")
+	require.Equal(t, []*Result{{Hostname: "www.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}}}, posted, "Got unexpected posted results")
+}
+
+// staticBackend resolves every hostname to the same ip
+type staticBackend string
+
+func (b staticBackend) Name() string { return "static" }
+
+func (b staticBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	for _, hostname := range strings.Fields(string(data)) {
+		if err := onRecord(&parser.Record{Domain: hostname, IPs: []string{string(b)}, Status: "NOERROR"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunnerBackend(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "hosts.txt")
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\napi.example.com\n"), 0644), "Could not write hostnames")
+
+	var results []*Result
+	runner, err := NewWithOptions(
+		WithMode(Resolve),
+		WithDomains("example.com"),
+		WithSubdomainsList(list),
+		WithStore(dir),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnResult(func(result *Result) {
+			results = append(results, result)
+		}),
+		func(options *Options) {
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.ElementsMatch(t, []*Result{
+		{Hostname: "www.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}},
+		{Hostname: "api.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}},
+	}, results, "Got unexpected results")
+}
+
+func TestRunnerWordlistError(t *testing.T) {
+	// The candidates read before the error are still resolved and written
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	require.Nil(t, os.WriteFile(first, []byte("www\n"), 0644), "Could not write wordlist")
+	second := filepath.Join(dir, "second.txt")
+	require.Nil(t, os.WriteFile(second, []byte(strings.Repeat("a", 128*1024)+"\n"), 0644), "Could not write wordlist")
+
+	var hostnames []string
+	runner, err := NewWithOptions(
+		WithMode(BruteForce),
+		WithDomains("example.com"),
+		WithWordlist(first, second),
+		WithStore(dir),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnHostname(func(hostname string) {
+			hostnames = append(hostnames, hostname)
+		}),
+		func(options *Options) {
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	err = runner.Run(context.Background())
+	require.ErrorContains(t, err, "could not read bruteforce wordlist", "Got unexpected error")
+	require.Equal(t, []string{"www.example.com"}, hostnames, "Resolved candidates not written")
+
+	entries, err := os.ReadDir(runner.tempDir)
+	require.Nil(t, err, "Could not read temporary directory")
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), "bruteforce-"), "Chunk file %s left behind", entry.Name())
+	}
+}
+
+func TestRunnerStreamDuplicates(t *testing.T) {
+	// The hostnames already read are not resolved again by the next batches
+	var resolved []string
+	runner, err := NewWithOptions(
+		WithMode(Resolve),
+		WithDomains("example.com"),
+		WithHostnames("www.example.com", "api.example.com", "www.example.com", "WWW.example.com.", "api.example.com"),
+		WithStore(t.TempDir()),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnHostname(func(hostname string) {
+			resolved = append(resolved, hostname)
+		}),
+		func(options *Options) {
+			options.Stream = true
+			options.BatchSize = 1
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Equal(t, []string{"www.example.com", "api.example.com"}, resolved, "Got unexpected results")
+}
+
+// interruptingReader interrupts the run once its data is read, blocking
+// until released
+type interruptingReader struct {
+	data    string
+	cancel  context.CancelFunc
+	release chan struct{}
+}
+
+func (r *interruptingReader) Read(p []byte) (int, error) {
+	if r.data != "" {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	r.cancel()
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestRunnerStreamInterrupted(t *testing.T) {
+	// The hostnames of the pending batch are resolved when interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &interruptingReader{data: "www.example.com\n", cancel: cancel, release: make(chan struct{})}
+	t.Cleanup(func() { close(reader.release) })
+
+	var resolved []string
+	runner, err := NewWithOptions(
+		WithMode(Resolve),
+		WithDomains("example.com"),
+		WithInput(reader),
+		WithStore(t.TempDir()),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnHostname(func(hostname string) {
+			resolved = append(resolved, hostname)
+		}),
+		func(options *Options) {
+			options.Stream = true
+			options.BatchSize = 100
+			options.BatchInterval = time.Hour
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	require.Nil(t, runner.Run(ctx), "Could not run enumeration")
+	require.Equal(t, []string{"www.example.com"}, resolved, "Got unexpected results")
+}
+
+func TestSeenCache(t *testing.T) {
+	seen := newSeenCache(2)
+	require.False(t, seen.add("a.example.com"), "Got unread hostname as seen")
+	require.False(t, seen.add("b.example.com"), "Got unread hostname as seen")
+	require.True(t, seen.add("a.example.com"), "Got read hostname as unseen")
+	require.False(t, seen.add("c.example.com"), "Got unread hostname as seen")
+	require.False(t, seen.add("b.example.com"), "Least recently read hostname was not forgotten")
+}
+
+// interruptingClient interrupts the run on the first wildcard query
+type interruptingClient struct {
+	runner *Runner
+	cancel context.CancelFunc
+}
+
+func (c interruptingClient) QueryOne(hostname string) (*retryabledns.DNSData, error) {
+	c.cancel()
+	<-c.runner.ctx.Done()
+	return nil, context.Canceled
+}
+
+func (c interruptingClient) QueryMultiple(hostname string) (*retryabledns.DNSData, error) {
+	return c.QueryOne(hostname)
+}
+
+func TestRunnerInterruptedWildcards(t *testing.T) {
+	// The hosts on the ips whose wildcard check was interrupted are left out
+	dir := t.TempDir()
+	list := filepath.Join(dir, "hosts.txt")
+	require.Nil(t, os.WriteFile(list, []byte("a.example.com\nb.example.com\nc.example.com\nd.example.com\ne.example.com\n"), 0644), "Could not write hostnames")
+
+	var hostnames []string
+	dropped := make(map[string]DropReason)
+	runner, err := NewWithOptions(
+		WithMode(Resolve),
+		WithDomains("example.com"),
+		WithSubdomainsList(list),
+		WithStore(dir),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnHostname(func(hostname string) {
+			hostnames = append(hostnames, hostname)
+		}),
+		WithOnDropped(func(hostname string, reason DropReason) {
+			dropped[hostname] = reason
+		}),
+		func(options *Options) {
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := runner.options.TrustedResolvers + "|" + strconv.Itoa(runner.options.Retries) + "|" + runner.options.Proxy
+	runner.shared.trustedClients[key] = interruptingClient{runner: runner, cancel: cancel}
+
+	require.Nil(t, runner.Run(ctx), "Could not run enumeration")
+	require.Empty(t, hostnames, "Wrote hosts whose wildcard check was interrupted")
+	require.Len(t, dropped, 5, "Got unexpected drops")
+	for hostname, reason := range dropped {
+		require.Equal(t, massdns.DropUnchecked, reason, "Got unexpected drop reason for %s", hostname)
+	}
+}
+
+func TestRunnerErrors(t *testing.T) {
+	_, err := NewWithOptions(WithMode(BruteForce), WithDomains("example.com"))
+	require.ErrorIs(t, err, ErrInvalidOptions, "Got unexpected validation error")
+	require.EqualError(t, err, "resolver file doesn't exists", "Got unexpected validation message")
+
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	require.Nil(t, os.WriteFile(empty, nil, 0644), "Could not write massdns output")
+	runner := newFilterRunner(t, func(options *Options) {
+		options.MassdnsRaw = empty
+	})
+	require.ErrorIs(t, runner.Run(context.Background()), ErrEmptyInput, "Got unexpected run error")
+}
+
+// logWriter collects the log messages
+type logWriter struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (w *logWriter) Write(data []byte, level levels.Level) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.messages = append(w.messages, string(data))
+}
+
+func TestRunnerLogger(t *testing.T) {
+	writer := &logWriter{}
+	logger := &gologger.Logger{}
+	logger.SetMaxLevel(levels.LevelInfo)
+	logger.SetFormatter(formatter.NewCLI(true))
+	logger.SetWriter(writer)
+
+	runner := newFilterRunner(t, WithLogger(logger))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.Contains(t, writer.messages, "[INF] Finished resolving.", "Progress was not logged with the logger")
+}
+
+func TestRunnerLoggerConcurrent(t *testing.T) {
+	// Each runner prints its results and tags its log lines with its own logger and phases
+	writers := []*logWriter{{}, {}}
+	var wg sync.WaitGroup
+	for _, writer := range writers {
+		logger := &gologger.Logger{}
+		logger.SetMaxLevel(levels.LevelInfo)
+		logger.SetWriter(writer)
+		runner := newFilterRunner(t, WithLogger(logger), func(options *Options) {
+			options.NoStdout = false
+			options.LogJSON = true
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+		}()
+	}
+	wg.Wait()
+
+	for _, writer := range writers {
+		var results, finished int
+		for _, message := range writer.messages {
+			switch {
+			case message == "www.example.com":
+				results++
+			case strings.Contains(message, `"msg":"Finished resolving.","phase":"output"`):
+				finished++
+			}
+		}
+		require.Equal(t, 1, results, "Got unexpected printed results")
+		require.Equal(t, 1, finished, "Log line was not tagged with the phase")
+	}
+}
+
+func TestRunnerStats(t *testing.T) {
+	runner := newFilterRunner(t, func(options *Options) {
+		options.ExcludeIPCIDRs = []string{"10.0.0.0/8"}
+	})
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+
+	stats := runner.Stats()
+	require.Equal(t, 0, stats.Found, "Got unexpected found hosts")
+	require.Equal(t, map[DropReason]int64{massdns.DropExcluded: 1}, stats.Dropped, "Got unexpected drops")
+	require.Zero(t, stats.Errors, "Got unexpected errors")
+	require.False(t, stats.Partial, "Got partial enumeration")
+	require.Contains(t, stats.Phases, massdns.PhaseOutput, "Output phase was not timed")
+	require.Positive(t, stats.Duration, "Enumeration was not timed")
+	require.Equal(t, stats.Duration, runner.Stats().Duration, "Duration changed after the run")
+}
+
+func TestRunnerReuse(t *testing.T) {
+	runner := newFilterRunner(t)
+	for i := 0; i < 2; i++ {
+		var hostnames []string
+		results, errs := runner.Results(context.Background())
+		for hostname := range results {
+			hostnames = append(hostnames, hostname)
+		}
+		require.Nil(t, <-errs, "Could not run enumeration %d", i+1)
+		require.Equal(t, []string{"www.example.com"}, hostnames, "Got unexpected results of enumeration %d", i+1)
+		require.Equal(t, 1, runner.Stats().Found, "Got stats of previous enumerations")
+	}
+
+	var wg sync.WaitGroup
+	stats := make([]RunStats, 2)
+	found := make([][]string, 2)
+	for i := range stats {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+			stats[i], err = runner.Enumerate(context.Background(), WithOnHostname(func(hostname string) {
+				found[i] = append(found[i], hostname)
+			}))
+			require.Nil(t, err, "Could not run concurrent enumeration")
+		}(i)
+	}
+	wg.Wait()
+	for i := range stats {
+		require.Equal(t, []string{"www.example.com"}, found[i], "Got unexpected results of concurrent enumeration")
+		require.Equal(t, 1, stats[i].Found, "Got unexpected stats of concurrent enumeration")
+	}
+}
+
+func TestRunnerInput(t *testing.T) {
+	var hostnames []string
+	runner, err := NewWithOptions(
+		WithMode(Resolve),
+		WithDomains("example.com"),
+		WithHostnames("www.example.com", "https://api.example.com/path"),
+		WithStore(t.TempDir()),
+		WithBackend(staticBackend("10.0.0.1")),
+		WithOnHostname(func(hostname string) {
+			hostnames = append(hostnames, hostname)
+		}),
+		func(options *Options) {
+			options.NoStdout = true
+		},
+	)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	require.ElementsMatch(t, []string{"www.example.com", "api.example.com"}, hostnames, "Got unexpected results")
+
+	_, err = NewWithOptions(WithMode(Resolve), WithSubdomainsList("hosts.txt"), WithInput(strings.NewReader("www.example.com\n")))
+	require.EqualError(t, err, "both subdomains list and input reader specified", "Accepted both subdomains list and input reader")
+}
+
+// memoryQueue is a queue of jobs, cancelling the workers once empty
+type memoryQueue struct {
+	jobs    []string
+	results []JobResult
+	acked   int
+	cancel  context.CancelFunc
+}
+
+func (q *memoryQueue) Pop(ctx context.Context) (*queue.Message, error) {
+	if len(q.jobs) == 0 {
+		q.cancel()
+		return nil, ctx.Err()
+	}
+	job := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return &queue.Message{Data: []byte(job)}, nil
+}
+
+func (q *memoryQueue) Ack(ctx context.Context, message *queue.Message) error {
+	q.acked++
+	return nil
+}
+
+func (q *memoryQueue) Requeue(ctx context.Context, message *queue.Message) error {
+	q.jobs = append(q.jobs, string(message.Data))
+	return nil
+}
+
+func (q *memoryQueue) Push(ctx context.Context, data []byte) error {
+	var result JobResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	q.results = append(q.results, result)
+	return nil
+}
+
+func (q *memoryQueue) Close() error { return nil }
+
+func TestRunnerJobs(t *testing.T) {
+	options := DefaultOptions
+	options.Directory = t.TempDir()
+	options.CustomBackend = staticBackend("10.0.0.1")
+	options.NoStdout = true
+	runner, err := New(&options)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := &memoryQueue{
+		jobs: []string{
+			`{"id":"resolve","mode":"resolve","domains":["example.com"],"hostnames":["www.example.com","api.example.com"]}`,
+			`{"id":"invalid","mode":"unknown"}`,
+		},
+		cancel: cancel,
+	}
+	require.Nil(t, runner.ServeJobs(ctx, q), "Could not serve jobs")
+	require.Equal(t, 2, q.acked, "Jobs not acknowledged")
+	require.Len(t, q.results, 2, "Got unexpected results")
+
+	require.Equal(t, "resolve", q.results[0].ID, "Got wrong job id")
+	require.Empty(t, q.results[0].Error, "Job failed")
+	require.ElementsMatch(t, []*Result{
+		{Hostname: "www.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}},
+		{Hostname: "api.example.com", Status: "NOERROR", IPs: []string{"10.0.0.1"}},
+	}, q.results[0].Results, "Got unexpected hosts")
+	require.Equal(t, 2, q.results[0].Stats.Found, "Got unexpected stats")
+
+	require.Equal(t, "invalid", q.results[1].ID, "Got wrong job id")
+	require.NotEmpty(t, q.results[1].Error, "Invalid job succeeded")
+}
+
+func TestRunnerAgent(t *testing.T) {
+	options := DefaultOptions
+	options.Directory = t.TempDir()
+	options.CustomBackend = staticBackend("10.0.0.1")
+	options.NoStdout = true
+	runner, err := New(&options)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		authorization string
+		messages      []AgentMessage
+	)
+	controller := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		authorization = conn.Request().Header.Get("Authorization")
+		job := `{"id":"resolve","mode":"resolve","domains":["example.com"],"hostnames":["www.example.com","api.example.com"]}`
+		require.Nil(t, websocket.Message.Send(conn, job), "Could not send job")
+		for {
+			var message AgentMessage
+			if err := websocket.JSON.Receive(conn, &message); err != nil {
+				return
+			}
+			messages = append(messages, message)
+			if message.Type == AgentDone {
+				cancel()
+				return
+			}
+		}
+	}))
+	defer controller.Close()
+
+	config, err := agentConfig("ws"+strings.TrimPrefix(controller.URL, "http"), "s3cret")
+	require.Nil(t, err, "Could not create agent config")
+	require.Nil(t, runner.serveAgent(ctx, config), "Could not serve agent")
+	require.Equal(t, "Bearer s3cret", authorization, "Got unexpected authorization")
+
+	var found []string
+	for _, message := range messages {
+		require.Equal(t, "resolve", message.ID, "Got wrong job id")
+		if message.Type == AgentResult {
+			found = append(found, message.Result.Hostname)
+		}
+	}
+	require.ElementsMatch(t, []string{"www.example.com", "api.example.com"}, found, "Got unexpected hosts")
+	done := messages[len(messages)-1]
+	require.Equal(t, AgentDone, done.Type, "Job not done")
+	require.Empty(t, done.Error, "Job failed")
+	require.Equal(t, 2, done.Stats.Found, "Got unexpected stats")
+}
+
+// changesSink collects the changes written by the recurring scans
+type changesSink struct {
+	lines []string
+}
+
+func (s *changesSink) Write(result *Result, line string) error {
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func (s *changesSink) Flush() error { return nil }
+
+func (s *changesSink) Close() error { return nil }
+
+func TestRunnerScheduledScans(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions
+	options.Directory = dir
+	options.CustomBackend = staticBackend("10.0.0.1")
+	options.NoStdout = true
+	runner, err := New(&options)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	list := filepath.Join(dir, "hosts.txt")
+	target := &scheduledTarget{Name: "example", Mode: string(Resolve), Domains: []string{"example.com"}, List: list}
+	sink := &changesSink{}
+
+	// The first scan records every host as new
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\napi.example.com\n"), 0644), "Could not write list")
+	require.Nil(t, runner.scanTarget(context.Background(), dir, target, []OutputSink{sink}), "Could not scan target")
+	require.Equal(t, []string{"[new] api.example.com\n", "[new] www.example.com\n"}, sink.lines, "Got unexpected changes of the first scan")
+
+	sink.lines = nil
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\ndev.example.com\n"), 0644), "Could not write list")
+	require.Nil(t, runner.scanTarget(context.Background(), dir, target, []OutputSink{sink}), "Could not scan target")
+	require.Equal(t, []string{"[removed] api.example.com\n", "[new] dev.example.com\n"}, sink.lines, "Got unexpected changes")
+
+	sink.lines = nil
+	require.Nil(t, runner.scanTarget(context.Background(), dir, target, []OutputSink{sink}), "Could not scan target")
+	require.Empty(t, sink.lines, "Got changes of an unchanged target")
+}
+
+func TestRunnerProject(t *testing.T) {
+	dir := t.TempDir()
+	projects := defaultProjectsLocation
+	defaultProjectsLocation = filepath.Join(dir, "projects")
+	defer func() { defaultProjectsLocation = projects }()
+
+	list := filepath.Join(dir, "hosts.txt")
+	options := DefaultOptions
+	options.Directory = dir
+	options.Mode = string(Resolve)
+	options.Domains = []string{"example.com"}
+	options.SubdomainsList = list
+	options.CustomBackend = staticBackend("10.0.0.1")
+	options.NoStdout = true
+	options.Project = "example"
+	runner, err := New(&options)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+
+	project := filepath.Join(defaultProjectsLocation, "example")
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\napi.example.com\n"), 0644), "Could not write list")
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	results, err := loadTargetState(filepath.Join(project, projectResultsName))
+	require.Nil(t, err, "Could not read project results")
+	require.Len(t, results, 2, "Got unexpected project results")
+	require.NoDirExists(t, filepath.Join(project, projectRunDirName), "Run state kept after a complete run")
+
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\ndev.example.com\n"), 0644), "Could not write list")
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+	files, err := filepath.Glob(filepath.Join(project, projectChangesDirName, "*.json"))
+	require.Nil(t, err, "Could not list changes")
+	require.Len(t, files, 1, "Got unexpected changes files")
+	data, err := os.ReadFile(files[0])
+	require.Nil(t, err, "Could not read changes")
+	var changes []*Result
+	require.Nil(t, json.Unmarshal(data, &changes), "Could not decode changes")
+	require.Len(t, changes, 2, "Got unexpected changes")
+	require.Equal(t, "api.example.com", changes[0].Hostname, "Got unexpected removed host")
+	require.Equal(t, ChangeRemoved, changes[0].Change, "Got unexpected change")
+	require.Equal(t, "dev.example.com", changes[1].Hostname, "Got unexpected new host")
+	require.Equal(t, ChangeNew, changes[1].Change, "Got unexpected change")
+}
+
+// memoryObjects is an object storage of the memory
+type memoryObjects struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memoryObjects) Put(ctx context.Context, key, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memoryObjects) Get(ctx context.Context, key, file string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return objectstore.ErrNotFound
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func (m *memoryObjects) List(ctx context.Context) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var keys []string
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// failingBackend fails every resolution
+type failingBackend struct{}
+
+func (failingBackend) Name() string { return "failing" }
+
+func (failingBackend) Resolve(ctx context.Context, inputFile string, onRecord parser.OnRecordFN) error {
+	return errors.New("resolution failed")
+}
+
+func TestRunnerCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "hosts.txt")
+	require.Nil(t, os.WriteFile(list, []byte("www.example.com\napi.example.com\n"), 0644), "Could not write list")
+	store := &memoryObjects{objects: make(map[string][]byte)}
+
+	run := func(backend massdns.Backend) []string {
+		var (
+			mutex     sync.Mutex
+			hostnames []string
+		)
+		runner, err := NewWithOptions(
+			WithMode(Resolve),
+			WithDomains("example.com"),
+			WithSubdomainsList(list),
+			WithStore(dir),
+			WithBackend(backend),
+			func(options *Options) {
+				options.NoStdout = true
+				options.OnHostname = func(hostname string) {
+					mutex.Lock()
+					hostnames = append(hostnames, hostname)
+					mutex.Unlock()
+				}
+			},
+		)
+		require.Nil(t, err, "Could not create runner")
+		defer runner.Close()
+		runner.checkpoint = &checkpointer{store: store, dir: filepath.Join(runner.tempDir, "checkpoint"), uploaded: make(map[string]fileVersion)}
+		require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+		return hostnames
+	}
+
+	require.ElementsMatch(t, []string{"www.example.com", "api.example.com"}, run(staticBackend("10.0.0.1")), "Got unexpected hostnames")
+	keys, err := store.List(context.Background())
+	require.Nil(t, err, "Could not list checkpoint")
+	require.NotEmpty(t, keys, "Run state not checkpointed")
+
+	// Another instance resumes from the checkpoint without resolving again
+	require.ElementsMatch(t, []string{"www.example.com", "api.example.com"}, run(failingBackend{}), "Got unexpected resumed hostnames")
+}
+
+func TestRunnerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	runner := newFilterRunner(t, WithTracerProvider(provider))
+	require.Nil(t, runner.Run(context.Background()), "Could not run enumeration")
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "shuffledns.run", "Run not traced")
+	require.Contains(t, spans, "shuffledns.parse", "Parse phase not traced")
+	require.Contains(t, spans, "shuffledns.output", "Output phase not traced")
+	require.Equal(t, spans["shuffledns.run"].SpanContext().SpanID(), spans["shuffledns.output"].Parent().SpanID(), "Phase not a child of the run")
+}
+
+func TestPprof(t *testing.T) {
+	address, err := servePprof("127.0.0.1:0", gologger.DefaultLogger)
+	require.Nil(t, err, "Could not serve pprof")
+
+	resp, err := http.Get("http://" + address.String() + "/debug/pprof/heap?debug=1")
+	require.Nil(t, err, "Could not get heap profile")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "Got unexpected status")
+
+	resp, err = http.Get("http://" + address.String() + "/debug/pprof/cmdline")
+	require.Nil(t, err, "Could not get command line")
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode, "Served the command line")
+
+	require.Equal(t, "127.0.0.1:6060", localAddress(":6060"), "Bare port not bound to loopback")
+	require.Equal(t, "0.0.0.0:6060", localAddress("0.0.0.0:6060"), "Explicit host replaced")
+}
+
+func TestDashboard(t *testing.T) {
+	dashboard, address, err := serveDashboard("127.0.0.1:0", "", gologger.DefaultLogger)
+	require.Nil(t, err, "Could not serve dashboard")
+
+	options := DefaultOptions
+	options.Directory = t.TempDir()
+	options.CustomBackend = staticBackend("10.0.0.1")
+	options.NoStdout = true
+	runner, err := New(&options)
+	require.Nil(t, err, "Could not create runner")
+	defer runner.Close()
+	runner.dashboard = dashboard
+
+	runner.runJob(context.Background(), []byte(`{"id":"nightly","mode":"resolve","domains":["example.com"],"hostnames":["www.example.com"]}`))
+
+	get := func(path string) string {
+		resp, err := http.Get("http://" + address.String() + path)
+		require.Nil(t, err, "Could not get %s", path)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, "Got unexpected status of %s", path)
+		var body bytes.Buffer
+		_, err = body.ReadFrom(resp.Body)
+		require.Nil(t, err, "Could not read %s", path)
+		return body.String()
+	}
+	require.Contains(t, get("/"), "nightly", "Job not listed")
+
+	var state dashboardState
+	require.Nil(t, json.Unmarshal([]byte(get("/api/jobs")), &state), "Could not decode jobs")
+	require.Len(t, state.Jobs, 1, "Got unexpected jobs")
+	require.Equal(t, jobDone, state.Jobs[0].Status, "Job not done")
+	require.Equal(t, 1, state.Jobs[0].Found, "Got unexpected found count")
+	require.Equal(t, "www.example.com\n", get("/jobs/1/results.txt"), "Got unexpected results")
+}
+
+func TestDashboardToken(t *testing.T) {
+	_, _, err := serveDashboard("0.0.0.0:0", "", gologger.DefaultLogger)
+	require.NotNil(t, err, "Served the dashboard off loopback without token")
+
+	_, address, err := serveDashboard("127.0.0.1:0", "s3cret", gologger.DefaultLogger)
+	require.Nil(t, err, "Could not serve dashboard")
+
+	status := func(path string, authorize func(req *http.Request)) int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+address.String()+path, nil)
+		require.Nil(t, err, "Could not create request")
+		authorize(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err, "Could not get %s", path)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, path := range []string{"/", "/api/jobs", "/jobs/1/results.json"} {
+		require.Equal(t, http.StatusUnauthorized, status(path, func(req *http.Request) {}), "Served %s without credentials", path)
+		require.Equal(t, http.StatusUnauthorized, status(path, func(req *http.Request) { req.Header.Set("Authorization", "Bearer wrong") }), "Served %s with a wrong token", path)
+	}
+	require.Equal(t, http.StatusOK, status("/api/jobs", func(req *http.Request) { req.Header.Set("Authorization", "Bearer s3cret") }), "Refused the bearer token")
+	require.Equal(t, http.StatusOK, status("/api/jobs", func(req *http.Request) { req.SetBasicAuth("admin", "s3cret") }), "Refused the basic auth")
+}
+
+// bufferWriter is a log writer of a buffer
+type bufferWriter struct{ buffer *bytes.Buffer }
+
+func (w bufferWriter) Write(data []byte, level levels.Level) {
+	w.buffer.Write(data)
+	w.buffer.WriteString("\n")
+}
+
+func TestProgressBar(t *testing.T) {
+	var output bytes.Buffer
+	bar := newProgressBar(&output)
+	bar.qps = 100
+	bar.update(Progress{Phase: massdns.PhaseMassdns, Candidates: 2000, Queries: 1000})
+	require.Equal(t, "\r\033[Kmassdns   [##########----------]  50% 1.0k/2.0k | 100 qps | ETA 10s", output.String(), "Got unexpected bar")
+
+	// The log lines are written above the bar
+	output.Reset()
+	bar.writer(bufferWriter{buffer: &output}).Write([]byte("found"), levels.LevelInfo)
+	require.Equal(t, "\r\033[Kfound\n\r\033[Kmassdns   [##########----------]  50% 1.0k/2.0k | 100 qps | ETA 10s", output.String(), "Got unexpected log line")
+
+	output.Reset()
+	bar.clear()
+	require.Equal(t, "\r\033[K", output.String(), "Bar not cleared")
+}
+
+func TestFetchChaos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		require.Equal(t, "/dns/example.com/subdomains", r.URL.Path, "Got unexpected path")
+		_, _ = w.Write([]byte(`{"domain":"example.com","subdomains":["www","api.dev","*"],"count":3}`))
+	}))
+	defer server.Close()
+
+	endpoint := chaosEndpoint
+	chaosEndpoint = server.URL + "/dns/%s/subdomains"
+	defer func() { chaosEndpoint = endpoint }()
+
+	hostnames, err := fetchChaos(context.Background(), server.Client(), "secret", "example.com")
+	require.Nil(t, err, "Could not fetch chaos subdomains")
+	require.Equal(t, []string{"www.example.com", "api.dev.example.com"}, hostnames, "Could not get hostnames")
+
+	_, err = fetchChaos(context.Background(), server.Client(), "wrong", "example.com")
+	require.NotNil(t, err, "Could not get unauthorized error")
+}
+
+func TestFetchCT(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "%.example.com", r.URL.Query().Get("q"), "Got unexpected query")
+		_, _ = w.Write([]byte(`[{"common_name":"example.com","name_value":"example.com\nwww.example.com"},{"common_name":"*.dev.example.com","name_value":"*.dev.example.com\nexample.org"}]`))
+	}))
+	defer server.Close()
+
+	hostnames, err := fetchCT(context.Background(), server.Client(), server.URL+"/?q=%25.{domain}&output=json", "example.com")
+	require.Nil(t, err, "Could not search certificates")
+	require.ElementsMatch(t, []string{"example.com", "www.example.com", "dev.example.com"}, hostnames, "Could not get hostnames")
+}
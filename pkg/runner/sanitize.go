@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// sanitizeHostname normalizes an input line to a bare lowercase hostname,
+// stripping the url scheme, credentials, port, path, wildcard prefix
+// and trailing dots.
+func sanitizeHostname(line string) string {
+	host := strings.TrimSpace(line)
+	if index := strings.Index(host, "://"); index != -1 {
+		host = host[index+3:]
+	}
+	if index := strings.IndexAny(host, "/?#"); index != -1 {
+		host = host[:index]
+	}
+	if index := strings.LastIndex(host, "@"); index != -1 {
+		host = host[index+1:]
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.TrimPrefix(host, "*.")
+	host = strings.Trim(host, ".")
+	// RFC4343 - case insensitive domain
+	return strings.ToLower(host)
+}
+
+// sanitizeDomains normalizes the target domains in place
+func (options *Options) sanitizeDomains() {
+	domains := options.Domains[:0]
+	for _, domain := range options.Domains {
+		if domain = sanitizeHostname(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	options.Domains = domains
+}
+
+// sanitizeList writes the sanitized hostnames read from the reader to a
+// temporary file and returns its path along with the number of changed lines.
+func (r *Runner) sanitizeList(reader io.Reader) (string, int, error) {
+	file, err := os.CreateTemp(r.tempDir, "massdns-input-")
+	if err != nil {
+		return "", 0, fmt.Errorf("could not create resolution list (%s): %w", r.tempDir, err)
+	}
+	defer file.Close()
+	writer := r.newCandidateWriter(file)
+
+	var changed int
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hostname := sanitizeHostname(line)
+		if hostname != line {
+			changed++
+		}
+		if hostname == "" {
+			continue
+		}
+		writer.Write(hostname)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, fmt.Errorf("could not read resolution list: %w", err)
+	}
+	return file.Name(), changed, writer.Flush()
+}
@@ -0,0 +1,343 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/ShlomieLiberow/shuffledns/pkg/schedule"
+	folderutil "github.com/projectdiscovery/utils/folder"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultScheduleState is the directory keeping the results of the
+// scheduled targets when the schedule file gives none
+var defaultScheduleState = filepath.Join(folderutil.AppConfigDirOrDefault(".", "shuffledns"), "schedule")
+
+// Changes of the hosts written by the recurring scans
+const (
+	// ChangeNew is a host found since the previous scan
+	ChangeNew = "new"
+	// ChangeRemoved is a host of the previous scan not found anymore
+	ChangeRemoved = "removed"
+)
+
+// scheduleConfig is the file of the targets scanned by -schedule
+type scheduleConfig struct {
+	State   string             `yaml:"state"`
+	Targets []*scheduledTarget `yaml:"targets"`
+}
+
+// scheduledTarget is a target scanned on a schedule
+type scheduledTarget struct {
+	Name      string   `yaml:"name"`
+	Schedule  string   `yaml:"schedule"`
+	Mode      string   `yaml:"mode"`
+	Domains   []string `yaml:"domains"`
+	Wordlist  []string `yaml:"wordlist"`
+	List      string   `yaml:"list"`
+	Resolvers string   `yaml:"resolvers"`
+
+	schedule schedule.Schedule
+	// next is the time of the next scan, zero if never
+	next time.Time
+}
+
+// loadSchedule reads the targets of the schedule file
+func loadSchedule(file string) (*scheduleConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config scheduleConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse schedule: %w", err)
+	}
+	if len(config.Targets) == 0 {
+		return nil, errors.New("no targets scheduled")
+	}
+
+	names := make(map[string]struct{}, len(config.Targets))
+	for _, target := range config.Targets {
+		if !validName(target.Name) {
+			return nil, fmt.Errorf("invalid target name %q", target.Name)
+		}
+		if _, ok := names[target.Name]; ok {
+			return nil, fmt.Errorf("target %s scheduled twice", target.Name)
+		}
+		names[target.Name] = struct{}{}
+
+		if target.schedule, err = schedule.Parse(target.Schedule); err != nil {
+			return nil, fmt.Errorf("could not parse schedule of %s: %w", target.Name, err)
+		}
+	}
+	return &config, nil
+}
+
+// serveSchedule scans the targets of the schedule file on their schedule
+// until interrupted, writing the hosts new or removed since the previous
+// scans to the output, the webhook and the sinks
+func serveSchedule(options *Options) error {
+	config, err := loadSchedule(options.Schedule)
+	if err != nil {
+		return err
+	}
+	// The results are kept in the project, if any
+	if config.State == "" {
+		if config.State = defaultScheduleState; options.Project != "" {
+			config.State = filepath.Join(options.projectDir(), projectScheduleDirName)
+		}
+	}
+	if err := os.MkdirAll(config.State, 0755); err != nil {
+		return fmt.Errorf("could not create state directory: %w", err)
+	}
+
+	sinks := slices.Clone(options.Sinks)
+	if options.Output == "-" {
+		sinks = append(sinks, massdns.NewWriterSink(os.Stdout))
+	} else {
+		if options.Output != "" {
+			sink, err := massdns.NewFileSinkSize(options.Output, true, options.OutputBufferSize)
+			if err != nil {
+				return fmt.Errorf("could not create output file: %w", err)
+			}
+			sinks = append(sinks, sink)
+		}
+		if !options.NoStdout {
+			sinks = append(sinks, massdns.NewStdoutSink(options.logger()))
+		}
+	}
+	if options.Webhook != "" {
+		sinks = append(sinks, massdns.NewWebhookSink(options.Webhook))
+	}
+	defer func() {
+		for _, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				options.logger().Error().Msgf("Could not write changes: %s\n", err)
+			}
+		}
+	}()
+
+	// The scans only collect their results, the changes being written
+	scanOptions := *options
+	scanOptions.Output, scanOptions.Webhook, scanOptions.Sinks = "", "", nil
+	scanOptions.NoStdout = true
+	runner, err := New(&scanOptions)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	if options.Dashboard != "" {
+		if runner.dashboard, _, err = serveDashboard(options.Dashboard, options.DashboardToken, runner.logger); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runner.serveSchedule(ctx, config, sinks)
+}
+
+// serveSchedule scans the targets when they are due until ctx is done.
+// The targets never scanned are scanned right away to record their results.
+func (r *Runner) serveSchedule(ctx context.Context, config *scheduleConfig, sinks []OutputSink) error {
+	now := time.Now()
+	for _, target := range config.Targets {
+		if _, err := os.Stat(targetStatePath(config.State, target)); err == nil {
+			target.next = target.schedule.Next(now)
+		} else {
+			target.next = now
+		}
+		r.dashboard.schedule(target.Name, target.next)
+	}
+
+	for {
+		var next time.Time
+		for _, target := range config.Targets {
+			if !target.next.IsZero() && (next.IsZero() || target.next.Before(next)) {
+				next = target.next
+			}
+		}
+		if next.IsZero() {
+			return errors.New("no target is ever due")
+		}
+
+		r.logger.Info().Msgf("Next scan at %s\n", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		for _, target := range config.Targets {
+			if target.next.IsZero() || target.next.After(time.Now()) {
+				continue
+			}
+			if err := r.scanTarget(ctx, config.State, target, sinks); err != nil {
+				r.logError("Could not scan %s: %s\n", target.Name, err)
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			target.next = target.schedule.Next(time.Now())
+			r.dashboard.schedule(target.Name, target.next)
+		}
+	}
+}
+
+// scanTarget scans the target, writing the hosts new or removed since
+// its previous scan to the sinks. The results of the partial scans are
+// left out, not to report the hosts they missed as removed.
+func (r *Runner) scanTarget(ctx context.Context, stateDir string, target *scheduledTarget, sinks []OutputSink) error {
+	var mutex sync.Mutex
+	current := make(map[string]*Result)
+	r.logger.Info().Msgf("Scanning %s\n", target.Name)
+	job := r.dashboard.start(target.Name)
+	stats, err := r.Enumerate(ctx,
+		WithMode(Mode(target.Mode)),
+		r.dashboard.track(job),
+		WithOnResult(func(result *Result) {
+			mutex.Lock()
+			current[result.Hostname] = result
+			mutex.Unlock()
+		}),
+		func(options *Options) {
+			options.Domains, options.Wordlist = target.Domains, target.Wordlist
+			if target.List != "" {
+				options.SubdomainsList = target.List
+			}
+			if target.Resolvers != "" {
+				options.ResolversFile = target.Resolvers
+			}
+		},
+	)
+	r.dashboard.finish(job, sortedResults(current), err)
+	if err != nil {
+		return err
+	}
+	if stats.Partial {
+		r.logger.Info().Msgf("Scan of %s is partial, keeping the previous results\n", target.Name)
+		return nil
+	}
+
+	statePath := targetStatePath(stateDir, target)
+	previous, err := loadTargetState(statePath)
+	if err != nil {
+		return err
+	}
+	changes := diffResults(previous, current)
+	for _, change := range changes {
+		line := fmt.Sprintf("[%s] %s\n", change.Change, change.Hostname)
+		if r.options.Json {
+			data, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+			line = string(data) + "\n"
+		}
+		for _, sink := range sinks {
+			if err := sink.Write(change, line); err != nil {
+				r.logError("Could not write changes: %s\n", err)
+			}
+		}
+	}
+	for _, sink := range sinks {
+		if err := sink.Flush(); err != nil {
+			r.logError("Could not write changes: %s\n", err)
+		}
+	}
+	r.logger.Info().Msgf("Scanned %s: %d hosts, %d changes\n", target.Name, len(current), len(changes))
+	return saveTargetState(statePath, current)
+}
+
+// diffResults returns the hosts new and removed, sorted by hostname
+func diffResults(previous, current map[string]*Result) []*Result {
+	var changes []*Result
+	for hostname, result := range current {
+		if _, ok := previous[hostname]; !ok {
+			change := *result
+			change.Change = ChangeNew
+			changes = append(changes, &change)
+		}
+	}
+	for hostname, result := range previous {
+		if _, ok := current[hostname]; !ok {
+			change := *result
+			change.Change = ChangeRemoved
+			changes = append(changes, &change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Hostname < changes[j].Hostname
+	})
+	return changes
+}
+
+// sortedResults returns the results sorted by hostname
+func sortedResults(results map[string]*Result) []*Result {
+	sorted := make([]*Result, 0, len(results))
+	for _, result := range results {
+		sorted = append(sorted, result)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Hostname < sorted[j].Hostname
+	})
+	return sorted
+}
+
+// targetStatePath is the file keeping the results of the previous scan of the target
+func targetStatePath(stateDir string, target *scheduledTarget) string {
+	return filepath.Join(stateDir, target.Name+".json")
+}
+
+// loadTargetState reads the results of the previous scan, none if never scanned
+func loadTargetState(path string) (map[string]*Result, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read previous results: %w", err)
+	}
+	var results []*Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("could not read previous results: %w", err)
+	}
+	state := make(map[string]*Result, len(results))
+	for _, result := range results {
+		state[result.Hostname] = result
+	}
+	return state, nil
+}
+
+// saveTargetState replaces the results of the previous scan
+func saveTargetState(path string, state map[string]*Result) error {
+	return saveResults(path, sortedResults(state))
+}
+
+// saveResults replaces the file with the results as a json array
+func saveResults(path string, results []*Result) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("could not save results: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("could not save results: %w", err)
+	}
+	return nil
+}
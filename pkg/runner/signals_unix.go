@@ -0,0 +1,36 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySignals handles the signals received during the run without
+// interrupting it: SIGUSR1 prints a snapshot of the progress and
+// SIGHUP reloads the resolvers before the next chunk.
+func (r *Runner) notifySignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR1:
+					r.logger.Info().Msgf("%s\n", r.stats())
+				case syscall.SIGHUP:
+					r.logger.Info().Msgf("Resolvers will be reloaded before the next chunk\n")
+					r.shared.reloadSignal.Request()
+				}
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package runner
+
+// notifySignals is a no-op since SIGUSR1 and SIGHUP do not exist on windows
+func (r *Runner) notifySignals() {}
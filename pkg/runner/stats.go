@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+)
+
+// RunStats are the statistics of the enumeration, returned by Stats
+type RunStats struct {
+	// Started is the time the enumeration started
+	Started time.Time
+	// Duration is the time taken by Run, or elapsed so far if it is running
+	Duration time.Duration
+	// Phases is the time spent in every pipeline phase
+	Phases map[massdns.Phase]time.Duration
+	// Candidates is the number of candidates generated
+	Candidates int64
+	// Queries is the number of dns queries let through the rate limiter
+	Queries uint64
+	// Parsed is the number of hosts parsed from the massdns output
+	Parsed int64
+	// WildcardChecks is the number of hostnames checked for wildcards
+	WildcardChecks int64
+	// Found is the number of hostnames written to the output
+	Found int
+	// Dropped is the number of hosts left out of the output by reason
+	Dropped map[DropReason]int64
+	// Errors is the number of errors of the enumeration, logged or returned by Run
+	Errors int64
+	// Partial is set when the enumeration was interrupted, skipped or reached the deadline
+	Partial bool
+}
+
+// runStats collects the statistics of the enumeration which are not
+// kept by the progress counters
+type runStats struct {
+	mutex    sync.Mutex
+	finished time.Time
+	errors   int64
+	dropped  map[DropReason]int64
+
+	// phase is the phase being executed since phaseStart
+	phase      massdns.Phase
+	phaseStart time.Time
+	phases     map[massdns.Phase]time.Duration
+}
+
+// Stats returns the statistics of the enumeration, to be recorded as
+// metrics once Run returns
+func (r *Runner) Stats() RunStats {
+	progress := r.progress()
+
+	r.runStats.mutex.Lock()
+	defer r.runStats.mutex.Unlock()
+
+	stats := RunStats{
+		Started:        r.start,
+		Duration:       progress.Elapsed,
+		Phases:         make(map[massdns.Phase]time.Duration, len(r.runStats.phases)+1),
+		Candidates:     progress.Candidates,
+		Queries:        progress.Queries,
+		Parsed:         progress.Parsed,
+		WildcardChecks: progress.WildcardChecks,
+		Found:          progress.Found,
+		Dropped:        make(map[DropReason]int64, len(r.runStats.dropped)),
+		Errors:         r.runStats.errors,
+		Partial:        context.Cause(r.ctx) != nil,
+	}
+	if !r.runStats.finished.IsZero() {
+		stats.Duration = r.runStats.finished.Sub(r.start)
+	}
+	for phase, took := range r.runStats.phases {
+		stats.Phases[phase] = took
+	}
+	if r.runStats.phase != "" && r.runStats.finished.IsZero() {
+		stats.Phases[r.runStats.phase] += time.Since(r.runStats.phaseStart)
+	}
+	for reason, dropped := range r.runStats.dropped {
+		stats.Dropped[reason] = dropped
+	}
+	return stats
+}
+
+// trackStats times the phases of the enumeration until the returned
+// function is called with the error of the run
+func (r *Runner) trackStats() (stop func(err error)) {
+	stats := &r.runStats
+	switchPhase := func(phase massdns.Phase) {
+		stats.mutex.Lock()
+		defer stats.mutex.Unlock()
+
+		now := time.Now()
+		if stats.phase != "" {
+			stats.phases[stats.phase] += now.Sub(stats.phaseStart)
+		}
+		stats.phase, stats.phaseStart = phase, now
+	}
+
+	stats.mutex.Lock()
+	stats.phases = make(map[massdns.Phase]time.Duration)
+	stats.phase = ""
+	stats.mutex.Unlock()
+	stopWatching := r.phases.Watch(switchPhase)
+
+	return func(err error) {
+		stopWatching()
+		switchPhase("")
+		if err != nil {
+			r.countError()
+		}
+
+		stats.mutex.Lock()
+		stats.finished = time.Now()
+		stats.mutex.Unlock()
+	}
+}
+
+// countError counts an error of the enumeration in the statistics
+func (r *Runner) countError() {
+	r.runStats.mutex.Lock()
+	r.runStats.errors++
+	r.runStats.mutex.Unlock()
+}
+
+// logError logs an error of the enumeration, counting it in the statistics
+func (r *Runner) logError(format string, args ...interface{}) {
+	r.countError()
+	r.logger.Error().Msgf(format, args...)
+}
+
+// onDropped counts the hosts left out of the output and passes them on
+// to the OnDropped callback of the options, one call at a time
+func (r *Runner) onDropped(hostname string, reason DropReason) {
+	r.runStats.mutex.Lock()
+	if r.runStats.dropped == nil {
+		r.runStats.dropped = make(map[DropReason]int64)
+	}
+	r.runStats.dropped[reason]++
+	r.runStats.mutex.Unlock()
+
+	if r.options.OnDropped != nil {
+		r.droppedMutex.Lock()
+		r.options.OnDropped(hostname, reason)
+		r.droppedMutex.Unlock()
+	}
+}
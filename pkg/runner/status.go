@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"sync"
+	"time"
+)
+
+// logStatus logs a status line of the progress every status interval
+// until the returned function is called, for the logs of the runs
+// without a terminal to draw the progress bar on
+func (r *Runner) logStatus() (stop func()) {
+	var (
+		mutex   sync.Mutex
+		logged  time.Time
+		queries uint64
+	)
+	onProgress := r.options.OnProgress
+	r.options.OnProgress = func(progress Progress) {
+		if onProgress != nil {
+			onProgress(progress)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		now := time.Now()
+		if logged.IsZero() {
+			// The first line is logged after an interval
+			logged = now
+			return
+		}
+		elapsed := now.Sub(logged)
+		if elapsed < r.options.StatusInterval {
+			return
+		}
+		var qps uint64
+		if progress.Queries >= queries {
+			qps = uint64(float64(progress.Queries-queries) / elapsed.Seconds())
+		}
+		logged, queries = now, progress.Queries
+
+		state := ""
+		if progress.Paused {
+			state = " (paused)"
+		}
+		r.logger.Info().Msgf("Status: phase %s%s, processed %d/%d, resolved %d, dropped %d, %d qps, elapsed %s\n",
+			progress.Phase, state, progress.Queries, progress.Candidates, progress.Parsed, progress.WildcardDrops, qps, progress.Elapsed.Round(time.Second))
+	}
+	return func() {
+		r.options.OnProgress = onProgress
+	}
+}
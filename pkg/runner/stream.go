@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// streamSeenSize bounds the number of hostnames remembered by the stream
+// to skip the duplicates, the least recently read ones being forgotten first
+const streamSeenSize = 1000000
+
+// processStream resolves the hostnames read continuously from stdin.
+// Hostnames are grouped in batches which are flushed either when full
+// or when the batch interval elapses, so that results keep flowing
+// even on slow pipelines. The wildcard state is shared across batches,
+// and the hostnames recently read are skipped by the next batches.
+func (r *Runner) processStream() error {
+	massdns, err := r.newMassdns("")
+	if err != nil {
+		return fmt.Errorf("could not create massdns client: %w", err)
+	}
+
+	// invalid and duplicates are only read once lines has been closed
+	var invalid, duplicates int
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		seen := newSeenCache(streamSeenSize)
+		scanner := bufio.NewScanner(r.input())
+		for scanner.Scan() {
+			text := sanitizeHostname(scanner.Text())
+			if text == "" {
+				continue
+			}
+			if !isValidHostname(text) {
+				r.logger.Debug().Msgf("Skipping invalid hostname %s\n", text)
+				invalid++
+				continue
+			}
+			if seen.add(text) {
+				duplicates++
+				continue
+			}
+			select {
+			case lines <- text:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			r.logError("Could not read stdin: %s\n", err)
+		}
+	}()
+
+	batch := make([]string, 0, r.options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		defer func() { batch = batch[:0] }()
+
+		file, err := os.CreateTemp(r.tempDir, "massdns-batch-")
+		if err != nil {
+			r.logError("Could not create batch list (%s): %s\n", r.tempDir, err)
+			return
+		}
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString(strings.Join(batch, "\n") + "\n")
+		file.Close()
+		if err != nil {
+			r.logError("Could not write batch list (%s): %s\n", file.Name(), err)
+			return
+		}
+
+		r.logger.Info().Msgf("Resolving batch of %d hostnames\n", len(batch))
+		if err := massdns.RunBatch(r.ctx, file.Name()); err != nil {
+			r.logError("Could not run massdns: %s\n", err)
+		}
+	}
+
+	finish := func() {
+		if r.options.WildcardOutputFile != "" {
+			_ = massdns.DumpWildcardsToFile(r.options.WildcardOutputFile)
+		}
+		if r.options.ReservedOutput != "" {
+			if err := massdns.DumpReservedToFile(r.options.ReservedOutput); err != nil {
+				r.logError("Could not write the reserved hosts: %s\n", err)
+			}
+		}
+		if r.options.CNAMEReport != "" {
+			if err := massdns.DumpCNAMEReportToFile(r.options.CNAMEReport); err != nil {
+				r.logError("Could not write the cname report: %s\n", err)
+			}
+		}
+		if r.options.LabelReport != "" {
+			r.writeLabelReport()
+		}
+		r.warnPartial()
+		r.logger.Info().Msgf("Finished resolving.\n")
+	}
+
+	ticker := time.NewTicker(r.options.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				if invalid > 0 {
+					r.logger.Info().Msgf("Skipped %d invalid hostnames\n", invalid)
+				}
+				if duplicates > 0 {
+					r.logger.Info().Msgf("Skipped %d duplicate hostnames\n", duplicates)
+				}
+				finish()
+				return nil
+			}
+			batch = append(batch, line)
+			if len(batch) >= r.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.ctx.Done():
+			// The pending batch runs as interrupted, keeping its partial results
+			flush()
+			finish()
+			return nil
+		}
+	}
+}
+
+// seenCache remembers the most recently read hostnames up to a size
+type seenCache struct {
+	size     int
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// newSeenCache creates an empty cache of the size
+func newSeenCache(size int) *seenCache {
+	return &seenCache{size: size, order: list.New(), elements: make(map[string]*list.Element)}
+}
+
+// add remembers the hostname, forgetting the least recently read one
+// once full, and returns true if it was already remembered
+func (c *seenCache) add(hostname string) bool {
+	if element, ok := c.elements[hostname]; ok {
+		c.order.MoveToFront(element)
+		return true
+	}
+	c.elements[hostname] = c.order.PushFront(hostname)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.elements, oldest.Value.(string))
+	}
+	return false
+}
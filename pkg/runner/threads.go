@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/projectdiscovery/goflags"
+)
+
+const (
+	// threadsPerResolver is the number of massdns queries kept in flight per resolver
+	threadsPerResolver = 10
+	// minThreads and maxThreads bound the auto-tuned massdns concurrency
+	minThreads, maxThreads = 100, 20000
+	// wildcardThreadsPerResolver is the number of wildcard checks per resolver
+	wildcardThreadsPerResolver = 2
+	// minWildcardThreads and maxWildcardThreads bound the auto-tuned wildcard checks
+	minWildcardThreads, maxWildcardThreads = 10, 500
+	// socketsPerWildcardThread is the share of the open files limit a wildcard check may use
+	socketsPerWildcardThread = 4
+)
+
+// resetAutoThreads zeroes the thread counts left to their defaults so
+// they are derived from the resolvers. The values given on the command
+// line, in the config file or by the profile are kept as overrides, even
+// when they are equal to the defaults.
+func resetAutoThreads(flagSet *goflags.FlagSet, options *Options, configFile string) error {
+	explicit, err := presetFlags(flagSet, configFile)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	if options.Profile != "" {
+		profiles, err := loadProfiles(configFile)
+		if err != nil {
+			return fmt.Errorf("could not read profiles: %w", err)
+		}
+		for key := range profiles[options.Profile] {
+			explicit[key] = struct{}{}
+		}
+	}
+
+	auto := func(name string) bool {
+		_, ok := explicit[name]
+		return !ok
+	}
+	if auto("t") {
+		options.Threads = 0
+	}
+	if auto("wt") {
+		options.WildcardThreads = 0
+	}
+	return nil
+}
+
+// tuneThreads derives the massdns and wildcard thread counts left to zero
+// from the number of resolvers, so a short list is not flooded and a long
+// one is used fully. The wildcard checks are also bounded by the open files limit.
+func (r *Runner) tuneThreads() error {
+	if !r.options.AutoThreads || (r.options.Threads > 0 && r.options.WildcardThreads > 0) {
+		return nil
+	}
+
+	resolvers, err := readResolvers(r.options.ResolversFile)
+	if err != nil {
+		return fmt.Errorf("could not read resolvers: %w", err)
+	}
+
+	if r.options.Threads <= 0 {
+		r.options.Threads = autoThreads(len(resolvers))
+	}
+	if r.options.WildcardThreads <= 0 {
+		r.options.WildcardThreads = autoWildcardThreads(len(resolvers), openFilesLimit())
+	}
+	r.logger.Info().Msgf("Auto-tuned %d massdns threads and %d wildcard threads for %d resolvers\n", r.options.Threads, r.options.WildcardThreads, len(resolvers))
+	return nil
+}
+
+// autoThreads returns the massdns threads keeping every resolver busy
+func autoThreads(resolvers int) int {
+	return clamp(resolvers*threadsPerResolver, minThreads, maxThreads)
+}
+
+// autoWildcardThreads returns the wildcard threads for the resolvers, the
+// sockets of the checks fitting in the open files limit when it is known
+func autoWildcardThreads(resolvers, openFiles int) int {
+	limit := maxWildcardThreads
+	if openFiles > 0 && openFiles/socketsPerWildcardThread < limit {
+		limit = max(openFiles/socketsPerWildcardThread, minWildcardThreads)
+	}
+	return clamp(resolvers*wildcardThreadsPerResolver, minWildcardThreads, limit)
+}
+
+// clamp bounds the value between low and high
+func clamp(value, low, high int) int {
+	return min(max(value, low), high)
+}
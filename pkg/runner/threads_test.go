@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projectdiscovery/goflags"
+	"github.com/projectdiscovery/gologger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoThreads(t *testing.T) {
+	require.Equal(t, minThreads, autoThreads(1), "Got unexpected threads for a single resolver")
+	require.Equal(t, 50*threadsPerResolver, autoThreads(50), "Got unexpected threads for 50 resolvers")
+	require.Equal(t, maxThreads, autoThreads(1000000), "Got unexpected threads for a million resolvers")
+}
+
+func TestAutoWildcardThreads(t *testing.T) {
+	tests := []struct {
+		name      string
+		resolvers int
+		openFiles int
+		threads   int
+	}{
+		{name: "single resolver", resolvers: 1, threads: minWildcardThreads},
+		{name: "unknown limit", resolvers: 50, threads: 50 * wildcardThreadsPerResolver},
+		{name: "many resolvers", resolvers: 1000000, threads: maxWildcardThreads},
+		{name: "open files cap", resolvers: 1000000, openFiles: 1024, threads: 1024 / socketsPerWildcardThread},
+		{name: "high open files limit", resolvers: 1000000, openFiles: 1 << 20, threads: maxWildcardThreads},
+		{name: "tiny open files limit", resolvers: 1000000, openFiles: 8, threads: minWildcardThreads},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.threads, autoWildcardThreads(test.resolvers, test.openFiles), "Got unexpected wildcard threads for %s", test.name)
+	}
+}
+
+func TestResetAutoThreads(t *testing.T) {
+	dir := t.TempDir()
+	emptyConfig := filepath.Join(dir, "empty.yaml")
+	require.Nil(t, os.WriteFile(emptyConfig, []byte("retries: 5\n"), 0644), "Could not write config")
+	defaultsConfig := filepath.Join(dir, "defaults.yaml")
+	require.Nil(t, os.WriteFile(defaultsConfig, []byte("t: 10000\n"), 0644), "Could not write config")
+	profileConfig := filepath.Join(dir, "profile.yaml")
+	require.Nil(t, os.WriteFile(profileConfig, []byte("profiles:\n  defaults:\n    wt: 250\n"), 0644), "Could not write config")
+
+	tests := []struct {
+		name            string
+		args            []string
+		config          string
+		profile         string
+		threads         int
+		wildcardThreads int
+	}{
+		{name: "defaults", config: emptyConfig},
+		{name: "command line", args: []string{"-t", "500"}, config: emptyConfig, threads: 500},
+		{name: "command line default", args: []string{"-wt", "250"}, config: emptyConfig, wildcardThreads: 250},
+		{name: "config file default", config: defaultsConfig, threads: 10000},
+		{name: "built-in profile", config: emptyConfig, profile: "stealth", threads: 500, wildcardThreads: 25},
+		{name: "profile default", config: profileConfig, profile: "defaults", wildcardThreads: 250},
+	}
+	for _, test := range tests {
+		options := &Options{Profile: test.profile}
+		flagSet := goflags.NewFlagSet()
+		flagSet.IntVar(&options.Threads, "t", 10000, "")
+		flagSet.IntVar(&options.WildcardThreads, "wt", 250, "")
+		flagSet.IntVar(&options.Retries, "retries", 5, "")
+		flagSet.IntVar(&options.RateLimit, "rate-limit", 0, "")
+		require.Nil(t, flagSet.CommandLine.Parse(test.args), "Could not parse flags for %s", test.name)
+		require.Nil(t, flagSet.MergeConfigFile(test.config), "Could not merge config file for %s", test.name)
+		if test.profile != "" {
+			require.Nil(t, applyProfile(flagSet, test.profile, test.config), "Could not apply profile for %s", test.name)
+		}
+
+		require.Nil(t, resetAutoThreads(flagSet, options, test.config), "Could not reset threads for %s", test.name)
+		require.Equal(t, test.threads, options.Threads, "Got unexpected threads for %s", test.name)
+		require.Equal(t, test.wildcardThreads, options.WildcardThreads, "Got unexpected wildcard threads for %s", test.name)
+	}
+}
+
+func TestTuneThreads(t *testing.T) {
+	// The thread counts given are kept, the other ones derived from the resolvers
+	resolvers := filepath.Join(t.TempDir(), "resolvers.txt")
+	require.Nil(t, os.WriteFile(resolvers, []byte("1.1.1.1\n8.8.8.8\n9.9.9.9\n"), 0644), "Could not write resolvers")
+
+	runner := &Runner{options: &Options{AutoThreads: true, ResolversFile: resolvers, WildcardThreads: 7}, logger: gologger.DefaultLogger}
+	require.Nil(t, runner.tuneThreads(), "Could not tune threads")
+	require.Equal(t, autoThreads(3), runner.options.Threads, "Got unexpected threads")
+	require.Equal(t, 7, runner.options.WildcardThreads, "Overrode the wildcard threads")
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"github.com/miekg/dns"
+	"github.com/rs/xid"
+)
+
+// defaultTLDs are the top level domains tried when no list was given
+var defaultTLDs = []string{
+	"com", "net", "org", "info", "biz", "io", "co", "me", "app", "dev",
+	"ai", "xyz", "online", "site", "store", "shop", "tech", "cloud", "page",
+	"us", "uk", "co.uk", "de", "fr", "it", "es", "nl", "be", "ch", "at",
+	"se", "no", "dk", "fi", "pl", "cz", "ru", "ua", "cn", "jp", "kr",
+	"in", "au", "com.au", "nz", "ca", "br", "com.br", "mx", "ar", "za",
+}
+
+// loadTLDs returns the normalized top level domains to try
+func (r *Runner) loadTLDs() ([]string, error) {
+	if r.options.TLDList == "" {
+		return defaultTLDs, nil
+	}
+
+	var tlds []string
+	err := readWordlists([]string{r.options.TLDList}, func(tld string) {
+		tlds = append(tlds, tld)
+	})
+	return tlds, err
+}
+
+// processTLDs resolves the base names combined with every top level
+// domain, and reports the variants which are registered but not resolving.
+// Top level domains resolving any name are skipped.
+func (r *Runner) processTLDs() error {
+	tlds, err := r.loadTLDs()
+	if err != nil {
+		return fmt.Errorf("could not read tld list: %w", err)
+	}
+
+	instance, err := r.newMassdns("")
+	if err != nil {
+		return fmt.Errorf("could not create massdns client: %w", err)
+	}
+
+	tlds = r.dropWildcardRoots(instance, tlds)
+	if len(tlds) == 0 {
+		r.logger.Info().Msgf("No top level domains left to try\n")
+		return nil
+	}
+
+	resolveFile := filepath.Join(r.tempDir, xid.New().String())
+	file, err := os.Create(resolveFile)
+	if err != nil {
+		return fmt.Errorf("could not create tld list (%s): %w", r.tempDir, err)
+	}
+	writer := r.newCandidateWriter(file)
+
+	r.phases.Set(massdns.PhaseGenerate)
+	r.logger.Info().Msgf("Started generating tld permutation\n")
+
+	now := time.Now()
+	var candidates []string
+	for _, baseName := range r.options.BaseNames {
+		baseName = normalizeWord(baseName)
+		for _, tld := range tlds {
+			candidate := baseName + "." + tld
+			if writer.Write(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	writer.Flush()
+	file.Close()
+
+	r.logger.Info().Msgf("Generating %d tld permutations took %s at %s\n", len(candidates), time.Since(now), resolveFile)
+
+	if err := instance.RunBatch(r.ctx, resolveFile); err != nil {
+		return fmt.Errorf("could not run massdns: %w", err)
+	}
+
+	if r.ctx.Err() == nil {
+		r.reportRegistered(instance, candidates)
+	}
+
+	r.warnPartial()
+	r.logger.Info().Msgf("Finished resolving.\n")
+	return nil
+}
+
+// reportRegistered reports the candidates which did not resolve but
+// have nameservers, meaning they are registered without any address.
+func (r *Runner) reportRegistered(instance *massdns.Instance, candidates []string) {
+	r.discoveredMutex.Lock()
+	resolved := make(map[string]struct{}, len(r.discovered))
+	for _, hostname := range r.discovered {
+		resolved[hostname] = struct{}{}
+	}
+	r.discoveredMutex.Unlock()
+
+	client, err := dnsclient.New(dnsclient.Options{Resolvers: instance.TrustedResolvers(), QuestionTypes: []uint16{dns.TypeNS}, Proxy: r.options.Proxy})
+	if err != nil {
+		r.logError("Could not create dns resolver: %s\n", err)
+		return
+	}
+
+	var registered []string
+	for _, candidate := range candidates {
+		if r.ctx.Err() != nil {
+			break
+		}
+		if _, ok := resolved[candidate]; ok {
+			continue
+		}
+		r.limiter.Take()
+		resp, err := client.QueryOne(candidate)
+		if err != nil || resp == nil || len(resp.NS) == 0 {
+			continue
+		}
+		registered = append(registered, candidate)
+	}
+
+	r.logger.Info().Msgf("Resolving variants: %d, registered but not resolving: %d\n", len(resolved), len(registered))
+	if len(registered) > 0 {
+		r.logger.Info().Msgf("Registered but not resolving: %s\n", strings.Join(registered, ", "))
+	}
+}
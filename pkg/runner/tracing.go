@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceFlushTimeout bounds the export of the spans at the end of a run
+const traceFlushTimeout = 5 * time.Second
+
+// tracerName is the instrumentation scope of the spans
+const tracerName = "github.com/ShlomieLiberow/shuffledns"
+
+// trace records the enumeration as a span, a child of the span of ctx if
+// any, with a child span for every phase, until the returned function is
+// called with the error of the run
+func (r *Runner) trace(ctx context.Context) (stop func(err error)) {
+	provider := r.options.TracerProvider
+	if provider == nil {
+		return func(error) {}
+	}
+	tracer := provider.Tracer(tracerName)
+
+	backend := r.options.Backend
+	switch {
+	case r.options.CustomBackend != nil:
+		backend = r.options.CustomBackend.Name()
+	case len(r.options.Workers) > 0:
+		backend = "distributed"
+	}
+	ctx, run := tracer.Start(ctx, "shuffledns.run", trace.WithAttributes(
+		attribute.String("shuffledns.mode", r.options.Mode),
+		attribute.String("shuffledns.domains", strings.Join(r.options.Domains, ",")),
+		attribute.String("shuffledns.backend", backend),
+	))
+
+	var (
+		mutex sync.Mutex
+		phase trace.Span
+	)
+	switchPhase := func(next massdns.Phase) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if phase != nil {
+			phase.SetAttributes(r.progressAttributes()...)
+			phase.End()
+			phase = nil
+		}
+		if next != "" {
+			_, phase = tracer.Start(ctx, "shuffledns."+string(next), trace.WithAttributes(attribute.String("shuffledns.phase", string(next))))
+		}
+	}
+	stopWatching := r.phases.Watch(switchPhase)
+
+	return func(err error) {
+		stopWatching()
+		switchPhase("")
+
+		stats := r.Stats()
+		var dropped int64
+		for _, count := range stats.Dropped {
+			dropped += count
+		}
+		run.SetAttributes(r.progressAttributes()...)
+		run.SetAttributes(
+			attribute.Int64("shuffledns.dropped", dropped),
+			attribute.Int64("shuffledns.errors", stats.Errors),
+			attribute.Bool("shuffledns.partial", stats.Partial),
+		)
+		if err != nil {
+			run.RecordError(err)
+			run.SetStatus(codes.Error, err.Error())
+		}
+		run.End()
+
+		// The spans are exported in batches, flushed at the end of the run
+		// when the provider supports it
+		flusher, ok := provider.(interface{ ForceFlush(context.Context) error })
+		if !ok {
+			return
+		}
+		flushCtx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := flusher.ForceFlush(flushCtx); err != nil {
+			r.logger.Warning().Msgf("Could not export traces: %s\n", err)
+		}
+	}
+}
+
+// progressAttributes returns the counters of the enumeration as span attributes
+func (r *Runner) progressAttributes() []attribute.KeyValue {
+	progress := r.progress()
+	return []attribute.KeyValue{
+		attribute.Int64("shuffledns.candidates", progress.Candidates),
+		attribute.Int64("shuffledns.queries", int64(progress.Queries)),
+		attribute.Int64("shuffledns.parsed", progress.Parsed),
+		attribute.Int64("shuffledns.wildcard_checks", progress.WildcardChecks),
+		attribute.Int64("shuffledns.wildcard_drops", progress.WildcardDrops),
+		attribute.Int64("shuffledns.found", int64(progress.Found)),
+	}
+}
@@ -3,50 +3,265 @@ package runner
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
 
+	"github.com/ShlomieLiberow/shuffledns/pkg/asn"
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
 	"github.com/ShlomieLiberow/shuffledns/pkg/massdns"
-	"github.com/projectdiscovery/gologger"
+	"github.com/ShlomieLiberow/shuffledns/pkg/parser"
+	"github.com/miekg/dns"
 	"github.com/projectdiscovery/gologger/formatter"
 	"github.com/projectdiscovery/gologger/levels"
 	fileutil "github.com/projectdiscovery/utils/file"
 )
 
+// Validate normalizes the target domains given as urls or wildcards
+// and validates the options, as done for the command line flags
+func (options *Options) Validate() error {
+	options.sanitizeDomains()
+	// The output file - writes the results to stdout without the logger
+	if options.Output == "-" {
+		options.Output = ""
+		options.OutputWriter = os.Stdout
+		options.NoStdout = true
+	}
+	if err := options.validateOptions(); err != nil {
+		return &invalidOptionsError{err: err}
+	}
+	return nil
+}
+
 // validateOptions validates the configuration options passed
 func (options *Options) validateOptions() error {
 	// Both verbose and silent flags were used
 	if options.Verbose && options.Silent {
 		return errors.New("both verbose and silent mode specified")
 	}
+	if options.SubdomainsList != "" && options.Input != nil {
+		return errors.New("both subdomains list and input reader specified")
+	}
+
+	// Both json and httpx output formats were used
+	if options.Json && options.HttpxOutput {
+		return errors.New("both json and httpx output specified")
+	}
+
+	// Check if a list of resolvers was provided and it exists, the verify
+	// mode only querying the trusted resolvers, custom backends their own
+	// and the worker nodes falling back to theirs
+	if options.Mode != string(Verify) && options.CustomBackend == nil && (len(options.Workers) == 0 || options.ResolversFile != "") {
+		if !fileutil.FileExists(options.ResolversFile) {
+			return errors.New("resolver file doesn't exists")
+		}
+
+		// Check if resolvers are blank
+		if blank, err := massdns.IsEmptyFile(options.ResolversFile); err == nil {
+			if blank {
+				return errors.New("empty resolver list specified")
+			}
+		} else {
+			return fmt.Errorf("could not read resolvers: %w", err)
+		}
+	}
+
+	// Check if the response codes to filter on are valid. Only the replies
+	// with answers are kept, NXDOMAIN ones with the cnames to missing names.
+	for _, rcode := range options.FilterRcodes {
+		if _, ok := dns.StringToRcode[strings.ToUpper(rcode)]; !ok {
+			return fmt.Errorf("invalid response code specified: %s", rcode)
+		}
+		if !slices.Contains(massdns.FilterableRcodes, strings.ToUpper(rcode)) {
+			return fmt.Errorf("response code %s can't be filtered on, the replies without answers are not kept", rcode)
+		}
+	}
+	if options.MinIPs < 0 {
+		return errors.New("min-ips can't be negative")
+	}
+	if options.MinTTL < 0 || options.MaxTTL < 0 {
+		return errors.New("ttl limits can't be negative")
+	}
+	if options.MaxTTL > 0 && options.MinTTL > options.MaxTTL {
+		return errors.New("min ttl can't be greater than max ttl")
+	}
+	if (options.MinTTL > 0 || options.MaxTTL > 0) && (options.RawInputFormat == parser.FormatMassdnsSimple || options.RawInputFormat == parser.FormatFDNS) {
+		return errors.New("ttl filters require a raw input format with ttls")
+	}
+	if options.Threads < 0 || options.WildcardThreads < 0 {
+		return errors.New("threads can't be negative")
+	}
+	if !options.AutoThreads && (options.Threads == 0 || options.WildcardThreads == 0) {
+		return errors.New("threads must be set unless auto-threads is used")
+	}
+	if options.RateLimit < 0 {
+		return errors.New("rate limit can't be negative")
+	}
+	for _, recordType := range options.VerifyTypes {
+		if !slices.Contains(massdns.VerifyTypes, recordType) {
+			return fmt.Errorf("invalid verification record type specified: %s", recordType)
+		}
+	}
+	if options.VerifyRetries < 0 || options.VerifyTimeout < 0 || options.VerifyRateLimit < 0 {
+		return errors.New("trusted verification retries, timeout and rate limit can't be negative")
+	}
+	if !slices.Contains(dnsclient.Rotations, options.ResolverRotation) {
+		return fmt.Errorf("invalid resolver rotation specified: %s", options.ResolverRotation)
+	}
+	if !slices.Contains(massdns.Backends, options.Backend) {
+		return fmt.Errorf("invalid backend specified: %s", options.Backend)
+	}
+	if len(options.Workers) > 0 {
+		if options.Mode == string(Verify) {
+			return errors.New("workers can't be used in verify mode")
+		}
+		if options.CustomBackend != nil || options.Backend != massdns.BackendMassdns {
+			return errors.New("workers resolve with massdns, no other backend can be specified")
+		}
+	}
+	if options.ResolverMaxInFlight < 0 {
+		return errors.New("resolver max in-flight queries can't be negative")
+	}
+	if options.Deadline < 0 {
+		return errors.New("deadline can't be negative")
+	}
+	if options.TrimErrorRate < 0 || options.TrimErrorRate > 100 {
+		return errors.New("trim error rate must be a percentage")
+	}
+	if (options.ResolverStats || options.TrimResolvers != "") && ((options.Backend != "" && options.Backend != massdns.BackendMassdns) || options.Mode == string(Verify)) {
+		return errors.New("resolver stats require the massdns backend")
+	}
+	if options.AdaptiveThreads && ((options.Backend != "" && options.Backend != massdns.BackendMassdns) || options.CustomBackend != nil || options.Mode == string(Verify)) {
+		return errors.New("adaptive-threads requires the massdns backend")
+	}
+	if options.RetryTimeouts && options.Backend == massdns.BackendZDNS {
+		return errors.New("retry-timeouts is not supported with the zdns backend")
+	}
+	if options.DualStack && options.Backend == massdns.BackendZDNS {
+		return errors.New("dual-stack requires the massdns or native backend")
+	}
+	if options.NegativeCache != "" && options.NegativeCacheTTL <= 0 {
+		return errors.New("negative cache ttl must be positive")
+	}
+	if options.OutputBufferSize < 0 || options.FlushInterval < 0 {
+		return errors.New("output buffer size and flush interval can't be negative")
+	}
+	if options.Proxy != "" {
+		if _, err := dnsclient.ParseProxy(options.Proxy); err != nil {
+			return err
+		}
+	}
+
+	if options.Webhook != "" {
+		if parsed, err := url.Parse(options.Webhook); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("webhook must be an http or https url")
+		}
+	}
+
+	if options.MinDepth < 0 || options.MaxDepth < 0 {
+		return errors.New("depth limits can't be negative")
+	}
+	if options.MaxDepth > 0 && options.MinDepth > options.MaxDepth {
+		return errors.New("min depth can't be greater than max depth")
+	}
+	if options.LabelReport != "" && len(options.Domains) == 0 {
+		return errors.New("label report requires a domain to be specified")
+	}
+	if (options.MinDepth > 0 || options.MaxDepth > 0) && len(options.Domains) == 0 {
+		return errors.New("depth limits require a domain to be specified")
+	}
 
-	// Check if a list of resolvers was provided and it exists
-	if !fileutil.FileExists(options.ResolversFile) {
-		return errors.New("resolver file doesn't exists")
+	// Check if the scope regular expressions compile
+	for _, expressions := range [][]string{options.MatchRegex, options.FilterRegex} {
+		for _, expression := range expressions {
+			if _, err := regexp.Compile(expression); err != nil {
+				return fmt.Errorf("invalid regex specified %s (go regular expressions, not globs): %w", expression, err)
+			}
+		}
+	}
+
+	// Check if the excluded and matched ranges are valid
+	if _, err := massdns.ParseCIDRs(options.ExcludeIPCIDRs); err != nil {
+		return err
+	}
+	if _, err := massdns.ParseCIDRs(options.MatchIPCIDRs); err != nil {
+		return err
+	}
+	if options.FlagExcluded && len(options.ExcludeIPCIDRs) == 0 {
+		return errors.New("flag-excluded requires excluded cidrs to be specified")
+	}
+	if options.MaxHostsPerIP < 0 {
+		return errors.New("max-hosts-per-ip must be non-negative")
+	}
+	if options.FlagCrowded && options.MaxHostsPerIP == 0 {
+		return errors.New("flag-crowded requires max-hosts-per-ip to be specified")
+	}
+	if options.FlagReserved && options.DropReserved {
+		return errors.New("both flag-reserved and drop-reserved specified")
+	}
+	if options.ReservedOutput != "" && !options.FlagReserved && !options.DropReserved {
+		return errors.New("reserved-output requires flag-reserved or drop-reserved")
 	}
 
-	// Check if resolvers are blank
-	if blank, err := massdns.IsEmptyFile(options.ResolversFile); err == nil {
-		if blank {
-			return errors.New("empty resolver list specified")
+	// Check if the asns are valid and can be mapped
+	if len(options.MatchASN) > 0 || len(options.FilterASN) > 0 {
+		for _, values := range [][]string{options.MatchASN, options.FilterASN} {
+			for _, value := range values {
+				if _, err := asn.ParseASN(value); err != nil {
+					return err
+				}
+			}
+		}
+		if !fileutil.FileExists(options.ASNDatabase) {
+			return errors.New("asn filters require an asn database to be specified")
+		}
+	}
+	if options.ASNInfo && !fileutil.FileExists(options.ASNDatabase) {
+		return errors.New("asn info requires an asn database to be specified")
+	}
+
+	if options.GeoIPDatabase != "" && !fileutil.FileExists(options.GeoIPDatabase) {
+		return errors.New("geoip database doesn't exists")
+	}
+
+	if options.CloudOnly && options.NonCloudOnly {
+		return errors.New("both cloud-only and non-cloud-only specified")
+	}
+
+	if options.CDNRanges != "" {
+		if !options.CDN {
+			return errors.New("cdn-ranges requires cdn tagging to be enabled")
+		}
+		if !fileutil.FileExists(options.CDNRanges) {
+			return errors.New("cdn ranges file doesn't exists")
 		}
-	} else {
-		return fmt.Errorf("could not read resolvers: %w", err)
 	}
 
 	switch options.Mode {
 	case "bruteforce":
-		if options.Wordlist == "" {
+		if len(options.Wordlist) == 0 && len(options.Import) == 0 && !options.Chaos && !options.CT {
 			return errors.New("wordlist not specified")
 		}
 		if len(options.Domains) == 0 {
 			return errors.New("domain not specified")
 		}
 	case "resolve":
-		if options.SubdomainsList == "" && !fileutil.HasStdin() {
+		if !options.hasInput() {
 			return errors.New("specify subdomains to resolve via flag or stdin")
 		}
+		if options.Stream {
+			if options.SubdomainsList != "" {
+				return errors.New("stream mode reads subdomains from stdin only")
+			}
+			if options.BatchSize <= 0 || options.BatchInterval <= 0 {
+				return errors.New("batch size and interval must be positive")
+			}
+		}
 		// If the optional domain name is not specified, wildcard filtering will be automatically disabled
 		if len(options.Domains) == 0 {
-			gologger.Print().Msgf("Wildcard filtering will be automatically disabled as no domain name has been provided")
+			options.logger().Print().Msgf("Wildcard filtering will be automatically disabled as no domain name has been provided")
 		}
 	case "filter":
 		// Check if the user just wants to perform wildcard filtering on an existing massdns output file.
@@ -56,10 +271,151 @@ func (options *Options) validateOptions() error {
 		if len(options.Domains) == 0 {
 			return errors.New("domain not specified")
 		}
+	case "verify":
+		if !options.hasInput() {
+			return errors.New("specify hostnames to verify via flag or stdin")
+		}
+		if options.Resume != "" || options.Alterations || options.Patterns || options.hasAffixes() {
+			return errors.New("resume, alterations, affixes and patterns are not supported in verify mode")
+		}
+	case "tld":
+		if len(options.BaseNames) == 0 {
+			return errors.New("base name not specified")
+		}
+		if options.TLDList != "" && !fileutil.FileExists(options.TLDList) {
+			return errors.New("tld list doesn't exists")
+		}
 	default:
 		return errors.New("execution mode not specified")
 	}
 
+	if options.Stream && options.Mode != "resolve" {
+		return errors.New("stream mode is only supported in resolve mode")
+	}
+
+	if options.Recursive {
+		if options.Mode != "bruteforce" {
+			return errors.New("recursive bruteforce is only supported in bruteforce mode")
+		}
+		if options.Depth <= 0 {
+			return errors.New("depth must be positive")
+		}
+	}
+
+	if options.Alterations {
+		if len(options.Domains) == 0 {
+			return errors.New("alterations require a domain to be specified")
+		}
+		if options.Stream {
+			return errors.New("alterations are not supported in stream mode")
+		}
+	}
+
+	if options.hasAffixes() {
+		if len(options.Domains) == 0 {
+			return errors.New("alteration prefixes and suffixes require a domain to be specified")
+		}
+		if options.Stream {
+			return errors.New("alteration prefixes and suffixes are not supported in stream mode")
+		}
+	}
+
+	if options.DomainResolvers != "" {
+		if options.Mode != string(BruteForce) && options.Mode != string(Resolve) {
+			return errors.New("domain resolvers are only supported in bruteforce and resolve modes")
+		}
+		if options.Stream {
+			return errors.New("domain resolvers are not supported in stream mode")
+		}
+		if !fileutil.FileExists(options.DomainResolvers) {
+			return errors.New("domain resolvers file doesn't exists")
+		}
+	}
+
+	if len(options.Import) > 0 && options.Mode != string(BruteForce) {
+		return errors.New("imports are only supported in bruteforce mode")
+	}
+	if options.Chaos {
+		if options.Mode != string(BruteForce) {
+			return errors.New("chaos is only supported in bruteforce mode")
+		}
+		if options.ChaosKey == "" {
+			return errors.New("chaos requires an api key, use -chaos-key or $PDCP_API_KEY")
+		}
+	}
+	if options.CT {
+		if options.Mode != string(BruteForce) {
+			return errors.New("certificate transparency is only supported in bruteforce mode")
+		}
+		if !strings.Contains(options.CTEndpoint, "{domain}") {
+			return errors.New("certificate transparency endpoint must contain {domain}")
+		}
+	}
+	for _, path := range options.Import {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("could not read import: %w", err)
+		}
+	}
+
+	if options.ScopeFile != "" && !fileutil.FileExists(options.ScopeFile) {
+		return errors.New("scope file doesn't exists")
+	}
+	if options.ScopeBurp != "" && !fileutil.FileExists(options.ScopeBurp) {
+		return errors.New("scope export doesn't exists")
+	}
+
+	if options.RawInputFormat != "" {
+		if options.MassdnsRaw == "" {
+			return errors.New("raw input format requires a raw input file")
+		}
+		if options.NDJSON {
+			return errors.New("both ndjson and raw input format specified")
+		}
+		if _, err := parser.Lookup(options.RawInputFormat); err != nil {
+			return fmt.Errorf("invalid raw input format: %w, use one of %s", err, strings.Join(parser.Formats(), ", "))
+		}
+		if options.RawInputFormat == parser.FormatFDNS && len(options.Domains) == 0 {
+			return errors.New("fdns raw input requires domains")
+		}
+	}
+
+	if options.Resume != "" && options.Stream {
+		return errors.New("resume is not supported in stream mode")
+	}
+
+	if options.Checkpoint != "" && (options.Mode == string(Verify) || options.Stream) {
+		return errors.New("checkpoints are not supported in verify and stream modes")
+	}
+
+	if options.Project != "" && !validName(options.Project) {
+		return fmt.Errorf("invalid project name %q", options.Project)
+	}
+
+	if options.AXFR && len(options.Domains) == 0 {
+		return errors.New("zone transfers require a domain to be specified")
+	}
+
+	if options.MailPolicy != "" {
+		if len(options.Domains) == 0 {
+			return errors.New("mail policy analysis requires a domain to be specified")
+		}
+		if options.Stream || options.Mode == string(Verify) {
+			return errors.New("mail policy analysis is not supported in stream and verify modes")
+		}
+	}
+	if options.MailPolicyDomains != "" && options.MailPolicy == "" {
+		return errors.New("mail policy domains require the mail policy file to be specified")
+	}
+
+	if options.Patterns {
+		if len(options.Domains) == 0 {
+			return errors.New("patterns require a domain to be specified")
+		}
+		if options.Stream {
+			return errors.New("patterns are not supported in stream mode")
+		}
+	}
+
 	return nil
 }
 
@@ -67,12 +423,12 @@ func (options *Options) validateOptions() error {
 func (options *Options) configureOutput() {
 	// If the user desires verbose output, show verbose output
 	if options.Verbose {
-		gologger.DefaultLogger.SetMaxLevel(levels.LevelVerbose)
+		options.logger().SetMaxLevel(levels.LevelVerbose)
 	}
 	if options.NoColor {
-		gologger.DefaultLogger.SetFormatter(formatter.NewCLI(true))
+		options.logger().SetFormatter(formatter.NewCLI(true))
 	}
 	if options.Silent {
-		gologger.DefaultLogger.SetMaxLevel(levels.LevelSilent)
+		options.logger().SetMaxLevel(levels.LevelSilent)
 	}
 }
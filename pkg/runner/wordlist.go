@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// normalizeWord normalizes a wordlist entry to a lowercase dns label prefix
+func normalizeWord(word string) string {
+	// RFC4343 - case insensitive domain
+	word = strings.ToLower(strings.TrimSpace(word))
+	return strings.Trim(word, ".")
+}
+
+// readWordlists reads all the wordlists, merging them into a single
+// normalized list of words with duplicates removed, and calls the
+// callback for each unique word in the order they were found.
+func readWordlists(wordlists []string, callback func(word string)) error {
+	seen := make(map[string]struct{})
+
+	for _, wordlist := range wordlists {
+		file, err := os.Open(wordlist)
+		if err != nil {
+			return fmt.Errorf("could not read wordlist %s: %w", wordlist, err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			word := normalizeWord(scanner.Text())
+			if word == "" {
+				continue
+			}
+			if _, ok := seen[word]; ok {
+				continue
+			}
+			seen[word] = struct{}{}
+			callback(word)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("could not read wordlist %s: %w", wordlist, err)
+		}
+	}
+	return nil
+}
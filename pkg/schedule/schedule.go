@@ -0,0 +1,164 @@
+// Package schedule parses the cron-like schedules of the recurring scans.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLookahead bounds the search of the next time of a schedule which
+// never matches, eg. on february 30th
+const maxLookahead = 5 * 366 * 24 * time.Hour
+
+// Schedule returns the times a scan is due
+type Schedule interface {
+	// Next returns the first time the scan is due after t, or the zero time if never
+	Next(t time.Time) time.Time
+}
+
+// every is a schedule due at a fixed interval
+type every time.Duration
+
+// Next returns t plus the interval
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cron is a schedule of the standard cron fields
+type cron struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday are set when the fields are *, the day
+	// matching either field otherwise
+	anyDay, anyWeekday bool
+}
+
+// Next returns the first minute after t matching the fields
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxLookahead)
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<uint(t.Hour())) == 0:
+			// Truncating would round the absolute time, off the local hour in zones with a half-hour offset
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay returns true if the day of the month or of the week match
+func (c *cron) matchDay(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// descriptors are the shorthands of the common schedules
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Parse parses a schedule: five cron fields (minute, hour, day of month,
+// month and day of week) made of *, values, ranges, steps and lists,
+// one of @hourly, @daily, @weekly and @monthly, or @every followed by
+// a duration (eg. @every 6h)
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if duration < time.Minute {
+			return nil, errors.New("interval must be at least a minute")
+		}
+		return every(duration), nil
+	}
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+	c := &cron{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&c.minutes, 0, 59},
+		{&c.hours, 0, 23},
+		{&c.days, 1, 31},
+		{&c.months, 1, 12},
+		{&c.weekdays, 0, 7},
+	}
+	for i, bound := range bounds {
+		bits, err := parseField(fields[i], bound.min, bound.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		*bound.field = bits
+	}
+	// Sunday is both 0 and 7
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	return c, nil
+}
+
+// parseField returns the bits of the values of a field
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(low); err != nil {
+				return 0, fmt.Errorf("invalid value %q", low)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(high); err != nil {
+					return 0, fmt.Errorf("invalid value %q", high)
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value %q out of range %d-%d", rangePart, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 11, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"30 4 29 2 *", time.Date(2024, 2, 29, 4, 30, 0, 0, time.UTC)},
+		{"@every 6h", now.Add(6 * time.Hour)},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		require.Nil(t, err, "Could not parse %s", test.spec)
+		require.Equal(t, test.next, schedule.Next(now), "Got wrong next time of %s", test.spec)
+	}
+
+	schedule, err := Parse("0 0 30 2 *")
+	require.Nil(t, err, "Could not parse schedule")
+	require.True(t, schedule.Next(now).IsZero(), "Got next time of a schedule never due")
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 10s", "@yearly"} {
+		_, err := Parse(spec)
+		require.NotNil(t, err, "Parsed invalid schedule %q", spec)
+	}
+}
+
+func TestScheduleNextLocation(t *testing.T) {
+	// Half-hour offset, as in Asia/Kolkata
+	location := time.FixedZone("IST", 5*3600+30*60)
+	now := time.Date(2024, 1, 10, 10, 30, 0, 0, location)
+
+	schedule, err := Parse("0 3 * * *")
+	require.Nil(t, err, "Could not parse schedule")
+	require.Equal(t, time.Date(2024, 1, 11, 3, 0, 0, 0, location), schedule.Next(now), "Got wrong next time")
+
+	schedule, err = Parse("@hourly")
+	require.Nil(t, err, "Could not parse schedule")
+	require.Equal(t, time.Date(2024, 1, 10, 11, 0, 0, 0, location), schedule.Next(now), "Got wrong next time")
+}
@@ -0,0 +1,10 @@
+// Package scope matches hostnames against the scope of an engagement,
+// made of included and excluded hostname patterns.
+//
+// A pattern is a hostname whose labels may contain wildcards which never
+// cross a label boundary: `app.*.example.net` matches `app.eu.example.net`
+// but not `app.eu.west.example.net`, and `api-*.example.com` matches
+// `api-dev.example.com`. A leading `*` label matches one or more labels,
+// so that `*.example.com` matches every subdomain of `example.com`, but
+// not `example.com` itself.
+package scope
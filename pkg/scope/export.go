@@ -0,0 +1,186 @@
+package scope
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// burpProject is the scope of a Burp Suite project options export
+type burpProject struct {
+	Target struct {
+		Scope struct {
+			Include []burpEntry `json:"include"`
+			Exclude []burpEntry `json:"exclude"`
+		} `json:"scope"`
+	} `json:"target"`
+}
+
+// burpEntry is a scope entry, a url prefix in the simple mode or a host
+// regular expression restricted to ports and paths in the advanced mode
+type burpEntry struct {
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix"`
+	Host    string `json:"host"`
+	Port    string `json:"port"`
+	File    string `json:"file"`
+}
+
+// zapContext is the scope of a ZAP context export
+type zapContext struct {
+	Context struct {
+		Include []string `xml:"incregexes"`
+		Exclude []string `xml:"excregexes"`
+	} `xml:"context"`
+}
+
+// LoadExport reads the scope of a Burp Suite project options export
+// (json) or of a ZAP context export (xml). The entries restricted to some
+// ports or paths include the whole host, but only the exclusions of whole
+// hosts are kept.
+func LoadExport(filename string) (*Scope, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return parseZAP(data)
+	}
+	return parseBurp(data)
+}
+
+// parseBurp parses the scope of a Burp Suite project options export
+func parseBurp(data []byte) (*Scope, error) {
+	var project burpProject
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("could not parse burp scope: %w", err)
+	}
+
+	scope := &Scope{}
+	for _, entry := range project.Target.Scope.Include {
+		if err := entry.add(scope.Include, scope.IncludeRegex); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range project.Target.Scope.Exclude {
+		if !entry.wholeHost() {
+			continue
+		}
+		if err := entry.add(scope.Exclude, scope.ExcludeRegex); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// add adds the host of an enabled entry, as a pattern for a prefix and
+// as a regular expression otherwise
+func (e burpEntry) add(addPattern, addRegex func(string) error) error {
+	if !e.Enabled {
+		return nil
+	}
+	if e.Prefix != "" {
+		parsed, err := url.Parse(e.Prefix)
+		if err != nil || parsed.Hostname() == "" {
+			return fmt.Errorf("invalid burp scope prefix %s", e.Prefix)
+		}
+		return addPattern(parsed.Hostname())
+	}
+	host := e.Host
+	if host == "" {
+		host = ".*"
+	}
+	return addRegex(host)
+}
+
+// wholeHost tells whether the entry applies to every port and path of its host
+func (e burpEntry) wholeHost() bool {
+	if e.Prefix != "" {
+		parsed, err := url.Parse(e.Prefix)
+		return err == nil && parsed.Port() == "" && strings.Trim(parsed.Path, "/") == ""
+	}
+	return isAnything(e.Port) && isAnything(e.File)
+}
+
+// isAnything tells whether the regular expression of a burp entry
+// restricts nothing
+func isAnything(expression string) bool {
+	switch strings.TrimSuffix(strings.TrimPrefix(expression, "^"), "$") {
+	case "", ".*", "/.*", "^/.*":
+		return true
+	}
+	return false
+}
+
+// parseZAP parses the scope of a ZAP context export, whose regular
+// expressions match urls
+func parseZAP(data []byte) (*Scope, error) {
+	var context zapContext
+	if err := xml.Unmarshal(data, &context); err != nil {
+		return nil, fmt.Errorf("could not parse zap scope: %w", err)
+	}
+
+	scope := &Scope{}
+	for _, expression := range context.Context.Include {
+		host, _ := zapHost(expression)
+		if err := scope.IncludeRegex("^(?:" + host + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	for _, expression := range context.Context.Exclude {
+		host, whole := zapHost(expression)
+		if !whole {
+			continue
+		}
+		if err := scope.ExcludeRegex("^(?:" + host + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// zapHost returns the host part of a url regular expression, and whether
+// the expression applies to every port and path of the host. The host
+// ends at the first slash or port separator outside of a character class
+// or group.
+func zapHost(expression string) (string, bool) {
+	expression = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(expression), "^"), "$")
+	if index := strings.Index(expression, "://"); index >= 0 {
+		expression = expression[index+3:]
+	}
+
+	var depth int
+	var class bool
+	for i := 0; i < len(expression); i++ {
+		switch c := expression[i]; {
+		case c == '\\':
+			i++
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c == ':':
+			return anyHost(expression[:i]), false
+		case depth == 0 && c == '/':
+			return anyHost(expression[:i]), isAnything(expression[i:])
+		}
+	}
+	// A trailing wildcard without any slash stands for the paths
+	return anyHost(strings.TrimSuffix(expression, ".*")), true
+}
+
+// anyHost returns the host expression, matching any host if empty
+func anyHost(expression string) string {
+	if expression == "" {
+		return ".*"
+	}
+	return expression
+}
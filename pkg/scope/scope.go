@@ -0,0 +1,192 @@
+package scope
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Scope is a set of included and excluded hostname patterns and
+// regular expressions
+type Scope struct {
+	include      []pattern
+	exclude      []pattern
+	includeRegex []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+}
+
+// pattern are the labels of a hostname pattern
+type pattern []string
+
+// New creates a scope of the included and excluded patterns. Every
+// hostname not excluded is in the scope if no pattern is included.
+func New(includes, excludes []string) (*Scope, error) {
+	scope := &Scope{}
+	for _, value := range includes {
+		if err := scope.Include(value); err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range excludes {
+		if err := scope.Exclude(value); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// Load reads a scope file of one pattern per line. The patterns starting
+// with ! are excluded, and the lines starting with # are ignored.
+func Load(filename string) (*Scope, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scope := &Scope{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(line, "!"); ok {
+			err = scope.Exclude(excluded)
+		} else {
+			err = scope.Include(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// Include adds a pattern of hostnames in the scope
+func (s *Scope) Include(value string) error {
+	p, err := parsePattern(value)
+	if err != nil {
+		return err
+	}
+	s.include = append(s.include, p)
+	return nil
+}
+
+// Exclude adds a pattern of hostnames out of the scope
+func (s *Scope) Exclude(value string) error {
+	p, err := parsePattern(value)
+	if err != nil {
+		return err
+	}
+	s.exclude = append(s.exclude, p)
+	return nil
+}
+
+// IncludeRegex adds a regular expression of hostnames in the scope
+func (s *Scope) IncludeRegex(expression string) error {
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return fmt.Errorf("invalid scope regex %s: %w", expression, err)
+	}
+	s.includeRegex = append(s.includeRegex, re)
+	return nil
+}
+
+// ExcludeRegex adds a regular expression of hostnames out of the scope
+func (s *Scope) ExcludeRegex(expression string) error {
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return fmt.Errorf("invalid scope regex %s: %w", expression, err)
+	}
+	s.excludeRegex = append(s.excludeRegex, re)
+	return nil
+}
+
+// Merge adds the patterns and regular expressions of the other scope
+func (s *Scope) Merge(other *Scope) {
+	s.include = append(s.include, other.include...)
+	s.exclude = append(s.exclude, other.exclude...)
+	s.includeRegex = append(s.includeRegex, other.includeRegex...)
+	s.excludeRegex = append(s.excludeRegex, other.excludeRegex...)
+}
+
+// Match tells whether the hostname matches an included pattern, if any,
+// and none of the excluded ones. Every hostname matches a nil scope.
+func (s *Scope) Match(hostname string) bool {
+	if s == nil {
+		return true
+	}
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	labels := strings.Split(hostname, ".")
+	for _, p := range s.exclude {
+		if p.match(labels) {
+			return false
+		}
+	}
+	for _, re := range s.excludeRegex {
+		if re.MatchString(hostname) {
+			return false
+		}
+	}
+	if len(s.include) == 0 && len(s.includeRegex) == 0 {
+		return true
+	}
+	for _, p := range s.include {
+		if p.match(labels) {
+			return true
+		}
+	}
+	for _, re := range s.includeRegex {
+		if re.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePattern parses a hostname pattern into its labels
+func parsePattern(value string) (pattern, error) {
+	value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if value == "" {
+		return nil, errors.New("empty scope pattern")
+	}
+	labels := strings.Split(value, ".")
+	for _, label := range labels {
+		if label == "" {
+			return nil, fmt.Errorf("invalid scope pattern %s: empty label", value)
+		}
+		if _, err := path.Match(label, ""); err != nil {
+			return nil, fmt.Errorf("invalid scope pattern %s: %w", value, err)
+		}
+	}
+	return pattern(labels), nil
+}
+
+// match tells whether the labels of a hostname match the pattern
+func (p pattern) match(labels []string) bool {
+	suffix := p
+	if len(p) > 1 && p[0] == "*" {
+		// The leading wildcard matches one or more labels
+		suffix = p[1:]
+		if len(labels) <= len(suffix) {
+			return false
+		}
+		labels = labels[len(labels)-len(suffix):]
+	} else if len(labels) != len(p) {
+		return false
+	}
+	for i, label := range suffix {
+		if matched, _ := path.Match(label, labels[i]); !matched {
+			return false
+		}
+	}
+	return true
+}
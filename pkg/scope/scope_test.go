@@ -0,0 +1,76 @@
+package scope
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeMatch(t *testing.T) {
+	scope, err := New([]string{"*.example.com", "app.*.example.net", "api-*.example.org"}, []string{"*.internal.example.com"})
+	require.Nil(t, err, "Could not create scope")
+
+	require.True(t, scope.Match("www.example.com"), "Could not match subdomain")
+	require.True(t, scope.Match("a.b.example.com"), "Could not match deep subdomain")
+	require.False(t, scope.Match("example.com"), "Matched apex with wildcard")
+	require.False(t, scope.Match("db.internal.example.com"), "Matched excluded subdomain")
+	require.True(t, scope.Match("App.EU.example.net."), "Could not match inner wildcard")
+	require.False(t, scope.Match("app.eu.west.example.net"), "Matched inner wildcard across labels")
+	require.True(t, scope.Match("api-dev.example.org"), "Could not match label wildcard")
+	require.False(t, scope.Match("www.example.org"), "Matched out of scope hostname")
+
+	var none *Scope
+	require.True(t, none.Match("www.example.com"), "Could not match nil scope")
+}
+
+func TestScopeLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "scope.txt")
+	err := os.WriteFile(filename, []byte("# scope\nexample.com\n*.example.com\n!admin.example.com\n"), 0o600)
+	require.Nil(t, err, "Could not write scope file")
+
+	scope, err := Load(filename)
+	require.Nil(t, err, "Could not load scope")
+	require.True(t, scope.Match("example.com"), "Could not match apex")
+	require.True(t, scope.Match("www.example.com"), "Could not match subdomain")
+	require.False(t, scope.Match("admin.example.com"), "Matched excluded hostname")
+
+	_, err = New([]string{"a..example.com"}, nil)
+	require.NotNil(t, err, "Could not reject invalid pattern")
+}
+
+func TestLoadExport(t *testing.T) {
+	dir := t.TempDir()
+
+	burp := filepath.Join(dir, "burp.json")
+	err := os.WriteFile(burp, []byte(`{"target":{"scope":{"advanced_mode":true,
+"include":[{"enabled":true,"host":"^.*\\.example\\.com$","protocol":"any"},{"enabled":false,"host":"^.*\\.example\\.org$"},{"enabled":true,"prefix":"https://app.example.net/login"}],
+"exclude":[{"enabled":true,"host":"^admin\\.example\\.com$"},{"enabled":true,"host":"^www\\.example\\.com$","file":"^/logout.*"}]}}}`), 0o600)
+	require.Nil(t, err, "Could not write burp scope")
+
+	scope, err := LoadExport(burp)
+	require.Nil(t, err, "Could not load burp scope")
+	require.True(t, scope.Match("www.example.com"), "Could not match host with excluded path")
+	require.False(t, scope.Match("admin.example.com"), "Matched excluded host")
+	require.False(t, scope.Match("www.example.org"), "Matched disabled entry")
+	require.True(t, scope.Match("app.example.net"), "Could not match prefix host")
+
+	zap := filepath.Join(dir, "zap.context")
+	err = os.WriteFile(zap, []byte(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<configuration><context><name>Target</name>
+<incregexes>https?://(.*\.)?example\.com/.*</incregexes>
+<incregexes>https://api\.example\.net.*</incregexes>
+<excregexes>https://[^/]*\.corp\.example\.com/.*</excregexes>
+<excregexes>https://www\.example\.com/logout.*</excregexes>
+</context></configuration>`), 0o600)
+	require.Nil(t, err, "Could not write zap scope")
+
+	scope, err = LoadExport(zap)
+	require.Nil(t, err, "Could not load zap scope")
+	require.True(t, scope.Match("example.com"), "Could not match optional group")
+	require.True(t, scope.Match("www.example.com"), "Could not match host with excluded path")
+	require.False(t, scope.Match("db.corp.example.com"), "Matched excluded host")
+	require.True(t, scope.Match("api.example.net"), "Could not match host with trailing wildcard")
+	require.False(t, scope.Match("api.example.network"), "Matched trailing wildcard as host")
+}
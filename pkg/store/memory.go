@@ -0,0 +1,146 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	sliceutil "github.com/projectdiscovery/utils/slice"
+)
+
+// errNotFound is returned for the hosts missing from the memory store
+var errNotFound = errors.New("not found")
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store kept in memory, suited to small enumerations
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	hostnames map[string]string
+	hosts     map[string]*Host
+	written   map[string]struct{}
+}
+
+// NewMemory creates a new in-memory storage for ip based wildcard removal
+func NewMemory() *MemoryStore {
+	return &MemoryStore{hostnames: make(map[string]string), hosts: make(map[string]*Host), written: make(map[string]struct{})}
+}
+
+// New creates a new ip-hostname pair in the map
+func (s *MemoryStore) New(ip, hostname string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.hostnames[ip] = hostname
+	return nil
+}
+
+// Exists indicates if an IP exists in the map
+func (s *MemoryStore) Exists(ip string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.hostnames[ip]
+	return ok
+}
+
+// GetHostnames returns the comma separated hostnames of an ip
+func (s *MemoryStore) GetHostnames(ip string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.hostnames[ip]
+}
+
+// Update appends a hostname to the hostnames of an existing ip
+func (s *MemoryStore) Update(ip, hostname string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hostnames, ok := s.hostnames[ip]
+	if !ok {
+		return errNotFound
+	}
+	s.hostnames[ip] = hostnames + "," + hostname
+	return nil
+}
+
+// Delete deletes the records for an IP from store.
+func (s *MemoryStore) Delete(ip string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.hostnames, ip)
+	return nil
+}
+
+// UpdateHost merges the answer details of a hostname into the store
+func (s *MemoryStore) UpdateHost(hostname string, host *Host) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	merged, ok := s.hosts[hostname]
+	if !ok {
+		merged = &Host{}
+		s.hosts[hostname] = merged
+	}
+	merged.Merge(host)
+	return nil
+}
+
+// GetHost gets a copy of the answer details of a hostname from the store
+func (s *MemoryStore) GetHost(hostname string) (*Host, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	host, ok := s.hosts[hostname]
+	if !ok {
+		return nil, errNotFound
+	}
+	copied := *host
+	copied.IPs = append([]string(nil), host.IPs...)
+	copied.CNAMEs = append([]string(nil), host.CNAMEs...)
+	return &copied, nil
+}
+
+// MarkWritten records the hostname as written to the output
+func (s *MemoryStore) MarkWritten(hostname string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.written[hostname]; ok {
+		return false, nil
+	}
+	s.written[hostname] = struct{}{}
+	return true, nil
+}
+
+// Close releases the data of the store
+func (s *MemoryStore) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.hostnames = make(map[string]string)
+	s.hosts = make(map[string]*Host)
+	s.written = make(map[string]struct{})
+}
+
+// Iterate calls f for every ip with its deduplicated hostnames, in
+// the order of the ips as leveldb does. The store may be modified by f.
+func (s *MemoryStore) Iterate(f func(ip string, hostnames []string, counter int)) {
+	s.mutex.RLock()
+	ips := make([]string, 0, len(s.hostnames))
+	values := make(map[string]string, len(s.hostnames))
+	for ip, hostnames := range s.hostnames {
+		ips = append(ips, ip)
+		values[ip] = hostnames
+	}
+	s.mutex.RUnlock()
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		hostnames := sliceutil.Dedupe(strings.Split(values[ip], ","))
+		f(ip, hostnames, len(hostnames))
+	}
+}
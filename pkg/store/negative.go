@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// NegativeCache keeps the names which don't exist on disk with leveldb,
+// each until its time to live is over, to be skipped by the next runs
+type NegativeCache struct {
+	db  *leveldb.DB
+	ttl time.Duration
+	// now returns the current time, replaced by the tests
+	now func() time.Time
+}
+
+// OpenNegativeCache opens the negative cache of the directory, created if
+// needed, removing the expired names. The cache can't be opened by two
+// processes at once.
+func OpenNegativeCache(path string, ttl time.Duration) (*NegativeCache, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{
+		CompactionTableSize: 256 * Megabyte,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cache := &NegativeCache{db: db, ttl: ttl, now: time.Now}
+	if err := cache.purge(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return cache, nil
+}
+
+// purge removes the expired names
+func (c *NegativeCache) purge() error {
+	now := c.now().Unix()
+	batch := new(leveldb.Batch)
+	iter := c.db.NewIterator(nil, nil)
+	for iter.Next() {
+		if expiry(iter.Value()) <= now {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return c.db.Write(batch, nil)
+}
+
+// Add caches the name until the time to live is over
+func (c *NegativeCache) Add(name string) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(c.now().Add(c.ttl).Unix()))
+	return c.db.Put([]byte(strings.ToLower(name)), value, nil)
+}
+
+// Covers returns true if the name or one of its parents is cached and
+// not expired
+func (c *NegativeCache) Covers(name string) bool {
+	now := c.now().Unix()
+	name = strings.ToLower(name)
+	for {
+		if value, err := c.db.Get([]byte(name), nil); err == nil && expiry(value) > now {
+			return true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+// Close releases the cache
+func (c *NegativeCache) Close() error {
+	return c.db.Close()
+}
+
+// expiry returns the unix time a name expires at from its value
+func expiry(value []byte) int64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 
 	sliceutil "github.com/projectdiscovery/utils/slice"
@@ -11,13 +13,82 @@ import (
 
 const Megabyte = 1 << 20
 
-// Store is a storage for ip based wildcard removal
-type Store struct {
+// writtenPrefix prefixes the hostnames written to the output in the
+// hosts index, which no hostname starts with
+const writtenPrefix = "\x00written\x00"
+
+// Store is a storage for ip based wildcard removal, indexing the
+// hostnames by ip and the answer details by hostname
+type Store interface {
+	// New creates a new ip-hostname pair
+	New(ip, hostname string) error
+	// Exists indicates if an ip exists
+	Exists(ip string) bool
+	// GetHostnames returns the comma separated hostnames of an ip
+	GetHostnames(ip string) string
+	// Update appends a hostname to the hostnames of an existing ip
+	Update(ip, hostname string) error
+	// Delete deletes the records for an ip
+	Delete(ip string) error
+	// UpdateHost merges the answer details of a hostname
+	UpdateHost(hostname string, host *Host) error
+	// GetHost gets the answer details of a hostname
+	GetHost(hostname string) (*Host, error)
+	// MarkWritten records the hostname as written to the output,
+	// returning true the first time only
+	MarkWritten(hostname string) (bool, error)
+	// Iterate calls f for every ip with its deduplicated hostnames
+	Iterate(f func(ip string, hostnames []string, counter int))
+	// Close releases the store and its data
+	Close()
+}
+
+var _ Store = (*LevelDBStore)(nil)
+
+// LevelDBStore is a Store kept on disk with leveldb
+type LevelDBStore struct {
+	path string
+
 	DB *leveldb.DB
+	// HostsDB indexes the answer details by hostname
+	HostsDB *leveldb.DB
 }
 
-// New creates a new storage for ip based wildcard removal
-func New(dbPath string) (*Store, error) {
+// Host contains the answer details gathered for a hostname
+type Host struct {
+	Status string   `json:"status,omitempty"`
+	IPs    []string `json:"ips,omitempty"`
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Source tags hosts obtained elsewhere than from massdns (eg. axfr)
+	Source string `json:"source,omitempty"`
+	// Resolver is the resolver which answered for the hostname
+	Resolver string `json:"resolver,omitempty"`
+	// TTL is the lowest ttl of the answers, nil if unknown
+	TTL *int `json:"ttl,omitempty"`
+}
+
+// Merge merges the answer details of host into h, the set fields
+// replacing the existing ones and the answers being added
+func (h *Host) Merge(host *Host) {
+	if host.Status != "" {
+		h.Status = host.Status
+	}
+	if host.Source != "" {
+		h.Source = host.Source
+	}
+	if host.Resolver != "" {
+		h.Resolver = host.Resolver
+	}
+	if host.TTL != nil && (h.TTL == nil || *host.TTL < *h.TTL) {
+		h.TTL = host.TTL
+	}
+	h.IPs = sliceutil.Dedupe(append(h.IPs, host.IPs...))
+	h.CNAMEs = sliceutil.Dedupe(append(h.CNAMEs, host.CNAMEs...))
+}
+
+// New creates a new leveldb storage for ip based wildcard removal
+// in a temporary directory below dbPath
+func New(dbPath string) (*LevelDBStore, error) {
 	storeDb, err := os.MkdirTemp(dbPath, "shuffledns-db-")
 	if err != nil {
 		return nil, err
@@ -28,22 +99,29 @@ func New(dbPath string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Store{DB: db}, nil
+	hostsDb, err := leveldb.OpenFile(filepath.Join(storeDb, "hosts"), &opt.Options{
+		CompactionTableSize: 256 * Megabyte,
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &LevelDBStore{path: storeDb, DB: db, HostsDB: hostsDb}, nil
 }
 
 // New creates a new ip-hostname pair in the map
-func (s *Store) New(ip, hostname string) error {
+func (s *LevelDBStore) New(ip, hostname string) error {
 	return s.DB.Put([]byte(ip), []byte(hostname), nil)
 }
 
 // Exists indicates if an IP exists in the map
-func (s *Store) Exists(ip string) bool {
+func (s *LevelDBStore) Exists(ip string) bool {
 	ok, err := s.DB.Has([]byte(ip), nil)
 	return err == nil && ok
 }
 
 // Get gets the meta-information for an IP address from the map.
-func (s *Store) GetHostnames(ip string) string {
+func (s *LevelDBStore) GetHostnames(ip string) string {
 	hostname, err := s.DB.Get([]byte(ip), nil)
 	if err != nil {
 		return ""
@@ -51,7 +129,8 @@ func (s *Store) GetHostnames(ip string) string {
 	return string(hostname)
 }
 
-func (s *Store) Update(ip, hostname string) error {
+// Update appends a hostname to the hostnames of an existing ip
+func (s *LevelDBStore) Update(ip, hostname string) error {
 	hostnames, err := s.DB.Get([]byte(ip), nil)
 	if err != nil {
 		return err
@@ -60,15 +139,61 @@ func (s *Store) Update(ip, hostname string) error {
 }
 
 // Delete deletes the records for an IP from store.
-func (s *Store) Delete(ip string) error {
+func (s *LevelDBStore) Delete(ip string) error {
 	return s.DB.Delete([]byte(ip), nil)
 }
 
-func (s *Store) Close() {
+// UpdateHost merges the answer details of a hostname into the store
+func (s *LevelDBStore) UpdateHost(hostname string, host *Host) error {
+	merged := &Host{}
+	if existing, err := s.GetHost(hostname); err == nil {
+		merged = existing
+	}
+	merged.Merge(host)
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return s.HostsDB.Put([]byte(hostname), data, nil)
+}
+
+// GetHost gets the answer details of a hostname from the store
+func (s *LevelDBStore) GetHost(hostname string) (*Host, error) {
+	data, err := s.HostsDB.Get([]byte(hostname), nil)
+	if err != nil {
+		return nil, err
+	}
+	host := &Host{}
+	if err := json.Unmarshal(data, host); err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// MarkWritten records the hostname as written to the output in the hosts
+// index, so that the hostnames are deduplicated on disk
+func (s *LevelDBStore) MarkWritten(hostname string) (bool, error) {
+	key := []byte(writtenPrefix + hostname)
+	written, err := s.HostsDB.Has(key, nil)
+	if err != nil {
+		return false, err
+	}
+	if written {
+		return false, nil
+	}
+	return true, s.HostsDB.Put(key, nil, nil)
+}
+
+// Close closes the store and removes its data from disk
+func (s *LevelDBStore) Close() {
+	s.HostsDB.Close()
 	s.DB.Close()
+	os.RemoveAll(s.path)
 }
 
-func (s *Store) Iterate(f func(ip string, hostnames []string, counter int)) {
+// Iterate calls f for every ip with its deduplicated hostnames
+func (s *LevelDBStore) Iterate(f func(ip string, hostnames []string, counter int)) {
 	iter := s.DB.NewIterator(nil, nil)
 	defer iter.Release()
 
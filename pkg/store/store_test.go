@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkWritten(t *testing.T) {
+	leveldb, err := New(t.TempDir())
+	require.Nil(t, err, "Could not create leveldb store")
+	defer leveldb.Close()
+
+	for _, st := range []Store{leveldb, NewMemory()} {
+		first, err := st.MarkWritten("www.example.com")
+		require.Nil(t, err, "Could not mark hostname")
+		require.True(t, first, "Hostname marked before being written")
+
+		first, err = st.MarkWritten("www.example.com")
+		require.Nil(t, err, "Could not mark hostname")
+		require.False(t, first, "Hostname written twice")
+
+		_, err = st.GetHost("www.example.com")
+		require.NotNil(t, err, "Got the written mark as a host")
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	path := t.TempDir()
+	cache, err := OpenNegativeCache(path, time.Hour)
+	require.Nil(t, err, "Could not open negative cache")
+
+	// The name is added two hours ago
+	now := time.Now().Add(-2 * time.Hour)
+	cache.now = func() time.Time { return now }
+	require.Nil(t, cache.Add("Internal.example.com"), "Could not add name")
+	require.True(t, cache.Covers("internal.example.com"), "Name not cached")
+	require.True(t, cache.Covers("api.internal.example.com"), "Child of the name not cached")
+	require.False(t, cache.Covers("example.com"), "Parent of the name cached")
+
+	now = time.Now()
+	require.False(t, cache.Covers("internal.example.com"), "Expired name cached")
+	require.Nil(t, cache.Close(), "Could not close negative cache")
+
+	// The expired names are removed once reopened
+	cache, err = OpenNegativeCache(path, time.Hour)
+	require.Nil(t, err, "Could not reopen negative cache")
+	defer cache.Close()
+	_, err = cache.db.Get([]byte("internal.example.com"), nil)
+	require.NotNil(t, err, "Expired name not removed")
+}
@@ -0,0 +1,56 @@
+// Package tracing creates the OpenTelemetry tracer provider exporting the
+// spans of the enumerations to a collector over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Configured tells if the standard OpenTelemetry variables give a
+// collector to export the spans to
+func Configured() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// NewProvider creates a tracer provider exporting the spans in batches
+// to the collector of the endpoint, /v1/traces being added if it has no
+// path. Without endpoint, the collector is read from the standard
+// OpenTelemetry variables, which also give the headers, timeout and
+// retries of the exports and the attributes of the resource.
+func NewProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	var options []otlptracehttp.Option
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid otlp endpoint %q", endpoint)
+		}
+		if strings.Trim(u.Path, "/") == "" {
+			u.Path = "/v1/traces"
+		}
+		options = append(options, otlptracehttp.WithEndpointURL(u.String()))
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create otlp exporter: %w", err)
+	}
+
+	// The service name of the variables takes precedence
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "shuffledns")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create otlp resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProvider(t *testing.T) {
+	var (
+		mutex  sync.Mutex
+		path   string
+		header string
+		names  []string
+		parent = make(map[string][]byte)
+		ids    = make(map[string][]byte)
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		data, err := io.ReadAll(req.Body)
+		require.Nil(t, err, "Could not read export")
+		var request coltracepb.ExportTraceServiceRequest
+		require.Nil(t, proto.Unmarshal(data, &request), "Could not decode export")
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		path, header = req.URL.Path, req.Header.Get("Authorization")
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					names = append(names, span.Name)
+					ids[span.Name], parent[span.Name] = span.SpanId, span.ParentSpanId
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20token")
+	provider, err := NewProvider(context.Background(), collector.URL)
+	require.Nil(t, err, "Could not create provider")
+
+	tracer := provider.Tracer("test")
+	ctx, run := tracer.Start(context.Background(), "run")
+	_, phase := tracer.Start(ctx, "massdns")
+	phase.End()
+	run.End()
+	require.Nil(t, provider.Shutdown(context.Background()), "Could not export spans")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, "/v1/traces", path, "Got wrong export path")
+	require.Equal(t, "Bearer token", header, "Got wrong headers")
+	require.ElementsMatch(t, []string{"run", "massdns"}, names, "Got wrong spans")
+	require.Equal(t, ids["run"], parent["massdns"], "Phase not a child of the run")
+
+	_, err = NewProvider(context.Background(), "localhost:4318")
+	require.NotNil(t, err, "Created provider without scheme")
+}
@@ -0,0 +1,188 @@
+package wildcards
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
+	"github.com/miekg/dns"
+	"github.com/rs/xid"
+)
+
+// DetectorOptions configures a Detector
+type DetectorOptions struct {
+	// Domains are the target domains, the hosts out of them not being checked
+	Domains []string
+	// Resolvers are the resolvers the random names are resolved with
+	Resolvers []string
+	// Retries is the number of retries of every query
+	Retries int
+	// Proxy is the socks5 or http proxy the queries are sent through
+	Proxy string
+	// RateLimiter paces the queries, unlimited if nil
+	RateLimiter *ratelimit.Limiter
+	// Threads is the number of hosts detected concurrently by DetectBatch
+	Threads int
+}
+
+// Detection is the outcome of the wildcard detection of a host
+type Detection struct {
+	// Host is the detected host
+	Host string
+	// Wildcard is set when the host resolves to the answers of a wildcard
+	Wildcard bool
+	// Root is the topmost level of the host answering random names, empty if none did
+	Root string
+	// IPs are the answers of the random names below the levels of the host
+	IPs []string
+}
+
+// Detector detects the hosts answered by a wildcard record rather than
+// by a record of their own. Random names are resolved below every level
+// of the hosts, from the target domain down to the host, and a host is a
+// wildcard when one of its ips is among their answers. The answers of the
+// levels are cached, so that the hosts sharing levels are checked with
+// a single query per level. A Detector is safe for concurrent use.
+type Detector struct {
+	resolver *Resolver
+	threads  int
+
+	// levels caches the answers of the random names by level
+	levels sync.Map
+}
+
+// levelAnswers are the answers of a random name below a level
+type levelAnswers struct {
+	once sync.Once
+	ips  []string
+	// err is set when the level could not be checked
+	err error
+}
+
+// NewDetector creates a wildcard detector
+func NewDetector(options DetectorOptions) (*Detector, error) {
+	if len(options.Resolvers) == 0 {
+		return nil, errors.New("no resolvers specified")
+	}
+	resolver, err := NewResolver(options.Domains, options.Retries, options.Resolvers, options.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	resolver.SetRateLimiter(options.RateLimiter)
+
+	threads := options.Threads
+	if threads <= 0 {
+		threads = 1
+	}
+	return &Detector{resolver: resolver, threads: threads}, nil
+}
+
+// Detect resolves the host and tells whether its answers come from a wildcard
+func (d *Detector) Detect(ctx context.Context, host string) (*Detection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d.resolver.limiter.Take()
+	resp, err := d.resolver.client.QueryOne(host)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	if resp.StatusCodeRaw == dns.RcodeSuccess {
+		ips = resp.A
+	}
+	return d.DetectAnswers(ctx, host, ips)
+}
+
+// DetectAnswers tells whether the ips the host resolved to, eg. with
+// massdns, come from a wildcard. Levels which could not be checked are
+// skipped, and the error of the detection is returned once ctx is done.
+func (d *Detector) DetectAnswers(ctx context.Context, host string, ips []string) (*Detection, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	detection := &Detection{Host: host}
+
+	wildcardIPs := make(map[string]struct{})
+	for _, level := range d.resolver.levels(host) {
+		answers := d.levelAnswers(ctx, level)
+		if answers.err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if len(answers.ips) == 0 {
+			continue
+		}
+		if detection.Root == "" || strings.Count(level, ".") < strings.Count(detection.Root, ".") {
+			detection.Root = level
+		}
+		for _, ip := range answers.ips {
+			if _, ok := wildcardIPs[ip]; !ok {
+				wildcardIPs[ip] = struct{}{}
+				detection.IPs = append(detection.IPs, ip)
+			}
+		}
+	}
+
+	for _, ip := range ips {
+		if _, ok := wildcardIPs[ip]; ok {
+			detection.Wildcard = true
+			break
+		}
+	}
+	return detection, nil
+}
+
+// DetectBatch detects the hosts concurrently, returning the detections
+// in the order of the hosts. The hosts which could not be resolved or
+// checked before ctx is done have a nil detection.
+func (d *Detector) DetectBatch(ctx context.Context, hosts []string) []*Detection {
+	detections := make([]*Detection, len(hosts))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < d.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				if detection, err := d.Detect(ctx, hosts[index]); err == nil {
+					detections[index] = detection
+				}
+			}
+		}()
+	}
+	for index := range hosts {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return detections
+}
+
+// levelAnswers returns the cached answers of a random name below the
+// level, resolving it the first time. Levels interrupted by ctx are
+// checked again by the next detections.
+func (d *Detector) levelAnswers(ctx context.Context, level string) *levelAnswers {
+	value, _ := d.levels.LoadOrStore(level, &levelAnswers{})
+	answers := value.(*levelAnswers)
+	answers.once.Do(func() {
+		if answers.err = ctx.Err(); answers.err != nil {
+			return
+		}
+		d.resolver.limiter.Take()
+		resp, err := d.resolver.client.QueryOne(xid.New().String() + "." + level)
+		if err != nil {
+			answers.err = err
+			return
+		}
+		if resp.StatusCodeRaw == dns.RcodeSuccess {
+			answers.ips = resp.A
+		}
+	})
+	if answers.err != nil && ctx.Err() != nil {
+		// Let the next detections check the level again
+		d.levels.CompareAndDelete(level, answers)
+	}
+	return answers
+}
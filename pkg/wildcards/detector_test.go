@@ -0,0 +1,64 @@
+package wildcards
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startResolver starts a resolver answering every name below
+// wild.example.com with 10.0.0.1, and www.example.com with 10.0.0.2
+func startResolver(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err, "Could not listen for resolver")
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := &dns.Msg{}
+		resp.SetReply(req)
+		name := req.Question[0].Name
+		switch {
+		case strings.HasSuffix(name, ".wild.example.com."):
+			rr, _ := dns.NewRR(name + " 60 IN A 10.0.0.1")
+			resp.Answer = append(resp.Answer, rr)
+		case name == "www.example.com.":
+			rr, _ := dns.NewRR(name + " 60 IN A 10.0.0.2")
+			resp.Answer = append(resp.Answer, rr)
+		default:
+			resp.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestDetector(t *testing.T) {
+	detector, err := NewDetector(DetectorOptions{
+		Domains:   []string{"example.com"},
+		Resolvers: []string{startResolver(t)},
+		Retries:   1,
+		Threads:   2,
+	})
+	require.Nil(t, err, "Could not create detector")
+
+	detection, err := detector.Detect(context.Background(), "a.b.wild.example.com")
+	require.Nil(t, err, "Could not detect wildcard")
+	require.True(t, detection.Wildcard, "Wildcard host not detected")
+	require.Equal(t, "wild.example.com", detection.Root, "Got wrong wildcard root")
+	require.Equal(t, []string{"10.0.0.1"}, detection.IPs, "Got wrong wildcard ips")
+
+	detections := detector.DetectBatch(context.Background(), []string{"www.example.com", "x.wild.example.com"})
+	require.Len(t, detections, 2, "Got wrong number of detections")
+	require.False(t, detections[0].Wildcard, "Host detected as wildcard")
+	require.Empty(t, detections[0].Root, "Got wildcard root for host")
+	require.True(t, detections[1].Wildcard, "Wildcard host not detected in batch")
+
+	detection, err = detector.DetectAnswers(context.Background(), "api.wild.example.com", []string{"10.0.0.3"})
+	require.Nil(t, err, "Could not detect wildcard from answers")
+	require.False(t, detection.Wildcard, "Host with its own answer detected as wildcard")
+	require.Equal(t, "wild.example.com", detection.Root, "Got wrong wildcard root")
+}
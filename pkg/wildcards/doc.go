@@ -0,0 +1,24 @@
+// Package wildcards detects the hostnames answered by wildcard dns
+// records rather than by records of their own.
+//
+// A Detector can be used on its own by other tools, without the runner:
+//
+//	detector, err := wildcards.NewDetector(wildcards.DetectorOptions{
+//		Domains:   []string{"example.com"},
+//		Resolvers: []string{"1.1.1.1:53"},
+//		Retries:   5,
+//		Threads:   25,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	for _, detection := range detector.DetectBatch(ctx, hosts) {
+//		if detection != nil && !detection.Wildcard {
+//			fmt.Println(detection.Host)
+//		}
+//	}
+//
+// The hosts already resolved, eg. by massdns, are checked against their
+// answers with DetectAnswers. The Resolver is the lower level detection
+// used by the massdns wildcard filtering.
+package wildcards
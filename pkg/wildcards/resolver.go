@@ -1,11 +1,13 @@
 package wildcards
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
+	"github.com/ShlomieLiberow/shuffledns/pkg/ratelimit"
 	"github.com/miekg/dns"
-	"github.com/projectdiscovery/dnsx/libs/dnsx"
 	"github.com/projectdiscovery/gologger"
 	stringsutil "github.com/projectdiscovery/utils/strings"
 	"github.com/rs/xid"
@@ -14,66 +16,91 @@ import (
 // Resolver represents a dns resolver for removing wildcards
 type Resolver struct {
 	domains []string
-	client  *dnsx.DNSX
+	client  dnsclient.Client
+	limiter *ratelimit.Limiter
+	logger  *gologger.Logger
 }
 
-// NewResolver initializes and creates a new resolver to find wildcards
-func NewResolver(domains []string, retries int, resolvers []string) (*Resolver, error) {
-	resolver := &Resolver{
-		domains: domains,
-	}
-
-	options := dnsx.DefaultOptions
-	options.BaseResolvers = resolvers
-	options.MaxRetries = retries
-	dnsResolver, err := dnsx.New(options)
+// NewResolver initializes and creates a new resolver to find wildcards,
+// sending the queries through proxy if it is not empty.
+func NewResolver(domains []string, retries int, resolvers []string, proxy string) (*Resolver, error) {
+	dnsResolver, err := dnsclient.New(dnsclient.Options{Resolvers: resolvers, Retries: retries, Proxy: proxy})
 	if err != nil {
 		return nil, fmt.Errorf("could not create dns resolver: %w", err)
 	}
-	resolver.client = dnsResolver
+	return NewResolverWithClient(domains, dnsResolver), nil
+}
+
+// NewResolverWithClient creates a resolver finding the wildcards of the
+// domains with an existing client, eg. shared by several resolvers.
+func NewResolverWithClient(domains []string, client dnsclient.Client) *Resolver {
+	return &Resolver{
+		domains: domains,
+		client:  client,
+		logger:  gologger.DefaultLogger,
+	}
+}
+
+// SetLogger logs the hosts skipped by the resolver with the logger
+func (w *Resolver) SetLogger(logger *gologger.Logger) {
+	w.logger = logger
+}
+
+// SetRateLimiter paces the queries of the resolver with the limiter
+func (w *Resolver) SetRateLimiter(limiter *ratelimit.Limiter) {
+	w.limiter = limiter
+}
 
-	return resolver, nil
+// HasWildcard returns true if a random name below host resolves,
+// meaning host is the root of a wildcard. Hosts are not checked once
+// ctx is done.
+func (w *Resolver) HasWildcard(ctx context.Context, host string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	w.limiter.Take()
+	in, err := w.client.QueryOne(xid.New().String() + "." + host)
+	if err != nil || in == nil {
+		return false
+	}
+	return in.StatusCodeRaw == dns.RcodeSuccess && len(in.A) > 0
 }
 
 // LookupHost returns wildcard IP addresses of a wildcard if it's a wildcard.
 // To determine, first we split the target host by dots, create permutation
 // of it's levels, check for wildcard on each one of them and if found any,
-// we remove all the hosts that have this IP from the map.
-func (w *Resolver) LookupHost(host string) (bool, map[string]struct{}) {
+// we remove all the hosts that have this IP from the map. The root is the
+// topmost level answering random names, empty if none did. The check is
+// abandoned, without any wildcard found, once ctx is done.
+func (w *Resolver) LookupHost(ctx context.Context, host string) (bool, string, map[string]struct{}) {
 	orig := make(map[string]struct{})
 	wildcards := make(map[string]struct{})
+	var root string
 
-	var domain string
-	for _, domainCandidate := range w.domains {
-		if stringsutil.HasSuffixAny(host, "."+domainCandidate) {
-			domain = domainCandidate
-			break
-		}
-	}
-
+	levels := w.levels(host)
 	// ignore records without domain (todo: might be interesting to detect dangling domains)
-	if domain == "" {
-		gologger.Info().Msgf("no domain found - skipping: %s", host)
-		return false, nil
+	if len(levels) == 0 {
+		w.logger.Info().Msgf("no domain found - skipping: %s", host)
+		return false, "", nil
 	}
 
-	subdomainPart := strings.TrimSuffix(host, "."+domain)
-	subdomainTokens := strings.Split(subdomainPart, ".")
-
 	// create the wildcard generation prefix.
 	// We use a rand prefix at the beginning like %rand%.domain.tld
 	// A permutation is generated for each level of the subdomain.
-	var hosts []string
-	hosts = append(hosts, xid.New().String()+"."+domain)
-
-	for i := 0; i < len(subdomainTokens); i++ {
-		newhost := xid.New().String() + "." + strings.Join(subdomainTokens[i:], ".") + "." + domain
-		hosts = append(hosts, newhost)
+	hosts := make([]string, 0, len(levels))
+	for _, level := range levels {
+		hosts = append(hosts, xid.New().String()+"."+level)
 	}
 
 	// Iterate over all the hosts generated for rand.
 	for _, h := range hosts {
+		// An interrupted check is not conclusive
+		if ctx.Err() != nil {
+			return false, "", nil
+		}
+
 		// Create a dns message and send it to the server
+		w.limiter.Take()
 		in, err := w.client.QueryOne(h)
 		if err != nil {
 			continue
@@ -82,6 +109,9 @@ func (w *Resolver) LookupHost(host string) (bool, map[string]struct{}) {
 		if in != nil && in.StatusCodeRaw != dns.RcodeSuccess {
 			continue
 		}
+		if level := strings.SplitN(h, ".", 2)[1]; len(in.A) > 0 && (root == "" || strings.Count(level, ".") < strings.Count(root, ".")) {
+			root = level
+		}
 
 		// Get all the records and add them to the wildcard map
 		for _, record := range in.A {
@@ -99,9 +129,32 @@ func (w *Resolver) LookupHost(host string) (bool, map[string]struct{}) {
 	// check if original ip are among wildcards
 	for a := range orig {
 		if _, ok := wildcards[a]; ok {
-			return true, wildcards
+			return true, root, wildcards
 		}
 	}
 
-	return false, wildcards
+	return false, root, wildcards
+}
+
+// levels returns the levels of host checked for wildcards: the target
+// domain it belongs to, then host and its parents down to the domain.
+// No level is returned for hosts out of the target domains.
+func (w *Resolver) levels(host string) []string {
+	var domain string
+	for _, domainCandidate := range w.domains {
+		if stringsutil.HasSuffixAny(host, "."+domainCandidate) {
+			domain = domainCandidate
+			break
+		}
+	}
+	if domain == "" {
+		return nil
+	}
+
+	subdomainTokens := strings.Split(strings.TrimSuffix(host, "."+domain), ".")
+	levels := []string{domain}
+	for i := 0; i < len(subdomainTokens); i++ {
+		levels = append(levels, strings.Join(subdomainTokens[i:], ".")+"."+domain)
+	}
+	return levels
 }
@@ -3,8 +3,14 @@ package wildcards
 import (
 	"bufio"
 	"os"
+	"strings"
+
+	"github.com/ShlomieLiberow/shuffledns/pkg/dnsclient"
 )
 
+// LoadResolversFromFile loads the resolvers of a file, one per line.
+// Plain resolvers use port 53 unless one is given, https:// urls are
+// queried over DoH and tls:// addresses over DoT.
 func LoadResolversFromFile(file string) ([]string, error) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -15,11 +21,11 @@ func LoadResolversFromFile(file string) ([]string, error) {
 	var servers []string
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		text := scanner.Text()
-		if text == "" {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
 			continue
 		}
-		servers = append(servers, text+":53")
+		servers = append(servers, dnsclient.ParseResolver(text))
 	}
 	return servers, nil
 }